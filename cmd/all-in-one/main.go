@@ -11,8 +11,10 @@ import (
 	"github.com/common-fate/iamzero/internal/tracing"
 	"github.com/common-fate/iamzero/pkg/audit"
 	"github.com/common-fate/iamzero/pkg/config"
+	"github.com/common-fate/iamzero/pkg/policies"
 	"github.com/common-fate/iamzero/pkg/service"
 	"github.com/common-fate/iamzero/pkg/storage"
+	"github.com/common-fate/iamzero/pkg/tags"
 	"github.com/common-fate/iamzero/pkg/tokens"
 	"github.com/peterbourgon/ff/v3"
 	"github.com/peterbourgon/ff/v3/ffcli"
@@ -26,6 +28,8 @@ type AllInOneCommand struct {
 	Collector         *collectorApp.Collector
 	Console           *consoleApp.Console
 	Auditor           *audit.Auditor
+	Optimiser         *policies.Optimiser
+	Tagger            *tags.Tagger
 	Svc               *service.Service
 }
 
@@ -48,6 +52,8 @@ func NewAllInOneCommand() *ffcli.Command {
 	c.PostgresStorage = storage.NewPostgresStorage()
 	c.Svc = service.NewService()
 	c.Auditor = audit.New()
+	c.Optimiser = policies.NewOptimiser()
+	c.Tagger = tags.NewTagger()
 
 	fs := flag.NewFlagSet("iamzero-collector", flag.ExitOnError)
 
@@ -59,6 +65,8 @@ func NewAllInOneCommand() *ffcli.Command {
 	c.PostgresStorage.AddFlags(fs)
 	c.Svc.AddFlags(fs)
 	c.Auditor.AddFlags(fs)
+	c.Optimiser.AddFlags(fs)
+	c.Tagger.AddFlags(fs)
 
 	return &ffcli.Command{
 		Name:       "iamzero-collector",
@@ -104,6 +112,8 @@ func (c *AllInOneCommand) Exec(ctx context.Context, _ []string) error {
 		TokenStore: store,
 		Storage:    storage,
 		Auditor:    c.Auditor,
+		Optimiser:  c.Optimiser,
+		Tagger:     c.Tagger,
 	}); err != nil {
 		return err
 	}
@@ -114,6 +124,7 @@ func (c *AllInOneCommand) Exec(ctx context.Context, _ []string) error {
 		TokenStore: store,
 		Storage:    storage,
 		Auditor:    c.Auditor,
+		Optimiser:  c.Optimiser,
 	}); err != nil {
 		return err
 	}
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/common-fate/iamzero/pkg/audit"
+	"github.com/common-fate/iamzero/pkg/recommendations"
+	"github.com/common-fate/iamzero/pkg/storage"
+	"github.com/peterbourgon/ff/v3"
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// GraphCommand configuration object
+type GraphCommand struct {
+	rootConfig *RootConfig
+	out        io.Writer
+
+	Auditor *audit.Auditor
+
+	logLevel string
+	format   string
+	output   string
+	findings bool
+}
+
+// NewGraphCommand creates a new ffcli.Command
+func NewGraphCommand(rootConfig *RootConfig, out io.Writer) *ffcli.Command {
+	c := GraphCommand{
+		rootConfig: rootConfig,
+		out:        out,
+	}
+
+	c.Auditor = audit.New()
+
+	fs := flag.NewFlagSet("iamzero graph", flag.ExitOnError)
+
+	// register CLI flags for other components
+	c.Auditor.AddFlags(fs)
+
+	fs.StringVar(&c.logLevel, "log-level", "info", "the log level (must match go.uber.org/zap log levels)")
+	fs.StringVar(&c.format, "format", string(audit.GraphFormatDOT), "the format to render the graph in (dot, mermaid or graphml)")
+	fs.StringVar(&c.output, "output", "", "the file to write the graph to (defaults to stdout)")
+	fs.BoolVar(&c.findings, "findings", true, "highlight principals with active findings in the local database")
+
+	rootConfig.RegisterFlags(fs)
+
+	return &ffcli.Command{
+		Name:       "graph",
+		ShortUsage: "iamzero graph [flags]",
+		ShortHelp:  "Export the graph of roles which principals can assume",
+		FlagSet:    fs,
+		Options:    []ff.Option{ff.WithEnvVarPrefix("IAMZERO")},
+		Exec:       c.Exec,
+	}
+}
+
+// Exec function for this command.
+func (c *GraphCommand) Exec(ctx context.Context, args []string) error {
+	cfg := zap.NewDevelopmentConfig()
+	err := cfg.Level.UnmarshalText([]byte(c.logLevel))
+	if err != nil {
+		return err
+	}
+	logProd, err := cfg.Build()
+	if err != nil {
+		return errors.Wrap(err, "can't initialize zap logger")
+	}
+	log := logProd.Sugar()
+
+	format, err := audit.ParseGraphFormat(c.format)
+	if err != nil {
+		return err
+	}
+
+	c.Auditor.Setup(log)
+
+	err = c.Auditor.LoadInventory(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	annotations := audit.GraphAnnotations{}
+	if c.findings {
+		db, err := storage.OpenBoltDB()
+		if err != nil {
+			return errors.Wrap(err, "error opening local database, ensure that you are not running 'iamzero local' or pass -findings=false")
+		}
+		findings, err := storage.NewBoltFindingStorage(db).ListForStatus(recommendations.PolicyStatusActive)
+		db.Close()
+		if err != nil {
+			return err
+		}
+		annotations = recommendations.GraphAnnotationsForFindings(findings)
+	}
+
+	out := c.out
+	if c.output != "" {
+		f, err := os.Create(c.output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	return c.Auditor.GetGraph().Render(out, format, annotations)
+}
@@ -17,7 +17,9 @@ import (
 	consoleApp "github.com/common-fate/iamzero/cmd/console/app"
 
 	"github.com/common-fate/iamzero/pkg/audit"
+	"github.com/common-fate/iamzero/pkg/policies"
 	"github.com/common-fate/iamzero/pkg/storage"
+	"github.com/common-fate/iamzero/pkg/tags"
 	"github.com/common-fate/iamzero/pkg/tokens"
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"github.com/pkg/errors"
@@ -34,6 +36,8 @@ type LocalCommand struct {
 	Collector *collectorApp.Collector
 	Console   *consoleApp.Console
 	Auditor   *audit.Auditor
+	Optimiser *policies.Optimiser
+	Tagger    *tags.Tagger
 
 	logLevel string
 }
@@ -48,6 +52,8 @@ func NewLocalCommand(rootConfig *RootConfig, out io.Writer) *ffcli.Command {
 	c.Collector = collectorApp.New()
 	c.Console = consoleApp.New()
 	c.Auditor = audit.New()
+	c.Optimiser = policies.NewOptimiser()
+	c.Tagger = tags.NewTagger()
 
 	fs := flag.NewFlagSet("iamzero local", flag.ExitOnError)
 
@@ -55,6 +61,8 @@ func NewLocalCommand(rootConfig *RootConfig, out io.Writer) *ffcli.Command {
 	c.Collector.AddFlags(fs)
 	c.Console.AddFlags(fs)
 	c.Auditor.AddFlags(fs)
+	c.Optimiser.AddFlags(fs)
+	c.Tagger.AddFlags(fs)
 
 	fs.StringVar(&c.logLevel, "log-level", "info", "the log level (must match go.uber.org/zap log levels)")
 
@@ -115,7 +123,7 @@ func (c *LocalCommand) Exec(ctx context.Context, _ []string) error {
 	// put the token into our in-memory token storage so that the user can send events to IAM Zero
 	// Note: in future the local version of IAM Zero could simply not use token storage at all,
 	// our collector endpoint could just be unauthenticated.
-	token, err := tokenStore.Create(ctx, "Local token")
+	token, err := tokenStore.Create(ctx, "Local token", nil)
 	if err != nil {
 		return err
 	}
@@ -191,6 +199,8 @@ func (c *LocalCommand) Exec(ctx context.Context, _ []string) error {
 		TokenStore: tokenStore,
 		Storage:    storage,
 		Auditor:    c.Auditor,
+		Optimiser:  c.Optimiser,
+		Tagger:     c.Tagger,
 	}); err != nil {
 		return err
 	}
@@ -201,6 +211,7 @@ func (c *LocalCommand) Exec(ctx context.Context, _ []string) error {
 		TokenStore: tokenStore,
 		Storage:    storage,
 		Auditor:    c.Auditor,
+		Optimiser:  c.Optimiser,
 	}); err != nil {
 		return err
 	}
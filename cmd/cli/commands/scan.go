@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"time"
 
 	collectorApp "github.com/common-fate/iamzero/cmd/collector/app"
 	consoleApp "github.com/common-fate/iamzero/cmd/console/app"
@@ -14,7 +15,10 @@ import (
 	"github.com/common-fate/iamzero/pkg/audit"
 	"github.com/common-fate/iamzero/pkg/cloudtrail"
 	"github.com/common-fate/iamzero/pkg/events"
+	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/common-fate/iamzero/pkg/recommendations"
 	"github.com/common-fate/iamzero/pkg/storage"
+	"github.com/common-fate/iamzero/pkg/tags"
 	"github.com/peterbourgon/ff/v3/ffcli"
 )
 
@@ -26,12 +30,21 @@ type ScanCommand struct {
 	Collector *collectorApp.Collector
 	Console   *consoleApp.Console
 	Auditor   *audit.Auditor
+	Optimiser *policies.Optimiser
+	Tagger    *tags.Tagger
 
-	roleName               string
+	roles                  stringSlice
+	allRoles               bool
 	logLevel               string
 	athenaCloudTrailBucket string
 	athenaResultsLocation  string
+	athenaWorkgroup        string
+	athenaTimeout          time.Duration
 	account                string
+	cloudTrailDir          string
+	lakeEventDataStore     string
+	since                  string
+	until                  string
 }
 
 // NewScanCommand creates a new ffcli.Command
@@ -44,6 +57,8 @@ func NewScanCommand(rootConfig *RootConfig, out io.Writer) *ffcli.Command {
 	c.Collector = collectorApp.New()
 	c.Console = consoleApp.New()
 	c.Auditor = audit.New()
+	c.Optimiser = policies.NewOptimiser()
+	c.Tagger = tags.NewTagger()
 
 	fs := flag.NewFlagSet("iamzero scan", flag.ExitOnError)
 
@@ -51,12 +66,21 @@ func NewScanCommand(rootConfig *RootConfig, out io.Writer) *ffcli.Command {
 	c.Collector.AddFlags(fs)
 	c.Console.AddFlags(fs)
 	c.Auditor.AddFlags(fs)
+	c.Optimiser.AddFlags(fs)
+	c.Tagger.AddFlags(fs)
 
 	fs.StringVar(&c.logLevel, "log-level", "info", "the log level (must match go.uber.org/zap log levels)")
-	fs.StringVar(&c.roleName, "role", "", "the name of the role to query events for")
-	fs.StringVar(&c.athenaCloudTrailBucket, "cloudtrail-bucket", "", "the S3 bucket that CloudTrail logs are stored in")
-	fs.StringVar(&c.athenaResultsLocation, "results-location", "", "the S3 path to store Athena query results in")
+	fs.Var(&c.roles, "role", "the name of a role to query events for (can be provided multiple times)")
+	fs.BoolVar(&c.allRoles, "all-roles", false, "query events for every role in the account rather than the roles provided with -role")
+	fs.StringVar(&c.athenaCloudTrailBucket, "cloudtrail-bucket", "", "the Athena table that CloudTrail logs are stored in, optionally qualified with a database (database.table)")
+	fs.StringVar(&c.athenaResultsLocation, "results-location", "", "the S3 path to store Athena query results in (optional if the workgroup has a results location)")
+	fs.StringVar(&c.athenaWorkgroup, "workgroup", cloudtrail.DefaultAthenaWorkgroup, "the Athena workgroup to run queries in")
+	fs.DurationVar(&c.athenaTimeout, "athena-timeout", cloudtrail.DefaultAthenaTimeout, "how long to wait for the Athena or CloudTrail Lake query to finish")
 	fs.StringVar(&c.account, "account", "", "the AWS account to query CloudTrail logs for")
+	fs.StringVar(&c.lakeEventDataStore, "cloudtrail-lake-event-data-store", "", "query a CloudTrail Lake event data store (ID or ARN) rather than Athena, e.g. to backfill events")
+	fs.StringVar(&c.since, "since", "", "only query events after this time (an RFC3339 timestamp, a date such as 2021-09-02, or a duration such as 72h)")
+	fs.StringVar(&c.until, "until", "", "only query events before this time (an RFC3339 timestamp, a date such as 2021-09-02, or a duration such as 72h)")
+	fs.StringVar(&c.cloudTrailDir, "cloudtrail-dir", "", "read CloudTrail log files from a local directory (such as a sync of the CloudTrail S3 bucket) rather than querying Athena")
 
 	rootConfig.RegisterFlags(fs)
 
@@ -82,18 +106,39 @@ func (c *ScanCommand) Exec(ctx context.Context, args []string) error {
 	}
 	log := logProd.Sugar()
 
-	if c.roleName == "" {
-		return errors.New("the -role argument must be provided")
+	// when reading log files from disk, the role and account are optional filters
+	if c.cloudTrailDir == "" {
+		if len(c.roles) == 0 && !c.allRoles {
+			return errors.New("the -role argument must be provided, or -all-roles to query events for every role in the account")
+		}
+
+		if c.lakeEventDataStore == "" {
+			if c.athenaCloudTrailBucket == "" {
+				return errors.New("the -cloudtrail-bucket argument must be provided")
+			}
+			if c.account == "" {
+				return errors.New("the -account argument must be provided")
+			}
+		}
+	}
+	if len(c.roles) > 0 && c.allRoles {
+		return errors.New("the -role and -all-roles arguments can't be used together")
 	}
 
-	if c.athenaCloudTrailBucket == "" {
-		return errors.New("the -cloudtrail-bucket argument must be provided")
+	now := time.Now()
+	since, err := cloudtrail.ParseTimeFlag(c.since, now)
+	if err != nil {
+		return errors.Wrap(err, "parsing -since")
 	}
-	if c.athenaResultsLocation == "" {
-		return errors.New("the -results-location argument must be provided")
+	until, err := cloudtrail.ParseTimeFlag(c.until, now)
+	if err != nil {
+		return errors.Wrap(err, "parsing -until")
 	}
-	if c.account == "" {
-		return errors.New("the -account argument must be provided")
+	query := cloudtrail.Query{
+		Account: c.account,
+		Roles:   c.roles,
+		Since:   since,
+		Until:   until,
 	}
 
 	db, err := storage.OpenBoltDB()
@@ -105,21 +150,67 @@ func (c *ScanCommand) Exec(ctx context.Context, args []string) error {
 
 	c.Auditor.Setup(log)
 
-	fmt.Printf("Querying CloudTrail logs for %s\n", c.roleName)
+	err = c.Auditor.LoadInventory(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	advisor, err := recommendations.NewAdvisorWithRulePacks(c.Auditor, c.Collector.AdvisoryRulesDir)
+	if err != nil {
+		return errors.Wrap(err, "loading advisory rule packs")
+	}
+
+	err = c.Tagger.Load()
+	if err != nil {
+		return err
+	}
 
 	detective := events.NewDetective(events.DetectiveOpts{
-		Log:     log,
-		Auditor: c.Auditor,
-		Storage: storage,
+		Log:       log,
+		Auditor:   c.Auditor,
+		Storage:   storage,
+		Advisor:   advisor,
+		Optimiser: c.Optimiser,
+		Tagger:    c.Tagger,
 	})
 
+	if c.cloudTrailDir != "" {
+		fmt.Printf("Reading CloudTrail log files in %s\n", c.cloudTrailDir)
+		s := cloudtrail.NewLogFileScanner(&cloudtrail.LogFileScannerParams{
+			Log:       log,
+			Detective: detective,
+			Dir:       c.cloudTrailDir,
+			Query:     query,
+		})
+		return s.Scan(ctx)
+	}
+
+	if c.lakeEventDataStore != "" {
+		fmt.Printf("Querying CloudTrail Lake event data store %s\n", c.lakeEventDataStore)
+		s := cloudtrail.NewLakeScanner(&cloudtrail.LakeScannerParams{
+			Log:            log,
+			Detective:      detective,
+			EventDataStore: c.lakeEventDataStore,
+			Timeout:        c.athenaTimeout,
+		})
+		return s.Scan(ctx, query)
+	}
+
+	if c.allRoles {
+		fmt.Printf("Querying CloudTrail logs for every role in %s\n", c.account)
+	} else {
+		fmt.Printf("Querying CloudTrail logs for %s\n", c.roles.String())
+	}
+
 	a := cloudtrail.NewCloudTrailAuditor(&cloudtrail.CloudTrailAuditorParams{
 		Log:                    log,
 		AthenaCloudTrailBucket: c.athenaCloudTrailBucket,
 		AthenaOutputLocation:   c.athenaResultsLocation,
+		Workgroup:              c.athenaWorkgroup,
+		Timeout:                c.athenaTimeout,
 		Detective:              detective,
 	})
-	err = a.GetActionsForRole(ctx, c.account, c.roleName)
+	err = a.Scan(ctx, query)
 	if err != nil {
 		return err
 	}
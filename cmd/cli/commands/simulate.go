@@ -0,0 +1,158 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/peterbourgon/ff/v3"
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/pkg/errors"
+)
+
+// stringSlice is a flag which can be provided multiple times
+type stringSlice []string
+
+func (s *stringSlice) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSlice) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// SimulateCommand configuration object
+type SimulateCommand struct {
+	rootConfig *RootConfig
+	out        io.Writer
+
+	identityPolicies stringSlice
+	resourcePolicies stringSlice
+	scps             stringSlice
+	context          stringSlice
+	boundary         string
+	principal        string
+	action           string
+	resource         string
+	resourceRequired bool
+}
+
+// NewSimulateCommand creates a new ffcli.Command
+func NewSimulateCommand(rootConfig *RootConfig, out io.Writer) *ffcli.Command {
+	c := SimulateCommand{
+		rootConfig: rootConfig,
+		out:        out,
+	}
+
+	fs := flag.NewFlagSet("iamzero simulate", flag.ExitOnError)
+
+	fs.Var(&c.identityPolicies, "policy", "path to an identity-based policy JSON document (can be provided multiple times)")
+	fs.Var(&c.resourcePolicies, "resource-policy", "path to a resource-based policy JSON document (can be provided multiple times)")
+	fs.Var(&c.scps, "scp", "path to a service control policy JSON document. Each SCP is evaluated as a separate level of the organization (can be provided multiple times)")
+	fs.Var(&c.context, "context", "a condition key in the form key=value, e.g. aws:SourceVpce=vpce-1a2b3c4d (can be provided multiple times)")
+	fs.StringVar(&c.boundary, "boundary", "", "path to a permissions boundary policy JSON document")
+	fs.StringVar(&c.principal, "principal", "", "the ARN of the role or user making the request")
+	fs.StringVar(&c.action, "action", "", "the IAM action to simulate, e.g. s3:GetObject")
+	fs.StringVar(&c.resource, "resource", "*", "the ARN of the resource to simulate access to")
+	fs.BoolVar(&c.resourceRequired, "resource-policy-required", false, "require the resource-based policy to allow the request, as for role trust policies and KMS key policies")
+
+	rootConfig.RegisterFlags(fs)
+
+	return &ffcli.Command{
+		Name:       "simulate",
+		ShortUsage: "iamzero simulate [flags]",
+		ShortHelp:  "Simulate whether IAM policies allow a request, without calling AWS",
+		FlagSet:    fs,
+		Options:    []ff.Option{ff.WithEnvVarPrefix("IAMZERO")},
+		Exec:       c.Exec,
+	}
+}
+
+// Exec function for this command.
+func (c *SimulateCommand) Exec(ctx context.Context, _ []string) error {
+	if c.action == "" {
+		return errors.New("the -action flag must be provided, for example 'iamzero simulate -action s3:GetObject -policy policy.json'")
+	}
+
+	var ps policies.PolicySet
+	var err error
+
+	ps.Identity, err = loadPolicyFiles(c.identityPolicies)
+	if err != nil {
+		return err
+	}
+	ps.Resource, err = loadPolicyFiles(c.resourcePolicies)
+	if err != nil {
+		return err
+	}
+	for _, path := range c.scps {
+		scp, err := loadPolicyFile(path)
+		if err != nil {
+			return err
+		}
+		ps.SCPs = append(ps.SCPs, []policies.AWSIAMPolicy{*scp})
+	}
+	if c.boundary != "" {
+		ps.PermissionsBoundary, err = loadPolicyFile(c.boundary)
+		if err != nil {
+			return err
+		}
+	}
+	ps.ResourcePolicyRequired = c.resourceRequired
+
+	req := policies.Request{
+		Principal: c.principal,
+		Action:    c.action,
+		Resource:  c.resource,
+		Context:   map[string][]string{},
+	}
+	for _, kv := range c.context {
+		split := strings.SplitN(kv, "=", 2)
+		if len(split) != 2 {
+			return fmt.Errorf("context %q must be in the form key=value", kv)
+		}
+		req.Context[split[0]] = append(req.Context[split[0]], split[1])
+	}
+
+	res := policies.Evaluate(ps, req)
+
+	fmt.Fprintf(c.out, "%s: %s\n", res.Decision, res.Reason)
+	for _, m := range res.MatchedStatements {
+		statement, err := json.Marshal(m.Statement)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "  [%s] %s\n", m.PolicyType, statement)
+	}
+	return nil
+}
+
+func loadPolicyFiles(paths []string) ([]policies.AWSIAMPolicy, error) {
+	ps := []policies.AWSIAMPolicy{}
+	for _, path := range paths {
+		p, err := loadPolicyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, *p)
+	}
+	return ps, nil
+}
+
+func loadPolicyFile(path string) (*policies.AWSIAMPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading policy %s", path)
+	}
+	var p policies.AWSIAMPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, errors.Wrapf(err, "parsing policy %s", path)
+	}
+	return &p, nil
+}
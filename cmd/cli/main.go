@@ -17,12 +17,16 @@ func main() {
 		localCommand            = commands.NewLocalCommand(rootConfig, out)
 		applyCommand            = commands.NewApplyCommand(rootConfig, out)
 		scanCommand             = commands.NewScanCommand(rootConfig, out)
+		simulateCommand         = commands.NewSimulateCommand(rootConfig, out)
+		graphCommand            = commands.NewGraphCommand(rootConfig, out)
 	)
 
 	rootCommand.Subcommands = []*ffcli.Command{
 		localCommand,
 		applyCommand,
 		scanCommand,
+		simulateCommand,
+		graphCommand,
 	}
 
 	if err := rootCommand.Parse(os.Args[1:]); err != nil {
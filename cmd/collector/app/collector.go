@@ -7,8 +7,13 @@ import (
 	"time"
 
 	"github.com/common-fate/iamzero/pkg/audit"
+	"github.com/common-fate/iamzero/pkg/events"
+	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/common-fate/iamzero/pkg/recommendations"
 	"github.com/common-fate/iamzero/pkg/storage"
+	"github.com/common-fate/iamzero/pkg/tags"
 	"github.com/common-fate/iamzero/pkg/tokens"
+	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
@@ -20,6 +25,10 @@ type Collector struct {
 	demo       bool
 	storage    *storage.Storage
 	auditor    *audit.Auditor
+	advisor    *recommendations.Advisor
+	optimiser  *policies.Optimiser
+	tagger     *tags.Tagger
+	pipeline   *events.Pipeline
 
 	// whether to enable the AWS CDK resource integration
 	CDK                   bool
@@ -29,6 +38,17 @@ type Collector struct {
 	TransportSQSEnabled   bool
 	TransportSQSQueueURL  string
 	TransportSQSTokenAuth bool
+	// TransportSQSCloudTrail accepts CloudTrail events delivered to the
+	// SQS queue by EventBridge, in addition to events from IAM Zero clients
+	TransportSQSCloudTrail bool
+	AdvisoryRulesDir       string
+	// PipelineWorkers is the number of events analysed at once
+	PipelineWorkers int
+	// PipelineMaxAttempts is the number of times an event is
+	// analysed before it is moved to the dead-letter queue
+	PipelineMaxAttempts int
+	// PipelineRetention is how long analysed events are kept in the queue
+	PipelineRetention time.Duration
 
 	// used to hold the server so that we can shut it down
 	httpServer *http.Server
@@ -45,6 +65,8 @@ type CollectorOptions struct {
 	Auditor    *audit.Auditor
 	TokenStore tokens.TokenStorer
 	Storage    *storage.Storage
+	Optimiser  *policies.Optimiser
+	Tagger     *tags.Tagger
 }
 
 func (c *Collector) AddFlags(fs *flag.FlagSet) {
@@ -55,6 +77,11 @@ func (c *Collector) AddFlags(fs *flag.FlagSet) {
 	fs.BoolVar(&c.TransportSQSEnabled, "transport-sqs-enabled", false, "enable SQS collector transport")
 	fs.BoolVar(&c.TransportSQSTokenAuth, "transport-sqs-token-auth", true, "verify IAM Zero token on events received via SQS")
 	fs.StringVar(&c.TransportSQSQueueURL, "transport-sqs-queue-url", "", "(if SQS transport enabled) the SQS queue URL")
+	fs.BoolVar(&c.TransportSQSCloudTrail, "transport-sqs-cloudtrail", false, "(if SQS transport enabled) accept CloudTrail events delivered to the queue by an EventBridge rule (these events don't require a token)")
+	fs.IntVar(&c.PipelineWorkers, "pipeline-workers", events.DefaultPipelineWorkers, "the number of queued events to analyse at once")
+	fs.IntVar(&c.PipelineMaxAttempts, "pipeline-max-attempts", events.DefaultPipelineMaxAttempts, "the number of times to try analysing a queued event before moving it to the dead-letter queue")
+	fs.DurationVar(&c.PipelineRetention, "pipeline-retention", events.DefaultPipelineRetention, "how long to keep analysed events in the queue before purging them (dead-lettered events are kept)")
+	fs.StringVar(&c.AdvisoryRulesDir, "advisory-rules-dir", "", "a directory of YAML or JSON advisory rule packs to load in addition to the built-in rules")
 }
 
 func (c *Collector) Start(ctx context.Context, opts *CollectorOptions) error {
@@ -63,29 +90,39 @@ func (c *Collector) Start(ctx context.Context, opts *CollectorOptions) error {
 	c.auditor = opts.Auditor
 	c.tokenStore = opts.TokenStore
 	c.storage = opts.Storage
+	c.optimiser = opts.Optimiser
+	c.tagger = opts.Tagger
 
 	c.auditor.Setup(c.log)
 
-	// err := c.auditor.LoadResources(ctx)
-	// if err != nil {
-	// 	return err
-	// }
+	if err := c.tagger.Load(); err != nil {
+		return err
+	}
 
-	if c.CDK {
-		err := c.auditor.LoadCloudFormationStacks(ctx)
-		if err != nil {
-			return err
-		}
+	advisor, err := recommendations.NewAdvisorWithRulePacks(c.auditor, c.AdvisoryRulesDir)
+	if err != nil {
+		return errors.Wrap(err, "loading advisory rule packs")
 	}
+	c.advisor = advisor
 
-	c.auditor.LoadFixture()
+	err = c.auditor.LoadInventory(ctx, c.CDK)
+	if err != nil {
+		return err
+	}
 
 	c.log.With("roles", c.auditor.GetRoles()).Info("auditor: found roles")
-
-	c.auditor.BuildLinks()
-
 	c.log.With("links", c.auditor.GetLinks()).Info("auditor: found links")
 
+	c.pipeline = events.NewPipeline(&events.PipelineParams{
+		Log:         c.log,
+		Queue:       c.storage.EventQueue,
+		Analyser:    c.newDetective(),
+		Workers:     c.PipelineWorkers,
+		MaxAttempts: c.PipelineMaxAttempts,
+		Retention:   c.PipelineRetention,
+	})
+	c.pipeline.Start(context.Background())
+
 	c.log.With("collector-host", c.Host).Info("starting IAM Zero collector server")
 
 	errorLog, _ := zap.NewStdLogAt(c.log.Desugar(), zap.ErrorLevel)
@@ -140,6 +177,10 @@ func (c *Collector) Close() error {
 		}
 		defer cancel()
 	}
+	// stop the pipeline after the HTTP server, so that no more events are enqueued
+	if c.pipeline != nil {
+		c.pipeline.Stop()
+	}
 
 	return nil
 }
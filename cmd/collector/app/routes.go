@@ -2,6 +2,7 @@ package app
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/common-fate/iamzero/internal/middleware"
 	"github.com/common-fate/iamzero/pkg/events"
 	"github.com/common-fate/iamzero/pkg/recommendations"
+	"github.com/common-fate/iamzero/pkg/storage"
 	"github.com/go-chi/chi"
 
 	chiMiddleware "github.com/go-chi/chi/middleware"
@@ -30,6 +32,7 @@ func (c *Collector) GetCollectorRoutes() *chi.Mux {
 			r.Use(middleware.CollectorTokenAuth(c.tokenStore, c.log))
 			r.Route("/events", func(r chi.Router) {
 				r.Post("/", c.HTTPCreateEventBatchHandler)
+				r.Get("/{eventID}", c.HTTPGetEventStatusHandler)
 			})
 		})
 	})
@@ -38,10 +41,12 @@ func (c *Collector) GetCollectorRoutes() *chi.Mux {
 }
 
 type CreateEventBatchResponse struct {
-	AlertIDs []string `json:"alertIDs"`
+	// EventIDs are the IDs of the queued events, which can be used to look up their status
+	EventIDs []string `json:"eventIDs"`
 }
 
-// HTTPCreateEventBatchHandler creates a batch of events
+// HTTPCreateEventBatchHandler validates a batch of events and queues them to be
+// analysed by the detective. Either every event in the batch is queued, or none are.
 // Design assumption - all events in a given batch are dispatched for the same token and role
 func (c *Collector) HTTPCreateEventBatchHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -65,30 +70,83 @@ func (c *Collector) HTTPCreateEventBatchHandler(w http.ResponseWriter, r *http.R
 
 	c.log.With("events", rec).Info("received events")
 
-	detective := events.NewDetective(events.DetectiveOpts{
-		Log:     c.log,
-		Storage: c.storage,
-		Auditor: c.auditor,
-	})
+	var fieldErrors []io.FieldError
+	for i, e := range rec {
+		if err := events.ValidateEvent(e); err != nil {
+			fieldErrors = append(fieldErrors, io.FieldError{Field: fmt.Sprintf("[%d]", i), Error: err.Error()})
+		}
+
+		// tags set by the client take precedence over the token's tags
+		rec[i].Tags = e.Tags.WithDefaults(token.Tags)
 
-	var res CreateEventBatchResponse
-	for _, e := range rec {
 		// censor info if in demo mode
 		if c.demo {
-			e.Identity.User = "iamzero-test-user"
-			e.Identity.Role = "arn:aws:iam::123456789012:role/iamzero-test-role"
-			e.Identity.Account = "123456789012"
+			rec[i].Identity.User = "iamzero-test-user"
+			rec[i].Identity.Role = "arn:aws:iam::123456789012:role/iamzero-test-role"
+			rec[i].Identity.Account = "123456789012"
 		}
+	}
+	if fieldErrors != nil {
+		io.RespondError(ctx, c.log, w, &io.Error{
+			Err:    errors.New("invalid events"),
+			Status: http.StatusBadRequest,
+			Fields: fieldErrors,
+		})
+		return
+	}
 
-		action, err := detective.AnalyseEvent(e)
+	ids, err := c.pipeline.Enqueue(token.ID, rec)
+	if err != nil {
+		io.RespondError(ctx, c.log, w, err)
+		return
+	}
 
-		if err != nil {
-			io.RespondError(ctx, c.log, w, err)
-			return
-		}
+	io.RespondJSON(ctx, c.log, w, CreateEventBatchResponse{EventIDs: ids}, http.StatusAccepted)
+}
+
+type EventStatusResponse struct {
+	ID        string                    `json:"id"`
+	Status    storage.QueuedEventStatus `json:"status"`
+	Attempts  int                       `json:"attempts"`
+	LastError string                    `json:"lastError,omitempty"`
+	// ActionID is the action created for the event, once it has been analysed
+	ActionID string `json:"actionId,omitempty"`
+}
+
+// HTTPGetEventStatusHandler returns the processing status of a queued event.
+// Events can only be looked up with the token they were sent with.
+func (c *Collector) HTTPGetEventStatusHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	eventID := chi.URLParam(r, "eventID")
 
-		res.AlertIDs = append(res.AlertIDs, action.ID)
+	token, ok := middleware.TokenFromContext(ctx)
+	if !ok {
+		io.RespondError(ctx, c.log, w, errors.New("could not load token"))
+		return
+	}
+
+	if token == nil {
+		http.Error(w, "invalid token", http.StatusBadRequest)
+		return
 	}
 
-	io.RespondJSON(ctx, c.log, w, res, http.StatusAccepted)
+	e, err := c.storage.EventQueue.Get(eventID)
+	if err != nil {
+		io.RespondError(ctx, c.log, w, err)
+		return
+	}
+
+	if e == nil || e.TokenID != token.ID {
+		http.Error(w, "event not found", http.StatusNotFound)
+		return
+	}
+
+	res := EventStatusResponse{
+		ID:        e.ID,
+		Status:    e.Status,
+		Attempts:  e.Attempts,
+		LastError: e.LastError,
+		ActionID:  e.ActionID,
+	}
+	io.RespondJSON(ctx, c.log, w, res, http.StatusOK)
 }
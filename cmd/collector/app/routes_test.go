@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/common-fate/iamzero/pkg/events"
+	"github.com/common-fate/iamzero/pkg/storage"
+	"github.com/common-fate/iamzero/pkg/tags"
+	"github.com/common-fate/iamzero/pkg/tokens"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// buildTestCollector builds a collector with in-memory storage. The
+// pipeline isn't started, so queued events stay pending.
+func buildTestCollector(t *testing.T) (*Collector, *tokens.Token) {
+	log := zap.NewNop().Sugar()
+	tokenStore := tokens.NewInMemoryTokenStorer(context.Background(), log, trace.NewNoopTracerProvider().Tracer(""))
+	token, err := tokenStore.Create(context.Background(), "test", tags.Tags{"env": "prod", "service": "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := storage.BuildInMemoryStorage()
+	c := &Collector{
+		log:        log,
+		tokenStore: tokenStore,
+		storage:    s,
+		pipeline:   events.NewPipeline(&events.PipelineParams{Log: log, Queue: s.EventQueue}),
+	}
+	return c, token
+}
+
+func doRequest(c *Collector, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-iamzero-token", token)
+	rr := httptest.NewRecorder()
+	c.GetCollectorRoutes().ServeHTTP(rr, req)
+	return rr
+}
+
+const testEventBatch = `[{
+	"identity": {"user": "test", "role": "arn:aws:sts::123456789012:assumed-role/test-role/session", "account": "123456789012"},
+	"data": {"type": "awsAction", "service": "s3", "region": "ap-southeast-2", "operation": "HeadObject", "parameters": {"Bucket": "test"}}
+}]`
+
+func TestCreateEventBatch_QueuesEvents(t *testing.T) {
+	c, token := buildTestCollector(t)
+
+	rr := doRequest(c, http.MethodPost, "/api/v1/events/", token.ID, testEventBatch)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	var res CreateEventBatchResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&res))
+	if !assert.Len(t, res.EventIDs, 1) {
+		return
+	}
+
+	rr = doRequest(c, http.MethodGet, "/api/v1/events/"+res.EventIDs[0], token.ID, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var status EventStatusResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&status))
+	assert.Equal(t, EventStatusResponse{ID: res.EventIDs[0], Status: storage.QueuedEventPending}, status)
+
+	// the event can't be looked up with a different token
+	other, err := c.tokenStore.Create(context.Background(), "other", nil)
+	assert.NoError(t, err)
+	rr = doRequest(c, http.MethodGet, "/api/v1/events/"+res.EventIDs[0], other.ID, "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestCreateEventBatch_AddsTokenTags(t *testing.T) {
+	c, token := buildTestCollector(t)
+
+	body := `[{
+	"identity": {"user": "test", "role": "arn:aws:sts::123456789012:assumed-role/test-role/session", "account": "123456789012"},
+	"data": {"type": "awsAction", "service": "s3", "region": "ap-southeast-2", "operation": "HeadObject", "parameters": {"Bucket": "test"}},
+	"tags": {"service": "worker"}
+}]`
+	rr := doRequest(c, http.MethodPost, "/api/v1/events/", token.ID, body)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	queued, err := c.storage.EventQueue.ListForStatus(storage.QueuedEventPending)
+	assert.NoError(t, err)
+	if assert.Len(t, queued, 1) {
+		// the tag set by the client takes precedence over the token's tag
+		assert.Equal(t, tags.Tags{"env": "prod", "service": "worker"}, queued[0].Event.Tags)
+	}
+}
+
+func TestCreateEventBatch_RejectsInvalidBatch(t *testing.T) {
+	c, token := buildTestCollector(t)
+
+	body := `[` + strings.Trim(testEventBatch, "[]") + `, {"identity": {"role": "test-role"}, "data": {"service": "s3", "operation": "HeadObject"}}]`
+	rr := doRequest(c, http.MethodPost, "/api/v1/events/", token.ID, body)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "identity.role is not a valid ARN")
+
+	// none of the events in the batch are queued
+	pending, err := c.storage.EventQueue.ListForStatus(storage.QueuedEventPending)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
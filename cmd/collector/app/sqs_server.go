@@ -8,6 +8,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/common-fate/iamzero/pkg/cloudtrail"
 	"github.com/common-fate/iamzero/pkg/events"
 	"github.com/common-fate/iamzero/pkg/recommendations"
 	"github.com/common-fate/iamzero/pkg/tokens"
@@ -131,6 +132,18 @@ func (s *SQSServer) QueueUrl() string {
 }
 
 func (c *Collector) HandleSQSMessage(ctx context.Context, msg *types.Message) error {
+	if c.TransportSQSCloudTrail {
+		entry, ok, err := cloudtrail.ParseEventBridgeEvent([]byte(*msg.Body))
+		if err != nil {
+			return err
+		}
+		// CloudTrail events are delivered by EventBridge rather than an IAM Zero
+		// client, so they don't include a token.
+		if ok {
+			return c.handleCloudTrailEvent(entry)
+		}
+	}
+
 	var e recommendations.AWSEvent
 
 	err := json.Unmarshal([]byte(*msg.Body), &e)
@@ -155,18 +168,40 @@ func (c *Collector) HandleSQSMessage(ctx context.Context, msg *types.Message) er
 		if token == nil {
 			return errors.New("token not found")
 		}
+		e.Tags = e.Tags.WithDefaults(token.Tags)
 	}
 
-	detective := events.NewDetective(events.DetectiveOpts{
-		Log:     c.log,
-		Storage: c.storage,
-		Auditor: c.auditor,
-	})
-
-	_, err = detective.AnalyseEvent(e)
+	_, err = c.newDetective().AnalyseEvent(e)
 
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// handleCloudTrailEvent converts a CloudTrail event delivered by EventBridge
+// and analyses it. Events which can't be mapped to an AWS action are skipped.
+func (c *Collector) handleCloudTrailEvent(entry cloudtrail.CloudTrailLogEntry) error {
+	e, err := entry.TryConvertToEvent()
+	if err == cloudtrail.ErrNoMapping {
+		c.log.With("event", entry.EventKey()).Debug("skipping unmapped CloudTrail event")
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "converting CloudTrail event")
+	}
+
+	_, err = c.newDetective().AnalyseEvent(*e)
+	return err
+}
+
+func (c *Collector) newDetective() *events.Detective {
+	return events.NewDetective(events.DetectiveOpts{
+		Log:       c.log,
+		Storage:   c.storage,
+		Auditor:   c.auditor,
+		Advisor:   c.advisor,
+		Optimiser: c.optimiser,
+		Tagger:    c.tagger,
+	})
+}
@@ -59,3 +59,24 @@ func TestWorkerExecutesHandler(t *testing.T) {
 	wg.Wait()
 	assert.True(t, executed)
 }
+
+func TestHandleSQSMessage_SkipsUnmappedCloudTrailEvent(t *testing.T) {
+	c := &Collector{
+		log:                    zap.NewNop().Sugar(),
+		TransportSQSCloudTrail: true,
+		// EventBridge events don't include a token
+		TransportSQSTokenAuth: true,
+	}
+	body := `{
+		"detail-type": "AWS API Call via CloudTrail",
+		"source": "aws.appsync",
+		"detail": {
+			"userIdentity": {"type": "AssumedRole", "arn": "arn:aws:sts::123456789012:assumed-role/test-role/session", "accountId": "123456789012"},
+			"eventSource": "appsync.amazonaws.com",
+			"eventName": "ListGraphqlApis"
+		}
+	}`
+
+	err := c.HandleSQSMessage(context.Background(), &types.Message{Body: &body})
+	assert.NoError(t, err)
+}
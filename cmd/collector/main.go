@@ -8,8 +8,11 @@ import (
 
 	"github.com/common-fate/iamzero/cmd/collector/app"
 	"github.com/common-fate/iamzero/internal/tracing"
+	"github.com/common-fate/iamzero/pkg/audit"
+	"github.com/common-fate/iamzero/pkg/policies"
 	"github.com/common-fate/iamzero/pkg/service"
 	"github.com/common-fate/iamzero/pkg/storage"
+	"github.com/common-fate/iamzero/pkg/tags"
 	"github.com/common-fate/iamzero/pkg/tokens"
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"go.uber.org/zap"
@@ -19,6 +22,9 @@ type CollectorCommand struct {
 	TracingFactory    *tracing.TracingFactory
 	TokenStoreFactory *tokens.TokensStoreFactory
 	Collector         *app.Collector
+	Auditor           *audit.Auditor
+	Optimiser         *policies.Optimiser
+	Tagger            *tags.Tagger
 	Svc               *service.Service
 }
 
@@ -38,6 +44,9 @@ func NewCollectorCommand() *ffcli.Command {
 	c.TokenStoreFactory = tokens.NewFactory()
 	c.Collector = app.New()
 	c.Svc = service.NewService()
+	c.Auditor = audit.New()
+	c.Optimiser = policies.NewOptimiser()
+	c.Tagger = tags.NewTagger()
 
 	fs := flag.NewFlagSet("iamzero-collector", flag.ExitOnError)
 
@@ -46,6 +55,9 @@ func NewCollectorCommand() *ffcli.Command {
 	c.TokenStoreFactory.AddFlags(fs)
 	c.Collector.AddFlags(fs)
 	c.Svc.AddFlags(fs)
+	c.Auditor.AddFlags(fs)
+	c.Optimiser.AddFlags(fs)
+	c.Tagger.AddFlags(fs)
 
 	return &ffcli.Command{
 		Name:       "iamzero-collector",
@@ -80,6 +92,9 @@ func (c *CollectorCommand) Exec(ctx context.Context, _ []string) error {
 		Tracer:     tracer,
 		TokenStore: store,
 		Storage:    storage,
+		Auditor:    c.Auditor,
+		Optimiser:  c.Optimiser,
+		Tagger:     c.Tagger,
 	}); err != nil {
 		return err
 	}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/common-fate/iamzero/api/io"
 	"github.com/common-fate/iamzero/pkg/recommendations"
+	"github.com/common-fate/iamzero/pkg/storage"
 	"github.com/go-chi/chi"
 )
 
@@ -19,6 +20,33 @@ type ActionResponse struct {
 
 	Recommendations    []recommendations.RecommendationDetails `json:"recommendations"`
 	HasRecommendations bool                                    `json:"hasRecommendations"`
+	// Occurrences is how often the action's event has been seen. It isn't
+	// set for actions which were created before events were deduplicated.
+	Occurrences *EventOccurrences `json:"occurrences,omitempty"`
+}
+
+// EventOccurrences is how often an event has been seen, and the sessions which made it
+type EventOccurrences struct {
+	Count     int                   `json:"count"`
+	FirstSeen time.Time             `json:"firstSeen"`
+	LastSeen  time.Time             `json:"lastSeen"`
+	Sessions  storage.EventSessions `json:"sessions"`
+}
+
+func buildEventOccurrences(e *storage.StoredEvent) *EventOccurrences {
+	if e == nil {
+		return nil
+	}
+	sessions := e.Sessions
+	if sessions == nil {
+		sessions = storage.EventSessions{}
+	}
+	return &EventOccurrences{
+		Count:     e.Count,
+		FirstSeen: e.FirstSeen,
+		LastSeen:  e.LastSeen,
+		Sessions:  sessions,
+	}
 }
 
 // buildActionResponse loops through the advisories associated with an action
@@ -77,6 +105,13 @@ func (h *Handlers) GetAction(w http.ResponseWriter, r *http.Request) {
 
 	res := buildActionResponse(*action)
 
+	event, err := h.Storage.Event.GetForAction(action.ID)
+	if err != nil {
+		io.RespondError(ctx, h.Log, w, err)
+		return
+	}
+	res.Occurrences = buildEventOccurrences(event)
+
 	io.RespondJSON(ctx, h.Log, w, res, http.StatusOK)
 }
 
@@ -115,31 +150,43 @@ func (h *Handlers) EditAction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if b.Enabled != nil {
-		action.Enabled = *b.Enabled
-	}
+	// the action and its finding are updated while holding the lock for the role, so
+	// that the document isn't overwritten by events which are being analysed for it
+	err = h.Storage.WithRoleLock(policy.Identity.Role, func(s *storage.Storage) error {
+		// reload the action and finding, as they may have changed before the lock was held
+		action, err := s.Action.Get(actionID)
+		if err != nil {
+			return err
+		}
+		policy, err = s.Finding.Get(action.FindingID)
+		if err != nil {
+			return err
+		}
 
-	if b.SelectedAdvisoryID != nil {
-		if err := action.SelectAdvisory(*b.SelectedAdvisoryID); err != nil {
-			io.RespondError(ctx, h.Log, w, err)
-			return
+		if b.Enabled != nil {
+			action.Enabled = *b.Enabled
 		}
-	}
 
-	if err := h.Storage.Action.Update(*action); err != nil {
-		io.RespondError(ctx, h.Log, w, err)
-		return
-	}
+		if b.SelectedAdvisoryID != nil {
+			if err := action.SelectAdvisory(*b.SelectedAdvisoryID); err != nil {
+				return err
+			}
+		}
 
-	// return the updated Policy corresponding to this alert
-	actions, err := h.Storage.Action.ListForPolicy(policy.ID)
-	if err != nil {
-		io.RespondError(ctx, h.Log, w, err)
-		return
-	}
+		if err := s.Action.Update(*action); err != nil {
+			return err
+		}
 
-	policy.RecalculateDocument(actions)
-	if err := h.Storage.Finding.CreateOrUpdate(*policy); err != nil {
+		// return the updated Policy corresponding to this alert
+		actions, err := s.Action.ListForPolicy(policy.ID)
+		if err != nil {
+			return err
+		}
+
+		policy.RecalculateDocument(actions, h.Optimiser)
+		return s.Finding.CreateOrUpdate(*policy)
+	})
+	if err != nil {
 		io.RespondError(ctx, h.Log, w, err)
 		return
 	}
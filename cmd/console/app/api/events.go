@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/common-fate/iamzero/api/io"
+	"github.com/common-fate/iamzero/pkg/recommendations"
+	"github.com/common-fate/iamzero/pkg/storage"
+)
+
+// QueuedEventResponse is a queued event, without the token it was sent with
+type QueuedEventResponse struct {
+	ID        string                    `json:"id"`
+	Event     recommendations.AWSEvent  `json:"event"`
+	Status    storage.QueuedEventStatus `json:"status"`
+	Attempts  int                       `json:"attempts"`
+	LastError string                    `json:"lastError"`
+	CreatedAt time.Time                 `json:"createdAt"`
+	UpdatedAt time.Time                 `json:"updatedAt"`
+}
+
+// ListDeadLetterEvents lists the events which the collector
+// couldn't analyse after the maximum number of attempts
+func (h *Handlers) ListDeadLetterEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events, err := h.Storage.EventQueue.ListForStatus(storage.QueuedEventDeadLetter)
+	if err != nil {
+		io.RespondError(ctx, h.Log, w, err)
+		return
+	}
+
+	res := []QueuedEventResponse{}
+	for _, e := range events {
+		res = append(res, QueuedEventResponse{
+			ID:        e.ID,
+			Event:     e.Event,
+			Status:    e.Status,
+			Attempts:  e.Attempts,
+			LastError: e.LastError,
+			CreatedAt: e.CreatedAt,
+			UpdatedAt: e.UpdatedAt,
+		})
+	}
+
+	io.RespondJSON(ctx, h.Log, w, res, http.StatusOK)
+}
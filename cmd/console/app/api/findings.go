@@ -2,16 +2,36 @@ package api
 
 import (
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/common-fate/iamzero/api/io"
+	"github.com/common-fate/iamzero/pkg/catalog"
 	"github.com/common-fate/iamzero/pkg/recommendations"
 	"github.com/common-fate/iamzero/pkg/storage"
+	"github.com/common-fate/iamzero/pkg/tags"
 	"github.com/go-chi/chi"
 )
 
+// tagQueryPrefix is the prefix of query parameters which filter findings by tag,
+// e.g. ?tag.env=prod
+const tagQueryPrefix = "tag."
+
+// tagsFromQuery returns the tags passed as query parameters
+func tagsFromQuery(q url.Values) tags.Tags {
+	t := tags.Tags{}
+	for k, v := range q {
+		if strings.HasPrefix(k, tagQueryPrefix) && len(v) > 0 {
+			t[strings.TrimPrefix(k, tagQueryPrefix)] = v[0]
+		}
+	}
+	return t
+}
+
 // ListFindings lists findings stored by IAM Zero.
 // If the `status` query parameter is passed only findings matching the status
-// will be returned
+// will be returned. Findings can be filtered by their tags with `tag.<key>`
+// query parameters, such as `tag.env=prod`.
 func (h *Handlers) ListFindings(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	status := r.URL.Query().Get("status")
@@ -33,7 +53,15 @@ func (h *Handlers) ListFindings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	io.RespondJSON(ctx, h.Log, w, findings, http.StatusOK)
+	filter := tagsFromQuery(r.URL.Query())
+	res := []recommendations.Finding{}
+	for _, f := range findings {
+		if f.Tags.Matches(filter) {
+			res = append(res, f)
+		}
+	}
+
+	io.RespondJSON(ctx, h.Log, w, res, http.StatusOK)
 }
 
 func (h *Handlers) GetFinding(w http.ResponseWriter, r *http.Request) {
@@ -61,14 +89,75 @@ func (h *Handlers) ListActionsForFinding(w http.ResponseWriter, r *http.Request)
 		io.RespondError(ctx, h.Log, w, err)
 		return
 	}
-	io.RespondJSON(ctx, h.Log, w, alerts, http.StatusOK)
+
+	events, err := h.Storage.Event.ListStoredForFinding(findingID)
+	if err != nil {
+		io.RespondError(ctx, h.Log, w, err)
+		return
+	}
+	eventsForActions := map[string]*storage.StoredEvent{}
+	for i, e := range events {
+		eventsForActions[e.ActionID] = &events[i]
+	}
+
+	res := []FindingActionResponse{}
+	for _, a := range alerts {
+		res = append(res, FindingActionResponse{
+			AWSAction:   a,
+			Occurrences: buildEventOccurrences(eventsForActions[a.ID]),
+		})
+	}
+	io.RespondJSON(ctx, h.Log, w, res, http.StatusOK)
+}
+
+// FindingActionResponse is an action in a finding, along with how often its event has been seen
+type FindingActionResponse struct {
+	recommendations.AWSAction
+	Occurrences *EventOccurrences `json:"occurrences,omitempty"`
+}
+
+// GetOverPrivilegeReport compares the policies attached to the finding's role
+// with the actions observed for the finding, returning the unused grants.
+func (h *Handlers) GetOverPrivilegeReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	findingID := chi.URLParam(r, "findingID")
+	finding, err := h.Storage.Finding.Get(findingID)
+	if err != nil {
+		io.RespondError(ctx, h.Log, w, err)
+		return
+	}
+	if finding == nil {
+		http.Error(w, "finding not found", http.StatusNotFound)
+		return
+	}
+
+	if h.Auditor == nil {
+		http.Error(w, "the console is not configured with an auditor to load IAM roles", http.StatusNotImplemented)
+		return
+	}
+
+	role := h.Auditor.GetRoleByARN(finding.Identity.Role)
+	if role == nil {
+		http.Error(w, "the finding's role has not been loaded by the auditor", http.StatusNotFound)
+		return
+	}
+
+	actions, err := h.Storage.Action.ListForPolicy(findingID)
+	if err != nil {
+		io.RespondError(ctx, h.Log, w, err)
+		return
+	}
+
+	report := recommendations.BuildOverPrivilegeReport(finding, actions, role, catalog.Default())
+	io.RespondJSON(ctx, h.Log, w, report, http.StatusOK)
 }
 
 type setPolicyStatusBody struct {
 	Status string `json:"status"`
 }
 
-// FindFinding finds a finding by its role and status
+// FindFinding finds a finding by its role, status and tags. The tags are passed
+// as `tag.<key>` query parameters, and must be the tags which the finding is keyed by.
 func (h *Handlers) FindFinding(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	role := r.URL.Query().Get("role")
@@ -79,7 +168,11 @@ func (h *Handlers) FindFinding(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	finding, err := h.Storage.Finding.FindByRole(storage.FindByRoleQuery{Role: role, Status: status})
+	finding, err := h.Storage.Finding.FindByRole(storage.FindByRoleQuery{
+		Role:   role,
+		Status: status,
+		Tags:   tagsFromQuery(r.URL.Query()),
+	})
 	if err != nil {
 		io.RespondError(ctx, h.Log, w, err)
 		return
@@ -119,11 +212,19 @@ func (h *Handlers) SetFindingStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	finding.Status = b.Status
-
-	err = h.Storage.Finding.CreateOrUpdate(*finding)
+	// the finding is reloaded and saved while holding the lock for the role,
+	// so that the document isn't overwritten with an outdated one
+	err = h.Storage.WithRoleLock(finding.Identity.Role, func(s *storage.Storage) error {
+		finding, err = s.Finding.Get(findingID)
+		if err != nil {
+			return err
+		}
+		finding.Status = b.Status
+		return s.Finding.CreateOrUpdate(*finding)
+	})
 	if err != nil {
 		io.RespondError(ctx, h.Log, w, err)
+		return
 	}
 
 	io.RespondJSON(ctx, h.Log, w, finding, http.StatusOK)
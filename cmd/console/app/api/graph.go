@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/common-fate/iamzero/api/io"
+	"github.com/common-fate/iamzero/pkg/audit"
+	"github.com/common-fate/iamzero/pkg/recommendations"
+)
+
+// defaultMaxPaths limits the number of paths returned for each source
+// principal, as there can be many paths of the same length between two
+// principals in large environments.
+const defaultMaxPaths = 10
+
+// GetAssumeRoleGraph returns the graph of principals and the roles they can assume
+func (h *Handlers) GetAssumeRoleGraph(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if h.Auditor == nil {
+		http.Error(w, "the console is not configured with an auditor to load IAM roles", http.StatusNotImplemented)
+		return
+	}
+
+	io.RespondJSON(ctx, h.Log, w, h.Auditor.GetGraph(), http.StatusOK)
+}
+
+// ListAssumeRolePaths returns the shortest paths through which principals
+// can assume the role passed in the `to` query parameter.
+// If the `from` query parameter is passed only paths from that principal
+// are returned; otherwise paths from every principal which can reach the
+// role are returned. The `max` query parameter limits the number of paths
+// returned for each principal.
+func (h *Handlers) ListAssumeRolePaths(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+
+	if to == "" {
+		http.Error(w, "to must be provided as a query parameter", http.StatusBadRequest)
+		return
+	}
+
+	maxPaths := defaultMaxPaths
+	if m := r.URL.Query().Get("max"); m != "" {
+		var err error
+		maxPaths, err = strconv.Atoi(m)
+		if err != nil || maxPaths < 1 {
+			http.Error(w, "max must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if h.Auditor == nil {
+		http.Error(w, "the console is not configured with an auditor to load IAM roles", http.StatusNotImplemented)
+		return
+	}
+
+	graph := h.Auditor.GetGraph()
+	if from != "" {
+		io.RespondJSON(ctx, h.Log, w, graph.ShortestPaths(from, to, maxPaths), http.StatusOK)
+		return
+	}
+	io.RespondJSON(ctx, h.Log, w, graph.PathsTo(to, maxPaths), http.StatusOK)
+}
+
+// ExportAssumeRoleGraph renders the assume role graph in the format passed
+// in the `format` query parameter: `dot`, `mermaid` or `graphml`.
+// Principals with active findings are highlighted.
+func (h *Handlers) ExportAssumeRoleGraph(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	format := audit.GraphFormatDOT
+	if f := r.URL.Query().Get("format"); f != "" {
+		var err error
+		format, err = audit.ParseGraphFormat(f)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if h.Auditor == nil {
+		http.Error(w, "the console is not configured with an auditor to load IAM roles", http.StatusNotImplemented)
+		return
+	}
+
+	findings, err := h.Storage.Finding.ListForStatus(recommendations.PolicyStatusActive)
+	if err != nil {
+		io.RespondError(ctx, h.Log, w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	err = h.Auditor.GetGraph().Render(w, format, recommendations.GraphAnnotationsForFindings(findings))
+	if err != nil {
+		h.Log.With("error", err).Error("error writing graph export")
+	}
+}
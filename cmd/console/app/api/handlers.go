@@ -2,6 +2,7 @@ package api
 
 import (
 	"github.com/common-fate/iamzero/pkg/audit"
+	"github.com/common-fate/iamzero/pkg/policies"
 	"github.com/common-fate/iamzero/pkg/storage"
 	"github.com/common-fate/iamzero/pkg/tokens"
 	"go.uber.org/zap"
@@ -13,4 +14,5 @@ type Handlers struct {
 	TokenStore tokens.TokenStorer
 	Storage    *storage.Storage
 	Auditor    *audit.Auditor
+	Optimiser  *policies.Optimiser
 }
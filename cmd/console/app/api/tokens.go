@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/common-fate/iamzero/api/io"
+	"github.com/common-fate/iamzero/pkg/tags"
 	"github.com/common-fate/iamzero/pkg/tokens"
 	"github.com/go-chi/chi"
 )
@@ -40,6 +41,8 @@ func (h *Handlers) DeleteToken(w http.ResponseWriter, r *http.Request) {
 
 type CreateTokenRequest struct {
 	Name string `json:"name"`
+	// Tags are added to events sent with the token
+	Tags tags.Tags `json:"tags"`
 }
 
 func (h *Handlers) CreateToken(w http.ResponseWriter, r *http.Request) {
@@ -51,7 +54,7 @@ func (h *Handlers) CreateToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.TokenStore.Create(ctx, rec.Name)
+	token, err := h.TokenStore.Create(ctx, rec.Name, rec.Tags)
 	if err != nil {
 		io.RespondError(ctx, h.Log, w, err)
 		return
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/common-fate/iamzero/pkg/audit"
+	"github.com/common-fate/iamzero/pkg/policies"
 	"github.com/common-fate/iamzero/pkg/storage"
 	"github.com/common-fate/iamzero/pkg/tokens"
 	"go.opentelemetry.io/otel/trace"
@@ -19,6 +20,7 @@ type Console struct {
 	tokenStore tokens.TokenStorer
 	storage    *storage.Storage
 	auditor    *audit.Auditor
+	optimiser  *policies.Optimiser
 
 	Host string
 
@@ -36,6 +38,7 @@ type ConsoleOptions struct {
 	TokenStore tokens.TokenStorer
 	Storage    *storage.Storage
 	Auditor    *audit.Auditor
+	Optimiser  *policies.Optimiser
 }
 
 func (c *Console) AddFlags(fs *flag.FlagSet) {
@@ -48,6 +51,7 @@ func (c *Console) Start(opts *ConsoleOptions) error {
 	c.tokenStore = opts.TokenStore
 	c.storage = opts.Storage
 	c.auditor = opts.Auditor
+	c.optimiser = opts.Optimiser
 
 	c.log.With("console-host", c.Host).Info("starting IAM Zero console")
 
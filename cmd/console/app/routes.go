@@ -18,6 +18,7 @@ func (c *Console) GetConsoleRoutes() *chi.Mux {
 		TokenStore: c.tokenStore,
 		Storage:    c.storage,
 		Auditor:    c.auditor,
+		Optimiser:  c.optimiser,
 	}
 
 	router.Route("/api/v1", func(r chi.Router) {
@@ -49,8 +50,19 @@ func (c *Console) GetConsoleRoutes() *chi.Mux {
 				r.Get("/find", handlers.FindFinding)
 				r.Get("/{findingID}", handlers.GetFinding)
 				r.Get("/{findingID}/actions", handlers.ListActionsForFinding)
+				r.Get("/{findingID}/overprivilege", handlers.GetOverPrivilegeReport)
 				r.Put("/{findingID}/status", handlers.SetFindingStatus)
 			})
+
+			r.Route("/events", func(r chi.Router) {
+				r.Get("/dead-letters", handlers.ListDeadLetterEvents)
+			})
+
+			r.Route("/graph", func(r chi.Router) {
+				r.Get("/", handlers.GetAssumeRoleGraph)
+				r.Get("/paths", handlers.ListAssumeRolePaths)
+				r.Get("/export", handlers.ExportAssumeRoleGraph)
+			})
 		})
 	})
 
@@ -8,6 +8,8 @@ import (
 
 	"github.com/common-fate/iamzero/cmd/console/app"
 	"github.com/common-fate/iamzero/internal/tracing"
+	"github.com/common-fate/iamzero/pkg/audit"
+	"github.com/common-fate/iamzero/pkg/policies"
 	"github.com/common-fate/iamzero/pkg/service"
 	"github.com/common-fate/iamzero/pkg/storage"
 	"github.com/common-fate/iamzero/pkg/tokens"
@@ -19,6 +21,8 @@ type ConsoleCommand struct {
 	TracingFactory    *tracing.TracingFactory
 	TokenStoreFactory *tokens.TokensStoreFactory
 	Collector         *app.Console
+	Auditor           *audit.Auditor
+	Optimiser         *policies.Optimiser
 	Svc               *service.Service
 }
 
@@ -38,6 +42,8 @@ func NewConsoleCommand() *ffcli.Command {
 	c.TokenStoreFactory = tokens.NewFactory()
 	c.Collector = app.New()
 	c.Svc = service.NewService()
+	c.Auditor = audit.New()
+	c.Optimiser = policies.NewOptimiser()
 
 	fs := flag.NewFlagSet("iamzero-console", flag.ExitOnError)
 
@@ -46,6 +52,8 @@ func NewConsoleCommand() *ffcli.Command {
 	c.TokenStoreFactory.AddFlags(fs)
 	c.Collector.AddFlags(fs)
 	c.Svc.AddFlags(fs)
+	c.Auditor.AddFlags(fs)
+	c.Optimiser.AddFlags(fs)
 
 	return &ffcli.Command{
 		Name:       "iamzero-console",
@@ -73,6 +81,14 @@ func (c *ConsoleCommand) Exec(ctx context.Context, _ []string) error {
 
 	storage := storage.BuildInMemoryStorage()
 
+	// the over-privilege report and assume role graph endpoints are served
+	// from the audit inventory. CloudFormation stacks are only used when
+	// analysing events in the collector, so they aren't loaded here.
+	c.Auditor.Setup(log)
+	if err := c.Auditor.LoadInventory(ctx, false); err != nil {
+		return err
+	}
+
 	console := c.Collector
 
 	if err := console.Start(&app.ConsoleOptions{
@@ -80,6 +96,8 @@ func (c *ConsoleCommand) Exec(ctx context.Context, _ []string) error {
 		Tracer:     tracer,
 		TokenStore: store,
 		Storage:    storage,
+		Auditor:    c.Auditor,
+		Optimiser:  c.Optimiser,
 	}); err != nil {
 		return err
 	}
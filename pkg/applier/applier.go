@@ -3,6 +3,7 @@ package applier
 import (
 	"fmt"
 
+	"github.com/common-fate/iamzero/pkg/policies"
 	"github.com/common-fate/iamzero/pkg/recommendations"
 	"go.uber.org/zap"
 )
@@ -41,6 +42,22 @@ type AWSIAMPolicyApplier struct {
 	Logger      *zap.SugaredLogger
 }
 
+// CheckStatement returns an error describing why a statement can't be written
+// to a project. The appliers only support Allow statements with Action and
+// Resource elements.
+func CheckStatement(s policies.AWSIAMStatement) error {
+	if s.Effect != "Allow" {
+		return fmt.Errorf("%s statements are not supported", s.Effect)
+	}
+	if len(s.NotAction.Values) > 0 || len(s.NotResource.Values) > 0 {
+		return fmt.Errorf("statements with NotAction or NotResource are not supported")
+	}
+	if len(s.Action.Values) == 0 || len(s.Resource.Values) == 0 {
+		return fmt.Errorf("the statement has no actions or resources")
+	}
+	return nil
+}
+
 func (changes PendingChanges) RenderDiff() error {
 	for _, change := range changes {
 		// @TODO Changes for change.FilePath may want to make this message nicer
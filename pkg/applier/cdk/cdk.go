@@ -10,6 +10,7 @@ import (
 	"path"
 
 	"github.com/common-fate/iamzero/pkg/applier"
+	"github.com/common-fate/iamzero/pkg/policies"
 	"github.com/common-fate/iamzero/pkg/recommendations"
 )
 
@@ -26,14 +27,25 @@ type CDKRole struct {
 	CDKPath string `json:"cdkPath"`
 }
 
+// Recommendation types understood by the CDK applier
+const (
+	// RecommendationTypeInlinePolicy adds the statements to the role as an inline policy
+	RecommendationTypeInlinePolicy = "IAMInlinePolicy"
+	// RecommendationTypeManagedPolicy creates a managed policy containing the statements
+	// and attaches it to the role. It is used when the statements don't fit within the
+	// inline policy size quota for a role.
+	RecommendationTypeManagedPolicy = "IAMManagedPolicy"
+)
+
 type CDKRecommendation struct {
 	Type       string         `json:"type"`
 	Statements []CDKStatement `json:"statements"`
 }
 
 type CDKStatement struct {
-	Resources []CDKResource `json:"resources"`
-	Actions   []string      `json:"actions"`
+	Resources []CDKResource      `json:"resources"`
+	Actions   []string           `json:"actions"`
+	Condition policies.Condition `json:"condition,omitempty"`
 }
 
 type CDKResource struct {
@@ -89,6 +101,12 @@ func (t *CDKIAMPolicyApplier) CalculateFinding(policy *recommendations.Finding,
 func (t *CDKIAMPolicyApplier) Plan() (*applier.PendingChanges, error) {
 
 	if t.Finding != nil && t.Finding.Role.CDKPath != "" {
+		for _, rec := range t.Finding.Recommendations {
+			// the CDK applier can't create managed policies yet
+			if rec.Type == RecommendationTypeManagedPolicy {
+				return nil, fmt.Errorf("the recommended policy for finding %s exceeds the inline policy size quota for a role, and the CDK applier doesn't support managed policies yet", t.Finding.FindingID)
+			}
+		}
 		findingStr, err := json.Marshal(t.Finding)
 		if err != nil {
 			return nil, err
@@ -129,61 +147,67 @@ func (t *CDKIAMPolicyApplier) Apply(changes *applier.PendingChanges) error {
 }
 
 func (t *CDKIAMPolicyApplier) calculateCDKFinding(policy *recommendations.Finding, actions []recommendations.AWSAction) {
-	// // only derive a CDK finding if we know that the role that we are
-	// // giving recommendations for has been defined using CDK
-	// if policy.Identity.CDKResource == nil {
-	// 	return
-	// }
-	// f := CDKFinding{
-	// 	FindingID: policy.ID,
-	// 	Role: CDKRole{
-	// 		Type:    policy.Identity.CDKResource.Type,
-	// 		CDKPath: policy.Identity.CDKResource.CDKPath,
-	// 	},
-	// 	Recommendations: []CDKRecommendation{},
-	// }
-
-	// for _, alert := range actions {
-	// 	if alert.Enabled && len(alert.Recommendations) > 0 {
-	// 		rec := CDKRecommendation{
-	// 			Type:       "IAMInlinePolicy",
-	// 			Statements: []CDKStatement{},
-	// 		}
-	// 		advisory := alert.GetSelectedAdvisory()
-	// 		for _, description := range advisory.Details().Description {
-	// 			// TODO: this should be redesigned to avoid casting from the interface.
-	// 			policy, ok := description.Policy.(policies.AWSIAMPolicy)
-	// 			if ok {
-	// 				for _, s := range policy.Statement {
-	// 					cdkStatement := CDKStatement{
-	// 						Actions: s.Action,
-	// 					}
-	// 					// TODO: we need to better structure resources so that
-	// 					// we have a reference to a CDK resource in an IAM statement
-	// 					for _, resource := range alert.Resources {
-
-	// 						var cdkResource CDKResource
-	// 						if resource.CDKResource != nil {
-	// 							cdkResource = CDKResource{
-	// 								Reference: "CDK",
-	// 								Type:      resource.CDKResource.Type,
-	// 								CDKPath:   &resource.CDKResource.CDKPath,
-	// 							}
-	// 						} else {
-	// 							cdkResource = CDKResource{
-	// 								Reference: "IAM",
-	// 								ARN:       &resource.ARN,
-	// 							}
-	// 						}
-	// 						cdkStatement.Resources = append(cdkStatement.Resources, cdkResource)
-	// 					}
-	// 					rec.Statements = append(rec.Statements, cdkStatement)
-	// 				}
-	// 			}
-	// 		}
-	// 		f.Recommendations = append(f.Recommendations, rec)
-	// 	}
-	// }
-
-	// t.Finding = &f
+	// only derive a CDK finding if we know that the role that we are
+	// giving recommendations for has been defined using CDK
+	if policy.Identity.CDKResource == nil {
+		t.Finding = nil
+		return
+	}
+	f := CDKFinding{
+		FindingID: policy.ID,
+		Role: CDKRole{
+			Type:    policy.Identity.CDKResource.Type,
+			CDKPath: policy.Identity.CDKResource.CDKPath,
+		},
+		Recommendations: []CDKRecommendation{},
+	}
+
+	// split the policy document into policies which fit within the AWS policy size quotas,
+	// each recommendation is written as a separate policy by the CDK applier.
+	plan := policies.PlanPolicies(policy.Document)
+	for _, warning := range plan.Warnings {
+		t.warnf("%s", warning)
+	}
+
+	recType := RecommendationTypeInlinePolicy
+	if !plan.Inline {
+		recType = RecommendationTypeManagedPolicy
+	}
+
+	for _, doc := range plan.Documents {
+		rec := CDKRecommendation{
+			Type:       recType,
+			Statements: []CDKStatement{},
+		}
+		for _, s := range doc.Statement {
+			if err := applier.CheckStatement(s); err != nil {
+				t.warnf("Skipping statement with actions %v in finding %s: %s", s.Action.Values, policy.ID, err)
+				continue
+			}
+			cdkStatement := CDKStatement{
+				Actions:   s.Action.Values,
+				Condition: s.Condition,
+			}
+			// TODO: we need to better structure resources so that
+			// we have a reference to a CDK resource in an IAM statement
+			for _, resource := range s.Resource.Values {
+				arn := resource
+				cdkStatement.Resources = append(cdkStatement.Resources, CDKResource{
+					Reference: "IAM",
+					ARN:       &arn,
+				})
+			}
+			rec.Statements = append(rec.Statements, cdkStatement)
+		}
+		f.Recommendations = append(f.Recommendations, rec)
+	}
+
+	t.Finding = &f
+}
+
+// warnf logs a warning if the applier has a logger configured
+func (t *CDKIAMPolicyApplier) warnf(template string, args ...interface{}) {
+	if t.AWSIAMPolicyApplier.Logger != nil {
+		t.AWSIAMPolicyApplier.Logger.Warnf(template, args...)
+	}
 }
@@ -0,0 +1,104 @@
+package applier_test
+
+import (
+	"fmt"
+	"testing"
+
+	cdkApplier "github.com/common-fate/iamzero/pkg/applier/cdk"
+	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/common-fate/iamzero/pkg/recommendations"
+	"github.com/stretchr/testify/assert"
+)
+
+func cdkFinding(statements ...policies.AWSIAMStatement) *recommendations.Finding {
+	return &recommendations.Finding{
+		ID: "abcde",
+		Identity: recommendations.ProcessedAWSIdentity{
+			Role:        "arn:aws:iam::12345678910:role/iamzero-cdk-role",
+			CDKResource: &policies.CDKResource{Type: "AWS::IAM::Role", CDKPath: "CdkExampleStack/iamzero-example-role/Resource"},
+		},
+		Document: policies.AWSIAMPolicy{Version: "2012-10-17", Statement: statements},
+	}
+}
+
+func TestCalculateFindingInlinePolicy(t *testing.T) {
+	condition := policies.Condition{"StringLike": {"s3:prefix": policies.NewConditionValue("home/*")}}
+	finding := cdkFinding(
+		policies.AWSIAMStatement{Effect: "Allow", Action: policies.NewStringValues("s3:GetObject"), Resource: policies.NewStringValues("arn:aws:s3:::bucket/*"), Condition: condition},
+		// unsupported statements are skipped
+		policies.AWSIAMStatement{Effect: "Deny", Action: policies.NewStringValues("s3:DeleteObject"), Resource: policies.NewStringValues("*")},
+		policies.AWSIAMStatement{Effect: "Allow", NotAction: policies.NewStringValues("iam:*"), Resource: policies.NewStringValues("*")},
+		policies.AWSIAMStatement{Effect: "Allow", Action: policies.NewStringValues("sqs:SendMessage")},
+	)
+
+	cdk := cdkApplier.CDKIAMPolicyApplier{}
+	cdk.CalculateFinding(finding, nil)
+
+	arn := "arn:aws:s3:::bucket/*"
+	assert.Equal(t, &cdkApplier.CDKFinding{
+		FindingID: "abcde",
+		Role:      cdkApplier.CDKRole{Type: "AWS::IAM::Role", CDKPath: "CdkExampleStack/iamzero-example-role/Resource"},
+		Recommendations: []cdkApplier.CDKRecommendation{
+			{
+				Type: cdkApplier.RecommendationTypeInlinePolicy,
+				Statements: []cdkApplier.CDKStatement{
+					{Actions: []string{"s3:GetObject"}, Resources: []cdkApplier.CDKResource{{Reference: "IAM", ARN: &arn}}, Condition: condition},
+				},
+			},
+		},
+	}, cdk.Finding)
+}
+
+func TestCalculateFindingPacksManagedPolicies(t *testing.T) {
+	statements := []policies.AWSIAMStatement{}
+	for i := 0; i < 64; i++ {
+		bucketArn := fmt.Sprintf("arn:aws:s3:::iamzero-cdk-example-bucket-with-a-long-name-that-is-not-in-the-project-%d/*", i)
+		statements = append(statements, policies.AWSIAMStatement{Effect: "Allow", Action: policies.NewStringValues("s3:GetObject", "s3:PutObject"), Resource: policies.NewStringValues(bucketArn)})
+	}
+	finding := cdkFinding(statements...)
+	assert.Greater(t, finding.Document.Length(), policies.InlinePolicyAggregateMaxLength)
+
+	cdk := cdkApplier.CDKIAMPolicyApplier{}
+	cdk.CalculateFinding(finding, nil)
+	if !assert.NotNil(t, cdk.Finding) {
+		return
+	}
+
+	// each recommendation fits within the managed policy quota, and
+	// together they contain every statement
+	assert.Greater(t, len(cdk.Finding.Recommendations), 1)
+	var resources []string
+	for _, rec := range cdk.Finding.Recommendations {
+		assert.Equal(t, cdkApplier.RecommendationTypeManagedPolicy, rec.Type)
+
+		doc := policies.AWSIAMPolicy{Version: "2012-10-17"}
+		for _, s := range rec.Statements {
+			assert.Equal(t, []string{"s3:GetObject", "s3:PutObject"}, s.Actions)
+			statement := policies.AWSIAMStatement{Effect: "Allow", Action: policies.NewStringValues(s.Actions...)}
+			for _, r := range s.Resources {
+				resources = append(resources, *r.ARN)
+				statement.Resource.Values = append(statement.Resource.Values, *r.ARN)
+			}
+			doc.Statement = append(doc.Statement, statement)
+		}
+		assert.LessOrEqual(t, doc.Length(), policies.ManagedPolicyMaxLength)
+	}
+	var expected []string
+	for _, s := range statements {
+		expected = append(expected, s.Resource.Values...)
+	}
+	assert.ElementsMatch(t, expected, resources)
+
+	// the CDK applier doesn't support managed policies yet
+	_, err := cdk.Plan()
+	assert.Error(t, err)
+}
+
+func TestCalculateFindingIgnoresRolesNotDefinedInCDK(t *testing.T) {
+	finding := cdkFinding(policies.AWSIAMStatement{Effect: "Allow", Action: policies.NewStringValues("s3:GetObject"), Resource: policies.NewStringValues("*")})
+	finding.Identity.CDKResource = nil
+
+	cdk := cdkApplier.CDKIAMPolicyApplier{}
+	cdk.CalculateFinding(finding, nil)
+	assert.Nil(t, cdk.Finding)
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -43,6 +44,7 @@ type TerraformRecommendation struct {
 type TerraformStatement struct {
 	Resources []TerraformResource `json:"resources"`
 	Actions   []string            `json:"actions"`
+	Condition policies.Condition  `json:"condition,omitempty"`
 }
 
 type TerraformResource struct {
@@ -281,61 +283,64 @@ func (t *TerraformIAMPolicyApplier) getRootFilePath() string {
 	return path.Join(t.AWSIAMPolicyApplier.ProjectPath, MAIN_TERRAFORM_FILE)
 }
 
-// Creates a single finding from enabled alerts
+// Creates a single finding from the statements in the finding's policy document
+//
+// The policy document has already been consolidated from the enabled actions, so each statement
+// is converted directly. Only allow statements with actions and resources are supported.
 func (t *TerraformIAMPolicyApplier) calculateTerraformFinding(policy *recommendations.Finding, actions []recommendations.AWSAction) {
+	rec := TerraformRecommendation{
+		Type:       "IAMInlinePolicy",
+		Statements: []TerraformStatement{},
+	}
+	for _, s := range policy.Document.Statement {
+		if err := applier.CheckStatement(s); err != nil {
+			t.warnf("Skipping statement with actions %v in finding %s: %s", s.Action.Values, policy.ID, err)
+			continue
+		}
+		terraformStatement := TerraformStatement{
+			Actions:   s.Action.Values,
+			Condition: s.Condition,
+		}
+		for _, resource := range s.Resource.Values {
+			arn := resource
+			terraformStatement.Resources = append(terraformStatement.Resources, TerraformResource{
+				Reference: "IAM",
+				ARN:       &arn,
+			})
+		}
+		rec.Statements = append(rec.Statements, terraformStatement)
+	}
 
-	terraformFinding := TerraformFinding{
-		FindingID: policy.ID,
-		Role:      policy.Identity.Role,
-
-		Recommendations: []TerraformRecommendation{
-			// {
-			// 	Type: "IAMInlinePolicy",
-			// 	Statements: []TerraformStatement{
-			// 		{
-			// 			Resources: []TerraformResource{
-			// 				{
-			// 					Reference: bucketArn,
-			// 					Type:      "AWS::S3::Bucket", ARN: &bucketArn,
-			// 				},
-			// 			},
-			// 			Actions: actionsDemo,
-			// 		},
-			// 	},
-			// },
-		},
-	}
-
-	// I copied this and modified it from the CDK example, it is subject to the same TODO comments as CDK above
-	for _, alert := range actions {
-		if alert.Enabled && len(alert.Recommendations) > 0 {
-			rec := TerraformRecommendation{
-				Type:       "IAMInlinePolicy",
-				Statements: []TerraformStatement{},
+	t.Finding = &TerraformFinding{
+		FindingID:       policy.ID,
+		Role:            policy.Identity.Role,
+		Recommendations: []TerraformRecommendation{rec},
+	}
+}
+
+// Document returns the IAM policy document for the statements in the finding
+//
+// This is used to measure the size of the policy against AWS quotas
+func (f *TerraformFinding) Document() policies.AWSIAMPolicy {
+	doc := policies.AWSIAMPolicy{Version: "2012-10-17", Statement: []policies.AWSIAMStatement{}}
+	for _, rec := range f.Recommendations {
+		for _, s := range rec.Statements {
+			statement := policies.AWSIAMStatement{
+				Effect:    "Allow",
+				Action:    policies.NewStringValues(s.Actions...),
+				Condition: s.Condition,
 			}
-			advisory := alert.GetSelectedAdvisory()
-			for _, description := range advisory.Details().Description {
-				policy, ok := description.Policy.(policies.AWSIAMPolicy)
-				if ok {
-					for _, s := range policy.Statement {
-						terraformStatement := TerraformStatement{
-							Actions: s.Action,
-						}
-						for _, resource := range s.Resource {
-							terraformResource := TerraformResource{
-								Reference: "IAM",
-								ARN:       &resource,
-							}
-							terraformStatement.Resources = append(terraformStatement.Resources, terraformResource)
-						}
-						rec.Statements = append(rec.Statements, terraformStatement)
-					}
+			for _, r := range s.Resources {
+				if r.ARN != nil {
+					statement.Resource.Values = append(statement.Resource.Values, *r.ARN)
 				}
 			}
-			terraformFinding.Recommendations = append(terraformFinding.Recommendations, rec)
+			if len(statement.Resource.Values) > 0 {
+				doc.Statement = append(doc.Statement, statement)
+			}
 		}
 	}
-	t.Finding = &terraformFinding
+	return doc
 }
 
 // Returns true if this StateFileResource is in the root directory by checking wether the Module property is nil
@@ -543,7 +548,6 @@ func (t *TerraformIAMPolicyApplier) PlanTerraformFinding() (*applier.PendingChan
 
 }
 func (t *TerraformIAMPolicyApplier) ApplyFindingToBlock(awsIamBlock *Block) error {
-	newInlinePolicies := []*hclwrite.Block{}
 	existingInlinePoliciesToRemove := []*hclwrite.Block{}
 	for _, nestedBlock := range awsIamBlock.RawBlock.Body().Blocks() {
 		if IsBlockInlinePolicy(nestedBlock) {
@@ -551,144 +555,215 @@ func (t *TerraformIAMPolicyApplier) ApplyFindingToBlock(awsIamBlock *Block) erro
 		}
 	}
 
-	for _, reccomendation := range t.Finding.Recommendations {
-		for i, statement := range reccomendation.Statements {
-			newBlock := hclwrite.NewBlock("inline_policy", nil)
-			actionsJson, _ := json.Marshal(statement.Actions)
-			arn := ""
-
-			// The ARN from the recommendation can contain "/*" on the end for an s3 bucket, to look this up in
-			// @TODO probably need to verify whether we could get specific things here(as in specific objects in a bucket)
-
-			splitArn := statement.Resources[0].SplitArn()
-			awsResource := t.Blocks.GetBlock(t.StateFileResources.Get(splitArn[0]).Key)
-			if awsResource != nil {
-				/*
-					THE BELOW SCENARIOS ONLY SUPPORT A FLAT PROJECT STRUCTURE WHERE THERE IS ONLY 1 LEVEL OF MODULE ABSTRACTION
-
-					MAIN.TF
-						->MODULES
-							->EC2
-								MAIN.TF
-
-				*/
-
-				// if both are in the same file, needs to be nil safe
-				if awsResource.Path == awsIamBlock.Path {
-					// both in same file
-					// standard method
-
-					arn = awsResource.AddressInFile + ".arn"
-					// if there is a specific resource then join it to the resource arn
-					if len(splitArn) > 1 && splitArn[1] != "*" {
-						// This adds a join statement to the terraform so that we refer to the correct bucket arn but add the specific resource correctly if it was specified in the finding
-						// https://www.terraform.io/docs/language/functions/join.html
-						arn = fmt.Sprintf(`join("/", [%s,"%s"])`, arn, strings.Join(splitArn[1:], "/"))
-					}
+	// split the finding into policies which fit within the AWS policy size quotas
+	plan := policies.PlanPolicies(t.Finding.Document())
+	for _, warning := range plan.Warnings {
+		t.warnf("%s", warning)
+	}
 
-				} else if !t.IsBlockInRoot(awsResource) && !t.IsBlockInRoot(awsIamBlock) {
-					// resources are in different files
-					// create and output for the resource
-					// create a variable for the role module
-					//do the plumbing
-					outputsFilePath := filepath.Join(filepath.Dir(awsResource.Path), "outputs.tf")
-					outputsFile, err := t.FileHandler.OpenFile(outputsFilePath, true)
+	// render each policy document, resolving ARNs to references to the resources in the project
+	references := map[string]string{}
+	documents := []string{}
+	for _, doc := range plan.Documents {
+		statements := []string{}
+		for _, statement := range doc.Statement {
+			resources := []string{}
+			for _, resourceARN := range statement.Resource.Values {
+				reference, ok := references[resourceARN]
+				if !ok {
+					var err error
+					reference, err = t.resourceReference(awsIamBlock, resourceARN)
 					if err != nil {
 						return err
 					}
+					references[resourceARN] = reference
+				}
+				resources = append(resources, reference)
+			}
+			statements = append(statements, renderPolicyStatement(statement.Action.Values, resources, statement.Condition))
+		}
+		documents = append(documents, renderPolicyDocument(statements))
+	}
 
-					outputName := AppendOutputBlockIfNotExist(outputsFile.Body(), GenerateOutputName(awsResource.AddressInFile, "arn"), "IAMZero generated output for resource", awsResource.AddressInFile+".arn")
+	// Remove all existing inline policies
+	for _, blockToRemove := range existingInlinePoliciesToRemove {
+		awsIamBlock.RawBlock.Body().RemoveBlock(blockToRemove)
+	}
+	// Remove managed policies generated by a previous run
+	removedManagedPolicies := false
+	for _, block := range awsIamBlock.File.Body().Blocks() {
+		if IsBlockGeneratedManagedPolicy(block, awsIamBlock.RawBlock) {
+			awsIamBlock.File.Body().RemoveBlock(block)
+			removedManagedPolicies = true
+		}
+	}
 
-					moduleDefinitionInRoot := awsResource.ParentModuleBlock
-					resourcePathInRootModule := ""
-					resourcePathInRootModule = strings.Join([]string{"module", moduleDefinitionInRoot.AddressInFile, outputName}, ".")
+	if plan.Inline {
+		if removedManagedPolicies {
+			awsIamBlock.RawBlock.Body().RemoveAttribute("managed_policy_arns")
+		}
+		// append the new blocks(inline policies) to this role
+		for i, doc := range documents {
+			newBlock := hclwrite.NewBlock("inline_policy", nil)
+			setPolicyAttributes(newBlock, doc, "name", "iamzero-generated-iam-policy-"+fmt.Sprint(i))
+			awsIamBlock.RawBlock.Body().AppendBlock(newBlock)
+		}
+		return nil
+	}
 
-					// resource is in root, role is in another file
-					// create variable for role module
-					// add variable value in root module declaration
+	// the policy doesn't fit within the inline policy quota for a role,
+	// so create managed policies alongside the role and attach them to it
+	policyArns := []string{}
+	for i, doc := range documents {
+		label := GeneratedManagedPolicyLabel(awsIamBlock.RawBlock, i)
+		newBlock := hclwrite.NewBlock("resource", []string{"aws_iam_policy", label})
+		// managed policy names must be unique within an account, so let Terraform generate a unique name
+		setPolicyAttributes(newBlock, doc, "name_prefix", "iamzero-generated-iam-policy-")
+		awsIamBlock.File.Body().AppendNewline()
+		awsIamBlock.File.Body().AppendBlock(newBlock)
+		policyArns = append(policyArns, "aws_iam_policy."+label+".arn")
+	}
+	awsIamBlock.RawBlock.Body().SetAttributeRaw("managed_policy_arns", StringToHclwriteTokensWithoutQuotes(fmt.Sprintf("[%s]", strings.Join(policyArns, ", "))))
 
-					// add variable for a resource
-					variableFilePath := filepath.Join(filepath.Dir(awsIamBlock.Path), "variables.tf")
-					variablesFile, err := t.FileHandler.OpenFile(variableFilePath, true)
-					if err != nil {
-						return err
-					}
+	return nil
+}
 
-					variableName := AppendVariableBlockIfNotExist(variablesFile.Body(), GenerateVariableName(awsResource.AddressInFile, "arn"), "IAMZero generated variable for resource")
+// resourceReference returns a Terraform expression referring to the resource with the given ARN.
+// If the resource is defined in the project, a reference to its arn attribute is used, with any
+// outputs and variables required to pass it to the module containing the role.
+// Otherwise the ARN is used directly as a string literal.
+func (t *TerraformIAMPolicyApplier) resourceReference(awsIamBlock *Block, resourceARN string) (string, error) {
+	arn := ""
+
+	// The ARN from the recommendation can contain "/*" on the end for an s3 bucket, to look this up in
+	// @TODO probably need to verify whether we could get specific things here(as in specific objects in a bucket)
+
+	splitArn := strings.Split(resourceARN, "/")
+	// blocks without labels such as 'locals' have an empty key, so only look up resources found in the state file
+	var awsResource *Block
+	if stateFileResource := t.StateFileResources.Get(splitArn[0]); stateFileResource.Key != "" {
+		awsResource = t.Blocks.GetBlock(stateFileResource.Key)
+	}
+	if awsResource != nil {
+		/*
+			THE BELOW SCENARIOS ONLY SUPPORT A FLAT PROJECT STRUCTURE WHERE THERE IS ONLY 1 LEVEL OF MODULE ABSTRACTION
+
+			MAIN.TF
+				->MODULES
+					->EC2
+						MAIN.TF
+
+		*/
+
+		// if both are in the same file, needs to be nil safe
+		if awsResource.Path == awsIamBlock.Path {
+			// both in same file
+			// standard method
+
+			arn = awsResource.AddressInFile + ".arn"
+			// if there is a specific resource then join it to the resource arn
+			if len(splitArn) > 1 && splitArn[1] != "*" {
+				// This adds a join statement to the terraform so that we refer to the correct bucket arn but add the specific resource correctly if it was specified in the finding
+				// https://www.terraform.io/docs/language/functions/join.html
+				arn = fmt.Sprintf(`join("/", [%s,"%s"])`, arn, strings.Join(splitArn[1:], "/"))
+			}
 
-					moduleDefinitionInRoot = awsIamBlock.ParentModuleBlock
+		} else if !t.IsBlockInRoot(awsResource) && !t.IsBlockInRoot(awsIamBlock) {
+			// resources are in different files
+			// create and output for the resource
+			// create a variable for the role module
+			//do the plumbing
+			outputsFilePath := filepath.Join(filepath.Dir(awsResource.Path), "outputs.tf")
+			outputsFile, err := t.FileHandler.OpenFile(outputsFilePath, true)
+			if err != nil {
+				return "", err
+			}
 
-					AppendTraversalAttributeToBlock(moduleDefinitionInRoot.RawBlock, variableName, resourcePathInRootModule)
-					arn = "var." + variableName
+			outputName := AppendOutputBlockIfNotExist(outputsFile.Body(), GenerateOutputName(awsResource.AddressInFile, "arn"), "IAMZero generated output for resource", awsResource.AddressInFile+".arn")
 
-				} else if !t.IsBlockInRoot(awsResource) && t.IsBlockInRoot(awsIamBlock) {
+			moduleDefinitionInRoot := awsResource.ParentModuleBlock
+			resourcePathInRootModule := ""
+			resourcePathInRootModule = strings.Join([]string{"module", moduleDefinitionInRoot.AddressInFile, outputName}, ".")
 
-					// role is in root,  resource is in another file
-					// create an output from the resource definition
-					// refer to it in the root inline policy
+			// resource is in root, role is in another file
+			// create variable for role module
+			// add variable value in root module declaration
 
-					outputsFilePath := filepath.Join(filepath.Dir(awsResource.Path), "outputs.tf")
-					outputsFile, err := t.FileHandler.OpenFile(outputsFilePath, true)
-					if err != nil {
-						return err
-					}
-					outputName := AppendOutputBlockIfNotExist(outputsFile.Body(), GenerateOutputName(awsResource.AddressInFile, "arn"), "IAMZero generated output for resource", awsResource.AddressInFile+".arn")
+			// add variable for a resource
+			variableFilePath := filepath.Join(filepath.Dir(awsIamBlock.Path), "variables.tf")
+			variablesFile, err := t.FileHandler.OpenFile(variableFilePath, true)
+			if err != nil {
+				return "", err
+			}
 
-					moduleDefinitionInRoot := awsResource.ParentModuleBlock
-					if moduleDefinitionInRoot != nil {
+			variableName := AppendVariableBlockIfNotExist(variablesFile.Body(), GenerateVariableName(awsResource.AddressInFile, "arn"), "IAMZero generated variable for resource")
 
-						arn = strings.Join([]string{"module", moduleDefinitionInRoot.AddressInFile, outputName}, ".")
-					} else {
-						return fmt.Errorf("failed to find module block in file Root file for :%s", awsResource.Path)
-					}
+			moduleDefinitionInRoot = awsIamBlock.ParentModuleBlock
 
-				} else if t.IsBlockInRoot(awsResource) && !t.IsBlockInRoot(awsIamBlock) {
-					// resource is in root, role is in another file
-					// create variable for role module
-					// add variable value in root module declaration
+			AppendTraversalAttributeToBlock(moduleDefinitionInRoot.RawBlock, variableName, resourcePathInRootModule)
+			arn = "var." + variableName
 
-					// add variable for a resource
-					variableFilePath := filepath.Join(filepath.Dir(awsIamBlock.Path), "variables.tf")
-					variablesFile, err := t.FileHandler.OpenFile(variableFilePath, true)
-					if err != nil {
-						return err
-					}
-					variableName := AppendVariableBlockIfNotExist(variablesFile.Body(), GenerateVariableName(awsResource.AddressInFile, "arn"), "IAMZero generated variable for resource")
-
-					moduleDefinitionInRoot := awsIamBlock.ParentModuleBlock
-					if moduleDefinitionInRoot != nil {
-						AppendTraversalAttributeToBlock(moduleDefinitionInRoot.RawBlock, variableName, awsResource.AddressInFile+".arn")
-						arn = "var." + variableName
-					} else {
-						return fmt.Errorf("failed to find module block in file Root file for :%s", awsIamBlock.Path)
-					}
-				} else {
-					// add quotes around it to make it valid for our use, maybe a json stringify equivalent would be good here to add the quotes robustly
-					arn = fmt.Sprintf(`"%s"`, *statement.Resources[0].ARN)
-					t.AWSIAMPolicyApplier.Logger.Warnf("Resource with ARN(%s) is declared more than 1 level into the project tree, this is not yet supported. Using ARN directly\n", arn, t.StateFile)
-				}
+		} else if !t.IsBlockInRoot(awsResource) && t.IsBlockInRoot(awsIamBlock) {
+
+			// role is in root,  resource is in another file
+			// create an output from the resource definition
+			// refer to it in the root inline policy
 
+			outputsFilePath := filepath.Join(filepath.Dir(awsResource.Path), "outputs.tf")
+			outputsFile, err := t.FileHandler.OpenFile(outputsFilePath, true)
+			if err != nil {
+				return "", err
+			}
+			outputName := AppendOutputBlockIfNotExist(outputsFile.Body(), GenerateOutputName(awsResource.AddressInFile, "arn"), "IAMZero generated output for resource", awsResource.AddressInFile+".arn")
+
+			moduleDefinitionInRoot := awsResource.ParentModuleBlock
+			if moduleDefinitionInRoot != nil {
+
+				arn = strings.Join([]string{"module", moduleDefinitionInRoot.AddressInFile, outputName}, ".")
 			} else {
-				// add quotes around it to make it valid for our use, maybe a json stringify equivalent would be good here to add the quotes robustly
-				arn = fmt.Sprintf(`"%s"`, *statement.Resources[0].ARN)
-				t.AWSIAMPolicyApplier.Logger.Warnf("Failed to find matching resource in state file for ARN(%s) in (%s) using ARN reference directly\n", arn, t.StateFile)
+				return "", fmt.Errorf("failed to find module block in file Root file for :%s", awsResource.Path)
+			}
+
+		} else if t.IsBlockInRoot(awsResource) && !t.IsBlockInRoot(awsIamBlock) {
+			// resource is in root, role is in another file
+			// create variable for role module
+			// add variable value in root module declaration
+
+			// add variable for a resource
+			variableFilePath := filepath.Join(filepath.Dir(awsIamBlock.Path), "variables.tf")
+			variablesFile, err := t.FileHandler.OpenFile(variableFilePath, true)
+			if err != nil {
+				return "", err
 			}
+			variableName := AppendVariableBlockIfNotExist(variablesFile.Body(), GenerateVariableName(awsResource.AddressInFile, "arn"), "IAMZero generated variable for resource")
 
-			setInlinePolicyIamPolicy(newBlock, string(actionsJson), arn, "iamzero-generated-iam-policy-"+fmt.Sprint(i))
-			newInlinePolicies = append(newInlinePolicies, newBlock)
+			moduleDefinitionInRoot := awsIamBlock.ParentModuleBlock
+			if moduleDefinitionInRoot != nil {
+				AppendTraversalAttributeToBlock(moduleDefinitionInRoot.RawBlock, variableName, awsResource.AddressInFile+".arn")
+				arn = "var." + variableName
+			} else {
+				return "", fmt.Errorf("failed to find module block in file Root file for :%s", awsIamBlock.Path)
+			}
+		} else {
+			// add quotes around it to make it valid for our use, maybe a json stringify equivalent would be good here to add the quotes robustly
+			arn = fmt.Sprintf(`"%s"`, resourceARN)
+			t.warnf("Resource with ARN(%s) is declared more than 1 level into the project tree, this is not yet supported. Using ARN directly\n", arn)
 		}
-	}
-	// Remove all existing inline policies
-	for _, blockToRemove := range existingInlinePoliciesToRemove {
-		awsIamBlock.RawBlock.Body().RemoveBlock(blockToRemove)
-	}
-	// append the new blocks(inline policies) to this role
-	for _, blockToAdd := range newInlinePolicies {
-		awsIamBlock.RawBlock.Body().AppendBlock(blockToAdd)
+
+	} else {
+		// add quotes around it to make it valid for our use, maybe a json stringify equivalent would be good here to add the quotes robustly
+		arn = fmt.Sprintf(`"%s"`, resourceARN)
+		t.warnf("Failed to find matching resource in state file for ARN(%s) in (%s) using ARN reference directly\n", arn, t.StateFile)
 	}
 
-	return nil
+	return arn, nil
+}
 
+// warnf logs a warning if the applier has a logger configured
+func (t *TerraformIAMPolicyApplier) warnf(template string, args ...interface{}) {
+	if t.AWSIAMPolicyApplier.Logger != nil {
+		t.AWSIAMPolicyApplier.Logger.Warnf(template, args...)
+	}
 }
 
 // Intended to be used on a policy attachment block
@@ -869,21 +944,69 @@ func MarshalStateFileToGo(stateFileBytes []byte) (*StateFile, error) {
 	return &stateFile, nil
 }
 
-func setInlinePolicyIamPolicy(block *hclwrite.Block, action string, resource string, name string) {
-	// @TODO if hclwrite add a simple way to write function values like this we may switch over,
-	// However for now it seems this is the simplest way to add a function block to HCL using the hclwite package
-	str := fmt.Sprintf(`jsonencode({
-        Version = "2012-10-17"
-        Statement = [
-          {
+// renderPolicyStatement renders an allow statement for use in a jsonencode() policy document.
+// resources are Terraform expressions, such as references to resource ARNs or quoted strings.
+// JSON objects are valid HCL object expressions so the condition can be inserted directly.
+func renderPolicyStatement(actions []string, resources []string, condition policies.Condition) string {
+	actionsJson, _ := json.Marshal(actions)
+
+	resource := resources[0]
+	if len(resources) > 1 {
+		resource = "[" + strings.Join(resources, ", ") + "]"
+	}
+
+	conditionLine := ""
+	if len(condition) > 0 {
+		b, _ := json.Marshal(condition)
+		// escape IAM policy variables such as ${aws:username} so that Terraform doesn't interpolate them
+		conditionJson := strings.NewReplacer("${", "$${", "%{", "%%{").Replace(string(b))
+		conditionLine = fmt.Sprintf("\n            Condition = %s", conditionJson)
+	}
+
+	return fmt.Sprintf(`          {
             Action   = %s
             Effect   = "Allow"
-            Resource = %s
-          },
+            Resource = %s%s
+          },`, actionsJson, resource, conditionLine)
+}
+
+// renderPolicyDocument renders a jsonencode() function call containing the statements
+// @TODO if hclwrite add a simple way to write function values like this we may switch over,
+// However for now it seems this is the simplest way to add a function block to HCL using the hclwite package
+func renderPolicyDocument(statements []string) string {
+	return fmt.Sprintf(`jsonencode({
+        Version = "2012-10-17"
+        Statement = [
+%s
         ]
-      })`, action, resource)
-	block.Body().SetAttributeRaw("policy", StringToHclwriteTokensWithoutQuotes(str))
-	block.Body().SetAttributeValue("name", cty.StringVal(name))
+      })`, strings.Join(statements, "\n"))
+}
+
+// setPolicyAttributes sets the policy attribute and the name (or name_prefix) attribute of an inline policy or aws_iam_policy block
+func setPolicyAttributes(block *hclwrite.Block, document string, nameAttribute string, name string) {
+	block.Body().SetAttributeRaw("policy", StringToHclwriteTokensWithoutQuotes(document))
+	block.Body().SetAttributeValue(nameAttribute, cty.StringVal(name))
+}
+
+// Returns the label used for an aws_iam_policy resource generated by IAM Zero for a role
+//
+// <roleName>_iamzero_<index>
+func GeneratedManagedPolicyLabel(roleBlock *hclwrite.Block, index int) string {
+	return fmt.Sprintf("%s_iamzero_%d", roleBlock.Labels()[len(roleBlock.Labels())-1], index)
+}
+
+// Returns true if the block is an aws_iam_policy resource which IAM Zero generated for the role
+func IsBlockGeneratedManagedPolicy(block *hclwrite.Block, roleBlock *hclwrite.Block) bool {
+	labels := block.Labels()
+	if block.Type() != "resource" || len(labels) != 2 || labels[0] != "aws_iam_policy" {
+		return false
+	}
+	prefix := strings.TrimSuffix(GeneratedManagedPolicyLabel(roleBlock, 0), "0")
+	if !strings.HasPrefix(labels[1], prefix) {
+		return false
+	}
+	_, err := strconv.Atoi(strings.TrimPrefix(labels[1], prefix))
+	return err == nil
 }
 
 // if createIfNotExist is true then this function will return a new empty hclwrite file if it is not found at the path
@@ -1,11 +1,13 @@
 package applier_test
 
 import (
+	"fmt"
 	"path"
 	"testing"
 
 	"github.com/common-fate/iamzero/pkg/applier"
 	terraformApplier "github.com/common-fate/iamzero/pkg/applier/terraform"
+	"github.com/common-fate/iamzero/pkg/policies"
 	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/stretchr/testify/assert"
 )
@@ -99,3 +101,48 @@ func AssertFilesEqual(t *testing.T, fh *terraformApplier.FileHandler, orginalPat
 	}
 	assert.Equal(t, string(hclwrite.Format(snapshot.Bytes())), string(hclwrite.Format(original.Bytes())))
 }
+
+func TestApplyFindingWithCondition(t *testing.T) {
+	// tests that statement conditions are written to the inline policy, with IAM policy variables escaped
+	iamRoleARN := "arn:aws:iam::12345678910:role/iamzero-tf-overprivileged-role"
+	actionsDemo := []string{"s3:GetObject"}
+	bucketArn := "arn:aws:s3:::iamzero-tf-example-bucket3/*"
+	condition := policies.Condition{"StringLike": {"s3:prefix": policies.NewConditionValue("home/${aws:username}/*")}}
+	finding := &terraformApplier.TerraformFinding{FindingID: "abcde", Role: iamRoleARN, Recommendations: []terraformApplier.TerraformRecommendation{{Type: "IAMInlinePolicy", Statements: []terraformApplier.TerraformStatement{{Resources: []terraformApplier.TerraformResource{{Reference: bucketArn, ARN: &bucketArn}}, Actions: actionsDemo, Condition: condition}}}}}
+
+	tf := terraformApplier.TerraformIAMPolicyApplier{AWSIAMPolicyApplier: applier.AWSIAMPolicyApplier{
+		ProjectPath: "./test/example_1/"}, Finding: finding}
+	err := tf.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tf.Plan()
+	assert.True(t, err == nil)
+
+	AssertFilesEqual(t, tf.FileHandler, "./test/example_1/", "./test/example_1/snapshots/snapshot_4/", "main.tf")
+}
+
+func TestApplyLargeFindingAsManagedPolicies(t *testing.T) {
+	// tests that a finding which is larger than the inline policy quota for a role is split into managed policies
+	iamRoleARN := "arn:aws:iam::12345678910:role/iamzero-tf-overprivileged-role"
+	statements := []terraformApplier.TerraformStatement{}
+	for i := 0; i < 64; i++ {
+		bucketArn := fmt.Sprintf("arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-%d/*", i)
+		statements = append(statements, terraformApplier.TerraformStatement{Resources: []terraformApplier.TerraformResource{{Reference: bucketArn, ARN: &bucketArn}}, Actions: []string{"s3:GetObject", "s3:PutObject"}})
+	}
+	finding := &terraformApplier.TerraformFinding{FindingID: "abcde", Role: iamRoleARN, Recommendations: []terraformApplier.TerraformRecommendation{{Type: "IAMInlinePolicy", Statements: statements}}}
+	assert.Greater(t, finding.Document().Length(), policies.InlinePolicyAggregateMaxLength)
+
+	tf := terraformApplier.TerraformIAMPolicyApplier{AWSIAMPolicyApplier: applier.AWSIAMPolicyApplier{
+		ProjectPath: "./test/example_1/"}, Finding: finding}
+	err := tf.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tf.Plan()
+	assert.True(t, err == nil)
+
+	AssertFilesEqual(t, tf.FileHandler, "./test/example_1/", "./test/example_1/snapshots/snapshot_5/", "main.tf")
+}
@@ -0,0 +1,393 @@
+terraform {
+  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = "~> 3.27"
+    }
+  }
+
+  required_version = ">= 0.14.9"
+}
+
+provider "aws" {
+  profile = "default"
+  region  = "ap-southeast-2"
+}
+
+# S3 state bucket for terraform
+resource "aws_s3_bucket" "iamzero-tf-example-bucket3" {
+  bucket = "iamzero-tf-example-bucket3"
+  acl    = "private"
+}
+resource "aws_s3_bucket" "tf-remote-state-demo-bucket" {
+  bucket = "tf-remote-state-demo-bucket"
+  acl    = "private"
+}
+
+locals {
+  #This should the the role of the AWS account that the user is using to login
+  aws-user-arn = "arn:aws:iam::12345678910:root"
+}
+
+resource "aws_iam_role" "iamzero-overprivileged-role" {
+  name = "iamzero-tf-overprivileged-role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Effect = "Allow"
+        Sid    = ""
+        Principal = {
+          AWS = local.aws-user-arn
+        }
+      },
+    ]
+  })
+  managed_policy_arns = [aws_iam_policy.iamzero-overprivileged-role_iamzero_0.arn, aws_iam_policy.iamzero-overprivileged-role_iamzero_1.arn]
+}
+
+module "ec2" {
+  source = "./modules/ec2/"
+}
+
+module "s3" {
+  source = "./modules/s3/"
+}
+resource "aws_iam_policy" "iamzero-overprivileged-role_iamzero_0" {
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-0/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-1/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-2/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-3/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-4/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-5/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-6/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-7/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-8/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-9/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-47/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-48/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-49/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-50/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-51/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-52/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-53/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-54/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-55/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-56/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-57/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-58/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-59/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-60/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-61/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-62/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-63/*"
+      },
+    ]
+  })
+  name_prefix = "iamzero-generated-iam-policy-"
+}
+
+resource "aws_iam_policy" "iamzero-overprivileged-role_iamzero_1" {
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-10/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-11/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-12/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-13/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-14/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-15/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-16/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-17/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-18/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-19/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-20/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-21/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-22/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-23/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-24/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-25/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-26/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-27/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-28/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-29/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-30/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-31/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-32/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-33/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-34/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-35/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-36/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-37/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-38/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-39/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-40/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-41/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-42/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-43/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-44/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-45/*"
+      },
+      {
+        Action   = ["s3:GetObject", "s3:PutObject"]
+        Effect   = "Allow"
+        Resource = "arn:aws:s3:::iamzero-tf-example-bucket-with-a-long-name-that-is-not-in-the-project-46/*"
+      },
+    ]
+  })
+  name_prefix = "iamzero-generated-iam-policy-"
+}
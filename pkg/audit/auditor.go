@@ -2,13 +2,12 @@ package audit
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
-	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/arn"
@@ -20,7 +19,6 @@ import (
 
 	"github.com/common-fate/iamzero/pkg/policies"
 	"go.uber.org/zap"
-	"golang.org/x/sync/errgroup"
 )
 
 // ManagedPolicy is a managed IAM policy
@@ -35,13 +33,14 @@ type InlinePolicy struct {
 	Document policies.AWSIAMPolicy `json:"document"`
 }
 
-type auditRoles []string
+// stringList is a flag which can be passed multiple times
+type stringList []string
 
-func (i *auditRoles) String() string {
+func (i *stringList) String() string {
 	return strings.Join(*i, ",")
 }
 
-func (i *auditRoles) Set(value string) error {
+func (i *stringList) Set(value string) error {
 	*i = append(*i, value)
 	return nil
 }
@@ -88,6 +87,12 @@ func (s *CDKResourceStorage) Add(r policies.CDKResource) {
 	s.resources = append(s.resources, r)
 }
 
+func (s *CDKResourceStorage) List() []policies.CDKResource {
+	s.Lock()
+	defer s.Unlock()
+	return s.resources
+}
+
 // GetByPhysicalID looks up a CDK resource by it's Physical ID
 func (s *CDKResourceStorage) GetByPhysicalID(id string) *policies.CDKResource {
 	for _, r := range s.resources {
@@ -98,6 +103,43 @@ func (s *CDKResourceStorage) GetByPhysicalID(id string) *policies.CDKResource {
 	return nil
 }
 
+// IaCSourceStorage stores the infrastructure-as-code sources of resources
+// in memory and is goroutine-safe
+type IaCSourceStorage struct {
+	sync.Mutex
+	sources []policies.IaCSource
+}
+
+func NewIaCSourceStorage() *IaCSourceStorage {
+	return &IaCSourceStorage{
+		sources: []policies.IaCSource{},
+	}
+}
+
+func (s *IaCSourceStorage) Add(src policies.IaCSource) {
+	s.Lock()
+	defer s.Unlock()
+	s.sources = append(s.sources, src)
+}
+
+func (s *IaCSourceStorage) List() []policies.IaCSource {
+	s.Lock()
+	defer s.Unlock()
+	return s.sources
+}
+
+// Get looks up the source of a resource by its account and physical ID
+func (s *IaCSourceStorage) Get(accountID, physicalID string) *policies.IaCSource {
+	s.Lock()
+	defer s.Unlock()
+	for _, src := range s.sources {
+		if src.AccountID == accountID && src.PhysicalID == physicalID {
+			return &src
+		}
+	}
+	return nil
+}
+
 // Auditor reads resources across a cloud environment to give an
 // understanding of what is deployed, and where.
 //
@@ -108,28 +150,64 @@ type Auditor struct {
 	// each AWS account will have a role
 	// the profile that IAM Zero runs as must have permission
 	// to assume each of these roles
-	auditRoles auditRoles
+	auditRoles stringList
+
+	// files containing `aws iam get-account-authorization-details` output
+	// to load the inventory from
+	authorizationDetailsFiles stringList
+
+	// a snapshot file to load the inventory from, instead of calling AWS
+	snapshotPath string
+	// a file to write a snapshot of the inventory to once it is loaded
+	snapshotOutPath string
+
+	// the statuses of the CloudFormation stacks to load resources from
+	stackStatuses stringList
+
+	// the maximum number of concurrent IAM API requests per account
+	concurrency int
+	// the number of times a throttled IAM API request is retried
+	maxRetries int
+	// the delay before the first retry of a throttled request,
+	// which doubles with each attempt
+	retryBackoff time.Duration
 
 	// a map of policy ARN to the actual policy document
 	policyMap sync.Map
 
 	// all IAM roles across all accounts audited
-	roleStorage  *AWSRoleStorage
-	links        []AssumeRoleLink
-	cdkResources *CDKResourceStorage
+	roleStorage *AWSRoleStorage
+	// all IAM users, groups and instance profiles across all accounts audited
+	entityStorage *IAMEntityStorage
+	links         []AssumeRoleLink
+	cdkResources  *CDKResourceStorage
+	// the CloudFormation, SAM, Serverless and CDK sources of IAM roles
+	iacSources *IaCSourceStorage
 
 	log *zap.SugaredLogger
 }
 
 func New() *Auditor {
 	return &Auditor{
-		roleStorage:  NewAWSRoleStorage(),
-		cdkResources: NewCDKResourceStorage(),
+		concurrency:   10,
+		maxRetries:    8,
+		retryBackoff:  500 * time.Millisecond,
+		roleStorage:   NewAWSRoleStorage(),
+		entityStorage: NewIAMEntityStorage(),
+		cdkResources:  NewCDKResourceStorage(),
+		iacSources:    NewIaCSourceStorage(),
+		log:           zap.NewNop().Sugar(),
 	}
 }
 
 func (a *Auditor) AddFlags(fs *flag.FlagSet) {
 	fs.Var(&a.auditRoles, "audit-role", "an audit role ARN to assume for auditing (multiple arguments allowed)")
+	fs.IntVar(&a.concurrency, "audit-concurrency", 10, "the maximum number of concurrent IAM API requests made when auditing an account")
+	fs.IntVar(&a.maxRetries, "audit-max-retries", 8, "the number of times to retry an IAM API request which is throttled")
+	fs.Var(&a.authorizationDetailsFiles, "audit-authorization-details", "a file containing the output of 'aws iam get-account-authorization-details' to load into the audit inventory (multiple arguments allowed)")
+	fs.StringVar(&a.snapshotPath, "audit-snapshot", "", "load the audit inventory from a snapshot file rather than from AWS")
+	fs.StringVar(&a.snapshotOutPath, "audit-snapshot-out", "", "write a snapshot of the audit inventory to this file once it is loaded")
+	fs.Var(&a.stackStatuses, "audit-stack-status", "a CloudFormation stack status, such as UPDATE_COMPLETE, to load stacks with (multiple arguments allowed, defaults to all stacks which have been deployed)")
 }
 
 // Setup configures logging for the auditor
@@ -137,11 +215,18 @@ func (a *Auditor) Setup(log *zap.SugaredLogger) {
 	a.log = log
 }
 
-// LoadResources loads all resources across all accounts into
-// a cache.
+// HasAuditRoles returns true if any audit roles have been supplied
+func (a *Auditor) HasAuditRoles() bool {
+	return len(a.auditRoles) > 0
+}
+
+// LoadResources loads the IAM inventory of each account into a cache:
+// roles, users, groups, customer and AWS managed policies, permissions
+// boundaries and instance profiles.
 //
-// Note: our initial use case loads IAM roles only
-// to map cross-account role access
+// All list requests are paginated. Requests are made concurrently, up to
+// the limit set by the -audit-concurrency flag, and are retried with
+// exponential backoff when they are throttled.
 func (a *Auditor) LoadResources(ctx context.Context) error {
 	if len(a.auditRoles) == 0 {
 		return errors.New("no audit roles supplied")
@@ -162,81 +247,53 @@ func (a *Auditor) LoadResources(ctx context.Context) error {
 		// from assumed role.
 		client := iam.NewFromConfig(cfg)
 
-		policies, err := client.ListPolicies(ctx, &iam.ListPoliciesInput{})
-		if err != nil {
-			return err
-		}
-
-		g, gctx := errgroup.WithContext(ctx)
-
-		for _, p := range policies.Policies {
-			policy := p
-			g.Go(func() error { return a.fetchPolicyDetails(gctx, client, policy) })
-		}
-
-		err = g.Wait()
-		if err != nil {
-			return err
-		}
-
-		// TODO: handle paginated response
-		roles, err := client.ListRoles(ctx, &iam.ListRolesInput{})
+		err = a.loadAccount(ctx, client)
 		if err != nil {
-			return err
-		}
-
-		g, gctx = errgroup.WithContext(ctx)
-
-		for _, r := range roles.Roles {
-			role := r
-			g.Go(func() error { return a.FetchDetailsForRole(gctx, client, role) })
-		}
-		err = g.Wait()
-		if err != nil {
-			return err
+			return fmt.Errorf("auditing with role %s: %w", role, err)
 		}
 	}
+
+	a.log.With(
+		"roles", len(a.GetRoles()),
+		"users", len(a.GetUsers()),
+		"groups", len(a.GetGroups()),
+		"policies", len(a.GetManagedPolicies()),
+		"instanceProfiles", len(a.GetInstanceProfiles()),
+	).Info("loaded IAM inventory")
 	return nil
 }
 
-func (a *Auditor) fetchPolicyDetails(ctx context.Context, client *iam.Client, p types.Policy) error {
+func (a *Auditor) fetchPolicyDetails(ctx context.Context, client IAMAPI, p types.Policy) error {
 	a.log.With("policy", p.Arn).Debug("fetching policy document")
-	details, err := client.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{
-		PolicyArn: p.Arn,
-		VersionId: p.DefaultVersionId,
+	var details *iam.GetPolicyVersionOutput
+	err := a.withRetry(ctx, func(ctx context.Context) (err error) {
+		details, err = client.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{
+			PolicyArn: p.Arn,
+			VersionId: p.DefaultVersionId,
+		})
+		return err
 	})
 	if err != nil {
 		return err
 	}
 	var doc policies.AWSIAMPolicy
-	s, err := url.QueryUnescape(*details.PolicyVersion.Document)
-	if err != nil {
-		return err
-	}
-	a.log.With("policy", p.Arn, "document", s).Debug("unmarshalling policy document")
-
-	err = json.Unmarshal([]byte(s), &doc)
+	err = decodePolicyDocument(details.PolicyVersion.Document, &doc)
 	if err != nil {
-		return err
+		return fmt.Errorf("decoding policy %s: %w", aws.ToString(p.Arn), err)
 	}
 	a.policyMap.Store(*p.Arn, doc)
 	return nil
 }
 
-func (a *Auditor) FetchDetailsForRole(ctx context.Context, client *iam.Client, r types.Role) error {
+func (a *Auditor) FetchDetailsForRole(ctx context.Context, client IAMAPI, r types.Role) error {
 	arnParsed, err := arn.Parse(*r.Arn)
 	if err != nil {
 		return err
 	}
 	var doc TrustPolicyDocument
-	s, err := url.QueryUnescape(*r.AssumeRolePolicyDocument)
-	if err != nil {
-		return err
-	}
-
-	err = json.Unmarshal([]byte(s), &doc)
+	err = decodePolicyDocument(r.AssumeRolePolicyDocument, &doc)
 	if err != nil {
-		return err
+		return fmt.Errorf("decoding trust policy for role %s: %w", *r.Arn, err)
 	}
 	role := AWSRole{
 		ARN:                 *r.Arn,
@@ -244,61 +301,70 @@ func (a *Auditor) FetchDetailsForRole(ctx context.Context, client *iam.Client, r
 		TrustPolicyDocument: doc,
 	}
 
-	a.log.With("role", r.Arn).Debug("fetching attached managed policies")
+	a.log.With("role", r.Arn).Debug("fetching role details")
 
-	managedPolicies, err := client.ListAttachedRolePolicies(ctx, &iam.ListAttachedRolePoliciesInput{
-		RoleName: r.RoleName,
+	// ListRoles doesn't include the permissions boundary of each role
+	var details *iam.GetRoleOutput
+	err = a.withRetry(ctx, func(ctx context.Context) (err error) {
+		details, err = client.GetRole(ctx, &iam.GetRoleInput{RoleName: r.RoleName})
+		return err
 	})
 	if err != nil {
 		return err
 	}
-
-	for _, p := range managedPolicies.AttachedPolicies {
-		arnParsed, err = arn.Parse(*p.PolicyArn)
+	if b := details.Role.PermissionsBoundary; b != nil {
+		role.PermissionsBoundary, err = a.managedPolicy(ctx, client, aws.ToString(b.PermissionsBoundaryArn))
 		if err != nil {
 			return err
 		}
-		policy, found := a.policyMap.Load(*p.PolicyArn)
-		if found {
-			role.ManagedPolicies = append(role.ManagedPolicies, ManagedPolicy{
-				ARN:      *p.PolicyArn,
-				Document: policy.(policies.AWSIAMPolicy),
-			})
-		}
 	}
 
-	a.log.With("role", r.Arn).Debug("fetching inline policies")
+	a.log.With("role", r.Arn).Debug("fetching attached managed policies")
 
-	inlinePolicies, err := client.ListRolePolicies(ctx, &iam.ListRolePoliciesInput{
-		RoleName: r.RoleName,
-	})
+	var attached []types.AttachedPolicy
+	ap := iam.NewListAttachedRolePoliciesPaginator(client, &iam.ListAttachedRolePoliciesInput{RoleName: r.RoleName})
+	for ap.HasMorePages() {
+		err := a.withRetry(ctx, func(ctx context.Context) error {
+			page, err := ap.NextPage(ctx)
+			if err == nil {
+				attached = append(attached, page.AttachedPolicies...)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	role.ManagedPolicies, err = a.attachedPolicies(ctx, client, attached)
 	if err != nil {
 		return err
 	}
 
-	for _, p := range inlinePolicies.PolicyNames {
-		a.log.With("role", r.Arn, "policy-name", p).Debug("fetching policy document")
-		details, err := client.GetRolePolicy(ctx, &iam.GetRolePolicyInput{
-			PolicyName: &p,
-			RoleName:   r.RoleName,
-		})
-		if err != nil {
+	a.log.With("role", r.Arn).Debug("fetching inline policies")
+
+	var names []string
+	ip := iam.NewListRolePoliciesPaginator(client, &iam.ListRolePoliciesInput{RoleName: r.RoleName})
+	for ip.HasMorePages() {
+		err := a.withRetry(ctx, func(ctx context.Context) error {
+			page, err := ip.NextPage(ctx)
+			if err == nil {
+				names = append(names, page.PolicyNames...)
+			}
 			return err
-		}
-		var doc policies.AWSIAMPolicy
-		s, err := url.QueryUnescape(*details.PolicyDocument)
+		})
 		if err != nil {
 			return err
 		}
-
-		err = json.Unmarshal([]byte(s), &doc)
+	}
+	role.InlinePolicies, err = a.inlinePolicies(ctx, names, func(ctx context.Context, name string) (*string, error) {
+		out, err := client.GetRolePolicy(ctx, &iam.GetRolePolicyInput{PolicyName: &name, RoleName: r.RoleName})
 		if err != nil {
-			return err
+			return nil, err
 		}
-		role.InlinePolicies = append(role.InlinePolicies, InlinePolicy{
-			Name:     p,
-			Document: doc,
-		})
+		return out.PolicyDocument, nil
+	})
+	if err != nil {
+		return err
 	}
 	a.roleStorage.Add(role)
 	return nil
@@ -309,6 +375,18 @@ func (a *Auditor) GetRoles() []AWSRole {
 	return a.roleStorage.List()
 }
 
+// GetRoleByARN returns the cached IAM role with the provided ARN,
+// or nil if the role hasn't been loaded.
+func (a *Auditor) GetRoleByARN(arn string) *AWSRole {
+	for _, r := range a.roleStorage.List() {
+		if r.ARN == arn {
+			role := r
+			return &role
+		}
+	}
+	return nil
+}
+
 func (a *Auditor) GetLinks() []AssumeRoleLink {
 	return a.links
 }
@@ -317,6 +395,13 @@ func (a *Auditor) GetCDKResourceByPhysicalID(id string) *policies.CDKResource {
 	return a.cdkResources.GetByPhysicalID(id)
 }
 
+// GetIaCSource looks up where a resource in an account is defined in
+// infrastructure-as-code. Returns nil if the resource isn't managed by
+// CloudFormation.
+func (a *Auditor) GetIaCSource(accountID, physicalID string) *policies.IaCSource {
+	return a.iacSources.Get(accountID, physicalID)
+}
+
 // GetPhysicalIDFromARNResource transforms an ARN resource string into
 // a CloudFormation physical ID.
 // We need to use this because when we parse the ARN read by IAM Zero
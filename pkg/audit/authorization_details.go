@@ -0,0 +1,299 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/pkg/errors"
+)
+
+// AuthorizationDetails is the output of the IAM GetAccountAuthorizationDetails
+// API, as written by `aws iam get-account-authorization-details`.
+// The AWS CLI combines paginated responses into a single document.
+type AuthorizationDetails struct {
+	UserDetailList  []UserDetail          `json:"UserDetailList"`
+	GroupDetailList []GroupDetail         `json:"GroupDetailList"`
+	RoleDetailList  []RoleDetail          `json:"RoleDetailList"`
+	Policies        []ManagedPolicyDetail `json:"Policies"`
+}
+
+type UserDetail struct {
+	Arn                     string                     `json:"Arn"`
+	UserName                string                     `json:"UserName"`
+	GroupList               []string                   `json:"GroupList"`
+	AttachedManagedPolicies []AttachedPolicyDetail     `json:"AttachedManagedPolicies"`
+	UserPolicyList          []InlinePolicyDetail       `json:"UserPolicyList"`
+	PermissionsBoundary     *PermissionsBoundaryDetail `json:"PermissionsBoundary"`
+}
+
+type GroupDetail struct {
+	Arn                     string                 `json:"Arn"`
+	GroupName               string                 `json:"GroupName"`
+	AttachedManagedPolicies []AttachedPolicyDetail `json:"AttachedManagedPolicies"`
+	GroupPolicyList         []InlinePolicyDetail   `json:"GroupPolicyList"`
+}
+
+type RoleDetail struct {
+	Arn                      string                     `json:"Arn"`
+	RoleName                 string                     `json:"RoleName"`
+	AssumeRolePolicyDocument policyDocument             `json:"AssumeRolePolicyDocument"`
+	AttachedManagedPolicies  []AttachedPolicyDetail     `json:"AttachedManagedPolicies"`
+	RolePolicyList           []InlinePolicyDetail       `json:"RolePolicyList"`
+	InstanceProfileList      []InstanceProfileDetail    `json:"InstanceProfileList"`
+	PermissionsBoundary      *PermissionsBoundaryDetail `json:"PermissionsBoundary"`
+}
+
+type ManagedPolicyDetail struct {
+	Arn               string                `json:"Arn"`
+	PolicyName        string                `json:"PolicyName"`
+	DefaultVersionId  string                `json:"DefaultVersionId"`
+	PolicyVersionList []PolicyVersionDetail `json:"PolicyVersionList"`
+}
+
+type PolicyVersionDetail struct {
+	VersionId        string         `json:"VersionId"`
+	IsDefaultVersion bool           `json:"IsDefaultVersion"`
+	Document         policyDocument `json:"Document"`
+}
+
+type AttachedPolicyDetail struct {
+	PolicyArn  string `json:"PolicyArn"`
+	PolicyName string `json:"PolicyName"`
+}
+
+type InlinePolicyDetail struct {
+	PolicyName     string         `json:"PolicyName"`
+	PolicyDocument policyDocument `json:"PolicyDocument"`
+}
+
+type InstanceProfileDetail struct {
+	Arn                 string `json:"Arn"`
+	InstanceProfileName string `json:"InstanceProfileName"`
+	Roles               []struct {
+		Arn string `json:"Arn"`
+	} `json:"Roles"`
+}
+
+type PermissionsBoundaryDetail struct {
+	PermissionsBoundaryArn string `json:"PermissionsBoundaryArn"`
+}
+
+// policyDocument is a policy document in GetAccountAuthorizationDetails
+// output. The AWS CLI decodes documents into JSON objects, while the API
+// and SDKs return them as URL-encoded strings. Both are accepted.
+type policyDocument json.RawMessage
+
+func (d *policyDocument) UnmarshalJSON(b []byte) error {
+	*d = append((*d)[0:0], b...)
+	return nil
+}
+
+// decode unmarshals the document into v.
+func (d policyDocument) decode(v interface{}) error {
+	b := bytes.TrimSpace([]byte(d))
+	if len(b) == 0 || bytes.Equal(b, []byte("null")) {
+		return errors.New("policy document is empty")
+	}
+	if b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		return decodePolicyDocument(&s, v)
+	}
+	return json.Unmarshal(b, v)
+}
+
+// LoadAuthorizationDetailsFile loads the output of
+// `aws iam get-account-authorization-details` into the auditor's
+// inventory.
+func (a *Auditor) LoadAuthorizationDetailsFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var details AuthorizationDetails
+	err = json.Unmarshal(b, &details)
+	if err != nil {
+		return errors.Wrapf(err, "parsing authorization details %s", path)
+	}
+	return a.LoadAuthorizationDetails(details)
+}
+
+// LoadAuthorizationDetails adds the roles, users, groups, managed policies
+// and instance profiles in GetAccountAuthorizationDetails output to the
+// auditor's inventory.
+//
+// AWS managed policies are only included in the output if it was
+// requested with the AWSManagedPolicy filter. Attachments of managed
+// policies which aren't included are skipped with a warning, as their
+// documents can't be looked up without calling AWS.
+func (a *Auditor) LoadAuthorizationDetails(details AuthorizationDetails) error {
+	for _, p := range details.Policies {
+		doc, err := p.defaultDocument()
+		if err != nil {
+			return errors.Wrapf(err, "decoding policy %s", p.Arn)
+		}
+		a.policyMap.Store(p.Arn, doc)
+	}
+
+	groupARNs := map[string]string{}
+	for _, g := range details.GroupDetailList {
+		groupARNs[g.GroupName] = g.Arn
+
+		accountID, err := accountIDFromARN(g.Arn)
+		if err != nil {
+			return err
+		}
+		group := AWSGroup{
+			ARN:             g.Arn,
+			AccountID:       accountID,
+			Name:            g.GroupName,
+			ManagedPolicies: a.offlineAttachedPolicies(g.Arn, g.AttachedManagedPolicies),
+		}
+		group.InlinePolicies, err = offlineInlinePolicies(g.GroupPolicyList)
+		if err != nil {
+			return errors.Wrapf(err, "decoding inline policies for group %s", g.Arn)
+		}
+		a.entityStorage.AddGroup(group)
+	}
+
+	for _, u := range details.UserDetailList {
+		accountID, err := accountIDFromARN(u.Arn)
+		if err != nil {
+			return err
+		}
+		user := AWSUser{
+			ARN:                 u.Arn,
+			AccountID:           accountID,
+			Name:                u.UserName,
+			ManagedPolicies:     a.offlineAttachedPolicies(u.Arn, u.AttachedManagedPolicies),
+			Groups:              []string{},
+			PermissionsBoundary: a.offlineBoundary(u.Arn, u.PermissionsBoundary),
+		}
+		user.InlinePolicies, err = offlineInlinePolicies(u.UserPolicyList)
+		if err != nil {
+			return errors.Wrapf(err, "decoding inline policies for user %s", u.Arn)
+		}
+		for _, name := range u.GroupList {
+			groupARN, ok := groupARNs[name]
+			if !ok {
+				// the group's path isn't known, so assume the default path
+				groupARN = fmt.Sprintf("arn:aws:iam::%s:group/%s", accountID, name)
+			}
+			user.Groups = append(user.Groups, groupARN)
+		}
+		a.entityStorage.AddUser(user)
+	}
+
+	instanceProfiles := map[string]bool{}
+	for _, r := range details.RoleDetailList {
+		accountID, err := accountIDFromARN(r.Arn)
+		if err != nil {
+			return err
+		}
+		var trust TrustPolicyDocument
+		err = r.AssumeRolePolicyDocument.decode(&trust)
+		if err != nil {
+			return errors.Wrapf(err, "decoding trust policy for role %s", r.Arn)
+		}
+		role := AWSRole{
+			ARN:                 r.Arn,
+			AccountID:           accountID,
+			ManagedPolicies:     a.offlineAttachedPolicies(r.Arn, r.AttachedManagedPolicies),
+			TrustPolicyDocument: trust,
+			PermissionsBoundary: a.offlineBoundary(r.Arn, r.PermissionsBoundary),
+		}
+		role.InlinePolicies, err = offlineInlinePolicies(r.RolePolicyList)
+		if err != nil {
+			return errors.Wrapf(err, "decoding inline policies for role %s", r.Arn)
+		}
+		a.roleStorage.Add(role)
+
+		// an instance profile is listed under each of its roles
+		for _, ip := range r.InstanceProfileList {
+			if instanceProfiles[ip.Arn] {
+				continue
+			}
+			instanceProfiles[ip.Arn] = true
+			profile := InstanceProfile{
+				ARN:       ip.Arn,
+				AccountID: accountID,
+				Name:      ip.InstanceProfileName,
+				Roles:     []string{},
+			}
+			for _, ipr := range ip.Roles {
+				profile.Roles = append(profile.Roles, ipr.Arn)
+			}
+			a.entityStorage.AddInstanceProfile(profile)
+		}
+	}
+	return nil
+}
+
+// defaultDocument returns the document of the default version of the policy.
+func (p ManagedPolicyDetail) defaultDocument() (policies.AWSIAMPolicy, error) {
+	var doc policies.AWSIAMPolicy
+	for _, v := range p.PolicyVersionList {
+		if v.IsDefaultVersion || v.VersionId == p.DefaultVersionId {
+			err := v.Document.decode(&doc)
+			return doc, err
+		}
+	}
+	return doc, errors.New("the default policy version is missing")
+}
+
+// offlineAttachedPolicies looks up the documents of attached managed policies,
+// skipping any policies which weren't loaded.
+func (a *Auditor) offlineAttachedPolicies(entity string, attached []AttachedPolicyDetail) []ManagedPolicy {
+	result := []ManagedPolicy{}
+	for _, p := range attached {
+		doc, ok := a.policyMap.Load(p.PolicyArn)
+		if !ok {
+			a.log.With("entity", entity, "policy", p.PolicyArn).Warn("attached managed policy isn't included in the authorization details, skipping it")
+			continue
+		}
+		result = append(result, ManagedPolicy{ARN: p.PolicyArn, Document: doc.(policies.AWSIAMPolicy)})
+	}
+	return result
+}
+
+// offlineBoundary looks up the document of a permissions boundary.
+// Returns nil if the entity doesn't have a boundary, or if its
+// document wasn't loaded.
+func (a *Auditor) offlineBoundary(entity string, b *PermissionsBoundaryDetail) *ManagedPolicy {
+	if b == nil || b.PermissionsBoundaryArn == "" {
+		return nil
+	}
+	doc, ok := a.policyMap.Load(b.PermissionsBoundaryArn)
+	if !ok {
+		a.log.With("entity", entity, "policy", b.PermissionsBoundaryArn).Warn("permissions boundary isn't included in the authorization details, skipping it")
+		return nil
+	}
+	return &ManagedPolicy{ARN: b.PermissionsBoundaryArn, Document: doc.(policies.AWSIAMPolicy)}
+}
+
+func offlineInlinePolicies(list []InlinePolicyDetail) ([]InlinePolicy, error) {
+	result := []InlinePolicy{}
+	for _, p := range list {
+		var doc policies.AWSIAMPolicy
+		err := p.PolicyDocument.decode(&doc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding policy %s", p.PolicyName)
+		}
+		result = append(result, InlinePolicy{Name: p.PolicyName, Document: doc})
+	}
+	return result, nil
+}
+
+func accountIDFromARN(s string) (string, error) {
+	parsed, err := arn.Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return parsed.AccountID, nil
+}
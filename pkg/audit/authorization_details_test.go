@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadAuthorizationDetailsFile(t *testing.T) {
+	a := newTestAuditor()
+	err := a.LoadAuthorizationDetailsFile(filepath.Join("testdata", "authorization-details.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Len(t, a.GetRoles(), 2)
+	assert.Len(t, a.GetManagedPolicies(), 2)
+
+	source := a.GetRoleByARN("arn:aws:iam::123456789012:role/source")
+	if assert.NotNil(t, source) {
+		assert.Equal(t, "123456789012", source.AccountID)
+		// ReadOnlyAccess is an AWS managed policy which isn't included in the file
+		if assert.Len(t, source.ManagedPolicies, 1) {
+			// the default version of the policy is used
+			assert.Equal(t, policies.NewStringValue("sts:AssumeRole"), source.ManagedPolicies[0].Document.Statement[0].Action)
+		}
+		if assert.NotNil(t, source.PermissionsBoundary) {
+			assert.Equal(t, "arn:aws:iam::123456789012:policy/boundary", source.PermissionsBoundary.ARN)
+		}
+		assert.Equal(t, []string{"ec2.amazonaws.com"}, source.TrustPolicyDocument.Statement[0].Principal.Service.Values)
+	}
+
+	// URL-encoded documents, as returned by the API, are decoded
+	target := a.GetRoleByARN("arn:aws:iam::123456789012:role/target")
+	if assert.NotNil(t, target) {
+		assert.Equal(t, []string{"arn:aws:iam::123456789012:role/source"}, target.TrustPolicyDocument.Statement[0].Principal.AWS.Values)
+		if assert.Len(t, target.InlinePolicies, 1) {
+			assert.Equal(t, policies.NewStringValue("arn:aws:s3:::bucket/*"), target.InlinePolicies[0].Document.Statement[0].Resource)
+		}
+	}
+
+	users := a.GetUsers()
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, []string{
+			"arn:aws:iam::123456789012:group/engineering/developers",
+			"arn:aws:iam::123456789012:group/unknown",
+		}, users[0].Groups)
+		assert.Len(t, users[0].InlinePolicies, 1)
+	}
+
+	groups := a.GetGroups()
+	if assert.Len(t, groups, 1) {
+		assert.Equal(t, "developers", groups[0].Name)
+		assert.Empty(t, groups[0].ManagedPolicies)
+	}
+
+	profiles := a.GetInstanceProfiles()
+	if assert.Len(t, profiles, 1) {
+		assert.Equal(t, []string{"arn:aws:iam::123456789012:role/source"}, profiles[0].Roles)
+	}
+
+	// links can be built without calling AWS
+	a.BuildLinks()
+	links := a.GetLinks()
+	if assert.Len(t, links, 1) {
+		assert.Equal(t, "arn:aws:iam::123456789012:role/source", links[0].SourceARN)
+		assert.Equal(t, "arn:aws:iam::123456789012:role/target", links[0].TargetARN)
+	}
+}
+
+func TestLoadAuthorizationDetailsMissingDefaultVersion(t *testing.T) {
+	a := newTestAuditor()
+	err := a.LoadAuthorizationDetails(AuthorizationDetails{
+		Policies: []ManagedPolicyDetail{{Arn: "arn:aws:iam::123456789012:policy/p", DefaultVersionId: "v2"}},
+	})
+	assert.Error(t, err)
+}
@@ -1,15 +1,108 @@
 package audit
 
-// CfnTemplate is the YAML CloudFormation template
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CfnTemplate is a CloudFormation template, which may be written in JSON or YAML
 type CfnTemplate struct {
-	Conditions interface{}
-	Resources  map[string]CfnResource `yaml:"Resources"`
+	// Transform is the name of a macro, or a list of macros, which
+	// processes the template
+	Transform  interface{}            `json:"Transform" yaml:"Transform"`
+	Conditions interface{}            `json:"Conditions" yaml:"Conditions"`
+	Resources  map[string]CfnResource `json:"Resources" yaml:"Resources"`
+	Outputs    map[string]interface{} `json:"Outputs" yaml:"Outputs"`
+}
+
+// Transforms returns the names of the macros which process the template.
+func (t CfnTemplate) Transforms() []string {
+	switch v := t.Transform.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		result := []string{}
+		for _, name := range v {
+			// transforms such as AWS::Include are objects
+			if s, ok := name.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
 }
 
 type CfnResource struct {
 	Metadata struct {
-		AwsCdkPath string `yaml:"aws:cdk:path"`
-	} `yaml:"Metadata"`
-	Properties interface{}
-	Type       string `yaml:"Type"`
+		AwsCdkPath string `json:"aws:cdk:path" yaml:"aws:cdk:path"`
+	} `json:"Metadata" yaml:"Metadata"`
+	Properties interface{} `json:"Properties" yaml:"Properties"`
+	Type       string      `json:"Type" yaml:"Type"`
+}
+
+// ParseCfnTemplate parses a CloudFormation template body in either JSON or
+// YAML format. Short-form intrinsic functions in YAML templates, such as
+// `!Ref Bucket`, are expanded into their full form (`{"Ref": "Bucket"}`)
+// so that resource properties are the same regardless of the format.
+func ParseCfnTemplate(body []byte) (CfnTemplate, error) {
+	var tmpl CfnTemplate
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		err := json.Unmarshal(trimmed, &tmpl)
+		return tmpl, err
+	}
+
+	var doc yaml.Node
+	err := yaml.Unmarshal(body, &doc)
+	if err != nil {
+		return tmpl, err
+	}
+	expandShortFormIntrinsics(&doc)
+	err = doc.Decode(&tmpl)
+	return tmpl, err
+}
+
+// expandShortFormIntrinsics replaces YAML nodes tagged with a short-form
+// intrinsic function such as `!GetAtt Role.Arn` with the full form
+// mapping, e.g. `Fn::GetAtt: [Role, Arn]`.
+func expandShortFormIntrinsics(n *yaml.Node) {
+	for _, child := range n.Content {
+		expandShortFormIntrinsics(child)
+	}
+
+	if !strings.HasPrefix(n.Tag, "!") || strings.HasPrefix(n.Tag, "!!") {
+		return
+	}
+
+	fn := strings.TrimPrefix(n.Tag, "!")
+	key := "Fn::" + fn
+	if fn == "Ref" || fn == "Condition" {
+		key = fn
+	}
+
+	value := *n
+	value.Tag = ""
+	value.Style &^= yaml.TaggedStyle
+	if fn == "GetAtt" && n.Kind == yaml.ScalarNode {
+		// `!GetAtt Resource.Attribute` is a string, while the full form
+		// takes a list of the resource and the attribute.
+		split := strings.SplitN(n.Value, ".", 2)
+		value = yaml.Node{Kind: yaml.SequenceNode}
+		for _, s := range split {
+			value.Content = append(value.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: s})
+		}
+	}
+
+	*n = yaml.Node{
+		Kind: yaml.MappingNode,
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: key},
+			&value,
+		},
+	}
 }
@@ -3,6 +3,7 @@ package audit
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -13,9 +14,43 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/common-fate/iamzero/pkg/policies"
-	"gopkg.in/yaml.v3"
 )
 
+// CloudFormationAPI is the subset of the CloudFormation API used by the
+// auditor to load stacks. It is satisfied by *cloudformation.Client.
+type CloudFormationAPI interface {
+	cloudformation.ListStacksAPIClient
+	cloudformation.ListStackResourcesAPIClient
+	GetTemplate(ctx context.Context, params *cloudformation.GetTemplateInput, optFns ...func(*cloudformation.Options)) (*cloudformation.GetTemplateOutput, error)
+}
+
+const (
+	cdkMetadataType = "AWS::CDK::Metadata"
+	nestedStackType = "AWS::CloudFormation::Stack"
+	iamRoleType     = "AWS::IAM::Role"
+
+	// samTransform is the transform which processes SAM templates
+	samTransform      = "AWS::Serverless-2016-10-31"
+	samResourcePrefix = "AWS::Serverless::"
+)
+
+// defaultStackStatuses are the statuses of the stacks which are loaded if
+// no statuses are passed with the -audit-stack-status flag. Deleted stacks,
+// and stacks which failed to create, don't have any resources.
+var defaultStackStatuses = []types.StackStatus{
+	types.StackStatusCreateComplete,
+	types.StackStatusUpdateInProgress,
+	types.StackStatusUpdateCompleteCleanupInProgress,
+	types.StackStatusUpdateComplete,
+	types.StackStatusUpdateRollbackInProgress,
+	types.StackStatusUpdateRollbackFailed,
+	types.StackStatusUpdateRollbackCompleteCleanupInProgress,
+	types.StackStatusUpdateRollbackComplete,
+	types.StackStatusDeleteFailed,
+	types.StackStatusImportComplete,
+	types.StackStatusImportRollbackComplete,
+}
+
 func (a *Auditor) LoadCloudFormationStacks(ctx context.Context) error {
 	if len(a.auditRoles) == 0 {
 		return errors.New("no audit roles supplied")
@@ -35,88 +70,271 @@ func (a *Auditor) LoadCloudFormationStacks(ctx context.Context) error {
 		// Create service client value configured for credentials
 		// from assumed role.
 		client := cloudformation.NewFromConfig(cfg)
-		output, err := client.ListStacks(ctx, &cloudformation.ListStacksInput{})
+
+		err = a.loadStacks(ctx, client)
+		if err != nil {
+			return fmt.Errorf("loading stacks with role %s: %w", role, err)
+		}
+	}
+	return nil
+}
+
+// loadStacks loads the resources defined in CDK stacks in an account,
+// and the source of every role managed by CloudFormation.
+// Nested stacks are loaded along with the root stack which contains them.
+func (a *Auditor) loadStacks(ctx context.Context, client CloudFormationAPI) error {
+	statuses := defaultStackStatuses
+	if len(a.stackStatuses) > 0 {
+		statuses = []types.StackStatus{}
+		for _, s := range a.stackStatuses {
+			statuses = append(statuses, types.StackStatus(s))
+		}
+	}
+
+	var summaries []types.StackSummary
+	p := cloudformation.NewListStacksPaginator(client, &cloudformation.ListStacksInput{
+		StackStatusFilter: statuses,
+	})
+	for p.HasMorePages() {
+		err := a.withRetry(ctx, func(ctx context.Context) error {
+			page, err := p.NextPage(ctx)
+			if err == nil {
+				summaries = append(summaries, page.StackSummaries...)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	stacks := map[string]types.StackSummary{}
+	for _, s := range summaries {
+		stacks[aws.ToString(s.StackId)] = s
+	}
+
+	cdkStacks := []string{}
+	for _, s := range summaries {
+		if s.ParentId != nil {
+			continue
+		}
+		loaded, err := a.loadStack(ctx, client, stacks, s, false)
 		if err != nil {
 			return err
 		}
+		cdkStacks = append(cdkStacks, loaded...)
+	}
+	a.log.With("cdkStacks", cdkStacks).Debug("found CDK stacks")
+	return nil
+}
 
-		cdkStacks := []types.StackSummary{}
+// loadStack loads the resources in a stack and the stacks nested within
+// it, returning the names of the stacks which were defined using CDK.
+//
+// CDK only adds metadata to root stacks, so nested stacks are treated
+// as CDK stacks if their parent is.
+func (a *Auditor) loadStack(ctx context.Context, client CloudFormationAPI, stacks map[string]types.StackSummary, stack types.StackSummary, parentIsCDK bool) ([]string, error) {
+	// extract the AWS account ID from the stack ID
+	stackARN, err := arn.Parse(aws.ToString(stack.StackId))
+	if err != nil {
+		return nil, err
+	}
 
-		for _, stack := range output.StackSummaries {
-			// extract the AWS account ID from the role
-			stackARN, err := arn.Parse(*stack.StackId)
-			if err != nil {
-				return err
+	a.log.With("stack", stack.StackName).Debug("listing stack resources")
+	var resources []types.StackResourceSummary
+	p := cloudformation.NewListStackResourcesPaginator(client, &cloudformation.ListStackResourcesInput{
+		StackName: stack.StackId,
+	})
+	for p.HasMorePages() {
+		err := a.withRetry(ctx, func(ctx context.Context) error {
+			page, err := p.NextPage(ctx)
+			if err == nil {
+				resources = append(resources, page.StackResourceSummaries...)
 			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
 
-			a.log.With("stack", stack.StackName).Debug("listing stack resources")
-			resources, err := client.ListStackResources(ctx, &cloudformation.ListStackResourcesInput{
-				StackName: stack.StackId,
-			})
-			if err != nil {
-				return err
+	isCDKStack := parentIsCDK
+	roles := []types.StackResourceSummary{}
+	for _, r := range resources {
+		switch aws.ToString(r.ResourceType) {
+		case cdkMetadataType:
+			// the CloudFormation stack has been defined using CDK
+			isCDKStack = true
+		case iamRoleType:
+			if r.PhysicalResourceId != nil {
+				roles = append(roles, r)
 			}
+		}
+	}
 
-			cdkResourcesInStack := []*policies.CDKResource{}
-			isCDKStack := false
+	cdkStacks := []string{}
+	// the template is only needed to find where CDK resources and roles are defined
+	if isCDKStack || len(roles) > 0 {
+		tmpl, err := a.getStackTemplate(ctx, client, stack)
+		if err != nil {
+			return nil, err
+		}
 
-			for _, r := range resources.StackResourceSummaries {
-				if *r.ResourceType == "AWS::CDK::Metadata" {
-					// the CloudFormation stack has been defined using CDK
-					cdkStacks = append(cdkStacks, stack)
-					isCDKStack = true
-				}
-			}
-			if isCDKStack {
-				for _, r := range resources.StackResourceSummaries {
-					a.log.With("resource", r).Debug("adding CDK resource")
-					// the CDK metadata is not a real cloud resource like an IAM role or an S3 bucket,
-					// so we don't worry about tracking it.
-					if *r.ResourceType != "AWS::CDK::Metadata" {
-						res := policies.CDKResource{
-							Type:       *r.ResourceType,
-							StackID:    *stack.StackId,
-							LogicalID:  *r.LogicalResourceId,
-							PhysicalID: *r.PhysicalResourceId,
-							AccountID:  stackARN.AccountID,
-						}
-						cdkResourcesInStack = append(cdkResourcesInStack, &res)
-					}
-				}
-
-				// we need to look up the raw template of the stack in order to find the CDK path metadata for
-				// the resources defined in the CDK, in order to provide recommendations directly against
-				// the CDK source code.
-				tmpl, err := client.GetTemplate(ctx, &cloudformation.GetTemplateInput{
-					StackName: stack.StackId,
-				})
-				if err != nil {
-					return err
-				}
-
-				var obj CfnTemplate
-				err = yaml.Unmarshal([]byte(*tmpl.TemplateBody), &obj)
-				if err != nil {
-					return err
-				}
-
-				for _, r := range cdkResourcesInStack {
-					path := obj.Resources[r.LogicalID].Metadata.AwsCdkPath
-					id := parseIDFromCDKPath(path)
-
-					r.CDKPath = path
-					r.CDKID = id
-
-					a.cdkResources.Add(*r)
-				}
-
-				a.log.With("tmpl", obj).Debug("got template")
+		if isCDKStack {
+			cdkStacks = append(cdkStacks, aws.ToString(stack.StackName))
+			a.addCDKResources(stack, stackARN.AccountID, resources, tmpl.processed)
+		}
+
+		framework := stackFramework(isCDKStack, tmpl, resources)
+		for _, r := range roles {
+			logicalID := aws.ToString(r.LogicalResourceId)
+			a.iacSources.Add(policies.IaCSource{
+				Framework:    framework,
+				StackID:      aws.ToString(stack.StackId),
+				StackName:    aws.ToString(stack.StackName),
+				LogicalID:    logicalID,
+				PhysicalID:   aws.ToString(r.PhysicalResourceId),
+				AccountID:    stackARN.AccountID,
+				Type:         aws.ToString(r.ResourceType),
+				TemplatePath: tmpl.templatePath(framework, logicalID),
+			})
+		}
+	}
+
+	for _, r := range resources {
+		if aws.ToString(r.ResourceType) != nestedStackType {
+			continue
+		}
+		// the physical ID of a nested stack resource is the nested stack's ID
+		nested, ok := stacks[aws.ToString(r.PhysicalResourceId)]
+		if !ok {
+			a.log.With("stack", stack.StackName, "nestedStack", r.PhysicalResourceId).Debug("skipping nested stack which doesn't match the stack status filter")
+			continue
+		}
+		loaded, err := a.loadStack(ctx, client, stacks, nested, isCDKStack)
+		if err != nil {
+			return nil, err
+		}
+		cdkStacks = append(cdkStacks, loaded...)
+	}
+	return cdkStacks, nil
+}
+
+// addCDKResources adds the resources in a CDK stack to the auditor's
+// cache, along with the CDK path of each resource.
+func (a *Auditor) addCDKResources(stack types.StackSummary, accountID string, resources []types.StackResourceSummary, tmpl CfnTemplate) {
+	for _, r := range resources {
+		a.log.With("resource", r).Debug("adding CDK resource")
+		// the CDK metadata is not a real cloud resource like an IAM role or an S3 bucket,
+		// so we don't worry about tracking it.
+		if aws.ToString(r.ResourceType) == cdkMetadataType {
+			continue
+		}
+		res := policies.CDKResource{
+			Type:       aws.ToString(r.ResourceType),
+			StackID:    aws.ToString(stack.StackId),
+			LogicalID:  aws.ToString(r.LogicalResourceId),
+			PhysicalID: aws.ToString(r.PhysicalResourceId),
+			AccountID:  accountID,
+		}
+		res.CDKPath = tmpl.Resources[res.LogicalID].Metadata.AwsCdkPath
+		res.CDKID = parseIDFromCDKPath(res.CDKPath)
+
+		a.cdkResources.Add(res)
+	}
+}
+
+// stackTemplate holds the template of a stack as it was submitted, and
+// after any transforms such as SAM were processed.
+type stackTemplate struct {
+	original  CfnTemplate
+	processed CfnTemplate
+}
+
+// getStackTemplate looks up the raw template of a stack. The template
+// contains the CDK path metadata for resources defined in the CDK, which
+// we need in order to provide recommendations directly against the CDK
+// source code. The processed template is only fetched if the stack uses
+// transforms, so that the logical IDs of resources created by transforms
+// can be found.
+func (a *Auditor) getStackTemplate(ctx context.Context, client CloudFormationAPI, stack types.StackSummary) (stackTemplate, error) {
+	original, err := a.getTemplate(ctx, client, stack, types.TemplateStageOriginal)
+	if err != nil {
+		return stackTemplate{}, err
+	}
+	tmpl := stackTemplate{original: original, processed: original}
+	if len(original.Transforms()) > 0 {
+		tmpl.processed, err = a.getTemplate(ctx, client, stack, types.TemplateStageProcessed)
+	}
+	a.log.With("stack", stack.StackName, "tmpl", tmpl.processed).Debug("got template")
+	return tmpl, err
+}
+
+func (a *Auditor) getTemplate(ctx context.Context, client CloudFormationAPI, stack types.StackSummary, stage types.TemplateStage) (CfnTemplate, error) {
+	var out *cloudformation.GetTemplateOutput
+	err := a.withRetry(ctx, func(ctx context.Context) error {
+		var err error
+		out, err = client.GetTemplate(ctx, &cloudformation.GetTemplateInput{
+			StackName:     stack.StackId,
+			TemplateStage: stage,
+		})
+		return err
+	})
+	if err != nil {
+		return CfnTemplate{}, err
+	}
+
+	tmpl, err := ParseCfnTemplate([]byte(aws.ToString(out.TemplateBody)))
+	if err != nil {
+		return tmpl, fmt.Errorf("parsing %s template for stack %s: %w", stage, aws.ToString(stack.StackName), err)
+	}
+	return tmpl, nil
+}
+
+// stackFramework returns the framework which was used to define a stack.
+func stackFramework(isCDKStack bool, tmpl stackTemplate, resources []types.StackResourceSummary) policies.IaCFramework {
+	if isCDKStack {
+		return policies.IaCFrameworkCDK
+	}
+	for _, t := range tmpl.original.Transforms() {
+		if t == samTransform {
+			return policies.IaCFrameworkSAM
+		}
+	}
+	// the Serverless Framework adds a bucket to each stack which it
+	// uploads deployment artifacts to, unless a bucket is configured
+	if _, ok := tmpl.original.Outputs["ServerlessDeploymentBucketName"]; ok {
+		return policies.IaCFrameworkServerless
+	}
+	for _, r := range resources {
+		if aws.ToString(r.LogicalResourceId) == "ServerlessDeploymentBucket" {
+			return policies.IaCFrameworkServerless
+		}
+	}
+	return policies.IaCFrameworkCloudFormation
+}
+
+// templatePath locates a resource in the source of the stack's template,
+// returning an empty string if it isn't known.
+func (t stackTemplate) templatePath(framework policies.IaCFramework, logicalID string) string {
+	switch framework {
+	case policies.IaCFrameworkCDK:
+		return t.processed.Resources[logicalID].Metadata.AwsCdkPath
+	case policies.IaCFrameworkSAM:
+		if _, ok := t.original.Resources[logicalID]; ok {
+			return ""
+		}
+		// resources generated by the SAM transform, such as the role of a
+		// function, are named after the SAM resource which generated them
+		source := ""
+		for id, r := range t.original.Resources {
+			if strings.HasPrefix(r.Type, samResourcePrefix) && strings.HasPrefix(logicalID, id) && len(id) > len(source) {
+				source = id
 			}
 		}
-		a.log.With("cdkStacks", cdkStacks).Debug("found CDK stacks")
-		// a.log.With("cdkResources", cdkResources).Debug("found CDK resources")
+		return source
 	}
-	return nil
+	return ""
 }
 
 // parseIDFromCDKPath gets the CDK ID of a resource (as used in CDK source code)
@@ -128,7 +346,7 @@ func (a *Auditor) LoadCloudFormationStacks(ctx context.Context) error {
 // Returns an empty string if parsing fails.
 func parseIDFromCDKPath(path string) string {
 	split := strings.Split(path, "/")
-	if len(split) < 1 {
+	if len(split) < 2 {
 		return ""
 	}
 	// the last entry in the path is "Resource", so we want to take the second last.
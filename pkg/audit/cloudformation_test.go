@@ -1,8 +1,15 @@
 package audit
 
 import (
+	"context"
+	"sort"
+	"strconv"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/common-fate/iamzero/pkg/policies"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -12,3 +19,360 @@ func Test_parseIDFromCDKPath_works(t *testing.T) {
 
 	assert.Equal(t, "iamzero-example-role", result)
 }
+
+func Test_parseIDFromCDKPath_empty(t *testing.T) {
+	assert.Equal(t, "", parseIDFromCDKPath(""))
+}
+
+const yamlTemplate = `
+Conditions:
+  IsProd: !Equals [!Ref Stage, prod]
+Resources:
+  Role:
+    Type: AWS::IAM::Role
+    Metadata:
+      aws:cdk:path: Stack/Role/Resource
+    Properties:
+      RoleName: !Sub "${AWS::StackName}-role"
+      Path: /
+  Policy:
+    Type: AWS::IAM::Policy
+    Condition: IsProd
+    Properties:
+      Roles:
+        - !Ref Role
+      PolicyDocument:
+        Statement:
+          - Effect: Allow
+            Action: s3:GetObject
+            Resource: !GetAtt Bucket.Arn
+`
+
+func TestParseCfnTemplate_YAML(t *testing.T) {
+	tmpl, err := ParseCfnTemplate([]byte(yamlTemplate))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "Stack/Role/Resource", tmpl.Resources["Role"].Metadata.AwsCdkPath)
+	assert.Equal(t, map[string]interface{}{
+		"IsProd": map[string]interface{}{"Fn::Equals": []interface{}{map[string]interface{}{"Ref": "Stage"}, "prod"}},
+	}, tmpl.Conditions)
+	assert.Equal(t, map[string]interface{}{
+		"RoleName": map[string]interface{}{"Fn::Sub": "${AWS::StackName}-role"},
+		"Path":     "/",
+	}, tmpl.Resources["Role"].Properties)
+
+	props := tmpl.Resources["Policy"].Properties.(map[string]interface{})
+	assert.Equal(t, []interface{}{map[string]interface{}{"Ref": "Role"}}, props["Roles"])
+	statement := props["PolicyDocument"].(map[string]interface{})["Statement"].([]interface{})[0]
+	assert.Equal(t, map[string]interface{}{"Fn::GetAtt": []interface{}{"Bucket", "Arn"}}, statement.(map[string]interface{})["Resource"])
+}
+
+func TestParseCfnTemplate_JSON(t *testing.T) {
+	body := `{
+	"Resources": {
+		"Role": {
+			"Type": "AWS::IAM::Role",
+			"Metadata": {"aws:cdk:path": "Stack/Role/Resource"},
+			"Properties": {"RoleName": {"Fn::Sub": "${AWS::StackName}-role"}}
+		}
+	}
+}`
+	tmpl, err := ParseCfnTemplate([]byte(body))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "AWS::IAM::Role", tmpl.Resources["Role"].Type)
+	assert.Equal(t, "Stack/Role/Resource", tmpl.Resources["Role"].Metadata.AwsCdkPath)
+	assert.Equal(t, map[string]interface{}{
+		"RoleName": map[string]interface{}{"Fn::Sub": "${AWS::StackName}-role"},
+	}, tmpl.Resources["Role"].Properties)
+}
+
+type fakeStack struct {
+	summary   types.StackSummary
+	resources []types.StackResourceSummary
+	template  string
+	// processed is the template after transforms have been processed,
+	// if the stack uses transforms
+	processed string
+}
+
+// fakeCloudFormation is an in-memory implementation of CloudFormationAPI.
+// List responses contain a single item per page.
+type fakeCloudFormation struct {
+	stacks []fakeStack
+}
+
+func (f *fakeCloudFormation) stack(id *string) *fakeStack {
+	for i := range f.stacks {
+		if aws.ToString(f.stacks[i].summary.StackId) == aws.ToString(id) {
+			return &f.stacks[i]
+		}
+	}
+	return nil
+}
+
+// fakePage returns the index of the item for a page, and the next token.
+func fakePage(token *string, n int) (int, *string) {
+	i, _ := strconv.Atoi(aws.ToString(token))
+	if i+1 < n {
+		return i, aws.String(strconv.Itoa(i + 1))
+	}
+	return i, nil
+}
+
+func (f *fakeCloudFormation) ListStacks(ctx context.Context, params *cloudformation.ListStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ListStacksOutput, error) {
+	var matching []types.StackSummary
+	for _, s := range f.stacks {
+		for _, status := range params.StackStatusFilter {
+			if s.summary.StackStatus == status {
+				matching = append(matching, s.summary)
+			}
+		}
+	}
+	out := &cloudformation.ListStacksOutput{}
+	if len(matching) == 0 {
+		return out, nil
+	}
+	i, next := fakePage(params.NextToken, len(matching))
+	out.StackSummaries = matching[i : i+1]
+	out.NextToken = next
+	return out, nil
+}
+
+func (f *fakeCloudFormation) ListStackResources(ctx context.Context, params *cloudformation.ListStackResourcesInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ListStackResourcesOutput, error) {
+	s := f.stack(params.StackName)
+	out := &cloudformation.ListStackResourcesOutput{}
+	if s == nil || len(s.resources) == 0 {
+		return out, nil
+	}
+	i, next := fakePage(params.NextToken, len(s.resources))
+	out.StackResourceSummaries = s.resources[i : i+1]
+	out.NextToken = next
+	return out, nil
+}
+
+func (f *fakeCloudFormation) GetTemplate(ctx context.Context, params *cloudformation.GetTemplateInput, optFns ...func(*cloudformation.Options)) (*cloudformation.GetTemplateOutput, error) {
+	s := f.stack(params.StackName)
+	if params.TemplateStage == types.TemplateStageProcessed && s.processed != "" {
+		return &cloudformation.GetTemplateOutput{TemplateBody: aws.String(s.processed)}, nil
+	}
+	return &cloudformation.GetTemplateOutput{TemplateBody: aws.String(s.template)}, nil
+}
+
+func stackResource(logicalID, physicalID, resourceType string) types.StackResourceSummary {
+	return types.StackResourceSummary{
+		LogicalResourceId:  aws.String(logicalID),
+		PhysicalResourceId: aws.String(physicalID),
+		ResourceType:       aws.String(resourceType),
+	}
+}
+
+func TestLoadStacks(t *testing.T) {
+	const (
+		rootID    = "arn:aws:cloudformation:us-east-1:123456789012:stack/Root/1"
+		nestedID  = "arn:aws:cloudformation:us-east-1:123456789012:stack/Root-Nested/2"
+		deletedID = "arn:aws:cloudformation:us-east-1:123456789012:stack/Deleted/3"
+		plainID   = "arn:aws:cloudformation:us-east-1:123456789012:stack/Plain/4"
+	)
+
+	client := &fakeCloudFormation{stacks: []fakeStack{
+		{
+			summary: types.StackSummary{StackId: aws.String(rootID), StackName: aws.String("Root"), StackStatus: types.StackStatusUpdateComplete},
+			resources: []types.StackResourceSummary{
+				stackResource("CDKMetadata", "metadata", cdkMetadataType),
+				stackResource("RootRole", "root-role", "AWS::IAM::Role"),
+				stackResource("NestedStack", nestedID, nestedStackType),
+			},
+			template: `{"Resources": {
+				"RootRole": {"Type": "AWS::IAM::Role", "Metadata": {"aws:cdk:path": "Root/RootRole/Resource"}},
+				"NestedStack": {"Type": "AWS::CloudFormation::Stack", "Metadata": {"aws:cdk:path": "Root/Nested.NestedStack/Nested.NestedStackResource"}}
+			}}`,
+		},
+		{
+			// CDK doesn't add metadata to nested stacks
+			summary: types.StackSummary{StackId: aws.String(nestedID), StackName: aws.String("Root-Nested"), StackStatus: types.StackStatusCreateComplete, ParentId: aws.String(rootID)},
+			resources: []types.StackResourceSummary{
+				stackResource("NestedRole", "nested-role", "AWS::IAM::Role"),
+			},
+			template: `
+Resources:
+  NestedRole:
+    Type: AWS::IAM::Role
+    Metadata:
+      aws:cdk:path: Root/Nested/NestedRole/Resource
+    Properties:
+      Path: !Ref AWS::NoValue
+`,
+		},
+		{
+			summary: types.StackSummary{StackId: aws.String(deletedID), StackName: aws.String("Deleted"), StackStatus: types.StackStatusDeleteComplete},
+			resources: []types.StackResourceSummary{
+				stackResource("CDKMetadata", "metadata", cdkMetadataType),
+				stackResource("DeletedRole", "deleted-role", "AWS::IAM::Role"),
+			},
+		},
+		{
+			summary: types.StackSummary{StackId: aws.String(plainID), StackName: aws.String("Plain"), StackStatus: types.StackStatusCreateComplete},
+			resources: []types.StackResourceSummary{
+				stackResource("PlainRole", "plain-role", "AWS::IAM::Role"),
+			},
+			template: `{"Resources": {"PlainRole": {"Type": "AWS::IAM::Role"}}}`,
+		},
+	}}
+
+	a := newTestAuditor()
+	err := a.loadStacks(context.Background(), client)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	resources := a.cdkResources.List()
+	sort.Slice(resources, func(i, j int) bool { return resources[i].LogicalID < resources[j].LogicalID })
+	want := []policies.CDKResource{
+		{
+			StackID:    nestedID,
+			LogicalID:  "NestedRole",
+			PhysicalID: "nested-role",
+			AccountID:  "123456789012",
+			CDKPath:    "Root/Nested/NestedRole/Resource",
+			CDKID:      "NestedRole",
+			Type:       "AWS::IAM::Role",
+		},
+		{
+			StackID:    rootID,
+			LogicalID:  "NestedStack",
+			PhysicalID: nestedID,
+			AccountID:  "123456789012",
+			CDKPath:    "Root/Nested.NestedStack/Nested.NestedStackResource",
+			CDKID:      "Nested.NestedStack",
+			Type:       nestedStackType,
+		},
+		{
+			StackID:    rootID,
+			LogicalID:  "RootRole",
+			PhysicalID: "root-role",
+			AccountID:  "123456789012",
+			CDKPath:    "Root/RootRole/Resource",
+			CDKID:      "RootRole",
+			Type:       "AWS::IAM::Role",
+		},
+	}
+	assert.Equal(t, want, resources)
+
+	sources := a.iacSources.List()
+	sort.Slice(sources, func(i, j int) bool { return sources[i].LogicalID < sources[j].LogicalID })
+	assert.Equal(t, []policies.IaCSource{
+		{
+			Framework:    policies.IaCFrameworkCDK,
+			StackID:      nestedID,
+			StackName:    "Root-Nested",
+			LogicalID:    "NestedRole",
+			PhysicalID:   "nested-role",
+			AccountID:    "123456789012",
+			Type:         "AWS::IAM::Role",
+			TemplatePath: "Root/Nested/NestedRole/Resource",
+		},
+		{
+			Framework:  policies.IaCFrameworkCloudFormation,
+			StackID:    plainID,
+			StackName:  "Plain",
+			LogicalID:  "PlainRole",
+			PhysicalID: "plain-role",
+			AccountID:  "123456789012",
+			Type:       "AWS::IAM::Role",
+		},
+		{
+			Framework:    policies.IaCFrameworkCDK,
+			StackID:      rootID,
+			StackName:    "Root",
+			LogicalID:    "RootRole",
+			PhysicalID:   "root-role",
+			AccountID:    "123456789012",
+			Type:         "AWS::IAM::Role",
+			TemplatePath: "Root/RootRole/Resource",
+		},
+	}, sources)
+}
+
+func TestLoadStacks_Frameworks(t *testing.T) {
+	const (
+		samID        = "arn:aws:cloudformation:us-east-1:123456789012:stack/sam-app/1"
+		serverlessID = "arn:aws:cloudformation:us-east-1:123456789012:stack/service-dev/2"
+	)
+
+	client := &fakeCloudFormation{stacks: []fakeStack{
+		{
+			summary: types.StackSummary{StackId: aws.String(samID), StackName: aws.String("sam-app"), StackStatus: types.StackStatusCreateComplete},
+			resources: []types.StackResourceSummary{
+				stackResource("HelloFunction", "sam-app-HelloFunction", "AWS::Lambda::Function"),
+				stackResource("HelloFunctionRole", "sam-app-HelloFunctionRole", "AWS::IAM::Role"),
+				stackResource("SharedRole", "sam-app-SharedRole", "AWS::IAM::Role"),
+			},
+			template: `
+Transform: AWS::Serverless-2016-10-31
+Resources:
+  Hello:
+    Type: AWS::Serverless::Api
+  HelloFunction:
+    Type: AWS::Serverless::Function
+    Properties:
+      Handler: app.handler
+  SharedRole:
+    Type: AWS::IAM::Role
+`,
+			processed: `{"Resources": {
+				"HelloFunction": {"Type": "AWS::Lambda::Function"},
+				"HelloFunctionRole": {"Type": "AWS::IAM::Role"},
+				"SharedRole": {"Type": "AWS::IAM::Role"}
+			}}`,
+		},
+		{
+			summary: types.StackSummary{StackId: aws.String(serverlessID), StackName: aws.String("service-dev"), StackStatus: types.StackStatusUpdateComplete},
+			resources: []types.StackResourceSummary{
+				stackResource("ServerlessDeploymentBucket", "service-dev-serverlessdeploymentbucket", "AWS::S3::Bucket"),
+				stackResource("IamRoleLambdaExecution", "service-dev-us-east-1-lambdaRole", "AWS::IAM::Role"),
+			},
+			template: `{
+				"Resources": {"IamRoleLambdaExecution": {"Type": "AWS::IAM::Role"}},
+				"Outputs": {"ServerlessDeploymentBucketName": {"Value": {"Ref": "ServerlessDeploymentBucket"}}}
+			}`,
+		},
+	}}
+
+	a := newTestAuditor()
+	err := a.loadStacks(context.Background(), client)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// stacks which weren't defined with CDK don't have CDK resources
+	assert.Empty(t, a.cdkResources.List())
+
+	assert.Equal(t, &policies.IaCSource{
+		Framework:    policies.IaCFrameworkSAM,
+		StackID:      samID,
+		StackName:    "sam-app",
+		LogicalID:    "HelloFunctionRole",
+		PhysicalID:   "sam-app-HelloFunctionRole",
+		AccountID:    "123456789012",
+		Type:         "AWS::IAM::Role",
+		TemplatePath: "HelloFunction",
+	}, a.GetIaCSource("123456789012", "sam-app-HelloFunctionRole"))
+
+	shared := a.GetIaCSource("123456789012", "sam-app-SharedRole")
+	if assert.NotNil(t, shared) {
+		assert.Equal(t, policies.IaCFrameworkSAM, shared.Framework)
+		assert.Equal(t, "", shared.TemplatePath)
+	}
+
+	lambdaRole := a.GetIaCSource("123456789012", "service-dev-us-east-1-lambdaRole")
+	if assert.NotNil(t, lambdaRole) {
+		assert.Equal(t, policies.IaCFrameworkServerless, lambdaRole.Framework)
+		assert.Equal(t, "IamRoleLambdaExecution", lambdaRole.LogicalID)
+	}
+
+	assert.Nil(t, a.GetIaCSource("999999999999", "sam-app-SharedRole"))
+}
@@ -0,0 +1,479 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/common-fate/iamzero/pkg/policies"
+)
+
+// fakeAPIError is returned by the fake IAM API, and implements the
+// ErrorCode method of AWS API errors.
+type fakeAPIError struct {
+	code string
+}
+
+func (e *fakeAPIError) Error() string     { return e.code }
+func (e *fakeAPIError) ErrorCode() string { return e.code }
+
+type fakePolicy struct {
+	name     string
+	document policies.AWSIAMPolicy
+	// raw, if set, is returned as the policy document instead of `document`
+	raw string
+	// attached is false for policies which are only used as a permissions boundary
+	attached bool
+}
+
+type fakeEntity struct {
+	name     string
+	attached []string
+	inline   map[string]policies.AWSIAMPolicy
+	// boundary is the ARN of the entity's permissions boundary
+	boundary string
+	// groups holds the names of the groups a user is a member of
+	groups []string
+	// trust is the trust policy of a role
+	trust policies.AWSIAMPolicy
+}
+
+// fakeIAM is an in-memory implementation of IAMAPI for a single account.
+// List responses are paginated using pageSize, and the first `throttle`
+// requests fail with a throttling error.
+type fakeIAM struct {
+	accountID        string
+	pageSize         int
+	policies         map[string]fakePolicy
+	policyOrder      []string
+	roles            []fakeEntity
+	users            []fakeEntity
+	groups           []fakeEntity
+	instanceProfiles map[string][]string
+
+	mu          sync.Mutex
+	throttle    int
+	inFlight    int
+	maxInFlight int
+	calls       int
+}
+
+func newFakeIAM(accountID string) *fakeIAM {
+	return &fakeIAM{
+		accountID:        accountID,
+		pageSize:         2,
+		policies:         map[string]fakePolicy{},
+		instanceProfiles: map[string][]string{},
+	}
+}
+
+func (f *fakeIAM) arn(resource string) string {
+	return fmt.Sprintf("arn:aws:iam::%s:%s", f.accountID, resource)
+}
+
+func (f *fakeIAM) addPolicy(name string, doc policies.AWSIAMPolicy, attached bool) string {
+	a := f.arn("policy/" + name)
+	f.policies[a] = fakePolicy{name: name, document: doc, attached: attached}
+	f.policyOrder = append(f.policyOrder, a)
+	return a
+}
+
+// enter records a request, returning a throttling error if the
+// request should be throttled.
+func (f *fakeIAM) enter() error {
+	f.mu.Lock()
+	f.calls++
+	if f.throttle > 0 {
+		f.throttle--
+		f.mu.Unlock()
+		return &fakeAPIError{code: "Throttling"}
+	}
+	f.inFlight++
+	if f.inFlight > f.maxInFlight {
+		f.maxInFlight = f.inFlight
+	}
+	f.mu.Unlock()
+	// give concurrent requests a chance to overlap
+	time.Sleep(time.Millisecond)
+	return nil
+}
+
+func (f *fakeIAM) exit() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inFlight--
+}
+
+// page returns the bounds of the page starting at marker, and the marker
+// of the next page if the results are truncated.
+func (f *fakeIAM) page(n int, marker *string) (start, end int, next *string) {
+	if marker != nil {
+		start, _ = strconv.Atoi(*marker)
+	}
+	end = start + f.pageSize
+	if end >= n {
+		return start, n, nil
+	}
+	return start, end, aws.String(strconv.Itoa(end))
+}
+
+func encodeDocument(v interface{}) *string {
+	b, _ := json.Marshal(v)
+	return aws.String(url.QueryEscape(string(b)))
+}
+
+func findEntity(entities []fakeEntity, name *string) (fakeEntity, error) {
+	for _, e := range entities {
+		if e.name == aws.ToString(name) {
+			return e, nil
+		}
+	}
+	return fakeEntity{}, &fakeAPIError{code: "NoSuchEntity"}
+}
+
+func (f *fakeIAM) ListPolicies(ctx context.Context, params *iam.ListPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListPoliciesOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	var ps []types.Policy
+	for _, a := range f.policyOrder {
+		p := f.policies[a]
+		if params.OnlyAttached && !p.attached {
+			continue
+		}
+		ps = append(ps, types.Policy{Arn: aws.String(a), PolicyName: aws.String(p.name), DefaultVersionId: aws.String("v1")})
+	}
+	start, end, next := f.page(len(ps), params.Marker)
+	return &iam.ListPoliciesOutput{Policies: ps[start:end], Marker: next, IsTruncated: next != nil}, nil
+}
+
+func (f *fakeIAM) GetPolicy(ctx context.Context, params *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	p, ok := f.policies[aws.ToString(params.PolicyArn)]
+	if !ok {
+		return nil, &fakeAPIError{code: "NoSuchEntity"}
+	}
+	return &iam.GetPolicyOutput{Policy: &types.Policy{Arn: params.PolicyArn, PolicyName: aws.String(p.name), DefaultVersionId: aws.String("v1")}}, nil
+}
+
+func (f *fakeIAM) GetPolicyVersion(ctx context.Context, params *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	p, ok := f.policies[aws.ToString(params.PolicyArn)]
+	if !ok || aws.ToString(params.VersionId) != "v1" {
+		return nil, &fakeAPIError{code: "NoSuchEntity"}
+	}
+	document := encodeDocument(p.document)
+	if p.raw != "" {
+		document = aws.String(url.QueryEscape(p.raw))
+	}
+	return &iam.GetPolicyVersionOutput{PolicyVersion: &types.PolicyVersion{Document: document, VersionId: params.VersionId}}, nil
+}
+
+func (f *fakeIAM) role(e fakeEntity) types.Role {
+	return types.Role{
+		Arn:                      aws.String(f.arn("role/" + e.name)),
+		RoleName:                 aws.String(e.name),
+		AssumeRolePolicyDocument: encodeDocument(e.trust),
+	}
+}
+
+func (f *fakeIAM) ListRoles(ctx context.Context, params *iam.ListRolesInput, optFns ...func(*iam.Options)) (*iam.ListRolesOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	start, end, next := f.page(len(f.roles), params.Marker)
+	out := &iam.ListRolesOutput{Marker: next, IsTruncated: next != nil}
+	for _, r := range f.roles[start:end] {
+		out.Roles = append(out.Roles, f.role(r))
+	}
+	return out, nil
+}
+
+func (f *fakeIAM) GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	r, err := findEntity(f.roles, params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	role := f.role(r)
+	if r.boundary != "" {
+		role.PermissionsBoundary = &types.AttachedPermissionsBoundary{PermissionsBoundaryArn: aws.String(r.boundary)}
+	}
+	return &iam.GetRoleOutput{Role: &role}, nil
+}
+
+func (f *fakeIAM) attachedPolicies(e fakeEntity, marker *string) ([]types.AttachedPolicy, *string) {
+	start, end, next := f.page(len(e.attached), marker)
+	var result []types.AttachedPolicy
+	for _, a := range e.attached[start:end] {
+		result = append(result, types.AttachedPolicy{PolicyArn: aws.String(a), PolicyName: aws.String(f.policies[a].name)})
+	}
+	return result, next
+}
+
+func (f *fakeIAM) inlinePolicyNames(e fakeEntity, marker *string) ([]string, *string) {
+	var names []string
+	for name := range e.inline {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	start, end, next := f.page(len(names), marker)
+	return names[start:end], next
+}
+
+func (f *fakeIAM) inlinePolicy(entities []fakeEntity, entity, policy *string) (*string, error) {
+	e, err := findEntity(entities, entity)
+	if err != nil {
+		return nil, err
+	}
+	doc, ok := e.inline[aws.ToString(policy)]
+	if !ok {
+		return nil, &fakeAPIError{code: "NoSuchEntity"}
+	}
+	return encodeDocument(doc), nil
+}
+
+func (f *fakeIAM) ListAttachedRolePolicies(ctx context.Context, params *iam.ListAttachedRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedRolePoliciesOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	r, err := findEntity(f.roles, params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	ps, next := f.attachedPolicies(r, params.Marker)
+	return &iam.ListAttachedRolePoliciesOutput{AttachedPolicies: ps, Marker: next, IsTruncated: next != nil}, nil
+}
+
+func (f *fakeIAM) ListRolePolicies(ctx context.Context, params *iam.ListRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListRolePoliciesOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	r, err := findEntity(f.roles, params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	names, next := f.inlinePolicyNames(r, params.Marker)
+	return &iam.ListRolePoliciesOutput{PolicyNames: names, Marker: next, IsTruncated: next != nil}, nil
+}
+
+func (f *fakeIAM) GetRolePolicy(ctx context.Context, params *iam.GetRolePolicyInput, optFns ...func(*iam.Options)) (*iam.GetRolePolicyOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	doc, err := f.inlinePolicy(f.roles, params.RoleName, params.PolicyName)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetRolePolicyOutput{PolicyDocument: doc, PolicyName: params.PolicyName, RoleName: params.RoleName}, nil
+}
+
+func (f *fakeIAM) user(e fakeEntity) types.User {
+	return types.User{Arn: aws.String(f.arn("user/" + e.name)), UserName: aws.String(e.name)}
+}
+
+func (f *fakeIAM) ListUsers(ctx context.Context, params *iam.ListUsersInput, optFns ...func(*iam.Options)) (*iam.ListUsersOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	start, end, next := f.page(len(f.users), params.Marker)
+	out := &iam.ListUsersOutput{Marker: next, IsTruncated: next != nil}
+	for _, u := range f.users[start:end] {
+		out.Users = append(out.Users, f.user(u))
+	}
+	return out, nil
+}
+
+func (f *fakeIAM) GetUser(ctx context.Context, params *iam.GetUserInput, optFns ...func(*iam.Options)) (*iam.GetUserOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	u, err := findEntity(f.users, params.UserName)
+	if err != nil {
+		return nil, err
+	}
+	user := f.user(u)
+	if u.boundary != "" {
+		user.PermissionsBoundary = &types.AttachedPermissionsBoundary{PermissionsBoundaryArn: aws.String(u.boundary)}
+	}
+	return &iam.GetUserOutput{User: &user}, nil
+}
+
+func (f *fakeIAM) ListAttachedUserPolicies(ctx context.Context, params *iam.ListAttachedUserPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedUserPoliciesOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	u, err := findEntity(f.users, params.UserName)
+	if err != nil {
+		return nil, err
+	}
+	ps, next := f.attachedPolicies(u, params.Marker)
+	return &iam.ListAttachedUserPoliciesOutput{AttachedPolicies: ps, Marker: next, IsTruncated: next != nil}, nil
+}
+
+func (f *fakeIAM) ListUserPolicies(ctx context.Context, params *iam.ListUserPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	u, err := findEntity(f.users, params.UserName)
+	if err != nil {
+		return nil, err
+	}
+	names, next := f.inlinePolicyNames(u, params.Marker)
+	return &iam.ListUserPoliciesOutput{PolicyNames: names, Marker: next, IsTruncated: next != nil}, nil
+}
+
+func (f *fakeIAM) GetUserPolicy(ctx context.Context, params *iam.GetUserPolicyInput, optFns ...func(*iam.Options)) (*iam.GetUserPolicyOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	doc, err := f.inlinePolicy(f.users, params.UserName, params.PolicyName)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetUserPolicyOutput{PolicyDocument: doc, PolicyName: params.PolicyName, UserName: params.UserName}, nil
+}
+
+func (f *fakeIAM) ListGroupsForUser(ctx context.Context, params *iam.ListGroupsForUserInput, optFns ...func(*iam.Options)) (*iam.ListGroupsForUserOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	u, err := findEntity(f.users, params.UserName)
+	if err != nil {
+		return nil, err
+	}
+	start, end, next := f.page(len(u.groups), params.Marker)
+	out := &iam.ListGroupsForUserOutput{Marker: next, IsTruncated: next != nil}
+	for _, g := range u.groups[start:end] {
+		out.Groups = append(out.Groups, f.group(fakeEntity{name: g}))
+	}
+	return out, nil
+}
+
+func (f *fakeIAM) group(e fakeEntity) types.Group {
+	return types.Group{Arn: aws.String(f.arn("group/" + e.name)), GroupName: aws.String(e.name)}
+}
+
+func (f *fakeIAM) ListGroups(ctx context.Context, params *iam.ListGroupsInput, optFns ...func(*iam.Options)) (*iam.ListGroupsOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	start, end, next := f.page(len(f.groups), params.Marker)
+	out := &iam.ListGroupsOutput{Marker: next, IsTruncated: next != nil}
+	for _, g := range f.groups[start:end] {
+		out.Groups = append(out.Groups, f.group(g))
+	}
+	return out, nil
+}
+
+func (f *fakeIAM) ListAttachedGroupPolicies(ctx context.Context, params *iam.ListAttachedGroupPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedGroupPoliciesOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	g, err := findEntity(f.groups, params.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	ps, next := f.attachedPolicies(g, params.Marker)
+	return &iam.ListAttachedGroupPoliciesOutput{AttachedPolicies: ps, Marker: next, IsTruncated: next != nil}, nil
+}
+
+func (f *fakeIAM) ListGroupPolicies(ctx context.Context, params *iam.ListGroupPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListGroupPoliciesOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	g, err := findEntity(f.groups, params.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	names, next := f.inlinePolicyNames(g, params.Marker)
+	return &iam.ListGroupPoliciesOutput{PolicyNames: names, Marker: next, IsTruncated: next != nil}, nil
+}
+
+func (f *fakeIAM) GetGroupPolicy(ctx context.Context, params *iam.GetGroupPolicyInput, optFns ...func(*iam.Options)) (*iam.GetGroupPolicyOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	doc, err := f.inlinePolicy(f.groups, params.GroupName, params.PolicyName)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetGroupPolicyOutput{PolicyDocument: doc, PolicyName: params.PolicyName, GroupName: params.GroupName}, nil
+}
+
+func (f *fakeIAM) ListInstanceProfiles(ctx context.Context, params *iam.ListInstanceProfilesInput, optFns ...func(*iam.Options)) (*iam.ListInstanceProfilesOutput, error) {
+	if err := f.enter(); err != nil {
+		return nil, err
+	}
+	defer f.exit()
+
+	var names []string
+	for name := range f.instanceProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	start, end, next := f.page(len(names), params.Marker)
+	out := &iam.ListInstanceProfilesOutput{Marker: next, IsTruncated: next != nil}
+	for _, name := range names[start:end] {
+		ip := types.InstanceProfile{Arn: aws.String(f.arn("instance-profile/" + name)), InstanceProfileName: aws.String(name)}
+		for _, r := range f.instanceProfiles[name] {
+			role, err := findEntity(f.roles, aws.String(r))
+			if err != nil {
+				return nil, err
+			}
+			ip.Roles = append(ip.Roles, f.role(role))
+		}
+		out.InstanceProfiles = append(out.InstanceProfiles, ip)
+	}
+	return out, nil
+}
@@ -0,0 +1,149 @@
+package audit
+
+import (
+	"sort"
+)
+
+// GraphNode is a principal in the assume role graph
+type GraphNode struct {
+	ARN       string        `json:"arn"`
+	AccountID string        `json:"accountId"`
+	Type      PrincipalType `json:"type"`
+}
+
+// AssumeRoleGraph is a directed graph of the roles and users in the
+// inventory, with a link from each principal to each role it can assume.
+type AssumeRoleGraph struct {
+	Nodes []GraphNode      `json:"nodes"`
+	Links []AssumeRoleLink `json:"links"`
+
+	// indexes into Links, keyed by the source and target ARN
+	outgoing map[string][]int
+	incoming map[string][]int
+}
+
+// AssumeRolePath is a chain of links through which the source principal
+// can assume the target role, by assuming each role in turn.
+type AssumeRolePath struct {
+	SourceARN string           `json:"sourceARN"`
+	TargetARN string           `json:"targetARN"`
+	Links     []AssumeRoleLink `json:"links"`
+}
+
+// NewAssumeRoleGraph builds a graph from nodes and links.
+// Nodes and links are sorted by ARN so that path searches are deterministic.
+func NewAssumeRoleGraph(nodes []GraphNode, links []AssumeRoleLink) *AssumeRoleGraph {
+	g := &AssumeRoleGraph{
+		Nodes:    append([]GraphNode{}, nodes...),
+		Links:    append([]AssumeRoleLink{}, links...),
+		outgoing: map[string][]int{},
+		incoming: map[string][]int{},
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ARN < g.Nodes[j].ARN })
+	sort.Slice(g.Links, func(i, j int) bool {
+		if g.Links[i].SourceARN != g.Links[j].SourceARN {
+			return g.Links[i].SourceARN < g.Links[j].SourceARN
+		}
+		return g.Links[i].TargetARN < g.Links[j].TargetARN
+	})
+	for i, l := range g.Links {
+		g.outgoing[l.SourceARN] = append(g.outgoing[l.SourceARN], i)
+		g.incoming[l.TargetARN] = append(g.incoming[l.TargetARN], i)
+	}
+	return g
+}
+
+// GetGraph returns the assume role graph of the roles and users in the cache
+func (a *Auditor) GetGraph() *AssumeRoleGraph {
+	nodes := []GraphNode{}
+	for _, r := range a.GetRoles() {
+		nodes = append(nodes, GraphNode{ARN: r.ARN, AccountID: r.AccountID, Type: PrincipalTypeRole})
+	}
+	for _, u := range a.GetUsers() {
+		nodes = append(nodes, GraphNode{ARN: u.ARN, AccountID: u.AccountID, Type: PrincipalTypeUser})
+	}
+	return NewAssumeRoleGraph(nodes, a.GetLinks())
+}
+
+// distancesTo returns the number of links in the shortest path from each
+// principal which can reach the target to the target.
+func (g *AssumeRoleGraph) distancesTo(target string) map[string]int {
+	dist := map[string]int{target: 0}
+	queue := []string{target}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, i := range g.incoming[current] {
+			source := g.Links[i].SourceARN
+			if _, ok := dist[source]; !ok {
+				dist[source] = dist[current] + 1
+				queue = append(queue, source)
+			}
+		}
+	}
+	return dist
+}
+
+// ShortestPaths returns the shortest paths from the source principal to
+// the target role. If there are several paths of the same length, up to
+// maxPaths of them are returned. Returns an empty slice if the source
+// can't reach the target.
+func (g *AssumeRoleGraph) ShortestPaths(source, target string, maxPaths int) []AssumeRolePath {
+	return g.shortestPaths(source, target, g.distancesTo(target), maxPaths)
+}
+
+// PathsTo returns the shortest paths to the target role from each
+// principal which can reach it, answering "who can assume this role?".
+// Up to maxPathsPerSource paths are returned for each principal.
+// Paths are ordered by their length and then by the source ARN.
+func (g *AssumeRoleGraph) PathsTo(target string, maxPathsPerSource int) []AssumeRolePath {
+	dist := g.distancesTo(target)
+
+	var sources []string
+	for arn := range dist {
+		if arn != target {
+			sources = append(sources, arn)
+		}
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if dist[sources[i]] != dist[sources[j]] {
+			return dist[sources[i]] < dist[sources[j]]
+		}
+		return sources[i] < sources[j]
+	})
+
+	result := []AssumeRolePath{}
+	for _, source := range sources {
+		result = append(result, g.shortestPaths(source, target, dist, maxPathsPerSource)...)
+	}
+	return result
+}
+
+// shortestPaths walks from the source towards the target, only following
+// links which reduce the distance to the target by one.
+func (g *AssumeRoleGraph) shortestPaths(source, target string, dist map[string]int, maxPaths int) []AssumeRolePath {
+	result := []AssumeRolePath{}
+	if _, ok := dist[source]; !ok || source == target {
+		return result
+	}
+
+	var walk func(current string, links []AssumeRoleLink)
+	walk = func(current string, links []AssumeRoleLink) {
+		if len(result) >= maxPaths {
+			return
+		}
+		if current == target {
+			path := AssumeRolePath{SourceARN: source, TargetARN: target, Links: append([]AssumeRoleLink{}, links...)}
+			result = append(result, path)
+			return
+		}
+		for _, i := range g.outgoing[current] {
+			l := g.Links[i]
+			if d, ok := dist[l.TargetARN]; ok && d == dist[current]-1 {
+				walk(l.TargetARN, append(links, l))
+			}
+		}
+	}
+	walk(source, nil)
+	return result
+}
@@ -0,0 +1,262 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// GraphFormat is a format which the assume role graph can be rendered in
+type GraphFormat string
+
+const (
+	// GraphFormatDOT is the GraphViz DOT language
+	GraphFormatDOT GraphFormat = "dot"
+	// GraphFormatMermaid is a Mermaid flowchart, which can be embedded in Markdown
+	GraphFormatMermaid GraphFormat = "mermaid"
+	// GraphFormatGraphML is GraphML, which can be opened in graph editors such as yEd
+	GraphFormatGraphML GraphFormat = "graphml"
+)
+
+// ParseGraphFormat returns the graph format with the given name
+func ParseGraphFormat(s string) (GraphFormat, error) {
+	switch f := GraphFormat(strings.ToLower(s)); f {
+	case GraphFormatDOT, GraphFormatMermaid, GraphFormatGraphML:
+		return f, nil
+	}
+	return "", fmt.Errorf("unsupported graph format %q (must be one of dot, mermaid or graphml)", s)
+}
+
+// ContentType returns the MIME type of the format
+func (f GraphFormat) ContentType() string {
+	switch f {
+	case GraphFormatDOT:
+		return "text/vnd.graphviz"
+	case GraphFormatGraphML:
+		return "application/graphml+xml"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// GraphAnnotations maps principal ARNs to notes about them, such as
+// findings. Annotated principals are highlighted in rendered graphs.
+type GraphAnnotations map[string][]string
+
+// accountGroup holds the nodes in an AWS account
+type accountGroup struct {
+	accountID string
+	nodes     []GraphNode
+}
+
+// accountGroups groups the graph's nodes by their account, adding nodes
+// for any link sources or targets which aren't in the graph.
+func (g *AssumeRoleGraph) accountGroups() []accountGroup {
+	nodes := append([]GraphNode{}, g.Nodes...)
+	seen := map[string]bool{}
+	for _, n := range nodes {
+		seen[n.ARN] = true
+	}
+	for _, l := range g.Links {
+		for _, arn := range []string{l.SourceARN, l.TargetARN} {
+			if !seen[arn] {
+				seen[arn] = true
+				nodes = append(nodes, GraphNode{ARN: arn, AccountID: accountFromARN(arn)})
+			}
+		}
+	}
+
+	byAccount := map[string]*accountGroup{}
+	var groups []*accountGroup
+	for _, n := range nodes {
+		grp, ok := byAccount[n.AccountID]
+		if !ok {
+			grp = &accountGroup{accountID: n.AccountID}
+			byAccount[n.AccountID] = grp
+			groups = append(groups, grp)
+		}
+		grp.nodes = append(grp.nodes, n)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].accountID < groups[j].accountID })
+
+	result := []accountGroup{}
+	for _, grp := range groups {
+		sort.Slice(grp.nodes, func(i, j int) bool { return grp.nodes[i].ARN < grp.nodes[j].ARN })
+		result = append(result, *grp)
+	}
+	return result
+}
+
+// accountLabel is the label of the group of nodes in an account
+func accountLabel(accountID string) string {
+	if accountID == "" {
+		return "Unknown account"
+	}
+	return "Account " + accountID
+}
+
+// nodeLabel returns the resource part of an ARN, e.g. "role/example"
+func nodeLabel(arn string) string {
+	split := strings.SplitN(arn, ":", 6)
+	if len(split) < 6 {
+		return arn
+	}
+	return split[5]
+}
+
+// Render writes the graph in the given format. Nodes are grouped by
+// their AWS account, and principals with annotations are highlighted.
+func (g *AssumeRoleGraph) Render(w io.Writer, format GraphFormat, annotations GraphAnnotations) error {
+	bw := bufio.NewWriter(w)
+	switch format {
+	case GraphFormatDOT:
+		g.renderDOT(bw, annotations)
+	case GraphFormatMermaid:
+		g.renderMermaid(bw, annotations)
+	case GraphFormatGraphML:
+		g.renderGraphML(bw, annotations)
+	default:
+		return fmt.Errorf("unsupported graph format %q", format)
+	}
+	return bw.Flush()
+}
+
+func dotEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, `"`, `\"`)
+}
+
+func dotQuote(s string) string {
+	return `"` + dotEscape(s) + `"`
+}
+
+// dotLabel returns a quoted label with each line separated by a line break
+func dotLabel(lines []string) string {
+	escaped := []string{}
+	for _, l := range lines {
+		escaped = append(escaped, dotEscape(l))
+	}
+	return `"` + strings.Join(escaped, `\n`) + `"`
+}
+
+func (g *AssumeRoleGraph) renderDOT(w *bufio.Writer, annotations GraphAnnotations) {
+	fmt.Fprintln(w, "digraph iamzero {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box, style=rounded];")
+
+	for i, grp := range g.accountGroups() {
+		fmt.Fprintf(w, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(w, "    label=%s;\n", dotQuote(accountLabel(grp.accountID)))
+		for _, n := range grp.nodes {
+			label := nodeLabel(n.ARN)
+			notes := annotations[n.ARN]
+			if len(notes) == 0 {
+				fmt.Fprintf(w, "    %s [label=%s];\n", dotQuote(n.ARN), dotQuote(label))
+				continue
+			}
+			fmt.Fprintf(w, "    %s [label=%s, style=\"rounded,filled\", fillcolor=\"#fed7d7\", color=\"#c53030\"];\n", dotQuote(n.ARN), dotLabel(append([]string{label}, notes...)))
+		}
+		fmt.Fprintln(w, "  }")
+	}
+
+	for _, l := range g.Links {
+		fmt.Fprintf(w, "  %s -> %s;\n", dotQuote(l.SourceARN), dotQuote(l.TargetARN))
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// mermaidEscape escapes characters which can't appear in a quoted Mermaid label
+func mermaidEscape(s string) string {
+	s = strings.ReplaceAll(s, `"`, "#quot;")
+	s = strings.ReplaceAll(s, "<", "#lt;")
+	s = strings.ReplaceAll(s, ">", "#gt;")
+	return s
+}
+
+func (g *AssumeRoleGraph) renderMermaid(w *bufio.Writer, annotations GraphAnnotations) {
+	fmt.Fprintln(w, "flowchart LR")
+	fmt.Fprintln(w, "  classDef finding fill:#fed7d7,stroke:#c53030")
+
+	// Mermaid node IDs can't contain the characters used in ARNs
+	ids := map[string]string{}
+	var annotated []string
+
+	for i, grp := range g.accountGroups() {
+		fmt.Fprintf(w, "  subgraph account%d[\"%s\"]\n", i, mermaidEscape(accountLabel(grp.accountID)))
+		for _, n := range grp.nodes {
+			id := fmt.Sprintf("n%d", len(ids))
+			ids[n.ARN] = id
+
+			lines := []string{mermaidEscape(nodeLabel(n.ARN))}
+			for _, note := range annotations[n.ARN] {
+				lines = append(lines, mermaidEscape(note))
+			}
+			if len(annotations[n.ARN]) > 0 {
+				annotated = append(annotated, id)
+			}
+			fmt.Fprintf(w, "    %s[\"%s\"]\n", id, strings.Join(lines, "<br/>"))
+		}
+		fmt.Fprintln(w, "  end")
+	}
+
+	for _, l := range g.Links {
+		fmt.Fprintf(w, "  %s --> %s\n", ids[l.SourceARN], ids[l.TargetARN])
+	}
+	if len(annotated) > 0 {
+		fmt.Fprintf(w, "  class %s finding\n", strings.Join(annotated, ","))
+	}
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func (g *AssumeRoleGraph) renderGraphML(w *bufio.Writer, annotations GraphAnnotations) {
+	fmt.Fprintln(w, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(w, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(w, `  <key id="label" for="node" attr.name="label" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <key id="arn" for="node" attr.name="arn" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <key id="accountId" for="node" attr.name="accountId" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <key id="type" for="node" attr.name="type" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <key id="findings" for="node" attr.name="findings" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <key id="statements" for="edge" attr.name="statements" attr.type="int"/>`)
+	fmt.Fprintln(w, `  <graph id="assume-role-graph" edgedefault="directed">`)
+
+	// nodes in each account are placed in a nested graph
+	for _, grp := range g.accountGroups() {
+		accountID := "account:" + grp.accountID
+		fmt.Fprintf(w, "    <node id=\"%s\">\n", xmlEscape(accountID))
+		fmt.Fprintf(w, "      <data key=\"label\">%s</data>\n", xmlEscape(accountLabel(grp.accountID)))
+		fmt.Fprintf(w, "      <data key=\"accountId\">%s</data>\n", xmlEscape(grp.accountID))
+		fmt.Fprintf(w, "      <graph id=\"%s:\" edgedefault=\"directed\">\n", xmlEscape(accountID))
+		for _, n := range grp.nodes {
+			fmt.Fprintf(w, "        <node id=\"%s\">\n", xmlEscape(n.ARN))
+			fmt.Fprintf(w, "          <data key=\"label\">%s</data>\n", xmlEscape(nodeLabel(n.ARN)))
+			fmt.Fprintf(w, "          <data key=\"arn\">%s</data>\n", xmlEscape(n.ARN))
+			fmt.Fprintf(w, "          <data key=\"accountId\">%s</data>\n", xmlEscape(n.AccountID))
+			if n.Type != "" {
+				fmt.Fprintf(w, "          <data key=\"type\">%s</data>\n", xmlEscape(string(n.Type)))
+			}
+			if notes := annotations[n.ARN]; len(notes) > 0 {
+				fmt.Fprintf(w, "          <data key=\"findings\">%s</data>\n", xmlEscape(strings.Join(notes, "; ")))
+			}
+			fmt.Fprintln(w, "        </node>")
+		}
+		fmt.Fprintln(w, "      </graph>")
+		fmt.Fprintln(w, "    </node>")
+	}
+
+	for i, l := range g.Links {
+		fmt.Fprintf(w, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\">\n", i, xmlEscape(l.SourceARN), xmlEscape(l.TargetARN))
+		fmt.Fprintf(w, "      <data key=\"statements\">%d</data>\n", len(l.Statements))
+		fmt.Fprintln(w, "    </edge>")
+	}
+
+	fmt.Fprintln(w, "  </graph>")
+	fmt.Fprintln(w, "</graphml>")
+}
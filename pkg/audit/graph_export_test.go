@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func exportTestGraph() *AssumeRoleGraph {
+	nodes := []GraphNode{
+		{ARN: "arn:aws:iam::222222222222:role/deploy", AccountID: "222222222222", Type: PrincipalTypeRole},
+		{ARN: "arn:aws:iam::111111111111:role/ci", AccountID: "111111111111", Type: PrincipalTypeRole},
+		{ARN: "arn:aws:iam::111111111111:user/developer", AccountID: "111111111111", Type: PrincipalTypeUser},
+	}
+	links := []AssumeRoleLink{
+		{SourceARN: "arn:aws:iam::111111111111:user/developer", TargetARN: "arn:aws:iam::111111111111:role/ci"},
+		{SourceARN: "arn:aws:iam::111111111111:role/ci", TargetARN: "arn:aws:iam::222222222222:role/deploy"},
+		// the target isn't in the inventory
+		{SourceARN: "arn:aws:iam::222222222222:role/deploy", TargetARN: "arn:aws:iam::333333333333:role/external"},
+	}
+	return NewAssumeRoleGraph(nodes, links)
+}
+
+var exportTestAnnotations = GraphAnnotations{
+	"arn:aws:iam::111111111111:role/ci": {`active finding "1" (3 events)`},
+}
+
+func TestParseGraphFormat(t *testing.T) {
+	f, err := ParseGraphFormat("GraphML")
+	assert.NoError(t, err)
+	assert.Equal(t, GraphFormatGraphML, f)
+
+	_, err = ParseGraphFormat("png")
+	assert.Error(t, err)
+}
+
+func TestRenderDOT(t *testing.T) {
+	var b bytes.Buffer
+	err := exportTestGraph().Render(&b, GraphFormatDOT, exportTestAnnotations)
+	assert.NoError(t, err)
+
+	want := `digraph iamzero {
+  rankdir=LR;
+  node [shape=box, style=rounded];
+  subgraph cluster_0 {
+    label="Account 111111111111";
+    "arn:aws:iam::111111111111:role/ci" [label="role/ci\nactive finding \"1\" (3 events)", style="rounded,filled", fillcolor="#fed7d7", color="#c53030"];
+    "arn:aws:iam::111111111111:user/developer" [label="user/developer"];
+  }
+  subgraph cluster_1 {
+    label="Account 222222222222";
+    "arn:aws:iam::222222222222:role/deploy" [label="role/deploy"];
+  }
+  subgraph cluster_2 {
+    label="Account 333333333333";
+    "arn:aws:iam::333333333333:role/external" [label="role/external"];
+  }
+  "arn:aws:iam::111111111111:role/ci" -> "arn:aws:iam::222222222222:role/deploy";
+  "arn:aws:iam::111111111111:user/developer" -> "arn:aws:iam::111111111111:role/ci";
+  "arn:aws:iam::222222222222:role/deploy" -> "arn:aws:iam::333333333333:role/external";
+}
+`
+	assert.Equal(t, want, b.String())
+}
+
+func TestRenderMermaid(t *testing.T) {
+	var b bytes.Buffer
+	err := exportTestGraph().Render(&b, GraphFormatMermaid, exportTestAnnotations)
+	assert.NoError(t, err)
+
+	want := `flowchart LR
+  classDef finding fill:#fed7d7,stroke:#c53030
+  subgraph account0["Account 111111111111"]
+    n0["role/ci<br/>active finding #quot;1#quot; (3 events)"]
+    n1["user/developer"]
+  end
+  subgraph account1["Account 222222222222"]
+    n2["role/deploy"]
+  end
+  subgraph account2["Account 333333333333"]
+    n3["role/external"]
+  end
+  n0 --> n2
+  n1 --> n0
+  n2 --> n3
+  class n0 finding
+`
+	assert.Equal(t, want, b.String())
+}
+
+func TestRenderGraphML(t *testing.T) {
+	var b bytes.Buffer
+	err := exportTestGraph().Render(&b, GraphFormatGraphML, exportTestAnnotations)
+	assert.NoError(t, err)
+
+	type data struct {
+		Key   string `xml:"key,attr"`
+		Value string `xml:",chardata"`
+	}
+	type node struct {
+		ID    string `xml:"id,attr"`
+		Data  []data `xml:"data"`
+		Graph struct {
+			Nodes []node `xml:"node"`
+		} `xml:"graph"`
+	}
+	var doc struct {
+		Graph struct {
+			Nodes []node `xml:"node"`
+			Edges []struct {
+				Source string `xml:"source,attr"`
+				Target string `xml:"target,attr"`
+			} `xml:"edge"`
+		} `xml:"graph"`
+	}
+	err = xml.Unmarshal(b.Bytes(), &doc)
+	assert.NoError(t, err)
+
+	accounts := map[string][]string{}
+	findings := map[string]string{}
+	for _, account := range doc.Graph.Nodes {
+		for _, n := range account.Graph.Nodes {
+			accounts[account.ID] = append(accounts[account.ID], n.ID)
+			for _, d := range n.Data {
+				if d.Key == "findings" {
+					findings[n.ID] = d.Value
+				}
+			}
+		}
+	}
+	assert.Equal(t, map[string][]string{
+		"account:111111111111": {"arn:aws:iam::111111111111:role/ci", "arn:aws:iam::111111111111:user/developer"},
+		"account:222222222222": {"arn:aws:iam::222222222222:role/deploy"},
+		"account:333333333333": {"arn:aws:iam::333333333333:role/external"},
+	}, accounts)
+	assert.Equal(t, map[string]string{"arn:aws:iam::111111111111:role/ci": `active finding "1" (3 events)`}, findings)
+	assert.Len(t, doc.Graph.Edges, 3)
+	assert.True(t, strings.HasPrefix(b.String(), `<?xml version="1.0" encoding="UTF-8"?>`))
+}
@@ -0,0 +1,210 @@
+package audit
+
+import (
+	"testing"
+
+	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/stretchr/testify/assert"
+)
+
+func assumeRolePolicy(effect string, actions []string, resources ...string) policies.AWSIAMPolicy {
+	return policies.AWSIAMPolicy{
+		Version:   "2012-10-17",
+		Statement: []policies.AWSIAMStatement{{Effect: effect, Action: policies.NewStringValues(actions...), Resource: policies.NewStringValues(resources...)}},
+	}
+}
+
+func trustingRole(arn, account string, principals ...string) AWSRole {
+	return AWSRole{
+		ARN:       arn,
+		AccountID: account,
+		TrustPolicyDocument: TrustPolicyDocument{
+			Version: "2012-10-17",
+			Statement: []policies.AWSIAMStatement{
+				{Effect: "Allow", Action: policies.NewStringValues("sts:AssumeRole"), Principal: policies.AWSPrincipal(principals...)},
+			},
+		},
+	}
+}
+
+// buildGraphAuditor returns an auditor with the chain
+// developer (user) -> ci (role) -> deploy (role) -> prod-admin (role),
+// and a shortcut from ci to prod-admin via an account root trust policy.
+func buildGraphAuditor() *Auditor {
+	a := newTestAuditor()
+
+	a.entityStorage.AddGroup(AWSGroup{
+		ARN:       "arn:aws:iam::111111111111:group/developers",
+		AccountID: "111111111111",
+		Name:      "developers",
+		ManagedPolicies: []ManagedPolicy{
+			{ARN: "arn:aws:iam::111111111111:policy/assume-ci", Document: assumeRolePolicy("Allow", []string{"sts:AssumeRole"}, "arn:aws:iam::111111111111:role/ci")},
+		},
+	})
+	a.entityStorage.AddUser(AWSUser{
+		ARN:       "arn:aws:iam::111111111111:user/developer",
+		AccountID: "111111111111",
+		Name:      "developer",
+		Groups:    []string{"arn:aws:iam::111111111111:group/developers"},
+	})
+
+	ci := trustingRole("arn:aws:iam::111111111111:role/ci", "111111111111", "arn:aws:iam::111111111111:user/developer")
+	// sts:* on any role in any account
+	ci.ManagedPolicies = []ManagedPolicy{
+		{ARN: "arn:aws:iam::111111111111:policy/ci", Document: assumeRolePolicy("Allow", []string{"sts:*"}, "arn:aws:iam::*:role/*")},
+	}
+	a.roleStorage.Add(ci)
+
+	deploy := trustingRole("arn:aws:iam::222222222222:role/deploy", "222222222222", "arn:aws:iam::111111111111:role/ci")
+	deploy.InlinePolicies = []InlinePolicy{
+		{Name: "assume-admin", Document: assumeRolePolicy("Allow", []string{"sts:AssumeRole"}, "arn:aws:iam::333333333333:role/prod-admin")},
+	}
+	a.roleStorage.Add(deploy)
+
+	// trusts every principal in the deploy account, and the ci role's account
+	a.roleStorage.Add(trustingRole("arn:aws:iam::333333333333:role/prod-admin", "333333333333", "arn:aws:iam::222222222222:root", "111111111111"))
+
+	// trusts the ci role, but ci is denied from assuming it
+	a.roleStorage.Add(trustingRole("arn:aws:iam::444444444444:role/denied", "444444444444", "arn:aws:iam::111111111111:role/ci"))
+	ci.InlinePolicies = []InlinePolicy{
+		{Name: "deny", Document: assumeRolePolicy("Deny", []string{"sts:AssumeRole"}, "arn:aws:iam::444444444444:role/denied")},
+	}
+	a.roleStorage.iamRoles[0] = ci
+
+	a.BuildLinks()
+	return a
+}
+
+func linkPairs(links []AssumeRoleLink) [][2]string {
+	result := [][2]string{}
+	for _, l := range links {
+		result = append(result, [2]string{l.SourceARN, l.TargetARN})
+	}
+	return result
+}
+
+func TestBuildLinks(t *testing.T) {
+	a := buildGraphAuditor()
+	g := a.GetGraph()
+
+	assert.Equal(t, [][2]string{
+		{"arn:aws:iam::111111111111:role/ci", "arn:aws:iam::222222222222:role/deploy"},
+		{"arn:aws:iam::111111111111:role/ci", "arn:aws:iam::333333333333:role/prod-admin"},
+		{"arn:aws:iam::111111111111:user/developer", "arn:aws:iam::111111111111:role/ci"},
+		{"arn:aws:iam::222222222222:role/deploy", "arn:aws:iam::333333333333:role/prod-admin"},
+	}, linkPairs(g.Links))
+	assert.Len(t, g.Nodes, 5)
+
+	// the user's link is justified by its group's policy and the role's trust policy
+	var policiesUsed []string
+	for _, s := range g.Links[2].Statements {
+		policiesUsed = append(policiesUsed, s.Policy)
+	}
+	assert.ElementsMatch(t, []string{"arn:aws:iam::111111111111:policy/assume-ci", trustPolicyID}, policiesUsed)
+}
+
+func TestShortestPaths(t *testing.T) {
+	g := buildGraphAuditor().GetGraph()
+
+	paths := g.ShortestPaths("arn:aws:iam::111111111111:user/developer", "arn:aws:iam::333333333333:role/prod-admin", 10)
+	if assert.Len(t, paths, 1) {
+		assert.Equal(t, [][2]string{
+			{"arn:aws:iam::111111111111:user/developer", "arn:aws:iam::111111111111:role/ci"},
+			{"arn:aws:iam::111111111111:role/ci", "arn:aws:iam::333333333333:role/prod-admin"},
+		}, linkPairs(paths[0].Links))
+	}
+
+	assert.Empty(t, g.ShortestPaths("arn:aws:iam::333333333333:role/prod-admin", "arn:aws:iam::111111111111:role/ci", 10))
+	assert.Empty(t, g.ShortestPaths("arn:aws:iam::111111111111:role/ci", "arn:aws:iam::444444444444:role/denied", 10))
+}
+
+func TestPathsTo(t *testing.T) {
+	g := buildGraphAuditor().GetGraph()
+
+	paths := g.PathsTo("arn:aws:iam::333333333333:role/prod-admin", 10)
+	var sources []string
+	for _, p := range paths {
+		sources = append(sources, p.SourceARN)
+		assert.Equal(t, "arn:aws:iam::333333333333:role/prod-admin", p.TargetARN)
+	}
+	assert.Equal(t, []string{
+		"arn:aws:iam::111111111111:role/ci",
+		"arn:aws:iam::222222222222:role/deploy",
+		"arn:aws:iam::111111111111:user/developer",
+	}, sources)
+}
+
+func TestPrincipalIndexCandidates(t *testing.T) {
+	ps := []principal{
+		{ARN: "arn:aws:iam::111111111111:role/a", AccountID: "111111111111"},
+		{ARN: "arn:aws:iam::111111111111:role/b", AccountID: "111111111111"},
+		{ARN: "arn:aws:iam::222222222222:role/c", AccountID: "222222222222"},
+	}
+	idx := newPrincipalIndex(ps)
+
+	assert.Equal(t, []int{1}, idx.candidates(trustingRole("", "", "arn:aws:iam::111111111111:role/b").TrustPolicyDocument))
+	assert.Equal(t, []int{0, 1}, idx.candidates(trustingRole("", "", "arn:aws:iam::111111111111:root").TrustPolicyDocument))
+	assert.Equal(t, []int{2}, idx.candidates(trustingRole("", "", "222222222222").TrustPolicyDocument))
+	assert.Equal(t, []int{0, 1, 2}, idx.candidates(trustingRole("", "", "arn:aws:iam::*:role/*").TrustPolicyDocument))
+	assert.Empty(t, idx.candidates(TrustPolicyDocument{}))
+}
+
+func TestBuildLinksWithTrustPolicyConditions(t *testing.T) {
+	a := newTestAuditor()
+	alice := "arn:aws:iam::111111111111:user/alice"
+	a.entityStorage.AddUser(AWSUser{
+		ARN:       alice,
+		AccountID: "111111111111",
+		Name:      "alice",
+		InlinePolicies: []InlinePolicy{
+			{Name: "assume", Document: assumeRolePolicy("Allow", []string{"sts:AssumeRole"}, "*")},
+		},
+	})
+
+	externalID := policies.Condition{"StringEquals": {"sts:ExternalId": policies.NewConditionValue("secret")}}
+	vendor := trustingRole("arn:aws:iam::111111111111:role/vendor", "111111111111", alice)
+	vendor.TrustPolicyDocument.Statement[0].Condition = externalID
+	a.roleStorage.Add(vendor)
+
+	mfa := trustingRole("arn:aws:iam::111111111111:role/mfa", "111111111111", "arn:aws:iam::111111111111:root")
+	mfa.TrustPolicyDocument.Statement[0].Condition = policies.Condition{"Bool": {"aws:MultiFactorAuthPresent": policies.NewConditionValue("true")}}
+	a.roleStorage.Add(mfa)
+
+	a.roleStorage.Add(trustingRole("arn:aws:iam::111111111111:role/open", "111111111111", alice))
+
+	// conditions on keys which are known are still evaluated
+	pinned := trustingRole("arn:aws:iam::111111111111:role/pinned", "111111111111", "arn:aws:iam::111111111111:root")
+	pinned.TrustPolicyDocument.Statement[0].Condition = policies.Condition{"StringEquals": {"aws:PrincipalArn": policies.NewConditionValue("arn:aws:iam::111111111111:user/bob")}}
+	a.roleStorage.Add(pinned)
+
+	a.BuildLinks()
+	g := a.GetGraph()
+
+	assert.Equal(t, [][2]string{
+		{alice, "arn:aws:iam::111111111111:role/mfa"},
+		{alice, "arn:aws:iam::111111111111:role/open"},
+		{alice, "arn:aws:iam::111111111111:role/vendor"},
+	}, linkPairs(g.Links))
+
+	conditional := map[string]bool{}
+	for _, l := range g.Links {
+		conditional[l.TargetARN] = l.Conditional
+	}
+	assert.Equal(t, map[string]bool{
+		"arn:aws:iam::111111111111:role/mfa":    true,
+		"arn:aws:iam::111111111111:role/open":   false,
+		"arn:aws:iam::111111111111:role/vendor": true,
+	}, conditional)
+
+	// the link carries the trust policy statement with the condition
+	var trust []LinkStatement
+	for _, s := range g.Links[2].Statements {
+		if s.Policy == trustPolicyID {
+			trust = append(trust, s)
+		}
+	}
+	if assert.Len(t, trust, 1) {
+		assert.True(t, trust[0].Conditional)
+		assert.Equal(t, externalID, trust[0].Statement.Condition)
+	}
+}
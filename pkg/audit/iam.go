@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"golang.org/x/sync/errgroup"
+)
+
+// IAMAPI is the subset of the IAM API used by the auditor to load an
+// account's inventory. It is satisfied by *iam.Client, and allows the
+// auditor to be tested against a fake implementation.
+type IAMAPI interface {
+	iam.ListPoliciesAPIClient
+	GetPolicy(ctx context.Context, params *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error)
+	GetPolicyVersion(ctx context.Context, params *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error)
+
+	iam.ListRolesAPIClient
+	iam.ListAttachedRolePoliciesAPIClient
+	iam.ListRolePoliciesAPIClient
+	GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error)
+	GetRolePolicy(ctx context.Context, params *iam.GetRolePolicyInput, optFns ...func(*iam.Options)) (*iam.GetRolePolicyOutput, error)
+
+	iam.ListUsersAPIClient
+	iam.ListAttachedUserPoliciesAPIClient
+	iam.ListUserPoliciesAPIClient
+	iam.ListGroupsForUserAPIClient
+	GetUser(ctx context.Context, params *iam.GetUserInput, optFns ...func(*iam.Options)) (*iam.GetUserOutput, error)
+	GetUserPolicy(ctx context.Context, params *iam.GetUserPolicyInput, optFns ...func(*iam.Options)) (*iam.GetUserPolicyOutput, error)
+
+	iam.ListGroupsAPIClient
+	iam.ListAttachedGroupPoliciesAPIClient
+	iam.ListGroupPoliciesAPIClient
+	GetGroupPolicy(ctx context.Context, params *iam.GetGroupPolicyInput, optFns ...func(*iam.Options)) (*iam.GetGroupPolicyOutput, error)
+
+	iam.ListInstanceProfilesAPIClient
+}
+
+// throttlingErrorCodes are the error codes returned by AWS APIs when
+// requests are being rate limited.
+var throttlingErrorCodes = map[string]bool{
+	"Throttling":                true,
+	"ThrottlingException":       true,
+	"ThrottledException":        true,
+	"RequestThrottledException": true,
+	"TooManyRequestsException":  true,
+	"RequestLimitExceeded":      true,
+}
+
+// isThrottlingError returns true if the error was caused by AWS rate
+// limiting the request.
+func isThrottlingError(err error) bool {
+	var apiErr interface{ ErrorCode() string }
+	if errors.As(err, &apiErr) {
+		return throttlingErrorCodes[apiErr.ErrorCode()]
+	}
+	return false
+}
+
+// maxRetryBackoff caps the delay between retries of a throttled request
+const maxRetryBackoff = 20 * time.Second
+
+// withRetry calls fn, retrying with exponential backoff while it returns
+// a throttling error. Large accounts easily exceed the IAM API rate
+// limits when loading the inventory, and the retries built into the AWS
+// SDK are often exhausted.
+func (a *Auditor) withRetry(ctx context.Context, fn func(ctx context.Context) error) error {
+	backoff := a.retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || !isThrottlingError(err) || attempt >= a.maxRetries {
+			return err
+		}
+		a.log.With("attempt", attempt+1, "backoff", backoff).Debug("request throttled, retrying")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// forEach calls fn for the indexes 0 to n-1, with at most `a.concurrency`
+// calls running at once. The context passed to fn is cancelled after the
+// first error, which is returned.
+func (a *Auditor) forEach(ctx context.Context, n int, fn func(ctx context.Context, i int) error) error {
+	limit := a.concurrency
+	if limit < 1 {
+		limit = 1
+	}
+	sem := make(chan struct{}, limit)
+	g, gctx := errgroup.WithContext(ctx)
+
+	for i := 0; i < n; i++ {
+		i := i
+		select {
+		case sem <- struct{}{}:
+		case <-gctx.Done():
+			return g.Wait()
+		}
+		g.Go(func() error {
+			defer func() { <-sem }()
+			return fn(gctx, i)
+		})
+	}
+	return g.Wait()
+}
+
+// decodePolicyDocument unmarshals a URL-encoded policy document as
+// returned by the IAM API.
+func decodePolicyDocument(document *string, v interface{}) error {
+	if document == nil {
+		return errors.New("policy document is empty")
+	}
+	s, err := url.QueryUnescape(*document)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(s), v)
+}
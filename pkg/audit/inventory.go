@@ -0,0 +1,485 @@
+package audit
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/pkg/errors"
+)
+
+// AWSUser is an IAM user
+type AWSUser struct {
+	ARN             string          `json:"arn"`
+	AccountID       string          `json:"accountId"`
+	Name            string          `json:"name"`
+	ManagedPolicies []ManagedPolicy `json:"managedPolicies"`
+	InlinePolicies  []InlinePolicy  `json:"inlinePolicies"`
+	// Groups holds the ARNs of the groups the user is a member of
+	Groups              []string       `json:"groups"`
+	PermissionsBoundary *ManagedPolicy `json:"permissionsBoundary,omitempty"`
+}
+
+// AWSGroup is an IAM group
+type AWSGroup struct {
+	ARN             string          `json:"arn"`
+	AccountID       string          `json:"accountId"`
+	Name            string          `json:"name"`
+	ManagedPolicies []ManagedPolicy `json:"managedPolicies"`
+	InlinePolicies  []InlinePolicy  `json:"inlinePolicies"`
+}
+
+// InstanceProfile is an EC2 instance profile
+type InstanceProfile struct {
+	ARN       string `json:"arn"`
+	AccountID string `json:"accountId"`
+	Name      string `json:"name"`
+	// Roles holds the ARNs of the roles in the instance profile
+	Roles []string `json:"roles"`
+}
+
+// IAMEntityStorage stores IAM users, groups and instance profiles
+// in memory and is goroutine-safe
+type IAMEntityStorage struct {
+	sync.Mutex
+	users            []AWSUser
+	groups           []AWSGroup
+	instanceProfiles []InstanceProfile
+}
+
+func NewIAMEntityStorage() *IAMEntityStorage {
+	return &IAMEntityStorage{
+		users:            []AWSUser{},
+		groups:           []AWSGroup{},
+		instanceProfiles: []InstanceProfile{},
+	}
+}
+
+func (s *IAMEntityStorage) AddUser(u AWSUser) {
+	s.Lock()
+	defer s.Unlock()
+	s.users = append(s.users, u)
+}
+
+func (s *IAMEntityStorage) AddGroup(g AWSGroup) {
+	s.Lock()
+	defer s.Unlock()
+	s.groups = append(s.groups, g)
+}
+
+func (s *IAMEntityStorage) AddInstanceProfile(p InstanceProfile) {
+	s.Lock()
+	defer s.Unlock()
+	s.instanceProfiles = append(s.instanceProfiles, p)
+}
+
+func (s *IAMEntityStorage) Users() []AWSUser {
+	s.Lock()
+	defer s.Unlock()
+	return s.users
+}
+
+func (s *IAMEntityStorage) Groups() []AWSGroup {
+	s.Lock()
+	defer s.Unlock()
+	return s.groups
+}
+
+func (s *IAMEntityStorage) InstanceProfiles() []InstanceProfile {
+	s.Lock()
+	defer s.Unlock()
+	return s.instanceProfiles
+}
+
+// loadAccount loads the IAM inventory of a single AWS account.
+//
+// Managed policies are loaded first, so that their documents can be
+// attached to the roles, users and groups which reference them.
+// Only managed policies which are attached to an entity are listed;
+// policies which are only used as a permissions boundary are fetched
+// when a role or user references them.
+func (a *Auditor) loadAccount(ctx context.Context, client IAMAPI) error {
+	if err := a.loadManagedPolicies(ctx, client); err != nil {
+		return errors.Wrap(err, "loading managed policies")
+	}
+	if err := a.loadRoles(ctx, client); err != nil {
+		return errors.Wrap(err, "loading roles")
+	}
+	if err := a.loadUsers(ctx, client); err != nil {
+		return errors.Wrap(err, "loading users")
+	}
+	if err := a.loadGroups(ctx, client); err != nil {
+		return errors.Wrap(err, "loading groups")
+	}
+	if err := a.loadInstanceProfiles(ctx, client); err != nil {
+		return errors.Wrap(err, "loading instance profiles")
+	}
+	return nil
+}
+
+func (a *Auditor) loadManagedPolicies(ctx context.Context, client IAMAPI) error {
+	var ps []types.Policy
+	p := iam.NewListPoliciesPaginator(client, &iam.ListPoliciesInput{
+		OnlyAttached: true,
+		Scope:        types.PolicyScopeTypeAll,
+	})
+	for p.HasMorePages() {
+		err := a.withRetry(ctx, func(ctx context.Context) error {
+			page, err := p.NextPage(ctx)
+			if err == nil {
+				ps = append(ps, page.Policies...)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.forEach(ctx, len(ps), func(ctx context.Context, i int) error {
+		return a.fetchPolicyDetails(ctx, client, ps[i])
+	})
+}
+
+func (a *Auditor) loadRoles(ctx context.Context, client IAMAPI) error {
+	var roles []types.Role
+	p := iam.NewListRolesPaginator(client, &iam.ListRolesInput{})
+	for p.HasMorePages() {
+		err := a.withRetry(ctx, func(ctx context.Context) error {
+			page, err := p.NextPage(ctx)
+			if err == nil {
+				roles = append(roles, page.Roles...)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.forEach(ctx, len(roles), func(ctx context.Context, i int) error {
+		return a.FetchDetailsForRole(ctx, client, roles[i])
+	})
+}
+
+func (a *Auditor) loadUsers(ctx context.Context, client IAMAPI) error {
+	var users []types.User
+	p := iam.NewListUsersPaginator(client, &iam.ListUsersInput{})
+	for p.HasMorePages() {
+		err := a.withRetry(ctx, func(ctx context.Context) error {
+			page, err := p.NextPage(ctx)
+			if err == nil {
+				users = append(users, page.Users...)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.forEach(ctx, len(users), func(ctx context.Context, i int) error {
+		return a.fetchDetailsForUser(ctx, client, users[i])
+	})
+}
+
+func (a *Auditor) loadGroups(ctx context.Context, client IAMAPI) error {
+	var groups []types.Group
+	p := iam.NewListGroupsPaginator(client, &iam.ListGroupsInput{})
+	for p.HasMorePages() {
+		err := a.withRetry(ctx, func(ctx context.Context) error {
+			page, err := p.NextPage(ctx)
+			if err == nil {
+				groups = append(groups, page.Groups...)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.forEach(ctx, len(groups), func(ctx context.Context, i int) error {
+		return a.fetchDetailsForGroup(ctx, client, groups[i])
+	})
+}
+
+func (a *Auditor) loadInstanceProfiles(ctx context.Context, client IAMAPI) error {
+	p := iam.NewListInstanceProfilesPaginator(client, &iam.ListInstanceProfilesInput{})
+	for p.HasMorePages() {
+		var profiles []types.InstanceProfile
+		err := a.withRetry(ctx, func(ctx context.Context) error {
+			page, err := p.NextPage(ctx)
+			if err == nil {
+				profiles = page.InstanceProfiles
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, ip := range profiles {
+			arnParsed, err := arn.Parse(aws.ToString(ip.Arn))
+			if err != nil {
+				return err
+			}
+			profile := InstanceProfile{
+				ARN:       aws.ToString(ip.Arn),
+				AccountID: arnParsed.AccountID,
+				Name:      aws.ToString(ip.InstanceProfileName),
+				Roles:     []string{},
+			}
+			for _, r := range ip.Roles {
+				profile.Roles = append(profile.Roles, aws.ToString(r.Arn))
+			}
+			a.entityStorage.AddInstanceProfile(profile)
+		}
+	}
+	return nil
+}
+
+func (a *Auditor) fetchDetailsForUser(ctx context.Context, client IAMAPI, u types.User) error {
+	arnParsed, err := arn.Parse(aws.ToString(u.Arn))
+	if err != nil {
+		return err
+	}
+	user := AWSUser{
+		ARN:       aws.ToString(u.Arn),
+		AccountID: arnParsed.AccountID,
+		Name:      aws.ToString(u.UserName),
+		Groups:    []string{},
+	}
+
+	a.log.With("user", u.Arn).Debug("fetching user details")
+
+	// ListUsers doesn't include the permissions boundary of each user
+	var details *iam.GetUserOutput
+	err = a.withRetry(ctx, func(ctx context.Context) (err error) {
+		details, err = client.GetUser(ctx, &iam.GetUserInput{UserName: u.UserName})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if b := details.User.PermissionsBoundary; b != nil {
+		user.PermissionsBoundary, err = a.managedPolicy(ctx, client, aws.ToString(b.PermissionsBoundaryArn))
+		if err != nil {
+			return err
+		}
+	}
+
+	var attached []types.AttachedPolicy
+	ap := iam.NewListAttachedUserPoliciesPaginator(client, &iam.ListAttachedUserPoliciesInput{UserName: u.UserName})
+	for ap.HasMorePages() {
+		err := a.withRetry(ctx, func(ctx context.Context) error {
+			page, err := ap.NextPage(ctx)
+			if err == nil {
+				attached = append(attached, page.AttachedPolicies...)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	user.ManagedPolicies, err = a.attachedPolicies(ctx, client, attached)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	ip := iam.NewListUserPoliciesPaginator(client, &iam.ListUserPoliciesInput{UserName: u.UserName})
+	for ip.HasMorePages() {
+		err := a.withRetry(ctx, func(ctx context.Context) error {
+			page, err := ip.NextPage(ctx)
+			if err == nil {
+				names = append(names, page.PolicyNames...)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	user.InlinePolicies, err = a.inlinePolicies(ctx, names, func(ctx context.Context, name string) (*string, error) {
+		out, err := client.GetUserPolicy(ctx, &iam.GetUserPolicyInput{PolicyName: &name, UserName: u.UserName})
+		if err != nil {
+			return nil, err
+		}
+		return out.PolicyDocument, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	gp := iam.NewListGroupsForUserPaginator(client, &iam.ListGroupsForUserInput{UserName: u.UserName})
+	for gp.HasMorePages() {
+		err := a.withRetry(ctx, func(ctx context.Context) error {
+			page, err := gp.NextPage(ctx)
+			if err == nil {
+				for _, g := range page.Groups {
+					user.Groups = append(user.Groups, aws.ToString(g.Arn))
+				}
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	a.entityStorage.AddUser(user)
+	return nil
+}
+
+func (a *Auditor) fetchDetailsForGroup(ctx context.Context, client IAMAPI, g types.Group) error {
+	arnParsed, err := arn.Parse(aws.ToString(g.Arn))
+	if err != nil {
+		return err
+	}
+	group := AWSGroup{
+		ARN:       aws.ToString(g.Arn),
+		AccountID: arnParsed.AccountID,
+		Name:      aws.ToString(g.GroupName),
+	}
+
+	a.log.With("group", g.Arn).Debug("fetching group policies")
+
+	var attached []types.AttachedPolicy
+	ap := iam.NewListAttachedGroupPoliciesPaginator(client, &iam.ListAttachedGroupPoliciesInput{GroupName: g.GroupName})
+	for ap.HasMorePages() {
+		err := a.withRetry(ctx, func(ctx context.Context) error {
+			page, err := ap.NextPage(ctx)
+			if err == nil {
+				attached = append(attached, page.AttachedPolicies...)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	group.ManagedPolicies, err = a.attachedPolicies(ctx, client, attached)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	ip := iam.NewListGroupPoliciesPaginator(client, &iam.ListGroupPoliciesInput{GroupName: g.GroupName})
+	for ip.HasMorePages() {
+		err := a.withRetry(ctx, func(ctx context.Context) error {
+			page, err := ip.NextPage(ctx)
+			if err == nil {
+				names = append(names, page.PolicyNames...)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	group.InlinePolicies, err = a.inlinePolicies(ctx, names, func(ctx context.Context, name string) (*string, error) {
+		out, err := client.GetGroupPolicy(ctx, &iam.GetGroupPolicyInput{PolicyName: &name, GroupName: g.GroupName})
+		if err != nil {
+			return nil, err
+		}
+		return out.PolicyDocument, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	a.entityStorage.AddGroup(group)
+	return nil
+}
+
+// attachedPolicies looks up the documents of attached managed policies.
+func (a *Auditor) attachedPolicies(ctx context.Context, client IAMAPI, attached []types.AttachedPolicy) ([]ManagedPolicy, error) {
+	result := []ManagedPolicy{}
+	for _, p := range attached {
+		policy, err := a.managedPolicy(ctx, client, aws.ToString(p.PolicyArn))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *policy)
+	}
+	return result, nil
+}
+
+// managedPolicy returns a managed policy from the cache, fetching it
+// if it hasn't been loaded yet.
+func (a *Auditor) managedPolicy(ctx context.Context, client IAMAPI, policyARN string) (*ManagedPolicy, error) {
+	if doc, ok := a.policyMap.Load(policyARN); ok {
+		return &ManagedPolicy{ARN: policyARN, Document: doc.(policies.AWSIAMPolicy)}, nil
+	}
+
+	var out *iam.GetPolicyOutput
+	err := a.withRetry(ctx, func(ctx context.Context) (err error) {
+		out, err = client.GetPolicy(ctx, &iam.GetPolicyInput{PolicyArn: &policyARN})
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting policy %s", policyARN)
+	}
+	err = a.fetchPolicyDetails(ctx, client, *out.Policy)
+	if err != nil {
+		return nil, err
+	}
+	doc, _ := a.policyMap.Load(policyARN)
+	return &ManagedPolicy{ARN: policyARN, Document: doc.(policies.AWSIAMPolicy)}, nil
+}
+
+// inlinePolicies fetches the documents of inline policies using the
+// provided getter.
+func (a *Auditor) inlinePolicies(ctx context.Context, names []string, get func(ctx context.Context, name string) (*string, error)) ([]InlinePolicy, error) {
+	result := []InlinePolicy{}
+	for _, name := range names {
+		var document *string
+		err := a.withRetry(ctx, func(ctx context.Context) (err error) {
+			document, err = get(ctx, name)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		var doc policies.AWSIAMPolicy
+		if err := decodePolicyDocument(document, &doc); err != nil {
+			return nil, errors.Wrapf(err, "decoding inline policy %s", name)
+		}
+		result = append(result, InlinePolicy{Name: name, Document: doc})
+	}
+	return result, nil
+}
+
+// GetUsers returns the cached IAM users across all AWS accounts
+func (a *Auditor) GetUsers() []AWSUser {
+	return a.entityStorage.Users()
+}
+
+// GetGroups returns the cached IAM groups across all AWS accounts
+func (a *Auditor) GetGroups() []AWSGroup {
+	return a.entityStorage.Groups()
+}
+
+// GetInstanceProfiles returns the cached instance profiles across all AWS accounts
+func (a *Auditor) GetInstanceProfiles() []InstanceProfile {
+	return a.entityStorage.InstanceProfiles()
+}
+
+// GetManagedPolicies returns the cached customer and AWS managed
+// policies, sorted by ARN.
+func (a *Auditor) GetManagedPolicies() []ManagedPolicy {
+	result := []ManagedPolicy{}
+	a.policyMap.Range(func(key, value interface{}) bool {
+		result = append(result, ManagedPolicy{ARN: key.(string), Document: value.(policies.AWSIAMPolicy)})
+		return true
+	})
+	sort.Slice(result, func(i, j int) bool { return result[i].ARN < result[j].ARN })
+	return result
+}
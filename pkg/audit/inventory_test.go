@@ -0,0 +1,200 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/stretchr/testify/assert"
+)
+
+func allowPolicy(action, resource string) policies.AWSIAMPolicy {
+	return policies.AWSIAMPolicy{
+		Version: "2012-10-17",
+		Statement: []policies.AWSIAMStatement{
+			{Effect: "Allow", Action: policies.NewStringValues(action), Resource: policies.NewStringValues(resource)},
+		},
+	}
+}
+
+func trustPolicy(principal string) policies.AWSIAMPolicy {
+	return policies.AWSIAMPolicy{
+		Version: "2012-10-17",
+		Statement: []policies.AWSIAMStatement{
+			{Effect: "Allow", Action: policies.NewStringValues("sts:AssumeRole"), Principal: policies.AWSPrincipal(principal)},
+		},
+	}
+}
+
+// buildFakeAccount returns a fake IAM API for an account with more of
+// each entity than fit on a single page.
+func buildFakeAccount() *fakeIAM {
+	f := newFakeIAM("123456789012")
+
+	readOnly := "arn:aws:iam::aws:policy/ReadOnlyAccess"
+	f.policies[readOnly] = fakePolicy{name: "ReadOnlyAccess", document: allowPolicy("s3:Get*", "*"), attached: true}
+	f.policyOrder = append(f.policyOrder, readOnly)
+
+	bucket := f.addPolicy("bucket", allowPolicy("s3:PutObject", "arn:aws:s3:::bucket/*"), true)
+	queue := f.addPolicy("queue", allowPolicy("sqs:SendMessage", "*"), true)
+	table := f.addPolicy("table", allowPolicy("dynamodb:GetItem", "*"), true)
+	boundary := f.addPolicy("boundary", allowPolicy("s3:*", "*"), false)
+
+	f.roles = []fakeEntity{
+		{
+			name:     "app",
+			attached: []string{readOnly, bucket, queue},
+			inline: map[string]policies.AWSIAMPolicy{
+				"a": allowPolicy("sns:Publish", "*"),
+				"b": allowPolicy("kms:Decrypt", "*"),
+				"c": allowPolicy("ssm:GetParameter", "*"),
+			},
+			boundary: boundary,
+			trust:    trustPolicy("arn:aws:iam::123456789012:root"),
+		},
+	}
+	for i := 0; i < 4; i++ {
+		f.roles = append(f.roles, fakeEntity{name: fmt.Sprintf("role-%d", i), trust: trustPolicy("arn:aws:iam::123456789012:root")})
+	}
+
+	f.users = []fakeEntity{
+		{name: "alice", attached: []string{table}, groups: []string{"admins", "developers", "readers"}, boundary: boundary},
+		{name: "bob", inline: map[string]policies.AWSIAMPolicy{"inline": allowPolicy("s3:ListBucket", "*")}},
+		{name: "carol"},
+	}
+	f.groups = []fakeEntity{
+		{name: "admins", attached: []string{readOnly}},
+		{name: "developers", inline: map[string]policies.AWSIAMPolicy{"dev": allowPolicy("lambda:InvokeFunction", "*")}},
+		{name: "readers"},
+	}
+	f.instanceProfiles = map[string][]string{
+		"app":   {"app"},
+		"other": {"role-0"},
+		"empty": {},
+	}
+	return f
+}
+
+func newTestAuditor() *Auditor {
+	a := New()
+	a.retryBackoff = time.Millisecond
+	return a
+}
+
+func TestLoadAccount(t *testing.T) {
+	a := newTestAuditor()
+	err := a.loadAccount(context.Background(), buildFakeAccount())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Len(t, a.GetRoles(), 5)
+	assert.Len(t, a.GetUsers(), 3)
+	assert.Len(t, a.GetGroups(), 3)
+	assert.Len(t, a.GetInstanceProfiles(), 3)
+
+	// the boundary isn't attached to any entity, so it is fetched when it is referenced
+	var arns []string
+	for _, p := range a.GetManagedPolicies() {
+		arns = append(arns, p.ARN)
+	}
+	assert.Equal(t, []string{
+		"arn:aws:iam::123456789012:policy/boundary",
+		"arn:aws:iam::123456789012:policy/bucket",
+		"arn:aws:iam::123456789012:policy/queue",
+		"arn:aws:iam::123456789012:policy/table",
+		"arn:aws:iam::aws:policy/ReadOnlyAccess",
+	}, arns)
+
+	app := a.GetRoleByARN("arn:aws:iam::123456789012:role/app")
+	if assert.NotNil(t, app) {
+		assert.Equal(t, "123456789012", app.AccountID)
+		assert.Len(t, app.ManagedPolicies, 3)
+		assert.Equal(t, allowPolicy("s3:PutObject", "arn:aws:s3:::bucket/*"), app.ManagedPolicies[1].Document)
+		assert.Len(t, app.InlinePolicies, 3)
+		if assert.NotNil(t, app.PermissionsBoundary) {
+			assert.Equal(t, "arn:aws:iam::123456789012:policy/boundary", app.PermissionsBoundary.ARN)
+		}
+		assert.Equal(t, "arn:aws:iam::123456789012:root", app.TrustPolicyDocument.Statement[0].Principal.AWS.Values[0])
+	}
+
+	for _, u := range a.GetUsers() {
+		if u.Name == "alice" {
+			assert.Equal(t, []string{
+				"arn:aws:iam::123456789012:group/admins",
+				"arn:aws:iam::123456789012:group/developers",
+				"arn:aws:iam::123456789012:group/readers",
+			}, u.Groups)
+			assert.Len(t, u.ManagedPolicies, 1)
+			assert.NotNil(t, u.PermissionsBoundary)
+		}
+	}
+
+	for _, ip := range a.GetInstanceProfiles() {
+		if ip.Name == "app" {
+			assert.Equal(t, []string{"arn:aws:iam::123456789012:role/app"}, ip.Roles)
+		}
+	}
+}
+
+func TestLoadAccountRetriesThrottledRequests(t *testing.T) {
+	f := buildFakeAccount()
+	f.throttle = 5
+
+	a := newTestAuditor()
+	err := a.loadAccount(context.Background(), f)
+	assert.NoError(t, err)
+	assert.Len(t, a.GetRoles(), 5)
+}
+
+func TestLoadAccountGivesUpAfterMaxRetries(t *testing.T) {
+	f := buildFakeAccount()
+	f.throttle = 100
+
+	a := newTestAuditor()
+	a.maxRetries = 2
+	err := a.loadAccount(context.Background(), f)
+	assert.True(t, isThrottlingError(err))
+	assert.Equal(t, 3, f.calls)
+}
+
+func TestLoadAccountLimitsConcurrency(t *testing.T) {
+	f := buildFakeAccount()
+	for i := 4; i < 30; i++ {
+		f.roles = append(f.roles, fakeEntity{name: fmt.Sprintf("role-%d", i), trust: trustPolicy("arn:aws:iam::123456789012:root")})
+	}
+
+	a := newTestAuditor()
+	a.concurrency = 3
+	err := a.loadAccount(context.Background(), f)
+	assert.NoError(t, err)
+	assert.Len(t, a.GetRoles(), 31)
+	assert.LessOrEqual(t, f.maxInFlight, 3)
+	assert.Greater(t, f.maxInFlight, 1)
+}
+
+func TestFetchedPolicyRoundTrips(t *testing.T) {
+	// single string and list elements must be rendered as they were fetched
+	doc := `{"Version":"2012-10-17","Statement":[{"Sid":"Read","Effect":"Allow","Action":"s3:GetObject","Resource":["arn:aws:s3:::bucket/*"],"Condition":{"StringLike":{"s3:prefix":"home/${aws:username}/*"}}},{"Effect":"Deny","NotAction":["iam:*","sts:*"],"NotResource":"arn:aws:iam::*:role/admin"}]}`
+	f := newFakeIAM("123456789012")
+	policyARN := f.arn("policy/raw")
+	f.policies[policyARN] = fakePolicy{name: "raw", raw: doc, attached: true}
+
+	a := newTestAuditor()
+	err := a.fetchPolicyDetails(context.Background(), f, types.Policy{Arn: aws.String(policyARN), DefaultVersionId: aws.String("v1")})
+	if !assert.NoError(t, err) {
+		return
+	}
+	managed := a.GetManagedPolicies()
+	if !assert.Len(t, managed, 1) {
+		return
+	}
+	rendered, err := json.Marshal(managed[0].Document)
+	assert.NoError(t, err)
+	assert.Equal(t, doc, string(rendered))
+}
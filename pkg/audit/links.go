@@ -1,36 +1,273 @@
 package audit
 
-import "github.com/google/uuid"
+import (
+	"regexp"
+	"sort"
+	"strings"
 
+	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/google/uuid"
+)
+
+// AssumeRoleLink is an edge in the assume role graph, meaning that the
+// source principal can call `sts:AssumeRole` on the target role.
 type AssumeRoleLink struct {
 	ID        string `json:"id"`
 	SourceARN string `json:"sourceARN"`
 	TargetARN string `json:"targetARN"`
+	// Statements are the Allow statements in the source's policies and
+	// the target's trust policy which justify the link.
+	Statements []LinkStatement `json:"statements,omitempty"`
+	// Conditional is true if the link depends on condition keys which
+	// can't be determined from the inventory, such as sts:ExternalId or
+	// aws:MultiFactorAuthPresent. The conditions are in the statements
+	// which are marked as conditional.
+	Conditional bool `json:"conditional,omitempty"`
+}
+
+// LinkStatement is a policy statement which allows a link between two principals
+type LinkStatement struct {
+	PolicyType policies.PolicyType `json:"policyType"`
+	// Policy identifies the policy containing the statement: the ARN of a
+	// managed policy, the name of an inline policy, or "trust-policy".
+	Policy    string                   `json:"policy"`
+	Statement policies.AWSIAMStatement `json:"statement"`
+	// Conditional is true if the statement's condition depends on keys
+	// which can't be determined from the inventory. Deny statements are
+	// only included if they are conditional.
+	Conditional bool `json:"conditional,omitempty"`
+}
+
+// trustPolicyID identifies statements from a role's trust policy in links
+const trustPolicyID = "trust-policy"
+
+// PrincipalType is the type of an IAM principal in the assume role graph
+type PrincipalType string
+
+const (
+	PrincipalTypeRole PrincipalType = "role"
+	PrincipalTypeUser PrincipalType = "user"
+)
+
+// principal is an IAM role or user which may be able to assume roles.
+// The Id of each policy identifies where the policy came from, so that
+// the statements justifying a link can be reported.
+type principal struct {
+	ARN       string
+	AccountID string
+	Type      PrincipalType
+	Policies  []policies.AWSIAMPolicy
+	Boundary  *policies.AWSIAMPolicy
+}
+
+// labelPolicy returns a copy of the policy with its Id set to the label.
+func labelPolicy(doc policies.AWSIAMPolicy, label string) policies.AWSIAMPolicy {
+	doc.Id = &label
+	return doc
+}
+
+func labelledPolicies(managed []ManagedPolicy, inline []InlinePolicy) []policies.AWSIAMPolicy {
+	ps := []policies.AWSIAMPolicy{}
+	for _, p := range managed {
+		ps = append(ps, labelPolicy(p.Document, p.ARN))
+	}
+	for _, p := range inline {
+		ps = append(ps, labelPolicy(p.Document, p.Name))
+	}
+	return ps
+}
+
+func rolePrincipal(r AWSRole) principal {
+	p := principal{
+		ARN:       r.ARN,
+		AccountID: r.AccountID,
+		Type:      PrincipalTypeRole,
+		Policies:  labelledPolicies(r.ManagedPolicies, r.InlinePolicies),
+	}
+	if r.PermissionsBoundary != nil {
+		b := labelPolicy(r.PermissionsBoundary.Document, r.PermissionsBoundary.ARN)
+		p.Boundary = &b
+	}
+	return p
 }
 
-// BuildLinks looks through all roles in the cache and checks whether
-// the source role can assume the target role.
+// userPrincipal includes the policies of the groups the user is a member of.
+func userPrincipal(u AWSUser, groups map[string]AWSGroup) principal {
+	p := principal{
+		ARN:       u.ARN,
+		AccountID: u.AccountID,
+		Type:      PrincipalTypeUser,
+		Policies:  labelledPolicies(u.ManagedPolicies, u.InlinePolicies),
+	}
+	for _, arn := range u.Groups {
+		if g, ok := groups[arn]; ok {
+			p.Policies = append(p.Policies, labelledPolicies(g.ManagedPolicies, g.InlinePolicies)...)
+		}
+	}
+	if u.PermissionsBoundary != nil {
+		b := labelPolicy(u.PermissionsBoundary.Document, u.PermissionsBoundary.ARN)
+		p.Boundary = &b
+	}
+	return p
+}
+
+// evaluateAssumeRole evaluates whether the principal can call `sts:AssumeRole`
+// on the target role. Only the principal's ARN and account are known, so
+// conditions on other keys are treated as conditions which could be satisfied.
+func evaluateAssumeRole(source principal, target AWSRole) policies.EvaluationResult {
+	ps := policies.PolicySet{
+		Identity:               source.Policies,
+		Resource:               []policies.AWSIAMPolicy{labelPolicy(target.TrustPolicyDocument.policy(), trustPolicyID)},
+		ResourcePolicyRequired: true,
+		PermissionsBoundary:    source.Boundary,
+	}
+	req := policies.Request{
+		Principal: source.ARN,
+		Action:    "sts:AssumeRole",
+		Resource:  target.ARN,
+		Context: map[string][]string{
+			"aws:PrincipalArn":     {source.ARN},
+			"aws:PrincipalAccount": {source.AccountID},
+		},
+		PartialContext: true,
+	}
+	return policies.Evaluate(ps, req)
+}
+
+// principals returns the roles and users in the inventory which may
+// assume roles.
+func (a *Auditor) principals() []principal {
+	groups := map[string]AWSGroup{}
+	for _, g := range a.GetGroups() {
+		groups[g.ARN] = g
+	}
+
+	result := []principal{}
+	for _, r := range a.roleStorage.List() {
+		result = append(result, rolePrincipal(r))
+	}
+	for _, u := range a.GetUsers() {
+		result = append(result, userPrincipal(u, groups))
+	}
+	return result
+}
+
+var accountIDRegex = regexp.MustCompile(`^\d{12}$`)
+
+// principalIndex finds the principals which a trust policy could
+// apply to, so that the policies of every principal don't need to be
+// evaluated against every role.
+type principalIndex struct {
+	all       []int
+	byARN     map[string][]int
+	byAccount map[string][]int
+}
+
+func newPrincipalIndex(ps []principal) principalIndex {
+	idx := principalIndex{byARN: map[string][]int{}, byAccount: map[string][]int{}}
+	for i, p := range ps {
+		idx.all = append(idx.all, i)
+		idx.byARN[p.ARN] = append(idx.byARN[p.ARN], i)
+		idx.byAccount[p.AccountID] = append(idx.byAccount[p.AccountID], i)
+	}
+	return idx
+}
+
+// candidates returns the indexes of principals which may be allowed by
+// the trust policy. The result is a superset of the principals which
+// the policy allows: each candidate is then evaluated.
+func (idx principalIndex) candidates(trust TrustPolicyDocument) []int {
+	seen := map[int]bool{}
+	add := func(is []int) {
+		for _, i := range is {
+			seen[i] = true
+		}
+	}
+
+	for _, s := range trust.Statement {
+		if !strings.EqualFold(s.Effect, "Allow") || !s.MatchesAction("sts:AssumeRole") {
+			continue
+		}
+		if s.NotPrincipal != nil || (s.Principal != nil && s.Principal.Wildcard) {
+			return idx.all
+		}
+		if s.Principal == nil {
+			continue
+		}
+		for _, v := range s.Principal.AWS.Values {
+			switch {
+			case v == "*" || strings.ContainsAny(v, "*?"):
+				return idx.all
+			case accountIDRegex.MatchString(v):
+				add(idx.byAccount[v])
+			case strings.HasSuffix(v, ":root"):
+				add(idx.byAccount[accountFromARN(v)])
+			case len(idx.byARN[v]) > 0:
+				add(idx.byARN[v])
+			default:
+				// principals such as assumed role sessions are matched
+				// against every principal in their account
+				add(idx.byAccount[accountFromARN(v)])
+			}
+		}
+	}
+
+	result := []int{}
+	for i := range seen {
+		result = append(result, i)
+	}
+	sort.Ints(result)
+	return result
+}
+
+// accountFromARN returns the account ID in an ARN, or an empty string
+// if the ARN can't be parsed.
+func accountFromARN(s string) string {
+	split := strings.SplitN(s, ":", 6)
+	if len(split) < 6 {
+		return ""
+	}
+	return split[4]
+}
+
+// BuildLinks builds the assume role graph, by checking whether each
+// role and user in the cache can assume each role.
 //
-// Note: initial implementation is O(N^2) efficiency
+// Policies are evaluated using the AWS policy evaluation logic, so
+// wildcards, account root principals, `sts:*` and explicit Deny
+// statements are taken into account. Principals are only evaluated
+// against roles whose trust policies could allow them. Links which
+// depend on conditions such as an external ID or MFA are marked as
+// conditional.
 func (a *Auditor) BuildLinks() {
 	links := []AssumeRoleLink{}
 
-	roles := a.roleStorage.List()
+	sources := a.principals()
+	idx := newPrincipalIndex(sources)
 
-	for _, source := range roles {
-		for _, target := range roles {
+	for _, target := range a.roleStorage.List() {
+		for _, i := range idx.candidates(target.TrustPolicyDocument) {
+			source := sources[i]
 			// don't compare the source against itself
 			if source.ARN == target.ARN {
 				continue
 			}
-			if source.CanAssume(target) {
-				link := AssumeRoleLink{
-					ID:        uuid.NewString(),
-					SourceARN: source.ARN,
-					TargetARN: target.ARN,
-				}
-				links = append(links, link)
+			res := evaluateAssumeRole(source, target)
+			if res.Decision != policies.DecisionAllow {
+				continue
+			}
+			link := AssumeRoleLink{
+				ID:          uuid.NewString(),
+				SourceARN:   source.ARN,
+				TargetARN:   target.ARN,
+				Statements:  []LinkStatement{},
+				Conditional: res.Conditional,
+			}
+			for _, m := range res.MatchedStatements {
+				ls := LinkStatement{PolicyType: m.PolicyType, Policy: m.PolicyID, Statement: m.Statement, Conditional: m.Conditional}
+				link.Statements = append(link.Statements, ls)
 			}
+			links = append(links, link)
 		}
 	}
 	a.links = links
@@ -18,8 +18,8 @@ func TestCanAssume_BasicCase(t *testing.T) {
 						{
 							Sid:      "1",
 							Effect:   "Allow",
-							Action:   []string{"sts:AssumeRole"},
-							Resource: []string{"arn:aws:iam::111222333444:role/target"},
+							Action:   policies.NewStringValues("sts:AssumeRole"),
+							Resource: policies.NewStringValues("arn:aws:iam::111222333444:role/target"),
 						},
 					},
 				},
@@ -38,11 +38,9 @@ func TestCanAssume_BasicCase(t *testing.T) {
 		TrustPolicyDocument: TrustPolicyDocument{
 			Statement: []policies.AWSIAMStatement{
 				{
-					Effect: "Allow",
-					Action: []string{"sts:AssumeRole"},
-					Principal: &policies.AWSIAMPrincipal{
-						AWS: "arn:aws:iam::123456789012:role/source",
-					},
+					Effect:    "Allow",
+					Action:    policies.NewStringValues("sts:AssumeRole"),
+					Principal: policies.AWSPrincipal("arn:aws:iam::123456789012:role/source"),
 				},
 			},
 		},
@@ -63,8 +61,8 @@ func TestCannotAssumeIfTrustPolicyNotConfigured(t *testing.T) {
 						{
 							Sid:      "1",
 							Effect:   "Allow",
-							Action:   []string{"sts:AssumeRole"},
-							Resource: []string{"arn:aws:iam::111222333444:role/target"},
+							Action:   policies.NewStringValues("sts:AssumeRole"),
+							Resource: policies.NewStringValues("arn:aws:iam::111222333444:role/target"),
 						},
 					},
 				},
@@ -86,3 +84,98 @@ func TestCannotAssumeIfTrustPolicyNotConfigured(t *testing.T) {
 	canAssume := source.CanAssume(target)
 	assert.False(t, canAssume)
 }
+
+func TestCannotAssumeRoleTrustingOnlyAService(t *testing.T) {
+	source := AWSRole{
+		ARN:       "arn:aws:iam::123456789012:role/source",
+		AccountID: "123456789012",
+		InlinePolicies: []InlinePolicy{
+			{
+				Document: policies.AWSIAMPolicy{
+					Statement: []policies.AWSIAMStatement{
+						{
+							Effect:   "Allow",
+							Action:   policies.NewStringValues("sts:AssumeRole"),
+							Resource: policies.NewStringValues("arn:aws:iam::123456789012:role/lambda"),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	target := AWSRole{
+		ARN:       "arn:aws:iam::123456789012:role/lambda",
+		AccountID: "123456789012",
+		TrustPolicyDocument: TrustPolicyDocument{
+			Statement: []policies.AWSIAMStatement{
+				{
+					Effect:    "Allow",
+					Action:    policies.NewStringValues("sts:AssumeRole"),
+					Principal: policies.ServicePrincipal("lambda.amazonaws.com"),
+				},
+			},
+		},
+	}
+
+	assert.False(t, source.CanAssume(target))
+}
+
+func TestCanAssumeRoleTrustingAccount(t *testing.T) {
+	source := AWSRole{
+		ARN:       "arn:aws:iam::123456789012:role/source",
+		AccountID: "123456789012",
+		InlinePolicies: []InlinePolicy{
+			{
+				Document: policies.AWSIAMPolicy{
+					Statement: []policies.AWSIAMStatement{
+						{
+							Effect:   "Allow",
+							Action:   policies.NewStringValues("sts:AssumeRole"),
+							Resource: policies.NewStringValues("arn:aws:iam::111222333444:role/target"),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	target := AWSRole{
+		ARN:       "arn:aws:iam::111222333444:role/target",
+		AccountID: "111222333444",
+		TrustPolicyDocument: TrustPolicyDocument{
+			Statement: []policies.AWSIAMStatement{
+				{
+					Effect:    "Allow",
+					Action:    policies.NewStringValues("sts:AssumeRole"),
+					Principal: policies.AWSPrincipal("arn:aws:iam::123456789012:root"),
+				},
+			},
+		},
+	}
+
+	assert.True(t, source.CanAssume(target))
+}
+
+func TestTrustRelationshipWithLowercaseEffect(t *testing.T) {
+	source := AWSRole{
+		ARN:       "arn:aws:iam::123456789012:role/source",
+		AccountID: "123456789012",
+	}
+
+	target := AWSRole{
+		ARN:       "arn:aws:iam::111222333444:role/target",
+		AccountID: "111222333444",
+		TrustPolicyDocument: TrustPolicyDocument{
+			Statement: []policies.AWSIAMStatement{
+				{
+					Effect:    "allow",
+					Action:    policies.NewStringValues("sts:AssumeRole"),
+					Principal: policies.AWSPrincipal("arn:aws:iam::123456789012:role/source"),
+				},
+			},
+		},
+	}
+
+	assert.True(t, target.HasTrustRelationshipAllowingSourceAssumption(source))
+}
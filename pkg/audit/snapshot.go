@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/pkg/errors"
+)
+
+// SnapshotVersion is the version of the snapshot format written by the
+// auditor. It must be incremented when a change to the format means
+// older snapshots can't be loaded.
+const SnapshotVersion = 1
+
+// Snapshot is a serialisable copy of the auditor's inventory.
+// Snapshots allow the inventory to be loaded without calling AWS, so that
+// an environment can be audited offline and the collector doesn't need to
+// re-crawl every account when it restarts.
+type Snapshot struct {
+	Version          int                    `json:"version"`
+	CreatedAt        time.Time              `json:"createdAt"`
+	Roles            []AWSRole              `json:"roles"`
+	Users            []AWSUser              `json:"users"`
+	Groups           []AWSGroup             `json:"groups"`
+	InstanceProfiles []InstanceProfile      `json:"instanceProfiles"`
+	ManagedPolicies  []ManagedPolicy        `json:"managedPolicies"`
+	CDKResources     []policies.CDKResource `json:"cdkResources"`
+	IaCSources       []policies.IaCSource   `json:"iacSources"`
+	Links            []AssumeRoleLink       `json:"links"`
+}
+
+// Snapshot returns a copy of the auditor's inventory.
+// Entities are sorted by ARN so that snapshots of the same inventory
+// are identical apart from their creation time.
+func (a *Auditor) Snapshot() Snapshot {
+	s := Snapshot{
+		Version:          SnapshotVersion,
+		CreatedAt:        time.Now().UTC(),
+		Roles:            append([]AWSRole{}, a.GetRoles()...),
+		Users:            append([]AWSUser{}, a.GetUsers()...),
+		Groups:           append([]AWSGroup{}, a.GetGroups()...),
+		InstanceProfiles: append([]InstanceProfile{}, a.GetInstanceProfiles()...),
+		ManagedPolicies:  a.GetManagedPolicies(),
+		CDKResources:     append([]policies.CDKResource{}, a.cdkResources.List()...),
+		IaCSources:       append([]policies.IaCSource{}, a.iacSources.List()...),
+		Links:            append([]AssumeRoleLink{}, a.GetLinks()...),
+	}
+
+	sort.Slice(s.Roles, func(i, j int) bool { return s.Roles[i].ARN < s.Roles[j].ARN })
+	sort.Slice(s.Users, func(i, j int) bool { return s.Users[i].ARN < s.Users[j].ARN })
+	sort.Slice(s.Groups, func(i, j int) bool { return s.Groups[i].ARN < s.Groups[j].ARN })
+	sort.Slice(s.InstanceProfiles, func(i, j int) bool { return s.InstanceProfiles[i].ARN < s.InstanceProfiles[j].ARN })
+	sort.Slice(s.CDKResources, func(i, j int) bool {
+		if s.CDKResources[i].StackID != s.CDKResources[j].StackID {
+			return s.CDKResources[i].StackID < s.CDKResources[j].StackID
+		}
+		return s.CDKResources[i].LogicalID < s.CDKResources[j].LogicalID
+	})
+	sort.Slice(s.IaCSources, func(i, j int) bool {
+		if s.IaCSources[i].StackID != s.IaCSources[j].StackID {
+			return s.IaCSources[i].StackID < s.IaCSources[j].StackID
+		}
+		return s.IaCSources[i].LogicalID < s.IaCSources[j].LogicalID
+	})
+	sort.Slice(s.Links, func(i, j int) bool {
+		if s.Links[i].SourceARN != s.Links[j].SourceARN {
+			return s.Links[i].SourceARN < s.Links[j].SourceARN
+		}
+		return s.Links[i].TargetARN < s.Links[j].TargetARN
+	})
+	return s
+}
+
+// LoadSnapshot adds the entities in a snapshot to the auditor's inventory.
+func (a *Auditor) LoadSnapshot(s Snapshot) error {
+	if s.Version != SnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d (expected version %d)", s.Version, SnapshotVersion)
+	}
+
+	for _, r := range s.Roles {
+		a.roleStorage.Add(r)
+	}
+	for _, u := range s.Users {
+		a.entityStorage.AddUser(u)
+	}
+	for _, g := range s.Groups {
+		a.entityStorage.AddGroup(g)
+	}
+	for _, ip := range s.InstanceProfiles {
+		a.entityStorage.AddInstanceProfile(ip)
+	}
+	for _, p := range s.ManagedPolicies {
+		a.policyMap.Store(p.ARN, p.Document)
+	}
+	for _, r := range s.CDKResources {
+		a.cdkResources.Add(r)
+	}
+	for _, src := range s.IaCSources {
+		a.iacSources.Add(src)
+	}
+	a.links = append(a.links, s.Links...)
+	return nil
+}
+
+// ExportSnapshot writes a snapshot of the auditor's inventory to a JSON file.
+func (a *Auditor) ExportSnapshot(path string) error {
+	b, err := json.MarshalIndent(a.Snapshot(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// ImportSnapshot loads a snapshot written by ExportSnapshot into the
+// auditor's inventory.
+func (a *Auditor) ImportSnapshot(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var s Snapshot
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		return errors.Wrapf(err, "parsing snapshot %s", path)
+	}
+	return a.LoadSnapshot(s)
+}
+
+// LoadInventory populates the auditor's inventory.
+//
+// If a snapshot file has been provided with the -audit-snapshot flag, the
+// inventory is loaded from it and AWS isn't called. Otherwise, the IAM
+// inventory is loaded from the accounts of each audit role, along with
+// CloudFormation stacks if loadStacks is true. Files passed with the
+// -audit-authorization-details flag are then loaded, allowing accounts
+// to be audited offline. Assume role links are built if they weren't
+// included in the snapshot, or if any authorization details were loaded.
+//
+// If the -audit-snapshot-out flag is set, a snapshot of the inventory is
+// written to it once loaded.
+func (a *Auditor) LoadInventory(ctx context.Context, loadStacks bool) error {
+	if a.snapshotPath != "" {
+		a.log.With("path", a.snapshotPath).Info("loading audit inventory from snapshot")
+		err := a.ImportSnapshot(a.snapshotPath)
+		if err != nil {
+			return errors.Wrap(err, "importing audit snapshot")
+		}
+	} else if a.HasAuditRoles() {
+		err := a.LoadResources(ctx)
+		if err != nil {
+			return errors.Wrap(err, "loading IAM inventory")
+		}
+		if loadStacks {
+			err = a.LoadCloudFormationStacks(ctx)
+			if err != nil {
+				return errors.Wrap(err, "loading CloudFormation stacks")
+			}
+		}
+	}
+
+	for _, path := range a.authorizationDetailsFiles {
+		a.log.With("path", path).Info("loading authorization details")
+		err := a.LoadAuthorizationDetailsFile(path)
+		if err != nil {
+			return errors.Wrap(err, "loading authorization details")
+		}
+	}
+
+	// links are rebuilt if anything was loaded alongside the snapshot, so that
+	// the roles, users and groups in authorization details files are linked
+	if len(a.links) == 0 || len(a.authorizationDetailsFiles) > 0 {
+		a.BuildLinks()
+	}
+
+	if a.snapshotOutPath != "" {
+		err := a.ExportSnapshot(a.snapshotOutPath)
+		if err != nil {
+			return errors.Wrap(err, "exporting audit snapshot")
+		}
+		a.log.With("path", a.snapshotOutPath).Info("wrote audit inventory snapshot")
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportSnapshotFixture(t *testing.T) {
+	a := newTestAuditor()
+	a.snapshotPath = filepath.Join("testdata", "snapshot.json")
+
+	err := a.LoadInventory(context.Background(), false)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, a.GetRoles(), 3)
+	assert.Len(t, a.GetManagedPolicies(), 1)
+
+	// the links weren't included in the snapshot, so they are built when it is loaded
+	links := a.GetLinks()
+	if assert.Len(t, links, 1) {
+		assert.Equal(t, "arn:aws:iam::123456789012:role/source", links[0].SourceARN)
+		assert.Equal(t, "arn:aws:iam::111222333444:role/target", links[0].TargetARN)
+	}
+}
+
+func TestLoadInventoryFromSnapshotAndAuthorizationDetails(t *testing.T) {
+	// write a snapshot which includes its assume role links
+	a := newTestAuditor()
+	err := a.ImportSnapshot(filepath.Join("testdata", "snapshot.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	a.BuildLinks()
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	err = a.ExportSnapshot(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	b := newTestAuditor()
+	b.snapshotPath = path
+	b.authorizationDetailsFiles = stringList{filepath.Join("testdata", "authorization-details.json")}
+	err = b.LoadInventory(context.Background(), false)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the roles loaded from the authorization details are linked as well as
+	// those loaded from the snapshot
+	targets := map[string]bool{}
+	for _, l := range b.GetLinks() {
+		targets[l.TargetARN] = true
+	}
+	assert.True(t, targets["arn:aws:iam::111222333444:role/target"])
+	assert.True(t, targets["arn:aws:iam::123456789012:role/target"])
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	a := newTestAuditor()
+	err := a.loadAccount(context.Background(), buildFakeAccount())
+	if !assert.NoError(t, err) {
+		return
+	}
+	a.BuildLinks()
+	a.iacSources.Add(policies.IaCSource{
+		Framework:  policies.IaCFrameworkSAM,
+		StackID:    "arn:aws:cloudformation:us-east-1:123456789012:stack/sam-app/1",
+		StackName:  "sam-app",
+		LogicalID:  "HelloFunctionRole",
+		PhysicalID: "sam-app-HelloFunctionRole",
+		AccountID:  "123456789012",
+		Type:       "AWS::IAM::Role",
+	})
+
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	err = a.ExportSnapshot(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	b := newTestAuditor()
+	err = b.ImportSnapshot(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	want, got := a.Snapshot(), b.Snapshot()
+	want.CreatedAt = got.CreatedAt
+	assert.Equal(t, want, got)
+}
+
+func TestLoadSnapshotUnsupportedVersion(t *testing.T) {
+	a := newTestAuditor()
+	err := a.LoadSnapshot(Snapshot{Version: SnapshotVersion + 1})
+	assert.Error(t, err)
+	assert.Empty(t, a.GetRoles())
+}
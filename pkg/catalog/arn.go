@@ -0,0 +1,219 @@
+package catalog
+
+import (
+	"regexp"
+	"strings"
+)
+
+// maxListValues is the maximum number of values from a list parameter which
+// will be expanded into separate ARNs. Lists larger than this are
+// treated as a wildcard to keep generated policies a reasonable size.
+const maxListValues = 10
+
+var arnVariableRegex = regexp.MustCompile(`\$\{([A-Za-z0-9]+)\}`)
+
+// ARNContext holds the values for the built-in ARN variables
+// ${Partition}, ${Region} and ${Account}.
+type ARNContext struct {
+	Partition string
+	Region    string
+	Account   string
+}
+
+// RenderedARN is a resource ARN rendered from request parameters
+type RenderedARN struct {
+	ARN string
+	// Name is a human-friendly name for the resource, built from
+	// the resource-specific variables in the ARN, e.g. "my-bucket/my-key".
+	Name string
+}
+
+// Rendering is the result of rendering a resource type's ARN format
+type Rendering struct {
+	ARNs []RenderedARN
+	// Resolved is the number of ARN variables which were resolved
+	Resolved int
+	// Unresolved is the number of ARN variables which were replaced with a wildcard
+	Unresolved int
+}
+
+// PartitionForRegion returns the AWS partition that a region belongs to.
+func PartitionForRegion(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	case strings.HasPrefix(region, "us-iso-"):
+		return "aws-iso"
+	case strings.HasPrefix(region, "us-isob-"):
+		return "aws-iso-b"
+	}
+	return "aws"
+}
+
+func isBuiltinVariable(v string) bool {
+	return v == "Partition" || v == "Region" || v == "Account"
+}
+
+// Variables returns the variables in the resource type's ARN format in
+// the order they appear, e.g. ["Partition", "BucketName", "ObjectName"].
+func (r ResourceType) Variables() []string {
+	vars := []string{}
+	seen := map[string]bool{}
+	for _, m := range arnVariableRegex.FindAllStringSubmatch(r.ARN, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			vars = append(vars, m[1])
+		}
+	}
+	return vars
+}
+
+// Render renders the ARN format using the provided request parameters.
+// Variables which can't be resolved from the parameters are replaced with a
+// "*" wildcard. If a parameter holds a list of values, an ARN is rendered
+// for each value.
+func (r ResourceType) Render(ctx ARNContext, params map[string]interface{}) Rendering {
+	vars := r.Variables()
+
+	// if the request contains the full ARN of the resource, use it directly.
+	for _, p := range r.ARNParameters {
+		if s, ok := params[p].(string); ok && strings.HasPrefix(s, "arn:") {
+			return Rendering{
+				ARNs:     []RenderedARN{{ARN: s, Name: friendlyNameFromARN(s)}},
+				Resolved: len(vars),
+			}
+		}
+	}
+
+	var res Rendering
+	values := map[string][]string{}
+
+	for _, v := range vars {
+		var resolved []string
+		switch v {
+		case "Partition":
+			resolved = []string{ctx.Partition}
+			if ctx.Partition == "" {
+				resolved = []string{PartitionForRegion(ctx.Region)}
+			}
+		case "Region":
+			if ctx.Region != "" {
+				resolved = []string{ctx.Region}
+			}
+		case "Account":
+			if ctx.Account != "" {
+				resolved = []string{ctx.Account}
+			}
+		default:
+			resolved = resolveParameter(r.Parameters[v], params)
+		}
+
+		if len(resolved) == 0 {
+			res.Unresolved++
+			resolved = []string{"*"}
+		} else {
+			res.Resolved++
+		}
+		values[v] = resolved
+	}
+
+	// expand the ARN format for every combination of variable values
+	arns := []RenderedARN{{ARN: r.ARN}}
+	for _, v := range vars {
+		expanded := []RenderedARN{}
+		for _, a := range arns {
+			for _, val := range values[v] {
+				name := a.Name
+				if !isBuiltinVariable(v) && val != "*" {
+					if name != "" {
+						name += "/"
+					}
+					name += val
+				}
+				expanded = append(expanded, RenderedARN{
+					ARN:  strings.ReplaceAll(a.ARN, "${"+v+"}", val),
+					Name: name,
+				})
+			}
+		}
+		arns = expanded
+	}
+
+	// match the advisory templates, which name resources "unknown" if they can't be parsed
+	for i := range arns {
+		if arns[i].Name == "" {
+			arns[i].Name = "unknown"
+		}
+	}
+	res.ARNs = arns
+	return res
+}
+
+// resolveParameter looks up the first parameter in `specs` which has a
+// usable value in the request parameters.
+func resolveParameter(specs []string, params map[string]interface{}) []string {
+	for _, spec := range specs {
+		split := strings.SplitN(spec, "|", 2)
+		name := split[0]
+		modifier := ""
+		if len(split) == 2 {
+			modifier = split[1]
+		}
+
+		raw := []string{}
+		switch val := params[name].(type) {
+		case string:
+			raw = append(raw, val)
+		case []string:
+			raw = append(raw, val...)
+		case []interface{}:
+			for _, item := range val {
+				s, ok := item.(string)
+				if !ok {
+					raw = nil
+					break
+				}
+				raw = append(raw, s)
+			}
+		}
+		if len(raw) == 0 || len(raw) > maxListValues {
+			continue
+		}
+
+		values := []string{}
+		for _, s := range raw {
+			s = applyModifier(s, modifier)
+			if s == "" {
+				values = nil
+				break
+			}
+			values = append(values, s)
+		}
+		if len(values) > 0 {
+			return values
+		}
+	}
+	return nil
+}
+
+func applyModifier(value, modifier string) string {
+	switch modifier {
+	case "last":
+		split := strings.Split(strings.TrimSuffix(value, "/"), "/")
+		return split[len(split)-1]
+	case "trim":
+		return strings.TrimPrefix(value, "/")
+	}
+	return value
+}
+
+// friendlyNameFromARN returns the resource section of an ARN
+func friendlyNameFromARN(arn string) string {
+	split := strings.SplitN(arn, ":", 6)
+	if len(split) < 6 {
+		return arn
+	}
+	return split[5]
+}
@@ -0,0 +1,245 @@
+// Package catalog contains a catalog of AWS IAM actions, the resource types
+// each action accepts, and the ARN formats for each resource type.
+//
+// The catalog follows the structure of the AWS Service Authorization Reference
+// (https://docs.aws.amazon.com/service-authorization/latest/reference/reference_policies_actions-resources-contextkeys.html)
+// and is shipped as data embedded in the binary. To extend the catalog, edit
+// catalog.json - no code changes are required.
+package catalog
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Access levels as used in the Service Authorization Reference.
+const (
+	AccessLevelList                  = "List"
+	AccessLevelRead                  = "Read"
+	AccessLevelWrite                 = "Write"
+	AccessLevelPermissionsManagement = "Permissions management"
+	AccessLevelTagging               = "Tagging"
+)
+
+//go:embed catalog.json
+var embeddedCatalog []byte
+
+// Catalog holds IAM actions and resource types for AWS services
+type Catalog struct {
+	Version int `json:"version"`
+	// Services is keyed by the IAM service prefix, e.g. "s3"
+	Services map[string]*Service `json:"services"`
+
+	// aliases maps SDK service names to IAM service prefixes
+	aliases map[string]string
+}
+
+// Service describes the IAM actions and resource types for an AWS service
+type Service struct {
+	Name string `json:"name"`
+	// Aliases are SDK service names which differ from the IAM service prefix,
+	// for example "sfn" for the "states" IAM prefix.
+	Aliases []string `json:"aliases,omitempty"`
+	// Actions is keyed by the IAM action name without the service prefix, e.g. "GetObject"
+	Actions map[string]Action `json:"actions"`
+	// ResourceTypes is keyed by the resource type name, e.g. "object"
+	ResourceTypes map[string]ResourceType `json:"resourceTypes"`
+	// Operations maps SDK operation names to the IAM actions which authorize
+	// them, for operations where the names differ.
+	// For example, the S3 HeadObject operation is authorized by s3:GetObject.
+	Operations map[string][]string `json:"operations,omitempty"`
+}
+
+// Action is an IAM action
+type Action struct {
+	AccessLevel string `json:"accessLevel"`
+	// ResourceTypes are the resource types which the action can be scoped to,
+	// in order of preference. Actions without resource types only support
+	// the "*" resource.
+	ResourceTypes []string `json:"resourceTypes,omitempty"`
+}
+
+// ResourceType is an AWS resource type which IAM actions can be scoped to
+type ResourceType struct {
+	// ARN is the ARN format of the resource, e.g. "arn:${Partition}:s3:::${BucketName}"
+	ARN string `json:"arn"`
+	// Parameters maps each variable in the ARN format to a list of request
+	// parameters which can be used to resolve it, in order of preference.
+	//
+	// A parameter may be followed by a modifier to transform its value:
+	//   "QueueUrl|last" uses the section of the value after the last "/"
+	//   "Name|trim" removes a leading "/" from the value
+	Parameters map[string][]string `json:"parameters,omitempty"`
+	// ARNParameters are request parameters which may contain the full ARN of the resource
+	ARNParameters []string `json:"arnParameters,omitempty"`
+}
+
+var (
+	defaultCatalog     *Catalog
+	defaultCatalogOnce sync.Once
+)
+
+// Default returns the catalog embedded in the binary.
+// It panics if the embedded catalog is invalid, which is
+// guarded against by the package tests.
+func Default() *Catalog {
+	defaultCatalogOnce.Do(func() {
+		c, err := Parse(embeddedCatalog)
+		if err != nil {
+			panic(errors.Wrap(err, "parsing embedded IAM catalog"))
+		}
+		defaultCatalog = c
+	})
+	return defaultCatalog
+}
+
+// Parse parses and validates a JSON catalog
+func Parse(data []byte) (*Catalog, error) {
+	var c Catalog
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	c.aliases = map[string]string{}
+	for prefix, svc := range c.Services {
+		c.aliases[prefix] = prefix
+		for _, alias := range svc.Aliases {
+			c.aliases[strings.ToLower(alias)] = prefix
+		}
+	}
+	return &c, nil
+}
+
+func (c *Catalog) validate() error {
+	for prefix, svc := range c.Services {
+		for name, action := range svc.Actions {
+			if !isValidAccessLevel(action.AccessLevel) {
+				return fmt.Errorf("%s:%s: invalid access level %q", prefix, name, action.AccessLevel)
+			}
+			for _, rt := range action.ResourceTypes {
+				if _, ok := svc.ResourceTypes[rt]; !ok {
+					return fmt.Errorf("%s:%s: resource type %q is not defined", prefix, name, rt)
+				}
+			}
+		}
+		for op, actions := range svc.Operations {
+			for _, a := range actions {
+				if _, ok := c.lookupAction(a); !ok {
+					return fmt.Errorf("%s operation %s: action %q is not defined", prefix, op, a)
+				}
+			}
+		}
+		for name, rt := range svc.ResourceTypes {
+			if !strings.HasPrefix(rt.ARN, "arn:${Partition}:") {
+				return fmt.Errorf("%s resource type %s: ARN %q must begin with arn:${Partition}:", prefix, name, rt.ARN)
+			}
+			for _, v := range rt.Variables() {
+				if isBuiltinVariable(v) {
+					continue
+				}
+				if len(rt.Parameters[v]) == 0 && len(rt.ARNParameters) == 0 {
+					return fmt.Errorf("%s resource type %s: no parameters are mapped to ARN variable %s", prefix, name, v)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func isValidAccessLevel(level string) bool {
+	switch level {
+	case AccessLevelList, AccessLevelRead, AccessLevelWrite, AccessLevelPermissionsManagement, AccessLevelTagging:
+		return true
+	}
+	return false
+}
+
+// ServicePrefix returns the IAM service prefix for an SDK service name.
+// Returns false if the service is not in the catalog.
+func (c *Catalog) ServicePrefix(service string) (string, bool) {
+	prefix, ok := c.aliases[strings.ToLower(service)]
+	return prefix, ok
+}
+
+// ActionsForOperation returns the fully qualified IAM actions (e.g. "s3:GetObject")
+// which authorize an SDK operation.
+// Returns nil if the operation is not in the catalog.
+func (c *Catalog) ActionsForOperation(service, operation string) []string {
+	prefix, ok := c.ServicePrefix(service)
+	if !ok {
+		return nil
+	}
+	svc := c.Services[prefix]
+	if actions, ok := svc.Operations[operation]; ok {
+		return actions
+	}
+	if _, ok := svc.Actions[operation]; ok {
+		return []string{prefix + ":" + operation}
+	}
+	return nil
+}
+
+// Action looks up a fully qualified IAM action such as "s3:GetObject".
+// The lookup is case-insensitive, as IAM action names are.
+func (c *Catalog) Action(name string) (*Action, bool) {
+	return c.lookupAction(name)
+}
+
+func (c *Catalog) lookupAction(name string) (*Action, bool) {
+	split := strings.SplitN(name, ":", 2)
+	if len(split) != 2 {
+		return nil, false
+	}
+	svc, ok := c.Services[strings.ToLower(split[0])]
+	if !ok {
+		return nil, false
+	}
+	if a, ok := svc.Actions[split[1]]; ok {
+		return &a, true
+	}
+	for actionName, a := range svc.Actions {
+		if strings.EqualFold(actionName, split[1]) {
+			action := a
+			return &action, true
+		}
+	}
+	return nil, false
+}
+
+// ResourceType looks up a resource type for the service that the fully
+// qualified IAM action belongs to.
+func (c *Catalog) ResourceType(action, resourceType string) (*ResourceType, bool) {
+	split := strings.SplitN(action, ":", 2)
+	svc, ok := c.Services[strings.ToLower(split[0])]
+	if !ok {
+		return nil, false
+	}
+	rt, ok := svc.ResourceTypes[resourceType]
+	if !ok {
+		return nil, false
+	}
+	return &rt, true
+}
+
+// ActionNames returns all fully qualified action names in the catalog, sorted.
+func (c *Catalog) ActionNames() []string {
+	names := []string{}
+	for prefix, svc := range c.Services {
+		for name := range svc.Actions {
+			names = append(names, prefix+":"+name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
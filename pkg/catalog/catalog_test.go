@@ -0,0 +1,81 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultCatalogIsValid(t *testing.T) {
+	c := Default()
+	assert.NotEmpty(t, c.ActionNames())
+}
+
+func TestActionsForOperation(t *testing.T) {
+	c := Default()
+	assert.Equal(t, []string{"s3:GetObject"}, c.ActionsForOperation("s3", "GetObject"))
+	assert.Equal(t, []string{"s3:GetObject"}, c.ActionsForOperation("s3", "HeadObject"))
+	assert.Equal(t, []string{"states:StartExecution"}, c.ActionsForOperation("sfn", "StartExecution"))
+	assert.Equal(t, []string{"kms:ReEncryptFrom", "kms:ReEncryptTo"}, c.ActionsForOperation("kms", "ReEncrypt"))
+	assert.Nil(t, c.ActionsForOperation("s3", "NotARealOperation"))
+	assert.Nil(t, c.ActionsForOperation("notaservice", "GetObject"))
+}
+
+func TestActionIsCaseInsensitive(t *testing.T) {
+	a, ok := Default().Action("S3:getobject")
+	assert.True(t, ok)
+	assert.Equal(t, AccessLevelRead, a.AccessLevel)
+}
+
+func TestParseRejectsUndefinedResourceType(t *testing.T) {
+	_, err := Parse([]byte(`{"version":1,"services":{"s3":{"name":"S3","actions":{"GetObject":{"accessLevel":"Read","resourceTypes":["object"]}},"resourceTypes":{}}}}`))
+	assert.EqualError(t, err, `s3:GetObject: resource type "object" is not defined`)
+}
+
+func TestParseRejectsUnmappedVariable(t *testing.T) {
+	_, err := Parse([]byte(`{"version":1,"services":{"s3":{"name":"S3","actions":{},"resourceTypes":{"bucket":{"arn":"arn:${Partition}:s3:::${BucketName}"}}}}}`))
+	assert.EqualError(t, err, "s3 resource type bucket: no parameters are mapped to ARN variable BucketName")
+}
+
+var testCtx = ARNContext{Region: "ap-southeast-2", Account: "123456789012"}
+
+func TestRenderS3Object(t *testing.T) {
+	rt, _ := Default().ResourceType("s3:GetObject", "object")
+	r := rt.Render(testCtx, map[string]interface{}{"Bucket": "test-bucket", "Key": "test-key"})
+	assert.Equal(t, []RenderedARN{{ARN: "arn:aws:s3:::test-bucket/test-key", Name: "test-bucket/test-key"}}, r.ARNs)
+	assert.Equal(t, 0, r.Unresolved)
+}
+
+func TestRenderMissingParameterIsWildcard(t *testing.T) {
+	rt, _ := Default().ResourceType("s3:GetObject", "object")
+	r := rt.Render(testCtx, map[string]interface{}{"Bucket": "test-bucket"})
+	assert.Equal(t, []RenderedARN{{ARN: "arn:aws:s3:::test-bucket/*", Name: "test-bucket"}}, r.ARNs)
+	assert.Equal(t, 1, r.Unresolved)
+}
+
+func TestRenderQueueURL(t *testing.T) {
+	rt, _ := Default().ResourceType("sqs:SendMessage", "queue")
+	r := rt.Render(testCtx, map[string]interface{}{"QueueUrl": "https://sqs.ap-southeast-2.amazonaws.com/123456789012/my-queue"})
+	assert.Equal(t, []RenderedARN{{ARN: "arn:aws:sqs:ap-southeast-2:123456789012:my-queue", Name: "my-queue"}}, r.ARNs)
+}
+
+func TestRenderListParameter(t *testing.T) {
+	rt, _ := Default().ResourceType("ssm:GetParameters", "parameter")
+	r := rt.Render(testCtx, map[string]interface{}{"Names": []interface{}{"/app/one", "/app/two"}})
+	assert.Equal(t, []RenderedARN{
+		{ARN: "arn:aws:ssm:ap-southeast-2:123456789012:parameter/app/one", Name: "app/one"},
+		{ARN: "arn:aws:ssm:ap-southeast-2:123456789012:parameter/app/two", Name: "app/two"},
+	}, r.ARNs)
+}
+
+func TestRenderARNParameter(t *testing.T) {
+	rt, _ := Default().ResourceType("lambda:InvokeFunction", "function")
+	r := rt.Render(testCtx, map[string]interface{}{"FunctionName": "arn:aws:lambda:us-east-1:210987654321:function:other"})
+	assert.Equal(t, []RenderedARN{{ARN: "arn:aws:lambda:us-east-1:210987654321:function:other", Name: "function:other"}}, r.ARNs)
+}
+
+func TestRenderPartitionFromRegion(t *testing.T) {
+	rt, _ := Default().ResourceType("sqs:SendMessage", "queue")
+	r := rt.Render(ARNContext{Region: "cn-north-1", Account: "123456789012"}, map[string]interface{}{"QueueName": "q"})
+	assert.Equal(t, "arn:aws-cn:sqs:cn-north-1:123456789012:q", r.ARNs[0].ARN)
+}
@@ -3,6 +3,7 @@ package cloudtrail
 import (
 	"github.com/common-fate/iamzero/pkg/recommendations"
 	"github.com/pkg/errors"
+	"go.uber.org/zap"
 )
 
 // Aggregator reads and deduplicates CloudTrailEvents.
@@ -11,27 +12,30 @@ import (
 // It stores events with a map of uint64 hashes to the event
 type Aggregator struct {
 	events map[uint64]recommendations.AWSEvent
+	// unmapped counts the entries which couldn't be converted to an
+	// event, keyed by event source and event name
+	unmapped map[string]int
 }
 
 func NewAggregator() Aggregator {
 	return Aggregator{
-		events: make(map[uint64]recommendations.AWSEvent),
+		events:   make(map[uint64]recommendations.AWSEvent),
+		unmapped: make(map[string]int),
 	}
 }
 
 // Read a new CloudTrail event, convert it and deduplicate it.
 func (a *Aggregator) Read(e CloudTrailLogEntry) error {
 	event, err := e.TryConvertToEvent()
-	// if the log entry couldn't be mapped we get an ErrNoMapping
-	// we simply ignore these errors
-	if err != nil && err != ErrNoMapping {
-		return errors.Wrap(err, "converting event")
-	}
-
-	// if we don't get an event, return early.
-	if event == nil {
+	// if the log entry couldn't be mapped we get an ErrNoMapping,
+	// which we count so that it can be reported
+	if err == ErrNoMapping {
+		a.unmapped[e.EventKey()]++
 		return nil
 	}
+	if err != nil {
+		return errors.Wrap(err, "converting event")
+	}
 
 	key, err := recommendations.HashEvent(*event)
 	if err != nil {
@@ -52,3 +56,24 @@ func (a *Aggregator) GetEvents() []recommendations.AWSEvent {
 
 	return e
 }
+
+// Unmapped returns the number of entries which couldn't be converted
+// to events, keyed by event source and event name,
+// e.g. "s3.amazonaws.com:HeadObject".
+func (a *Aggregator) Unmapped() map[string]int {
+	return a.unmapped
+}
+
+// ReportUnmapped logs the entries which couldn't be converted to events.
+// It returns the total number of unmapped entries.
+func (a *Aggregator) ReportUnmapped(log *zap.SugaredLogger) int {
+	total := 0
+	for key, count := range a.unmapped {
+		total += count
+		log.With("event", key, "count", count).Debug("unmapped CloudTrail event")
+	}
+	if total > 0 {
+		log.With("unmapped", total, "types", len(a.unmapped)).Info("some CloudTrail events couldn't be mapped and were skipped")
+	}
+	return total
+}
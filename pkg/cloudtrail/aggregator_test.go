@@ -3,8 +3,10 @@ package cloudtrail
 import (
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/common-fate/iamzero/pkg/recommendations"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
 )
 
 func TestAggregatorRead_Works(t *testing.T) {
@@ -33,6 +35,7 @@ func TestAggregatorRead_Works(t *testing.T) {
 				Operation: "HeadObject",
 				Parameters: map[string]interface{}{
 					"Bucket": "testbucket",
+					"Key":    "README.md",
 				},
 			},
 		},
@@ -40,3 +43,19 @@ func TestAggregatorRead_Works(t *testing.T) {
 
 	assert.Equal(t, expected, res)
 }
+
+func TestAggregatorRead_CountsUnmapped(t *testing.T) {
+	agg := NewAggregator()
+
+	e := getTestLogEntry()
+	e.EventSource = aws.String("appsync.amazonaws.com")
+	e.EventName = aws.String("ListGraphqlApis")
+
+	assert.NoError(t, agg.Read(e))
+	assert.NoError(t, agg.Read(e))
+	assert.NoError(t, agg.Read(getTestLogEntry()))
+
+	assert.Len(t, agg.GetEvents(), 1)
+	assert.Equal(t, map[string]int{"appsync.amazonaws.com:ListGraphqlApis": 2}, agg.Unmapped())
+	assert.Equal(t, 2, agg.ReportUnmapped(zap.NewNop().Sugar()))
+}
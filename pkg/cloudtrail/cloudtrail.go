@@ -2,7 +2,9 @@ package cloudtrail
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -10,32 +12,84 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/athena"
 	"github.com/aws/aws-sdk-go-v2/service/athena/types"
 	"github.com/common-fate/iamzero/pkg/events"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
+// AthenaAPI is the subset of the Athena API used by the CloudTrailAuditor.
+// It is satisfied by *athena.Client.
+type AthenaAPI interface {
+	athena.GetQueryResultsAPIClient
+	StartQueryExecution(ctx context.Context, params *athena.StartQueryExecutionInput, optFns ...func(*athena.Options)) (*athena.StartQueryExecutionOutput, error)
+	GetQueryExecution(ctx context.Context, params *athena.GetQueryExecutionInput, optFns ...func(*athena.Options)) (*athena.GetQueryExecutionOutput, error)
+	StopQueryExecution(ctx context.Context, params *athena.StopQueryExecutionInput, optFns ...func(*athena.Options)) (*athena.StopQueryExecutionOutput, error)
+	GetTableMetadata(ctx context.Context, params *athena.GetTableMetadataInput, optFns ...func(*athena.Options)) (*athena.GetTableMetadataOutput, error)
+}
+
+const (
+	// DefaultAthenaWorkgroup is the workgroup which exists in every account
+	DefaultAthenaWorkgroup = "primary"
+	// DefaultAthenaTimeout is how long to wait for a query to finish
+	DefaultAthenaTimeout = 15 * time.Minute
+
+	defaultAthenaDatabase = "default"
+	athenaDataCatalog     = "AwsDataCatalog"
+
+	// initialPollInterval and maxPollInterval bound the backoff
+	// when waiting for a query to finish
+	initialPollInterval = 500 * time.Millisecond
+	maxPollInterval     = 10 * time.Second
+)
+
 // CloudTrailAuditor queries CloudTrail logs
 // via Athena
 type CloudTrailAuditor struct {
 	log                    *zap.SugaredLogger
 	detective              *events.Detective
+	client                 AthenaAPI
 	athenaCloudTrailBucket string
 	athenaOutputLocation   string
+	workgroup              string
+	timeout                time.Duration
+	pollInterval           time.Duration
 }
 
 type CloudTrailAuditorParams struct {
-	Log                    *zap.SugaredLogger
-	Detective              *events.Detective
+	Log       *zap.SugaredLogger
+	Detective *events.Detective
+	// Client is used to query Athena. If nil, a client is
+	// created using the default AWS config.
+	Client AthenaAPI
+	// AthenaCloudTrailBucket is the Athena table containing the CloudTrail
+	// logs, which may be qualified with a database, e.g. "logs.cloudtrail"
 	AthenaCloudTrailBucket string
-	AthenaOutputLocation   string
+	// AthenaOutputLocation is the S3 path to store results in. It may be
+	// empty if the workgroup has an output location configured.
+	AthenaOutputLocation string
+	// Workgroup is the Athena workgroup to run queries in. Defaults to "primary".
+	Workgroup string
+	// Timeout is how long to wait for the query to finish. Defaults to 15 minutes.
+	Timeout time.Duration
 }
 
 func NewCloudTrailAuditor(params *CloudTrailAuditorParams) *CloudTrailAuditor {
-	return &CloudTrailAuditor{
+	a := &CloudTrailAuditor{
 		log:                    params.Log,
+		client:                 params.Client,
 		athenaCloudTrailBucket: params.AthenaCloudTrailBucket,
 		athenaOutputLocation:   params.AthenaOutputLocation,
+		workgroup:              params.Workgroup,
+		timeout:                params.Timeout,
+		pollInterval:           initialPollInterval,
 		detective:              params.Detective,
 	}
+	if a.workgroup == "" {
+		a.workgroup = DefaultAthenaWorkgroup
+	}
+	if a.timeout == 0 {
+		a.timeout = DefaultAthenaTimeout
+	}
+	return a
 }
 
 type CloudTrailUserIdentity struct {
@@ -45,6 +99,17 @@ type CloudTrailUserIdentity struct {
 	AccountID     *string
 	InvokedBy     *string
 	SessionIssuer *string
+	// SourceIdentity is set by the principal which assumed the role
+	SourceIdentity *string
+	// MFAAuthenticated is "true" if the session was created with MFA
+	MFAAuthenticated *string
+}
+
+// CloudTrailResource is a resource accessed by an event
+type CloudTrailResource struct {
+	ARN       string
+	AccountID string
+	Type      string
 }
 
 // CloudTrailLogEntry is an invidual audit log stored in CloudTrail
@@ -54,106 +119,320 @@ type CloudTrailLogEntry struct {
 	EventTime         *string
 	EventSource       *string
 	EventName         *string
+	AWSRegion         *string
 	ErrorCode         *string
 	ErrorMessage      *string
 	RequestParameters *string
+	Resources         []CloudTrailResource
+	SourceIPAddress   *string
+	UserAgent         *string
 }
 
-// CloudTrailAuditor queries CloudTrail logs
-// via Athena to find AWS actions relating to
-// a particular IAM role
-func (a *CloudTrailAuditor) GetActionsForRole(ctx context.Context, account, role string) error {
-	cfg, err := config.LoadDefaultConfig(ctx)
+// queryColumns are the columns selected from the CloudTrail table,
+// in the order they are read by rowToLogEntry.
+var queryColumns = []string{
+	"useridentity.type",
+	"useridentity.principalid",
+	"useridentity.arn",
+	"useridentity.accountid",
+	"useridentity.invokedby",
+	"useridentity.sessioncontext.sessionissuer",
+	"eventtime",
+	"eventsource",
+	"eventname",
+	"errorcode",
+	"errormessage",
+	"requestparameters",
+	"awsregion",
+	// the source identity isn't selected, as it is missing from tables
+	// created before it was added to CloudTrail
+	"useridentity.sessioncontext.attributes.mfaauthenticated",
+	"sourceipaddress",
+	"useragent",
+	resourcesColumn,
+}
+
+// resourcesColumn selects the resources of the event as a JSON array.
+// Athena returns arrays of structs in a form which can't be parsed reliably,
+// such as [{arn=..., accountid=..., type=...}], so each resource is converted
+// to a map before it is formatted as JSON.
+const resourcesColumn = "json_format(CAST(transform(resources, r -> map(ARRAY['arn', 'accountid', 'type'], ARRAY[r.arn, r.accountid, r.type])) AS JSON)) AS resources"
+
+// athenaResource is a resource in the JSON selected by resourcesColumn
+type athenaResource struct {
+	ARN       string `json:"arn"`
+	AccountID string `json:"accountid"`
+	Type      string `json:"type"`
+}
+
+// parseAthenaResources parses the resources selected by resourcesColumn.
+// Events without any resources have a null value.
+func parseAthenaResources(v *string) ([]CloudTrailResource, error) {
+	if v == nil || *v == "" {
+		return nil, nil
+	}
+	var raw []athenaResource
+	if err := json.Unmarshal([]byte(*v), &raw); err != nil {
+		return nil, errors.Wrap(err, "parsing event resources")
+	}
+	var resources []CloudTrailResource
+	for _, r := range raw {
+		resources = append(resources, CloudTrailResource{
+			ARN:       r.ARN,
+			AccountID: r.AccountID,
+			Type:      r.Type,
+		})
+	}
+	return resources, nil
+}
+
+func rowToLogEntry(r types.Row) (CloudTrailLogEntry, error) {
+	if len(r.Data) < len(queryColumns) {
+		return CloudTrailLogEntry{}, fmt.Errorf("expected %d columns in query results but found %d", len(queryColumns), len(r.Data))
+	}
+	resources, err := parseAthenaResources(r.Data[16].VarCharValue)
 	if err != nil {
-		return err
+		return CloudTrailLogEntry{}, err
 	}
-	svc := athena.NewFromConfig(cfg)
+	return CloudTrailLogEntry{
+		UserIdentity: CloudTrailUserIdentity{
+			Type:             r.Data[0].VarCharValue,
+			PrincipalID:      r.Data[1].VarCharValue,
+			ARN:              r.Data[2].VarCharValue,
+			AccountID:        r.Data[3].VarCharValue,
+			InvokedBy:        r.Data[4].VarCharValue,
+			SessionIssuer:    r.Data[5].VarCharValue,
+			MFAAuthenticated: r.Data[13].VarCharValue,
+		},
+		EventTime:         r.Data[6].VarCharValue,
+		EventSource:       r.Data[7].VarCharValue,
+		EventName:         r.Data[8].VarCharValue,
+		ErrorCode:         r.Data[9].VarCharValue,
+		ErrorMessage:      r.Data[10].VarCharValue,
+		RequestParameters: r.Data[11].VarCharValue,
+		AWSRegion:         r.Data[12].VarCharValue,
+		SourceIPAddress:   r.Data[14].VarCharValue,
+		UserAgent:         r.Data[15].VarCharValue,
+		Resources:         resources,
+	}, nil
+}
 
-	assumedRoleARN := fmt.Sprintf("arn:aws:sts::%s:assumed-role/%s/%%", account, role)
-	roleARN := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, role)
+// sqlString quotes a string literal for use in a query
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
 
-	query := fmt.Sprintf(`SELECT useridentity.type, useridentity.principalid, useridentity.arn, useridentity.accountid, useridentity.invokedby, useridentity.sessioncontext.sessionissuer, eventtime, eventsource, eventname, errorcode, errormessage, requestparameters
-	FROM %s
-	WHERE useridentity.arn LIKE '%s'
-			OR useridentity.arn = '%s'
-`, a.athenaCloudTrailBucket, assumedRoleARN, roleARN)
+// sqlIdentifier quotes an identifier for use in a query. Tables created
+// from the CloudTrail console contain hyphens, so must be quoted.
+func sqlIdentifier(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
 
-	a.log.With("query", query).Debug("constructed query")
+// tableName splits the table into its database and table name
+func (a *CloudTrailAuditor) tableName() (database, table string) {
+	split := strings.SplitN(a.athenaCloudTrailBucket, ".", 2)
+	if len(split) == 2 {
+		return split[0], split[1]
+	}
+	return defaultAthenaDatabase, a.athenaCloudTrailBucket
+}
 
-	out, err := svc.StartQueryExecution(ctx, &athena.StartQueryExecutionInput{
+// partitionKeys returns the partition keys of the CloudTrail table.
+// Tables created with partition projection are partitioned by columns
+// such as "timestamp" and "account", which avoid scanning every log file.
+// An error looking up the table is logged rather than returned, as
+// the query can still be run without the partition keys.
+func (a *CloudTrailAuditor) partitionKeys(ctx context.Context) map[string]bool {
+	database, table := a.tableName()
+	out, err := a.client.GetTableMetadata(ctx, &athena.GetTableMetadataInput{
+		CatalogName:  aws.String(athenaDataCatalog),
+		DatabaseName: aws.String(database),
+		TableName:    aws.String(table),
+	})
+	if err != nil {
+		a.log.With("error", err).Info("couldn't load the CloudTrail table metadata, the query won't be filtered by partition")
+		return nil
+	}
+	keys := map[string]bool{}
+	if out.TableMetadata != nil {
+		for _, c := range out.TableMetadata.PartitionKeys {
+			keys[strings.ToLower(aws.ToString(c.Name))] = true
+		}
+	}
+	return keys
+}
+
+// buildQuery builds the SQL to select the events matching the query.
+// Filters on partition keys are added where the table has them.
+func (a *CloudTrailAuditor) buildQuery(q Query, partitions map[string]bool) string {
+	conditions := []string{}
+
+	if q.Account != "" {
+		conditions = append(conditions, "useridentity.accountid = "+sqlString(q.Account))
+		if partitions["account"] {
+			conditions = append(conditions, "account = "+sqlString(q.Account))
+		}
+	}
+
+	if len(q.Roles) > 0 {
+		roles := []string{}
+		for _, r := range q.Roles {
+			roles = append(roles, sqlString(r))
+		}
+		// the session issuer of an assumed role session is the role
+		conditions = append(conditions, fmt.Sprintf("useridentity.sessioncontext.sessionissuer.type = 'Role' AND useridentity.sessioncontext.sessionissuer.username IN (%s)", strings.Join(roles, ", ")))
+	}
+
+	// CloudTrail event times are ISO 8601 timestamps, which sort as strings
+	if !q.Since.IsZero() {
+		conditions = append(conditions, "eventtime >= "+sqlString(q.Since.UTC().Format(time.RFC3339)))
+		if partitions["timestamp"] {
+			conditions = append(conditions, sqlIdentifier("timestamp")+" >= "+sqlString(q.Since.UTC().Format("2006/01/02")))
+		}
+	}
+	if !q.Until.IsZero() {
+		conditions = append(conditions, "eventtime <= "+sqlString(q.Until.UTC().Format(time.RFC3339)))
+		if partitions["timestamp"] {
+			conditions = append(conditions, sqlIdentifier("timestamp")+" <= "+sqlString(q.Until.UTC().Format("2006/01/02")))
+		}
+	}
+
+	database, table := a.tableName()
+	query := fmt.Sprintf("SELECT %s\nFROM %s.%s", strings.Join(queryColumns, ", "), sqlIdentifier(database), sqlIdentifier(table))
+	if len(conditions) > 0 {
+		query += "\nWHERE " + strings.Join(conditions, "\n  AND ")
+	}
+	return query
+}
+
+// runQuery starts the query and waits for it to finish, returning the
+// query execution ID. The query is stopped if the context is cancelled
+// or the timeout is reached before it finishes.
+func (a *CloudTrailAuditor) runQuery(ctx context.Context, query string) (string, error) {
+	input := &athena.StartQueryExecutionInput{
 		QueryString: &query,
-		ResultConfiguration: &types.ResultConfiguration{
+		WorkGroup:   aws.String(a.workgroup),
+	}
+	if a.athenaOutputLocation != "" {
+		input.ResultConfiguration = &types.ResultConfiguration{
 			OutputLocation: &a.athenaOutputLocation,
-		},
-		WorkGroup: aws.String("primary"),
-	})
+		}
+	}
+	out, err := a.client.StartQueryExecution(ctx, input)
 	if err != nil {
-		return err
+		return "", errors.Wrap(err, "starting Athena query")
 	}
+	queryID := aws.ToString(out.QueryExecutionId)
+	log := a.log.With("queryId", queryID)
+	fmt.Printf("waiting for Athena query... query-id=%s\n", queryID)
 
-	finished := false
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
 
-	for !finished {
-		fmt.Printf("waiting for Athena query... query-id=%s\n", *out.QueryExecutionId)
-		q, err := svc.GetQueryExecution(ctx, &athena.GetQueryExecutionInput{
-			QueryExecutionId: aws.String(*out.QueryExecutionId),
+	interval := a.pollInterval
+	for {
+		q, err := a.client.GetQueryExecution(ctx, &athena.GetQueryExecutionInput{
+			QueryExecutionId: aws.String(queryID),
 		})
-		if err != nil {
-			return err
+		if err == nil {
+			status := q.QueryExecution.Status
+			switch status.State {
+			case types.QueryExecutionStateSucceeded:
+				return queryID, nil
+			case types.QueryExecutionStateFailed, types.QueryExecutionStateCancelled:
+				return "", fmt.Errorf("error while querying athena: %s", aws.ToString(status.StateChangeReason))
+			}
+			log.With("state", status.State).Debug("waiting for Athena query")
+		} else if ctx.Err() == nil {
+			return "", errors.Wrap(err, "getting Athena query status")
 		}
 
-		state := q.QueryExecution.Status.State
-		if state == types.QueryExecutionStateRunning || state == types.QueryExecutionStateQueued {
-			// wait a second before trying again
-			time.Sleep(time.Second * 1)
-		} else if state == types.QueryExecutionStateSucceeded {
-			finished = true
-		} else {
-			reason := *q.QueryExecution.Status.StateChangeReason
-			return fmt.Errorf("error while querying athena: %s", reason)
+		select {
+		case <-ctx.Done():
+			a.stopQuery(queryID)
+			return "", errors.Wrapf(ctx.Err(), "waiting for Athena query %s", queryID)
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > maxPollInterval {
+			interval = maxPollInterval
 		}
 	}
-	res, err := svc.GetQueryResults(ctx, &athena.GetQueryResultsInput{
-		QueryExecutionId: out.QueryExecutionId,
+}
+
+// stopQuery stops a query which is no longer needed. The query is
+// stopped with a new context, as the query's context has finished.
+func (a *CloudTrailAuditor) stopQuery(queryID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := a.client.StopQueryExecution(ctx, &athena.StopQueryExecutionInput{
+		QueryExecutionId: aws.String(queryID),
 	})
 	if err != nil {
-		return err
+		a.log.With("queryId", queryID, "error", err).Error("stopping Athena query")
 	}
+}
 
-	agg := NewAggregator()
+// aggregate runs the query and reads every page of results into the aggregator,
+// returning the number of rows which were read.
+func (a *CloudTrailAuditor) aggregate(ctx context.Context, q Query, agg *Aggregator) (int, error) {
+	query := a.buildQuery(q, a.partitionKeys(ctx))
+	a.log.With("query", query).Debug("constructed query")
+
+	queryID, err := a.runQuery(ctx, query)
+	if err != nil {
+		return 0, err
+	}
 
-	for i, r := range res.ResultSet.Rows {
-		a.log.With("row", res.ResultSet.Rows).Debug("row from query")
-		if i == 0 {
-			continue
+	rows := 0
+	first := true
+	p := athena.NewGetQueryResultsPaginator(a.client, &athena.GetQueryResultsInput{
+		QueryExecutionId: aws.String(queryID),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return rows, errors.Wrap(err, "getting Athena query results")
 		}
-		entry := CloudTrailLogEntry{
-			UserIdentity: CloudTrailUserIdentity{
-				Type:          r.Data[0].VarCharValue,
-				PrincipalID:   r.Data[1].VarCharValue,
-				ARN:           r.Data[2].VarCharValue,
-				AccountID:     r.Data[3].VarCharValue,
-				InvokedBy:     r.Data[4].VarCharValue,
-				SessionIssuer: r.Data[5].VarCharValue,
-			},
-			EventTime:         r.Data[6].VarCharValue,
-			EventSource:       r.Data[7].VarCharValue,
-			EventName:         r.Data[8].VarCharValue,
-			ErrorCode:         r.Data[9].VarCharValue,
-			ErrorMessage:      r.Data[10].VarCharValue,
-			RequestParameters: r.Data[11].VarCharValue,
+		for i, r := range page.ResultSet.Rows {
+			// the first row of the results contains the column names
+			if first && i == 0 {
+				continue
+			}
+			entry, err := rowToLogEntry(r)
+			if err != nil {
+				return rows, err
+			}
+			if err := agg.Read(entry); err != nil {
+				return rows, err
+			}
+			rows++
 		}
+		first = false
+	}
+	return rows, nil
+}
 
-		err := agg.Read(entry)
+// Scan queries CloudTrail logs via Athena to find the AWS actions
+// matching the query, and analyses them with the detective.
+func (a *CloudTrailAuditor) Scan(ctx context.Context, q Query) error {
+	if a.client == nil {
+		cfg, err := config.LoadDefaultConfig(ctx)
 		if err != nil {
 			return err
 		}
+		a.client = athena.NewFromConfig(cfg)
+	}
 
+	agg := NewAggregator()
+	rows, err := a.aggregate(ctx, q, &agg)
+	if err != nil {
+		return err
 	}
 
 	events := agg.GetEvents()
 
-	a.log.With("events", events).Debug("found events")
+	a.log.With("rows", rows, "events", events).Debug("found events")
 
 	for _, e := range events {
 		_, err := a.detective.AnalyseEvent(e)
@@ -162,6 +441,10 @@ func (a *CloudTrailAuditor) GetActionsForRole(ctx context.Context, account, role
 		}
 	}
 
+	if unmapped := agg.ReportUnmapped(a.log); unmapped > 0 {
+		fmt.Printf("⚠️  %d CloudTrail events couldn't be mapped to an AWS action and were skipped. Run with -log-level debug to see them\n", unmapped)
+	}
+
 	fmt.Printf("💡 We found %d events by analysing your CloudTrail log. You can run \"iamzero local\" to view findings", len(events))
 
 	return nil
@@ -0,0 +1,212 @@
+package cloudtrail
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/athena"
+	"github.com/aws/aws-sdk-go-v2/service/athena/types"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakeAthena is an in-memory implementation of AthenaAPI.
+// Results are returned one page at a time.
+type fakeAthena struct {
+	partitionKeys []string
+	// states are returned by successive GetQueryExecution calls,
+	// with the last state repeated
+	states  []types.QueryExecutionState
+	pages   [][]types.Row
+	queries []string
+	polls   int
+	stopped bool
+}
+
+func (f *fakeAthena) StartQueryExecution(ctx context.Context, params *athena.StartQueryExecutionInput, optFns ...func(*athena.Options)) (*athena.StartQueryExecutionOutput, error) {
+	f.queries = append(f.queries, aws.ToString(params.QueryString))
+	return &athena.StartQueryExecutionOutput{QueryExecutionId: aws.String("query-1")}, nil
+}
+
+func (f *fakeAthena) GetQueryExecution(ctx context.Context, params *athena.GetQueryExecutionInput, optFns ...func(*athena.Options)) (*athena.GetQueryExecutionOutput, error) {
+	state := f.states[len(f.states)-1]
+	if f.polls < len(f.states) {
+		state = f.states[f.polls]
+	}
+	f.polls++
+	return &athena.GetQueryExecutionOutput{QueryExecution: &types.QueryExecution{
+		Status: &types.QueryExecutionStatus{State: state, StateChangeReason: aws.String("syntax error")},
+	}}, nil
+}
+
+func (f *fakeAthena) StopQueryExecution(ctx context.Context, params *athena.StopQueryExecutionInput, optFns ...func(*athena.Options)) (*athena.StopQueryExecutionOutput, error) {
+	f.stopped = true
+	return &athena.StopQueryExecutionOutput{}, nil
+}
+
+func (f *fakeAthena) GetTableMetadata(ctx context.Context, params *athena.GetTableMetadataInput, optFns ...func(*athena.Options)) (*athena.GetTableMetadataOutput, error) {
+	if f.partitionKeys == nil {
+		return nil, errors.New("access denied")
+	}
+	meta := &types.TableMetadata{Name: params.TableName}
+	for _, k := range f.partitionKeys {
+		meta.PartitionKeys = append(meta.PartitionKeys, types.Column{Name: aws.String(k)})
+	}
+	return &athena.GetTableMetadataOutput{TableMetadata: meta}, nil
+}
+
+func (f *fakeAthena) GetQueryResults(ctx context.Context, params *athena.GetQueryResultsInput, optFns ...func(*athena.Options)) (*athena.GetQueryResultsOutput, error) {
+	i, _ := strconv.Atoi(aws.ToString(params.NextToken))
+	out := &athena.GetQueryResultsOutput{ResultSet: &types.ResultSet{Rows: f.pages[i]}}
+	if i+1 < len(f.pages) {
+		out.NextToken = aws.String(strconv.Itoa(i + 1))
+	}
+	return out, nil
+}
+
+func testRow(values ...string) types.Row {
+	r := types.Row{}
+	for _, v := range values {
+		d := types.Datum{}
+		if v != "" {
+			d.VarCharValue = aws.String(v)
+		}
+		r.Data = append(r.Data, d)
+	}
+	return r
+}
+
+func headObjectRow(key string) types.Row {
+	e := getTestLogEntry()
+	return testRow(*e.UserIdentity.Type, *e.UserIdentity.PrincipalID, *e.UserIdentity.ARN, *e.UserIdentity.AccountID, "", *e.UserIdentity.SessionIssuer,
+		*e.EventTime, *e.EventSource, *e.EventName, "", "", `{"bucketName":"testbucket","key":"`+key+`"}`, "ap-southeast-2",
+		"true", "192.0.2.1", "aws-sdk-go-v2/1.9.0", "")
+}
+
+func newTestCloudTrailAuditor(client AthenaAPI) *CloudTrailAuditor {
+	a := NewCloudTrailAuditor(&CloudTrailAuditorParams{
+		Log:                    zap.NewNop().Sugar(),
+		Client:                 client,
+		AthenaCloudTrailBucket: "logs.cloudtrail_logs_aws-cloudtrail-logs",
+	})
+	a.pollInterval = time.Millisecond
+	return a
+}
+
+func TestBuildQuery(t *testing.T) {
+	a := newTestCloudTrailAuditor(nil)
+	q := Query{
+		Account: "123456789012",
+		Roles:   []string{"deploy", "o'brien"},
+		Since:   time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC),
+		Until:   time.Date(2021, 9, 2, 12, 0, 0, 0, time.UTC),
+	}
+
+	sql := a.buildQuery(q, map[string]bool{"timestamp": true, "account": true})
+	want := `SELECT ` + strings.Join(queryColumns, ", ") + `
+FROM "logs"."cloudtrail_logs_aws-cloudtrail-logs"
+WHERE useridentity.accountid = '123456789012'
+  AND account = '123456789012'
+  AND useridentity.sessioncontext.sessionissuer.type = 'Role' AND useridentity.sessioncontext.sessionissuer.username IN ('deploy', 'o''brien')
+  AND eventtime >= '2021-09-01T00:00:00Z'
+  AND "timestamp" >= '2021/09/01'
+  AND eventtime <= '2021-09-02T12:00:00Z'
+  AND "timestamp" <= '2021/09/02'`
+	assert.Equal(t, want, sql)
+
+	// account-wide, without partition projection
+	sql = a.buildQuery(Query{Account: "123456789012"}, nil)
+	assert.True(t, strings.HasSuffix(sql, "\nWHERE useridentity.accountid = '123456789012'"), sql)
+}
+
+func TestAggregateReadsAllPages(t *testing.T) {
+	client := &fakeAthena{
+		partitionKeys: []string{"region", "timestamp"},
+		states:        []types.QueryExecutionState{types.QueryExecutionStateQueued, types.QueryExecutionStateRunning, types.QueryExecutionStateSucceeded},
+		pages: [][]types.Row{
+			{testRow(queryColumns...), headObjectRow("a")},
+			{headObjectRow("b"), headObjectRow("c")},
+		},
+	}
+	a := newTestCloudTrailAuditor(client)
+
+	agg := NewAggregator()
+	rows, err := a.aggregate(context.Background(), Query{Since: time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)}, &agg)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, rows)
+	assert.Len(t, agg.GetEvents(), 3)
+	assert.Equal(t, 3, client.polls)
+	if assert.Len(t, client.queries, 1) {
+		assert.Contains(t, client.queries[0], `"timestamp" >= '2021/09/01'`)
+	}
+}
+
+func TestRowToLogEntryReadsResources(t *testing.T) {
+	r := headObjectRow("a")
+	r.Data[16].VarCharValue = aws.String(`[{"arn":"arn:aws:kms:ap-southeast-2:123456789012:key/1234abcd","accountid":"123456789012","type":"AWS::KMS::Key"}]`)
+
+	entry, err := rowToLogEntry(r)
+	if !assert.NoError(t, err) {
+		return
+	}
+	want := []CloudTrailResource{
+		{ARN: "arn:aws:kms:ap-southeast-2:123456789012:key/1234abcd", AccountID: "123456789012", Type: "AWS::KMS::Key"},
+	}
+	assert.Equal(t, want, entry.Resources)
+}
+
+func TestAggregateWithoutTableMetadata(t *testing.T) {
+	client := &fakeAthena{
+		states: []types.QueryExecutionState{types.QueryExecutionStateSucceeded},
+		pages:  [][]types.Row{{testRow(queryColumns...)}},
+	}
+	a := newTestCloudTrailAuditor(client)
+
+	agg := NewAggregator()
+	rows, err := a.aggregate(context.Background(), Query{Since: time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)}, &agg)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rows)
+	assert.NotContains(t, client.queries[0], `"timestamp"`)
+}
+
+func TestRunQueryFailed(t *testing.T) {
+	client := &fakeAthena{states: []types.QueryExecutionState{types.QueryExecutionStateFailed}}
+	a := newTestCloudTrailAuditor(client)
+
+	_, err := a.runQuery(context.Background(), "SELECT 1")
+	assert.EqualError(t, err, "error while querying athena: syntax error")
+}
+
+func TestRunQueryTimeout(t *testing.T) {
+	client := &fakeAthena{states: []types.QueryExecutionState{types.QueryExecutionStateRunning}}
+	a := newTestCloudTrailAuditor(client)
+	a.timeout = 20 * time.Millisecond
+
+	_, err := a.runQuery(context.Background(), "SELECT 1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, client.stopped)
+}
+
+func TestParseTimeFlag(t *testing.T) {
+	now := time.Date(2021, 9, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]time.Time{
+		"":                     {},
+		"72h":                  time.Date(2021, 9, 7, 12, 0, 0, 0, time.UTC),
+		"2021-09-02":           time.Date(2021, 9, 2, 0, 0, 0, 0, time.UTC),
+		"2021-09-02T04:29:14Z": time.Date(2021, 9, 2, 4, 29, 14, 0, time.UTC),
+	}
+	for value, want := range tests {
+		got, err := ParseTimeFlag(value, now)
+		assert.NoError(t, err, value)
+		assert.True(t, want.Equal(got), "%s: got %s", value, got)
+	}
+
+	_, err := ParseTimeFlag("last week", now)
+	assert.Error(t, err)
+}
@@ -3,6 +3,7 @@ package cloudtrail
 import (
 	"encoding/json"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/common-fate/iamzero/pkg/recommendations"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -10,71 +11,65 @@ import (
 
 var ErrNoMapping = errors.New("could not convert CloudTrail entry to IAM Zero event")
 
-// safeStringEquals checks if the first string pointer
-// is nil to avoid a nil dereference error
-func safeStringEquals(a *string, b string) bool {
-	return a != nil && *a == b
-}
-
 // TryConvertToEvent tries to map the CloudTrail log entry
 // to an AWSEvent. If the log entry cannot be processed, ErrNoMapping is returned.
+//
+// Entries are mapped using the serviceMappings for the event source.
 func (c *CloudTrailLogEntry) TryConvertToEvent() (*recommendations.AWSEvent, error) {
-	eventId := uuid.NewString()
-	if safeStringEquals(c.EventSource, "s3.amazonaws.com") {
-		// S3
-		if safeStringEquals(c.EventName, "HeadObject") {
-			var params map[string]string
-			err := json.Unmarshal([]byte(*c.RequestParameters), &params)
-			if err != nil {
-				return nil, errors.Wrap(err, "unmarshalling params")
-			}
+	mapping, ok := serviceMappings[aws.ToString(c.EventSource)]
+	if !ok || c.EventName == nil || c.UserIdentity.ARN == nil {
+		// we weren't able to convert the log entry into an event
+		return nil, ErrNoMapping
+	}
 
-			event := recommendations.AWSEvent{
-				ID:   eventId,
-				Time: *c.EventTime,
-				Identity: recommendations.AWSIdentity{
-					User:    *c.UserIdentity.PrincipalID,
-					Role:    *c.UserIdentity.ARN,
-					Account: *c.UserIdentity.AccountID,
-				},
-				Data: recommendations.AWSData{
-					Type:      "awsAction",
-					Service:   "s3",
-					Operation: "HeadObject",
-					Parameters: map[string]interface{}{
-						"Bucket": params["bucketName"],
-					},
-				},
-			}
-			return &event, nil
+	var params map[string]interface{}
+	if c.RequestParameters != nil {
+		err := json.Unmarshal([]byte(*c.RequestParameters), &params)
+		if err != nil {
+			return nil, errors.Wrap(err, "unmarshalling params")
 		}
-		if safeStringEquals(c.EventName, "ListObjects") {
-			var params map[string]string
-			err := json.Unmarshal([]byte(*c.RequestParameters), &params)
-			if err != nil {
-				return nil, errors.Wrap(err, "unmarshalling params")
-			}
+	}
 
-			event := recommendations.AWSEvent{
-				ID:   eventId,
-				Time: *c.EventTime,
-				Identity: recommendations.AWSIdentity{
-					User:    *c.UserIdentity.PrincipalID,
-					Role:    *c.UserIdentity.ARN,
-					Account: *c.UserIdentity.AccountID,
-				},
-				Data: recommendations.AWSData{
-					Type:      "awsAction",
-					Service:   "s3",
-					Operation: "ListObjects",
-					Parameters: map[string]interface{}{
-						"Bucket": params["bucketName"],
-					},
-				},
-			}
-			return &event, nil
-		}
+	event := recommendations.AWSEvent{
+		ID:   uuid.NewString(),
+		Time: aws.ToString(c.EventTime),
+		Identity: recommendations.AWSIdentity{
+			User:    aws.ToString(c.UserIdentity.PrincipalID),
+			Role:    aws.ToString(c.UserIdentity.ARN),
+			Account: aws.ToString(c.UserIdentity.AccountID),
+		},
+		Data: recommendations.AWSData{
+			Type:       "awsAction",
+			Service:    mapping.Service,
+			Region:     aws.ToString(c.AWSRegion),
+			Operation:  mapping.Operation(*c.EventName, params),
+			Parameters: mapping.ExtractParameters(params, c.Resources),
+		},
+	}
+
+	// the session ARN and name are added by the detective when the role
+	// ARN is replaced, as they are parsed from the assumed role ARN
+	session := recommendations.SessionContext{
+		SourceIdentity:   aws.ToString(c.UserIdentity.SourceIdentity),
+		MFAAuthenticated: aws.ToString(c.UserIdentity.MFAAuthenticated) == "true",
+		SourceIP:         aws.ToString(c.SourceIPAddress),
+		UserAgent:        aws.ToString(c.UserAgent),
+	}
+	if session != (recommendations.SessionContext{}) {
+		event.Identity.Session = &session
+	}
+
+	// failed calls are recorded as errors, so that access denied
+	// errors can be turned into findings
+	if c.ErrorCode != nil {
+		event.Data.Type = "awsError"
+		event.Data.ExceptionCode = *c.ErrorCode
+		event.Data.ExceptionMessage = aws.ToString(c.ErrorMessage)
 	}
-	// we weren't able to convert the log entry into an event
-	return nil, ErrNoMapping
+	return &event, nil
+}
+
+// EventKey identifies the type of a CloudTrail log entry, e.g. "s3.amazonaws.com:HeadObject"
+func (c *CloudTrailLogEntry) EventKey() string {
+	return aws.ToString(c.EventSource) + ":" + aws.ToString(c.EventName)
 }
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/common-fate/iamzero/pkg/catalog"
 	"github.com/common-fate/iamzero/pkg/recommendations"
 	"github.com/stretchr/testify/assert"
 )
@@ -44,12 +45,32 @@ func TestTryConvertToEvent_Works(t *testing.T) {
 			Operation: "HeadObject",
 			Parameters: map[string]interface{}{
 				"Bucket": "testbucket",
+				"Key":    "README.md",
 			},
 		},
 	}
 	assert.Equal(t, expected, result)
 }
 
+func TestTryConvertToEvent_Session(t *testing.T) {
+	e := getTestLogEntry()
+	e.UserIdentity.SourceIdentity = aws.String("alice")
+	e.UserIdentity.MFAAuthenticated = aws.String("true")
+	e.SourceIPAddress = aws.String("192.0.2.1")
+	e.UserAgent = aws.String("aws-cli/2.2.0")
+
+	result, err := e.TryConvertToEvent()
+	assert.NoError(t, err)
+
+	expected := &recommendations.SessionContext{
+		SourceIdentity:   "alice",
+		MFAAuthenticated: true,
+		SourceIP:         "192.0.2.1",
+		UserAgent:        "aws-cli/2.2.0",
+	}
+	assert.Equal(t, expected, result.Identity.Session)
+}
+
 func TestTryConvertToEvent_ReturnsErrorIfNoMapping(t *testing.T) {
 	e := CloudTrailLogEntry{
 		UserIdentity: CloudTrailUserIdentity{
@@ -66,3 +87,123 @@ func TestTryConvertToEvent_ReturnsErrorIfNoMapping(t *testing.T) {
 	_, err := e.TryConvertToEvent()
 	assert.ErrorIs(t, err, ErrNoMapping)
 }
+
+func TestTryConvertToEvent_Services(t *testing.T) {
+	tests := []struct {
+		name      string
+		entry     CloudTrailLogEntry
+		wantType  string
+		operation string
+		params    map[string]interface{}
+	}{
+		{
+			name: "dynamodb",
+			entry: CloudTrailLogEntry{
+				EventSource:       aws.String("dynamodb.amazonaws.com"),
+				EventName:         aws.String("GetItem"),
+				RequestParameters: aws.String(`{"tableName": "orders", "consistentRead": true}`),
+			},
+			operation: "GetItem",
+			params:    map[string]interface{}{"TableName": "orders", "Table": "orders", "ConsistentRead": true},
+		},
+		{
+			name: "lambda version suffix",
+			entry: CloudTrailLogEntry{
+				EventSource:       aws.String("lambda.amazonaws.com"),
+				EventName:         aws.String("GetFunction20150331v2"),
+				RequestParameters: aws.String(`{"functionName": "handler"}`),
+			},
+			operation: "GetFunction",
+			params:    map[string]interface{}{"FunctionName": "handler"},
+		},
+		{
+			name: "s3 list objects v2",
+			entry: CloudTrailLogEntry{
+				EventSource:       aws.String("s3.amazonaws.com"),
+				EventName:         aws.String("ListObjects"),
+				RequestParameters: aws.String(`{"bucketName": "testbucket", "prefix": "logs/", "list-type": "2", "Host": "testbucket.s3.amazonaws.com"}`),
+			},
+			operation: "ListObjectsV2",
+			params:    map[string]interface{}{"Bucket": "testbucket", "Prefix": "logs/"},
+		},
+		{
+			name: "ec2 nested parameters",
+			entry: CloudTrailLogEntry{
+				EventSource:       aws.String("ec2.amazonaws.com"),
+				EventName:         aws.String("TerminateInstances"),
+				RequestParameters: aws.String(`{"instancesSet": {"items": [{"instanceId": "i-1"}, {"instanceId": "i-2"}]}}`),
+			},
+			operation: "TerminateInstances",
+			params:    map[string]interface{}{"InstanceIds": []interface{}{"i-1", "i-2"}},
+		},
+		{
+			name: "kms key from resources",
+			entry: CloudTrailLogEntry{
+				EventSource: aws.String("kms.amazonaws.com"),
+				EventName:   aws.String("Decrypt"),
+				Resources: []CloudTrailResource{
+					{ARN: "arn:aws:kms:us-east-1:123456789012:key/abcd", Type: "AWS::KMS::Key"},
+				},
+			},
+			operation: "Decrypt",
+			params:    map[string]interface{}{"KeyId": "arn:aws:kms:us-east-1:123456789012:key/abcd"},
+		},
+		{
+			name: "states parameters keep their case",
+			entry: CloudTrailLogEntry{
+				EventSource:       aws.String("states.amazonaws.com"),
+				EventName:         aws.String("StartExecution"),
+				RequestParameters: aws.String(`{"stateMachineArn": "arn:aws:states:us-east-1:123456789012:stateMachine:flow"}`),
+			},
+			operation: "StartExecution",
+			params:    map[string]interface{}{"stateMachineArn": "arn:aws:states:us-east-1:123456789012:stateMachine:flow"},
+		},
+		{
+			name: "access denied",
+			entry: CloudTrailLogEntry{
+				EventSource:       aws.String("sqs.amazonaws.com"),
+				EventName:         aws.String("SendMessage"),
+				ErrorCode:         aws.String("AccessDenied"),
+				ErrorMessage:      aws.String("not authorized"),
+				RequestParameters: aws.String(`{"queueUrl": "https://sqs.us-east-1.amazonaws.com/123456789012/jobs"}`),
+			},
+			wantType:  "awsError",
+			operation: "SendMessage",
+			params:    map[string]interface{}{"QueueUrl": "https://sqs.us-east-1.amazonaws.com/123456789012/jobs"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e := tc.entry
+			e.UserIdentity = getTestLogEntry().UserIdentity
+			e.AWSRegion = aws.String("us-east-1")
+
+			result, err := e.TryConvertToEvent()
+			if !assert.NoError(t, err) {
+				return
+			}
+			wantType := tc.wantType
+			if wantType == "" {
+				wantType = "awsAction"
+			}
+			assert.Equal(t, wantType, result.Data.Type)
+			assert.Equal(t, "us-east-1", result.Data.Region)
+			assert.Equal(t, tc.operation, result.Data.Operation)
+			assert.Equal(t, tc.params, result.Data.Parameters)
+		})
+	}
+}
+
+// every service in the IAM action catalog used by the advisor should be mapped
+func TestServiceMappingsMatchCatalog(t *testing.T) {
+	mapped := map[string]bool{}
+	for _, m := range serviceMappings {
+		prefix, ok := catalog.Default().ServicePrefix(m.Service)
+		assert.True(t, ok, "service %s is not in the catalog", m.Service)
+		mapped[prefix] = true
+	}
+	for prefix := range catalog.Default().Services {
+		assert.True(t, mapped[prefix], "catalog service %s has no CloudTrail mapping", prefix)
+	}
+}
@@ -0,0 +1,39 @@
+package cloudtrail
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// EventBridgeCloudTrailDetailType is the detail type of the events which
+// CloudTrail sends to EventBridge for API calls.
+const EventBridgeCloudTrailDetailType = "AWS API Call via CloudTrail"
+
+// eventBridgeEnvelope is an event delivered by EventBridge. The detail of
+// a CloudTrail event is in the same format as a record in a log file.
+type eventBridgeEnvelope struct {
+	DetailType string          `json:"detail-type"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// ParseEventBridgeEvent parses a CloudTrail event which has been delivered
+// by EventBridge, for example to an SQS queue which is the target of an
+// EventBridge rule. It returns false if the body isn't an EventBridge
+// event for a CloudTrail API call.
+func ParseEventBridgeEvent(body []byte) (CloudTrailLogEntry, bool, error) {
+	var envelope eventBridgeEnvelope
+	// messages which aren't JSON objects aren't EventBridge events
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return CloudTrailLogEntry{}, false, nil
+	}
+	if envelope.DetailType != EventBridgeCloudTrailDetailType {
+		return CloudTrailLogEntry{}, false, nil
+	}
+
+	var record logFileRecord
+	if err := json.Unmarshal(envelope.Detail, &record); err != nil {
+		return CloudTrailLogEntry{}, true, errors.Wrap(err, "decoding EventBridge event detail")
+	}
+	return record.toLogEntry(), true, nil
+}
@@ -0,0 +1,61 @@
+package cloudtrail
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testEventBridgeEvent = `{
+	"version": "0",
+	"id": "36eb8523-97d0-4518-b33d-ee3579ff19f0",
+	"detail-type": "AWS API Call via CloudTrail",
+	"source": "aws.s3",
+	"account": "123456789012",
+	"time": "2021-09-02T04:29:14Z",
+	"region": "ap-southeast-2",
+	"resources": [],
+	"detail": {
+		"eventVersion": "1.08",
+		"userIdentity": {
+			"type": "AssumedRole",
+			"principalId": "AROAUAMTP2WEJUZJXFJX7:test-role",
+			"arn": "arn:aws:sts::123456789012:assumed-role/CdkExampleStack-iamzerooverprivilegedrole3B0B7D55-1TIJOTM9XXJZ7/test-role",
+			"accountId": "123456789012"
+		},
+		"eventTime": "2021-09-02T04:29:14Z",
+		"eventSource": "s3.amazonaws.com",
+		"eventName": "CreateBucket",
+		"awsRegion": "ap-southeast-2",
+		"requestParameters": {"bucketName": "testbucket", "Host": "testbucket.s3.ap-southeast-2.amazonaws.com"}
+	}
+}`
+
+func TestParseEventBridgeEvent(t *testing.T) {
+	entry, ok, err := ParseEventBridgeEvent([]byte(testEventBridgeEvent))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	e, err := entry.TryConvertToEvent()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "s3", e.Data.Service)
+	assert.Equal(t, "CreateBucket", e.Data.Operation)
+	assert.Equal(t, "ap-southeast-2", e.Data.Region)
+	assert.Equal(t, map[string]interface{}{"Bucket": "testbucket"}, e.Data.Parameters)
+	assert.Equal(t, "123456789012", e.Identity.Account)
+}
+
+func TestParseEventBridgeEvent_NotCloudTrail(t *testing.T) {
+	for _, body := range []string{
+		// an event sent by an IAM Zero client
+		`{"id": "1", "time": "2021-09-02T04:29:14Z", "data": {"type": "awsAction"}}`,
+		`{"detail-type": "EC2 Instance State-change Notification", "detail": {"state": "running"}}`,
+		`not json`,
+	} {
+		_, ok, err := ParseEventBridgeEvent([]byte(body))
+		assert.NoError(t, err)
+		assert.False(t, ok, body)
+	}
+}
@@ -0,0 +1,399 @@
+package cloudtrail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/common-fate/iamzero/pkg/events"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// LakeAPI is the subset of the CloudTrail Lake API used by the LakeScanner.
+type LakeAPI interface {
+	// StartQuery starts a query, returning the query ID
+	StartQuery(ctx context.Context, statement string) (string, error)
+	GetQueryResults(ctx context.Context, queryID, nextToken string) (*LakeQueryResults, error)
+	CancelQuery(ctx context.Context, queryID string) error
+}
+
+// Query statuses returned by the CloudTrail Lake API
+const (
+	LakeQueryStatusQueued   = "QUEUED"
+	LakeQueryStatusRunning  = "RUNNING"
+	LakeQueryStatusFinished = "FINISHED"
+)
+
+// LakeQueryResults is a page of results from a CloudTrail Lake query
+type LakeQueryResults struct {
+	QueryStatus  string
+	ErrorMessage string
+	// QueryResultRows are the rows of results. Each column in a row
+	// is a map of the column name to its value.
+	QueryResultRows [][]map[string]string
+	NextToken       string
+}
+
+// lakeColumns are the columns selected from the event data store,
+// with the aliases they are returned as.
+var lakeColumns = []struct {
+	expr  string
+	alias string
+}{
+	{"userIdentity.type", "identityType"},
+	{"userIdentity.principalId", "principalId"},
+	{"userIdentity.arn", "arn"},
+	{"userIdentity.accountId", "accountId"},
+	{"userIdentity.invokedBy", "invokedBy"},
+	{"userIdentity.sessionContext.sessionIssuer.arn", "sessionIssuer"},
+	{"eventTime", "eventTime"},
+	{"eventSource", "eventSource"},
+	{"eventName", "eventName"},
+	{"errorCode", "errorCode"},
+	{"errorMessage", "errorMessage"},
+	{"requestParameters", "requestParameters"},
+	{"awsRegion", "awsRegion"},
+	{"userIdentity.sessionContext.sourceIdentity", "sourceIdentity"},
+	{"userIdentity.sessionContext.attributes.mfaAuthenticated", "mfaAuthenticated"},
+	{"sourceIPAddress", "sourceIPAddress"},
+	{"userAgent", "userAgent"},
+	{"resources", "resources"},
+}
+
+// LakeScanner backfills events by querying a CloudTrail Lake event data store
+type LakeScanner struct {
+	log            *zap.SugaredLogger
+	detective      *events.Detective
+	client         LakeAPI
+	eventDataStore string
+	timeout        time.Duration
+	pollInterval   time.Duration
+}
+
+type LakeScannerParams struct {
+	Log       *zap.SugaredLogger
+	Detective *events.Detective
+	// Client is used to query CloudTrail Lake. If nil, a client is
+	// created using the default AWS config.
+	Client LakeAPI
+	// EventDataStore is the ID or ARN of the event data store to query
+	EventDataStore string
+	// Timeout is how long to wait for the query to finish. Defaults to 15 minutes.
+	Timeout time.Duration
+}
+
+func NewLakeScanner(params *LakeScannerParams) *LakeScanner {
+	s := &LakeScanner{
+		log:            params.Log,
+		detective:      params.Detective,
+		client:         params.Client,
+		eventDataStore: params.EventDataStore,
+		timeout:        params.Timeout,
+		pollInterval:   initialPollInterval,
+	}
+	if s.timeout == 0 {
+		s.timeout = DefaultAthenaTimeout
+	}
+	return s
+}
+
+// lakeTime formats a time in the format used by CloudTrail Lake
+func lakeTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// buildQuery builds the SQL to select the events matching the query.
+func (s *LakeScanner) buildQuery(q Query) string {
+	// queries are run against the event data store ID, rather than its ARN
+	store := s.eventDataStore
+	if i := strings.LastIndex(store, "/"); i != -1 {
+		store = store[i+1:]
+	}
+
+	columns := []string{}
+	for _, c := range lakeColumns {
+		columns = append(columns, c.expr+" AS "+c.alias)
+	}
+
+	conditions := []string{"eventType = 'AwsApiCall'"}
+	if q.Account != "" {
+		conditions = append(conditions, "userIdentity.accountId = "+sqlString(q.Account))
+	}
+	if len(q.Roles) > 0 {
+		roles := []string{}
+		for _, r := range q.Roles {
+			roles = append(roles, sqlString(r))
+		}
+		conditions = append(conditions, fmt.Sprintf("userIdentity.sessionContext.sessionIssuer.type = 'Role' AND userIdentity.sessionContext.sessionIssuer.userName IN (%s)", strings.Join(roles, ", ")))
+	}
+	if !q.Since.IsZero() {
+		conditions = append(conditions, "eventTime >= "+sqlString(lakeTime(q.Since)))
+	}
+	if !q.Until.IsZero() {
+		conditions = append(conditions, "eventTime <= "+sqlString(lakeTime(q.Until)))
+	}
+
+	return fmt.Sprintf("SELECT %s\nFROM %s\nWHERE %s", strings.Join(columns, ", "), store, strings.Join(conditions, "\n  AND "))
+}
+
+// lakeRowToLogEntry converts a row of results into a CloudTrailLogEntry
+func lakeRowToLogEntry(row []map[string]string) CloudTrailLogEntry {
+	values := map[string]*string{}
+	for _, col := range row {
+		for k, v := range col {
+			v := v
+			values[k] = &v
+		}
+	}
+
+	entry := CloudTrailLogEntry{
+		UserIdentity: CloudTrailUserIdentity{
+			Type:             values["identityType"],
+			PrincipalID:      values["principalId"],
+			ARN:              values["arn"],
+			AccountID:        values["accountId"],
+			InvokedBy:        values["invokedBy"],
+			SessionIssuer:    values["sessionIssuer"],
+			SourceIdentity:   values["sourceIdentity"],
+			MFAAuthenticated: values["mfaAuthenticated"],
+		},
+		EventTime:         values["eventTime"],
+		EventSource:       values["eventSource"],
+		EventName:         values["eventName"],
+		ErrorCode:         values["errorCode"],
+		ErrorMessage:      values["errorMessage"],
+		RequestParameters: values["requestParameters"],
+		AWSRegion:         values["awsRegion"],
+		SourceIPAddress:   values["sourceIPAddress"],
+		UserAgent:         values["userAgent"],
+	}
+
+	// event times are returned as "2006-01-02 15:04:05.000" rather than RFC3339
+	if entry.EventTime != nil {
+		for _, layout := range []string{"2006-01-02 15:04:05.000", "2006-01-02 15:04:05"} {
+			if t, err := time.Parse(layout, *entry.EventTime); err == nil {
+				formatted := t.Format(time.RFC3339)
+				entry.EventTime = &formatted
+				break
+			}
+		}
+	}
+
+	// request parameters are returned as a map, e.g. {bucketName=test, key=README.md}
+	if entry.RequestParameters != nil && !json.Valid([]byte(*entry.RequestParameters)) {
+		params, err := json.Marshal(parseLakeMap(*entry.RequestParameters))
+		if err == nil {
+			p := string(params)
+			entry.RequestParameters = &p
+		}
+	}
+
+	// resources are returned as a list of maps, e.g. [{accountId=123456789012, type=AWS::KMS::Key, ARN=...}]
+	if res := values["resources"]; res != nil {
+		list, _ := parseLakeValue(*res).([]interface{})
+		for _, item := range list {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			entry.Resources = append(entry.Resources, CloudTrailResource{
+				ARN:       lakeMapString(m, "arn"),
+				AccountID: lakeMapString(m, "accountId"),
+				Type:      lakeMapString(m, "type"),
+			})
+		}
+	}
+	return entry
+}
+
+// lakeMapString returns the string value of a key in a map parsed by
+// parseLakeValue. Keys are matched case-insensitively.
+func lakeMapString(m map[string]interface{}, key string) string {
+	for k, v := range m {
+		if s, ok := v.(string); ok && strings.EqualFold(k, key) {
+			return s
+		}
+	}
+	return ""
+}
+
+// parseLakeMap parses a map in the format returned by CloudTrail Lake,
+// e.g. {bucketName=test, key=README.md}. An empty map is returned if
+// the value isn't a map.
+func parseLakeMap(s string) map[string]interface{} {
+	if m, ok := parseLakeValue(s).(map[string]interface{}); ok {
+		return m
+	}
+	return map[string]interface{}{}
+}
+
+// parseLakeValue parses a value in the format returned by CloudTrail Lake.
+// Maps such as {instancesSet={items=[{instanceId=i-1}]}} and lists such as
+// [a, b] are parsed into map[string]interface{} and []interface{} values,
+// so that nested parameters can be looked up. Any other value, or a value
+// which can't be parsed as a map, is returned as a string.
+func parseLakeValue(s string) interface{} {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}"):
+		m := map[string]interface{}{}
+		for _, e := range splitLakeEntries(s[1 : len(s)-1]) {
+			kv := strings.SplitN(e, "=", 2)
+			if len(kv) != 2 {
+				return s
+			}
+			m[strings.TrimSpace(kv[0])] = parseLakeValue(kv[1])
+		}
+		return m
+	case strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]"):
+		list := []interface{}{}
+		for _, e := range splitLakeEntries(s[1 : len(s)-1]) {
+			list = append(list, parseLakeValue(e))
+		}
+		return list
+	}
+	return s
+}
+
+// splitLakeEntries splits the entries of a map or list on commas which
+// aren't inside a nested value.
+func splitLakeEntries(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	var entries []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				entries = append(entries, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(entries, strings.TrimSpace(s[start:]))
+}
+
+// waitForResults polls the query until it has finished, returning the first page of results.
+// The query is cancelled if the context is cancelled or the timeout is reached.
+func (s *LakeScanner) waitForResults(ctx context.Context, queryID string) (*LakeQueryResults, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	interval := s.pollInterval
+	for {
+		res, err := s.client.GetQueryResults(ctx, queryID, "")
+		if err == nil {
+			switch res.QueryStatus {
+			case LakeQueryStatusFinished:
+				return res, nil
+			case LakeQueryStatusQueued, LakeQueryStatusRunning:
+				s.log.With("queryId", queryID, "status", res.QueryStatus).Debug("waiting for CloudTrail Lake query")
+			default:
+				return nil, fmt.Errorf("error while querying CloudTrail Lake: %s %s", res.QueryStatus, res.ErrorMessage)
+			}
+		} else if ctx.Err() == nil {
+			return nil, errors.Wrap(err, "getting CloudTrail Lake query results")
+		}
+
+		select {
+		case <-ctx.Done():
+			s.cancelQuery(queryID)
+			return nil, errors.Wrapf(ctx.Err(), "waiting for CloudTrail Lake query %s", queryID)
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > maxPollInterval {
+			interval = maxPollInterval
+		}
+	}
+}
+
+// cancelQuery cancels a query which is no longer needed. The query is
+// cancelled with a new context, as the query's context has finished.
+func (s *LakeScanner) cancelQuery(queryID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.client.CancelQuery(ctx, queryID); err != nil {
+		s.log.With("queryId", queryID, "error", err).Error("cancelling CloudTrail Lake query")
+	}
+}
+
+// aggregate runs the query and reads every page of results into the aggregator,
+// returning the number of rows which were read.
+func (s *LakeScanner) aggregate(ctx context.Context, q Query, agg *Aggregator) (int, error) {
+	query := s.buildQuery(q)
+	s.log.With("query", query).Debug("constructed query")
+
+	queryID, err := s.client.StartQuery(ctx, query)
+	if err != nil {
+		return 0, errors.Wrap(err, "starting CloudTrail Lake query")
+	}
+	fmt.Printf("waiting for CloudTrail Lake query... query-id=%s\n", queryID)
+
+	res, err := s.waitForResults(ctx, queryID)
+	if err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	for {
+		for _, row := range res.QueryResultRows {
+			if err := agg.Read(lakeRowToLogEntry(row)); err != nil {
+				return rows, err
+			}
+			rows++
+		}
+		if res.NextToken == "" {
+			return rows, nil
+		}
+		res, err = s.client.GetQueryResults(ctx, queryID, res.NextToken)
+		if err != nil {
+			return rows, errors.Wrap(err, "getting CloudTrail Lake query results")
+		}
+	}
+}
+
+// Scan queries the CloudTrail Lake event data store to find the AWS actions
+// matching the query, and analyses them with the detective.
+func (s *LakeScanner) Scan(ctx context.Context, q Query) error {
+	if s.client == nil {
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return err
+		}
+		s.client = newLakeClient(cfg, s.eventDataStore)
+	}
+
+	agg := NewAggregator()
+	rows, err := s.aggregate(ctx, q, &agg)
+	if err != nil {
+		return err
+	}
+
+	events := agg.GetEvents()
+	s.log.With("rows", rows, "events", len(events)).Debug("found events")
+
+	for _, e := range events {
+		_, err := s.detective.AnalyseEvent(e)
+		if err != nil {
+			return err
+		}
+	}
+
+	if unmapped := agg.ReportUnmapped(s.log); unmapped > 0 {
+		fmt.Printf("⚠️  %d CloudTrail events couldn't be mapped to an AWS action and were skipped. Run with -log-level debug to see them\n", unmapped)
+	}
+
+	fmt.Printf("💡 We found %d events in CloudTrail Lake. You can run \"iamzero local\" to view findings", len(events))
+	return nil
+}
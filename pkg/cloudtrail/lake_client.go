@@ -0,0 +1,67 @@
+package cloudtrail
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+)
+
+// cloudTrailLakeAPI is the subset of the CloudTrail API used by the lakeClient.
+// It is satisfied by *cloudtrail.Client.
+type cloudTrailLakeAPI interface {
+	StartQuery(ctx context.Context, params *cloudtrail.StartQueryInput, optFns ...func(*cloudtrail.Options)) (*cloudtrail.StartQueryOutput, error)
+	GetQueryResults(ctx context.Context, params *cloudtrail.GetQueryResultsInput, optFns ...func(*cloudtrail.Options)) (*cloudtrail.GetQueryResultsOutput, error)
+	CancelQuery(ctx context.Context, params *cloudtrail.CancelQueryInput, optFns ...func(*cloudtrail.Options)) (*cloudtrail.CancelQueryOutput, error)
+}
+
+// lakeClient implements LakeAPI with the CloudTrail client from the AWS SDK.
+type lakeClient struct {
+	client         cloudTrailLakeAPI
+	eventDataStore string
+}
+
+func newLakeClient(cfg aws.Config, eventDataStore string) *lakeClient {
+	return &lakeClient{
+		client:         cloudtrail.NewFromConfig(cfg),
+		eventDataStore: eventDataStore,
+	}
+}
+
+func (c *lakeClient) StartQuery(ctx context.Context, statement string) (string, error) {
+	out, err := c.client.StartQuery(ctx, &cloudtrail.StartQueryInput{
+		QueryStatement: aws.String(statement),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.QueryId), nil
+}
+
+func (c *lakeClient) GetQueryResults(ctx context.Context, queryID, nextToken string) (*LakeQueryResults, error) {
+	in := &cloudtrail.GetQueryResultsInput{
+		EventDataStore: aws.String(c.eventDataStore),
+		QueryId:        aws.String(queryID),
+	}
+	if nextToken != "" {
+		in.NextToken = aws.String(nextToken)
+	}
+	out, err := c.client.GetQueryResults(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return &LakeQueryResults{
+		QueryStatus:     string(out.QueryStatus),
+		ErrorMessage:    aws.ToString(out.ErrorMessage),
+		QueryResultRows: out.QueryResultRows,
+		NextToken:       aws.ToString(out.NextToken),
+	}, nil
+}
+
+func (c *lakeClient) CancelQuery(ctx context.Context, queryID string) error {
+	_, err := c.client.CancelQuery(ctx, &cloudtrail.CancelQueryInput{
+		EventDataStore: aws.String(c.eventDataStore),
+		QueryId:        aws.String(queryID),
+	})
+	return err
+}
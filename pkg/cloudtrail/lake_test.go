@@ -0,0 +1,232 @@
+package cloudtrail
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakeLake is an in-memory implementation of LakeAPI.
+type fakeLake struct {
+	// statuses are returned by successive polls for the first page,
+	// with the last status repeated
+	statuses  []string
+	pages     [][][]map[string]string
+	queries   []string
+	polls     int
+	cancelled bool
+}
+
+func (f *fakeLake) StartQuery(ctx context.Context, statement string) (string, error) {
+	f.queries = append(f.queries, statement)
+	return "query-1", nil
+}
+
+func (f *fakeLake) GetQueryResults(ctx context.Context, queryID, nextToken string) (*LakeQueryResults, error) {
+	if nextToken == "" {
+		status := f.statuses[len(f.statuses)-1]
+		if f.polls < len(f.statuses) {
+			status = f.statuses[f.polls]
+		}
+		f.polls++
+		if status != LakeQueryStatusFinished {
+			return &LakeQueryResults{QueryStatus: status, ErrorMessage: "query failed"}, nil
+		}
+	}
+	i, _ := strconv.Atoi(nextToken)
+	res := &LakeQueryResults{QueryStatus: LakeQueryStatusFinished, QueryResultRows: f.pages[i]}
+	if i+1 < len(f.pages) {
+		res.NextToken = strconv.Itoa(i + 1)
+	}
+	return res, nil
+}
+
+func (f *fakeLake) CancelQuery(ctx context.Context, queryID string) error {
+	f.cancelled = true
+	return nil
+}
+
+func lakeRow(key string) []map[string]string {
+	return []map[string]string{
+		{"identityType": "AssumedRole"},
+		{"principalId": "AROAUAMTP2WEJUZJXFJX7:test-role"},
+		{"arn": "arn:aws:sts::123456789012:assumed-role/test-role/session"},
+		{"accountId": "123456789012"},
+		{"eventTime": "2021-09-02 04:29:14.000"},
+		{"eventSource": "s3.amazonaws.com"},
+		{"eventName": "HeadObject"},
+		{"requestParameters": "{bucketName=testbucket, key=" + key + ", Host=testbucket.s3.amazonaws.com}"},
+		{"awsRegion": "ap-southeast-2"},
+	}
+}
+
+func newTestLakeScanner(client LakeAPI) *LakeScanner {
+	s := NewLakeScanner(&LakeScannerParams{
+		Log:            zap.NewNop().Sugar(),
+		Client:         client,
+		EventDataStore: "arn:aws:cloudtrail:us-east-1:123456789012:eventdatastore/EXAMPLE-f852-4e8f-8bd1-bcf6cEXAMPLE",
+	})
+	s.pollInterval = time.Millisecond
+	return s
+}
+
+func TestLakeBuildQuery(t *testing.T) {
+	s := newTestLakeScanner(nil)
+	sql := s.buildQuery(Query{
+		Roles: []string{"deploy"},
+		Since: time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC),
+	})
+	assert.Contains(t, sql, "\nFROM EXAMPLE-f852-4e8f-8bd1-bcf6cEXAMPLE\n")
+	assert.Contains(t, sql, "userIdentity.arn AS arn")
+	assert.Contains(t, sql, "userIdentity.sessionContext.sessionIssuer.userName IN ('deploy')")
+	assert.Contains(t, sql, "eventTime >= '2021-09-01 00:00:00'")
+	assert.NotContains(t, sql, "accountId =")
+}
+
+func TestLakeAggregate(t *testing.T) {
+	client := &fakeLake{
+		statuses: []string{LakeQueryStatusQueued, LakeQueryStatusRunning, LakeQueryStatusFinished},
+		pages: [][][]map[string]string{
+			{lakeRow("a"), lakeRow("b")},
+			{lakeRow("c")},
+		},
+	}
+	s := newTestLakeScanner(client)
+
+	agg := NewAggregator()
+	rows, err := s.aggregate(context.Background(), Query{}, &agg)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, rows)
+	assert.Equal(t, 3, client.polls)
+
+	events := agg.GetEvents()
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, "2021-09-02T04:29:14Z", events[0].Time)
+		assert.Equal(t, "testbucket", events[0].Data.Parameters["Bucket"])
+	}
+}
+
+func TestLakeAggregateFailed(t *testing.T) {
+	s := newTestLakeScanner(&fakeLake{statuses: []string{"FAILED"}})
+
+	agg := NewAggregator()
+	_, err := s.aggregate(context.Background(), Query{}, &agg)
+	assert.EqualError(t, err, "error while querying CloudTrail Lake: FAILED query failed")
+}
+
+func TestLakeAggregateTimeout(t *testing.T) {
+	client := &fakeLake{statuses: []string{LakeQueryStatusRunning}}
+	s := newTestLakeScanner(client)
+	s.timeout = 20 * time.Millisecond
+
+	agg := NewAggregator()
+	_, err := s.aggregate(context.Background(), Query{}, &agg)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, client.cancelled)
+}
+
+func TestParseLakeMap(t *testing.T) {
+	assert.Equal(t, map[string]interface{}{
+		"bucketName": "testbucket",
+		"CreateBucketConfiguration": map[string]interface{}{
+			"LocationConstraint": "ap-southeast-2",
+			"xmlns":              "http://s3.amazonaws.com/doc/2006-03-01/",
+		},
+		"tags":   []interface{}{"a", "b"},
+		"policy": "{not a map}",
+	}, parseLakeMap("{bucketName=testbucket, CreateBucketConfiguration={LocationConstraint=ap-southeast-2, xmlns=http://s3.amazonaws.com/doc/2006-03-01/}, tags=[a, b], policy={not a map}}"))
+	assert.Empty(t, parseLakeMap("null"))
+}
+
+func TestLakeAggregateNestedParameters(t *testing.T) {
+	row := []map[string]string{
+		{"identityType": "AssumedRole"},
+		{"principalId": "AROAUAMTP2WEJUZJXFJX7:test-role"},
+		{"arn": "arn:aws:sts::123456789012:assumed-role/test-role/session"},
+		{"accountId": "123456789012"},
+		{"eventTime": "2021-09-02 04:29:14.000"},
+		{"eventSource": "ec2.amazonaws.com"},
+		{"eventName": "TerminateInstances"},
+		{"requestParameters": "{instancesSet={items=[{instanceId=i-0123456789abcdef0}, {instanceId=i-0fedcba9876543210}]}}"},
+		{"awsRegion": "ap-southeast-2"},
+		{"resources": "[{accountId=123456789012, type=AWS::EC2::Instance, ARN=arn:aws:ec2:ap-southeast-2:123456789012:instance/i-0123456789abcdef0}]"},
+	}
+	client := &fakeLake{
+		statuses: []string{LakeQueryStatusFinished},
+		pages:    [][][]map[string]string{{row}},
+	}
+	s := newTestLakeScanner(client)
+
+	agg := NewAggregator()
+	_, err := s.aggregate(context.Background(), Query{}, &agg)
+	assert.NoError(t, err)
+
+	events := agg.GetEvents()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, []interface{}{"i-0123456789abcdef0", "i-0fedcba9876543210"}, events[0].Data.Parameters["InstanceIds"])
+	}
+
+	entry := lakeRowToLogEntry(row)
+	assert.Equal(t, []CloudTrailResource{
+		{ARN: "arn:aws:ec2:ap-southeast-2:123456789012:instance/i-0123456789abcdef0", AccountID: "123456789012", Type: "AWS::EC2::Instance"},
+	}, entry.Resources)
+}
+
+// fakeCloudTrail is an in-memory implementation of cloudTrailLakeAPI.
+type fakeCloudTrail struct {
+	started   *cloudtrail.StartQueryInput
+	results   *cloudtrail.GetQueryResultsInput
+	cancelled *cloudtrail.CancelQueryInput
+}
+
+func (f *fakeCloudTrail) StartQuery(ctx context.Context, params *cloudtrail.StartQueryInput, optFns ...func(*cloudtrail.Options)) (*cloudtrail.StartQueryOutput, error) {
+	f.started = params
+	return &cloudtrail.StartQueryOutput{QueryId: aws.String("query-1")}, nil
+}
+
+func (f *fakeCloudTrail) GetQueryResults(ctx context.Context, params *cloudtrail.GetQueryResultsInput, optFns ...func(*cloudtrail.Options)) (*cloudtrail.GetQueryResultsOutput, error) {
+	f.results = params
+	return &cloudtrail.GetQueryResultsOutput{
+		QueryStatus:     types.QueryStatusFinished,
+		QueryResultRows: [][]map[string]string{{{"eventName": "HeadObject"}}},
+		NextToken:       aws.String("next"),
+	}, nil
+}
+
+func (f *fakeCloudTrail) CancelQuery(ctx context.Context, params *cloudtrail.CancelQueryInput, optFns ...func(*cloudtrail.Options)) (*cloudtrail.CancelQueryOutput, error) {
+	f.cancelled = params
+	return nil, errors.New("query has finished")
+}
+
+func TestLakeClient(t *testing.T) {
+	api := &fakeCloudTrail{}
+	c := &lakeClient{client: api, eventDataStore: "store"}
+
+	queryID, err := c.StartQuery(context.Background(), "SELECT eventName FROM store")
+	assert.NoError(t, err)
+	assert.Equal(t, "query-1", queryID)
+	assert.Equal(t, "SELECT eventName FROM store", aws.ToString(api.started.QueryStatement))
+
+	res, err := c.GetQueryResults(context.Background(), "query-1", "token")
+	assert.NoError(t, err)
+	assert.Equal(t, &LakeQueryResults{
+		QueryStatus:     LakeQueryStatusFinished,
+		QueryResultRows: [][]map[string]string{{{"eventName": "HeadObject"}}},
+		NextToken:       "next",
+	}, res)
+	assert.Equal(t, "store", aws.ToString(api.results.EventDataStore))
+	assert.Equal(t, "query-1", aws.ToString(api.results.QueryId))
+	assert.Equal(t, "token", aws.ToString(api.results.NextToken))
+
+	err = c.CancelQuery(context.Background(), "query-1")
+	assert.EqualError(t, err, "query has finished")
+	assert.Equal(t, "store", aws.ToString(api.cancelled.EventDataStore))
+}
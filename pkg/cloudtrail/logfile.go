@@ -0,0 +1,310 @@
+package cloudtrail
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/common-fate/iamzero/pkg/events"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// LogFileLocation is where a CloudTrail log file sits in the
+// AWSLogs/<account>/CloudTrail/<region>/YYYY/MM/DD layout that
+// CloudTrail delivers log files to S3 with.
+type LogFileLocation struct {
+	AccountID string
+	Region    string
+	Date      time.Time
+}
+
+// ParseLogFilePath finds the account, region and date of a log file from
+// its path. The path may be prefixed with anything, such as the directory
+// an S3 bucket was synced to, or an organization ID for organization trails.
+// It returns false if the path isn't a CloudTrail log file, which excludes
+// digest and Insights files.
+func ParseLogFilePath(path string) (LogFileLocation, bool) {
+	name := filepath.Base(path)
+	if !strings.HasSuffix(name, ".json") && !strings.HasSuffix(name, ".json.gz") {
+		return LogFileLocation{}, false
+	}
+
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	// <account>/CloudTrail/<region>/YYYY/MM/DD/<file>
+	if len(parts) < 7 {
+		return LogFileLocation{}, false
+	}
+	parts = parts[len(parts)-7:]
+	if parts[1] != "CloudTrail" {
+		return LogFileLocation{}, false
+	}
+
+	date, err := time.Parse("2006/01/02", strings.Join(parts[3:6], "/"))
+	if err != nil {
+		return LogFileLocation{}, false
+	}
+
+	return LogFileLocation{
+		AccountID: parts[0],
+		Region:    parts[2],
+		Date:      date,
+	}, true
+}
+
+// logFileRecord is an event in a raw CloudTrail log file. Unlike the
+// Athena table, nested objects such as the request parameters are
+// JSON rather than strings.
+type logFileRecord struct {
+	UserIdentity struct {
+		Type           *string `json:"type"`
+		PrincipalID    *string `json:"principalId"`
+		ARN            *string `json:"arn"`
+		AccountID      *string `json:"accountId"`
+		InvokedBy      *string `json:"invokedBy"`
+		SessionContext struct {
+			SessionIssuer  json.RawMessage `json:"sessionIssuer"`
+			SourceIdentity *string         `json:"sourceIdentity"`
+			Attributes     struct {
+				MFAAuthenticated *string `json:"mfaAuthenticated"`
+			} `json:"attributes"`
+		} `json:"sessionContext"`
+	} `json:"userIdentity"`
+	EventTime         *string         `json:"eventTime"`
+	EventSource       *string         `json:"eventSource"`
+	EventName         *string         `json:"eventName"`
+	AWSRegion         *string         `json:"awsRegion"`
+	ErrorCode         *string         `json:"errorCode"`
+	ErrorMessage      *string         `json:"errorMessage"`
+	RequestParameters json.RawMessage `json:"requestParameters"`
+	SourceIPAddress   *string         `json:"sourceIPAddress"`
+	UserAgent         *string         `json:"userAgent"`
+	Resources         []struct {
+		ARN       string `json:"ARN"`
+		AccountID string `json:"accountId"`
+		Type      string `json:"type"`
+	} `json:"resources"`
+}
+
+// rawString returns the JSON as a string, or nil if it is empty or null.
+func rawString(m json.RawMessage) *string {
+	if len(m) == 0 || string(m) == "null" {
+		return nil
+	}
+	s := string(m)
+	return &s
+}
+
+func (r *logFileRecord) toLogEntry() CloudTrailLogEntry {
+	entry := CloudTrailLogEntry{
+		UserIdentity: CloudTrailUserIdentity{
+			Type:             r.UserIdentity.Type,
+			PrincipalID:      r.UserIdentity.PrincipalID,
+			ARN:              r.UserIdentity.ARN,
+			AccountID:        r.UserIdentity.AccountID,
+			InvokedBy:        r.UserIdentity.InvokedBy,
+			SessionIssuer:    rawString(r.UserIdentity.SessionContext.SessionIssuer),
+			SourceIdentity:   r.UserIdentity.SessionContext.SourceIdentity,
+			MFAAuthenticated: r.UserIdentity.SessionContext.Attributes.MFAAuthenticated,
+		},
+		EventTime:         r.EventTime,
+		EventSource:       r.EventSource,
+		EventName:         r.EventName,
+		AWSRegion:         r.AWSRegion,
+		ErrorCode:         r.ErrorCode,
+		ErrorMessage:      r.ErrorMessage,
+		RequestParameters: rawString(r.RequestParameters),
+		SourceIPAddress:   r.SourceIPAddress,
+		UserAgent:         r.UserAgent,
+	}
+	for _, res := range r.Resources {
+		entry.Resources = append(entry.Resources, CloudTrailResource{
+			ARN:       res.ARN,
+			AccountID: res.AccountID,
+			Type:      res.Type,
+		})
+	}
+	return entry
+}
+
+// ReadLogFile reads a CloudTrail log file, which may be gzipped, calling fn
+// for each record in it. Records are decoded one at a time so that large
+// files don't need to be held in memory.
+func ReadLogFile(r io.Reader, fn func(CloudTrailLogEntry) error) error {
+	br := bufio.NewReader(r)
+	// gzip streams start with the magic bytes 0x1f 0x8b
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return errors.Wrap(err, "opening gzip stream")
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key != "Records" {
+			// skip over any other fields in the file
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return err
+		}
+		for dec.More() {
+			var record logFileRecord
+			if err := dec.Decode(&record); err != nil {
+				return errors.Wrap(err, "decoding record")
+			}
+			// events made by AWS services on behalf of an account
+			// don't have an identity we can attribute them to
+			if record.UserIdentity.ARN == nil {
+				continue
+			}
+			if err := fn(record.toLogEntry()); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if t != delim {
+		return fmt.Errorf("expected %s in CloudTrail log file but found %v", delim, t)
+	}
+	return nil
+}
+
+// LogFileScanner reads raw CloudTrail log files from a directory,
+// such as a local copy of a CloudTrail S3 bucket, so that logs can be
+// analysed without Athena.
+type LogFileScanner struct {
+	log       *zap.SugaredLogger
+	detective *events.Detective
+	dir       string
+	query     Query
+}
+
+type LogFileScannerParams struct {
+	Log       *zap.SugaredLogger
+	Detective *events.Detective
+	// Dir is the directory containing the AWSLogs folder, or any folder within it
+	Dir string
+	// Query selects the events in the log files to analyse
+	Query Query
+}
+
+func NewLogFileScanner(params *LogFileScannerParams) *LogFileScanner {
+	return &LogFileScanner{
+		log:       params.Log,
+		detective: params.Detective,
+		dir:       params.Dir,
+		query:     params.Query,
+	}
+}
+
+// Scan reads every log file in the directory and analyses the
+// events in them with the detective.
+func (s *LogFileScanner) Scan(ctx context.Context) error {
+	agg := NewAggregator()
+	files, err := s.aggregate(ctx, &agg)
+	if err != nil {
+		return err
+	}
+
+	events := agg.GetEvents()
+	s.log.With("files", files, "events", len(events)).Debug("read CloudTrail log files")
+
+	for _, e := range events {
+		_, err := s.detective.AnalyseEvent(e)
+		if err != nil {
+			return err
+		}
+	}
+
+	if unmapped := agg.ReportUnmapped(s.log); unmapped > 0 {
+		fmt.Printf("⚠️  %d CloudTrail events couldn't be mapped to an AWS action and were skipped. Run with -log-level debug to see them\n", unmapped)
+	}
+
+	fmt.Printf("💡 We found %d events in %d CloudTrail log files. You can run \"iamzero local\" to view findings", len(events), files)
+	return nil
+}
+
+// aggregate reads the log files in the directory into the aggregator,
+// returning the number of files which were read.
+func (s *LogFileScanner) aggregate(ctx context.Context, agg *Aggregator) (int, error) {
+	files := 0
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		loc, ok := ParseLogFilePath(path)
+		if !ok {
+			s.log.With("path", path).Debug("skipping file which isn't a CloudTrail log file")
+			return nil
+		}
+		if s.query.Account != "" && loc.AccountID != s.query.Account {
+			return nil
+		}
+		if !s.query.includesDate(loc.Date) {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		err = ReadLogFile(f, func(e CloudTrailLogEntry) error {
+			if !s.query.matches(e) {
+				return nil
+			}
+			return agg.Read(e)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "reading %s", path)
+		}
+		files++
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,155 @@
+package cloudtrail
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+const testLogFile = `{"Records": [
+	{
+		"eventVersion": "1.08",
+		"userIdentity": {
+			"type": "AssumedRole",
+			"principalId": "AROAUAMTP2WEJUZJXFJX7:test-role",
+			"arn": "arn:aws:sts::123456789012:assumed-role/CdkExampleStack-iamzerooverprivilegedrole3B0B7D55-1TIJOTM9XXJZ7/test-role",
+			"accountId": "123456789012",
+			"sessionContext": {
+				"sessionIssuer": {
+					"type": "Role",
+					"arn": "arn:aws:iam::123456789012:role/CdkExampleStack-iamzerooverprivilegedrole3B0B7D55-1TIJOTM9XXJZ7"
+				},
+				"attributes": {"mfaAuthenticated": "false", "creationDate": "2021-09-02T04:00:00Z"},
+				"sourceIdentity": "alice"
+			}
+		},
+		"eventTime": "2021-09-02T04:29:14Z",
+		"sourceIPAddress": "192.0.2.1",
+		"userAgent": "aws-cli/2.2.0",
+		"eventSource": "s3.amazonaws.com",
+		"eventName": "HeadObject",
+		"requestParameters": {"bucketName": "testbucket", "Host": "testbucket.s3.ap-southeast-2.amazonaws.com", "key": "README.md"}
+	},
+	{
+		"userIdentity": {"type": "AWSService", "invokedBy": "cloudtrail.amazonaws.com"},
+		"eventTime": "2021-09-02T04:30:00Z",
+		"eventSource": "s3.amazonaws.com",
+		"eventName": "PutObject",
+		"requestParameters": null
+	}
+]}`
+
+func gzipped(t *testing.T, s string) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	_, err := w.Write([]byte(s))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+func TestParseLogFilePath(t *testing.T) {
+	loc, ok := ParseLogFilePath("bucket/AWSLogs/o-abc123/123456789012/CloudTrail/ap-southeast-2/2021/09/02/123456789012_CloudTrail_ap-southeast-2_20210902T0430Z_abc.json.gz")
+	assert.True(t, ok)
+	assert.Equal(t, LogFileLocation{
+		AccountID: "123456789012",
+		Region:    "ap-southeast-2",
+		Date:      time.Date(2021, 9, 2, 0, 0, 0, 0, time.UTC),
+	}, loc)
+
+	_, ok = ParseLogFilePath("AWSLogs/123456789012/CloudTrail-Digest/ap-southeast-2/2021/09/02/digest.json.gz")
+	assert.False(t, ok)
+
+	_, ok = ParseLogFilePath("AWSLogs/123456789012/CloudTrail/ap-southeast-2/2021/09/02/notes.txt")
+	assert.False(t, ok)
+}
+
+func TestReadLogFile(t *testing.T) {
+	for name, body := range map[string][]byte{
+		"plain":   []byte(testLogFile),
+		"gzipped": gzipped(t, testLogFile),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var entries []CloudTrailLogEntry
+			err := ReadLogFile(bytes.NewReader(body), func(e CloudTrailLogEntry) error {
+				entries = append(entries, e)
+				return nil
+			})
+			assert.NoError(t, err)
+
+			// the event made by an AWS service is skipped
+			if assert.Len(t, entries, 1) {
+				assert.Equal(t, "HeadObject", *entries[0].EventName)
+				assert.JSONEq(t, `{"bucketName": "testbucket", "Host": "testbucket.s3.ap-southeast-2.amazonaws.com", "key": "README.md"}`, *entries[0].RequestParameters)
+				assert.Equal(t, "alice", *entries[0].UserIdentity.SourceIdentity)
+				assert.Equal(t, "false", *entries[0].UserIdentity.MFAAuthenticated)
+				assert.Equal(t, "192.0.2.1", *entries[0].SourceIPAddress)
+				assert.Equal(t, "aws-cli/2.2.0", *entries[0].UserAgent)
+			}
+		})
+	}
+}
+
+func TestReadLogFile_Invalid(t *testing.T) {
+	err := ReadLogFile(strings.NewReader(`[]`), func(e CloudTrailLogEntry) error { return nil })
+	assert.Error(t, err)
+}
+
+func TestLogFileScannerAggregate(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"AWSLogs/123456789012/CloudTrail/ap-southeast-2/2021/09/02/a.json.gz": gzipped(t, testLogFile),
+		// the same event in an uncompressed file is deduplicated
+		"AWSLogs/123456789012/CloudTrail/us-east-1/2021/09/02/b.json": []byte(testLogFile),
+		// not a log file
+		"AWSLogs/123456789012/CloudTrail-Digest/ap-southeast-2/2021/09/02/c.json.gz": []byte("invalid"),
+		// another account
+		"AWSLogs/210987654321/CloudTrail/ap-southeast-2/2021/09/02/d.json": []byte("invalid"),
+	}
+	for name, body := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, body, 0644))
+	}
+
+	s := NewLogFileScanner(&LogFileScannerParams{
+		Log: zap.NewNop().Sugar(),
+		Dir: dir,
+		Query: Query{
+			Account: "123456789012",
+			Roles:   []string{"CdkExampleStack-iamzerooverprivilegedrole3B0B7D55-1TIJOTM9XXJZ7"},
+		},
+	})
+	agg := NewAggregator()
+	n, err := s.aggregate(context.Background(), &agg)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	events := agg.GetEvents()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "HeadObject", events[0].Data.Operation)
+		assert.Equal(t, "testbucket", events[0].Data.Parameters["Bucket"])
+	}
+
+	// no events match a different role
+	s.query.Roles = []string{"other-role"}
+	agg = NewAggregator()
+	_, err = s.aggregate(context.Background(), &agg)
+	assert.NoError(t, err)
+	assert.Empty(t, agg.GetEvents())
+
+	// the log files are outside of the time window
+	s.query = Query{Since: time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)}
+	agg = NewAggregator()
+	n, err = s.aggregate(context.Background(), &agg)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
@@ -0,0 +1,189 @@
+package cloudtrail
+
+import (
+	"regexp"
+	"strings"
+)
+
+// serviceMapping describes how CloudTrail events from an event source,
+// such as "s3.amazonaws.com", are converted into AWSEvents.
+type serviceMapping struct {
+	// Service is the service name used in AWSEvents, which matches the
+	// service names in the IAM action catalog.
+	Service string
+	// Operations maps CloudTrail event names to SDK operation names, for
+	// events which are named differently to the operation.
+	Operations map[string]string
+	// Parameters maps request parameters to AWSEvent parameters. Nested
+	// parameters are addressed with ".", e.g. "instancesSet.items.instanceId".
+	// If a path passes through a list, the values from every item in the
+	// list are collected.
+	Parameters map[string][]string
+	// MappedParametersOnly skips request parameters which aren't in
+	// Parameters. Otherwise, the other top-level request parameters are
+	// copied to the AWSEvent.
+	MappedParametersOnly bool
+	// KeepParameterCase copies request parameters without changing their
+	// names. Otherwise the first letter is capitalised to match the SDK
+	// parameter names, e.g. "tableName" becomes "TableName".
+	KeepParameterCase bool
+	// Resources maps the types in the event's resources[] list to the
+	// parameter which is set to the resource ARN, if the request
+	// parameters don't already contain it.
+	Resources map[string]string
+	// operation returns the SDK operation name for an event, for events
+	// where the operation can't be found from the event name alone.
+	operation func(eventName string, params map[string]interface{}) string
+}
+
+// serviceMappings covers the services in the IAM action catalog,
+// keyed by the CloudTrail event source.
+var serviceMappings = map[string]serviceMapping{
+	"athena.amazonaws.com":         {Service: "athena"},
+	"cloudformation.amazonaws.com": {Service: "cloudformation"},
+	"monitoring.amazonaws.com":     {Service: "cloudwatch"},
+	"dynamodb.amazonaws.com": {
+		Service: "dynamodb",
+		// the advisory templates refer to the table as "Table"
+		Parameters: map[string][]string{"tableName": {"TableName", "Table"}},
+		Resources:  map[string]string{"AWS::DynamoDB::Table": "TableArn"},
+	},
+	"ec2.amazonaws.com": {
+		Service: "ec2",
+		// instance IDs are nested in a list of items, e.g. for TerminateInstances
+		Parameters: map[string][]string{"instancesSet.items.instanceId": {"InstanceIds"}},
+	},
+	"ecr.amazonaws.com":      {Service: "ecr"},
+	"events.amazonaws.com":   {Service: "events"},
+	"firehose.amazonaws.com": {Service: "firehose"},
+	"iam.amazonaws.com":      {Service: "iam"},
+	"kinesis.amazonaws.com":  {Service: "kinesis"},
+	"kms.amazonaws.com": {
+		Service: "kms",
+		// requests such as Decrypt don't include the key ID
+		Resources: map[string]string{"AWS::KMS::Key": "KeyId"},
+	},
+	"lambda.amazonaws.com": {
+		Service:   "lambda",
+		Resources: map[string]string{"AWS::Lambda::Function": "FunctionName"},
+		operation: func(eventName string, params map[string]interface{}) string {
+			// the Lambda API version is appended to most event names,
+			// e.g. GetFunction20150331v2
+			return lambdaVersionSuffix.ReplaceAllString(eventName, "")
+		},
+	},
+	"logs.amazonaws.com": {Service: "logs"},
+	"s3.amazonaws.com": {
+		Service: "s3",
+		// S3 request parameters include HTTP headers such as Host
+		MappedParametersOnly: true,
+		Parameters: map[string][]string{
+			"bucketName": {"Bucket"},
+			"key":        {"Key"},
+			"prefix":     {"Prefix"},
+		},
+		operation: func(eventName string, params map[string]interface{}) string {
+			// CloudTrail logs ListObjectsV2 as ListObjects
+			if eventName == "ListObjects" && params["list-type"] == "2" {
+				return "ListObjectsV2"
+			}
+			return eventName
+		},
+	},
+	"secretsmanager.amazonaws.com": {Service: "secretsmanager"},
+	"sns.amazonaws.com":            {Service: "sns"},
+	"sqs.amazonaws.com":            {Service: "sqs"},
+	"ssm.amazonaws.com":            {Service: "ssm"},
+	"states.amazonaws.com": {
+		Service: "states",
+		// Step Functions parameters are camelCase in the SDK
+		KeepParameterCase: true,
+	},
+	"sts.amazonaws.com": {Service: "sts"},
+}
+
+var lambdaVersionSuffix = regexp.MustCompile(`\d{8}(v\d+)?$`)
+
+// Operation returns the SDK operation name for a CloudTrail event name.
+func (m serviceMapping) Operation(eventName string, params map[string]interface{}) string {
+	if op, ok := m.Operations[eventName]; ok {
+		return op
+	}
+	if m.operation != nil {
+		return m.operation(eventName, params)
+	}
+	return eventName
+}
+
+// ExtractParameters builds the AWSEvent parameters from the request
+// parameters and resources of a CloudTrail event.
+func (m serviceMapping) ExtractParameters(params map[string]interface{}, resources []CloudTrailResource) map[string]interface{} {
+	result := map[string]interface{}{}
+
+	mapped := map[string]bool{}
+	for path, names := range m.Parameters {
+		split := strings.Split(path, ".")
+		mapped[split[0]] = true
+		val, ok := lookupPath(params, split)
+		if !ok {
+			continue
+		}
+		for _, name := range names {
+			result[name] = val
+		}
+	}
+
+	if !m.MappedParametersOnly {
+		for k, v := range params {
+			if mapped[k] || k == "" {
+				continue
+			}
+			name := k
+			if !m.KeepParameterCase {
+				name = strings.ToUpper(k[:1]) + k[1:]
+			}
+			if _, ok := result[name]; !ok {
+				result[name] = v
+			}
+		}
+	}
+
+	for _, r := range resources {
+		name, ok := m.Resources[r.Type]
+		if !ok || r.ARN == "" {
+			continue
+		}
+		if _, ok := result[name]; !ok {
+			result[name] = r.ARN
+		}
+	}
+	return result
+}
+
+// lookupPath finds the value at a path in the request parameters. If the
+// path passes through a list, the values found in each item are
+// returned as a list.
+func lookupPath(v interface{}, path []string) (interface{}, bool) {
+	if len(path) == 0 {
+		return v, v != nil
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return lookupPath(val[path[0]], path[1:])
+	case []interface{}:
+		values := []interface{}{}
+		for _, item := range val {
+			found, ok := lookupPath(item, path)
+			if !ok {
+				continue
+			}
+			if list, isList := found.([]interface{}); isList {
+				values = append(values, list...)
+			} else {
+				values = append(values, found)
+			}
+		}
+		return values, len(values) > 0
+	}
+	return nil, false
+}
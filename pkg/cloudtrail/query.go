@@ -0,0 +1,83 @@
+package cloudtrail
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Query selects the CloudTrail events to analyse
+type Query struct {
+	// Account limits the events to those made by principals in an account, if set
+	Account string
+	// Roles are the names of the roles to find events for.
+	// If empty, events for every principal are found.
+	Roles []string
+	// Since and Until bound the time of the events. A zero time is unbounded.
+	Since time.Time
+	Until time.Time
+}
+
+// ParseTimeFlag parses a time passed to the -since or -until flags. The
+// time may be an RFC3339 timestamp, a date such as 2021-09-02, or a
+// duration such as 72h which is subtracted from now.
+func ParseTimeFlag(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: must be an RFC3339 timestamp, a date (2006-01-02) or a duration (72h)", value)
+}
+
+// includesDate returns true if the events in a log file delivered on the
+// date may be within the query's time window. Log files are delivered
+// shortly after the events in them, so a day either side is allowed for.
+func (q Query) includesDate(date time.Time) bool {
+	if !q.Since.IsZero() && date.Before(q.Since.Add(-24*time.Hour)) {
+		return false
+	}
+	if !q.Until.IsZero() && date.After(q.Until.Add(24*time.Hour)) {
+		return false
+	}
+	return true
+}
+
+// matches returns true if the log entry is selected by the query.
+func (q Query) matches(e CloudTrailLogEntry) bool {
+	if q.Account != "" && aws.ToString(e.UserIdentity.AccountID) != q.Account {
+		return false
+	}
+
+	if !q.Since.IsZero() || !q.Until.IsZero() {
+		if e.EventTime == nil {
+			return false
+		}
+		t, err := time.Parse(time.RFC3339, *e.EventTime)
+		if err != nil || (!q.Since.IsZero() && t.Before(q.Since)) || (!q.Until.IsZero() && t.After(q.Until)) {
+			return false
+		}
+	}
+
+	if len(q.Roles) == 0 {
+		return true
+	}
+	arn := aws.ToString(e.UserIdentity.ARN)
+	for _, role := range q.Roles {
+		// role ARNs may include a path, e.g. arn:aws:iam::123456789012:role/path/name
+		isRole := strings.Contains(arn, ":role/") && strings.HasSuffix(arn, "/"+role)
+		if isRole || strings.Contains(arn, ":assumed-role/"+role+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,9 @@
 package events
 
 import (
+	"database/sql"
+	"errors"
+	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws/arn"
@@ -8,43 +11,65 @@ import (
 	"github.com/common-fate/iamzero/pkg/policies"
 	"github.com/common-fate/iamzero/pkg/recommendations"
 	"github.com/common-fate/iamzero/pkg/storage"
+	"github.com/common-fate/iamzero/pkg/tags"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
 // Detective looks through events to create and update Findings
 type Detective struct {
-	log     *zap.SugaredLogger
-	storage *storage.Storage
-	auditor *audit.Auditor
+	log       *zap.SugaredLogger
+	storage   *storage.Storage
+	auditor   *audit.Auditor
+	advisor   *recommendations.Advisor
+	optimiser *policies.Optimiser
+	tagger    *tags.Tagger
 }
 
 type DetectiveOpts struct {
 	Log     *zap.SugaredLogger
 	Storage *storage.Storage
 	Auditor *audit.Auditor
+	// Advisor is optional. If not provided, an advisor with the
+	// built-in advisory templates is used.
+	Advisor *recommendations.Advisor
+	// Optimiser is optional. If not provided, finding documents are
+	// consolidated without collapsing actions into wildcards.
+	Optimiser *policies.Optimiser
+	// Tagger is optional. If not provided, events aren't tagged by
+	// account and findings are keyed by role alone.
+	Tagger *tags.Tagger
 }
 
 // NewDetective creates and initialises a new Detective
 func NewDetective(opts DetectiveOpts) *Detective {
+	advisor := opts.Advisor
+	if advisor == nil {
+		advisor = recommendations.NewAdvisor(opts.Auditor)
+	}
 	return &Detective{
-		log:     opts.Log,
-		storage: opts.Storage,
-		auditor: opts.Auditor,
+		log:       opts.Log,
+		storage:   opts.Storage,
+		auditor:   opts.Auditor,
+		advisor:   advisor,
+		optimiser: opts.Optimiser,
+		tagger:    opts.Tagger,
 	}
 }
 
 func (c *Detective) AnalyseEvent(e recommendations.AWSEvent) (*recommendations.AWSAction, error) {
 
-	advisor := recommendations.NewAdvisor(c.auditor)
-
-	// if the event was captured from an assumed role, replace it with the IAM role ARN
-	// TODO: we should store both the session ARN and the role ARN in this case
+	// if the event was captured from an assumed role, replace it with the IAM role ARN.
+	// The session ARN is kept in the identity's session context.
 	iamRole, err := recommendations.ExtractRoleARNFromSession(e.Identity.Role)
 	if err != nil {
 		return nil, err
 	}
 	if iamRole != nil {
+		err = setSessionFromARN(&e.Identity, e.Identity.Role)
+		if err != nil {
+			return nil, err
+		}
 		e.Identity.Role = *iamRole
 	}
 
@@ -63,46 +88,47 @@ func (c *Detective) AnalyseEvent(e recommendations.AWSEvent) (*recommendations.A
 	cdkResource := c.auditor.GetCDKResourceByPhysicalID(physicalID)
 	c.log.With("cdkResource", cdkResource, "physicalID", physicalID).Debug("looked up CDK resource")
 
-	// try and find an existing finding
-	finding, err := c.storage.Finding.FindByRole(storage.FindByRoleQuery{
-		Role:   e.Identity.Role,
-		Status: recommendations.PolicyStatusActive,
-	})
+	iacSource := c.auditor.GetIaCSource(roleARN.AccountID, physicalID)
+	c.log.With("iacSource", iacSource, "physicalID", physicalID).Debug("looked up IaC source")
+
+	advice, err := c.advisor.Advise(e)
 	if err != nil {
 		return nil, err
+	} else {
+		c.log.With("advice", advice).Info("matched advisor recommendation")
 	}
-	if finding == nil {
-		identity := recommendations.ProcessedAWSIdentity{
-			User:        e.Identity.User,
-			Role:        e.Identity.Role,
-			Account:     e.Identity.Account,
-			CDKResource: cdkResource,
-		}
 
-		// create a new policy for the token and role if it doesn't exist
-		finding = &recommendations.Finding{
-			ID:         uuid.NewString(),
-			Identity:   identity,
-			UpdatedAt:  time.Now(),
-			EventCount: 0,
-			Status:     "active",
-			Document: policies.AWSIAMPolicy{
-				Version:   "2012-10-17",
-				Statement: []policies.AWSIAMStatement{},
-			},
+	// AccessDenied errors tell us exactly which permission is missing,
+	// so recommend granting it ahead of the advisory templates
+	missing := c.advisor.MissingPermissionForEvent(e)
+	if missing != nil {
+		c.log.With("missingPermission", missing).Info("event was denied access")
+		missingAdvice, err := c.advisor.CreateAdviceForMissingPermission(&e, *missing)
+		if err != nil {
+			return nil, err
 		}
+		if missingAdvice != nil {
+			advice = append([]*recommendations.LeastPrivilegePolicy{missingAdvice}, advice...)
+		}
+	}
+
+	if e.ID == "" {
+		e.ID = uuid.NewString()
 	}
 
-	advice, err := advisor.Advise(e)
+	// tags set by the client or the token take precedence over the account's tags
+	e.Tags = e.Tags.WithDefaults(c.tagger.ForAccount(e.Identity.Account))
+
+	// identical events are counted against the action created for the first
+	// of them, rather than creating another action
+	hash, err := recommendations.HashEvent(e)
 	if err != nil {
 		return nil, err
-	} else {
-		c.log.With("advice", advice).Info("matched advisor recommendation")
 	}
+	eventHash := strconv.FormatUint(hash, 16)
 
 	action := recommendations.AWSAction{
 		ID:                 uuid.NewString(),
-		FindingID:          finding.ID,
 		Event:              e,
 		Status:             recommendations.AlertActive,
 		Time:               time.Now(),
@@ -111,6 +137,13 @@ func (c *Detective) AnalyseEvent(e recommendations.AWSEvent) (*recommendations.A
 		Recommendations:                []*recommendations.LeastPrivilegePolicy{},
 		Enabled:                        true,
 		SelectedLeastPrivilegePolicyID: "",
+		MissingPermission:              missing,
+	}
+
+	// if the action was denied by an explicit deny, an SCP or a permissions boundary,
+	// granting it in the role's policy won't help, so don't include it by default
+	if missing != nil && !missing.Fixable() {
+		action.Enabled = false
 	}
 
 	if len(advice) > 0 {
@@ -120,21 +153,197 @@ func (c *Detective) AnalyseEvent(e recommendations.AWSEvent) (*recommendations.A
 		action.SelectedLeastPrivilegePolicyID = advice[0].GetID()
 	}
 
+	identity := recommendations.ProcessedAWSIdentity{
+		User:        e.Identity.User,
+		Role:        e.Identity.Role,
+		Account:     e.Identity.Account,
+		CDKResource: cdkResource,
+		IaCSource:   iacSource,
+	}
+
+	// findings are updated while holding a lock for the role, so that concurrent
+	// events for the same role don't create duplicate findings or overwrite
+	// each other's recalculated documents
+	var result *recommendations.AWSAction
+	err = c.storage.WithRoleLock(e.Identity.Role, func(s *storage.Storage) error {
+		var err error
+		result, err = c.addActionToFinding(s, identity, &action, eventHash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// addActionToFinding adds the action to the active finding for the role and the
+// event's key tags, creating the finding if it doesn't exist, and recalculates
+// the finding's policy document.
+// If the action's event has already been seen for the finding, the existing
+// action is returned instead. It must be called while holding the role lock.
+func (c *Detective) addActionToFinding(s *storage.Storage, identity recommendations.ProcessedAWSIdentity, action *recommendations.AWSAction, eventHash string) (*recommendations.AWSAction, error) {
+	// try and find an existing finding
+	key := c.tagger.FindingKey(action.Event.Tags)
+	finding, err := s.Finding.FindByRole(storage.FindByRoleQuery{
+		Role:   identity.Role,
+		Status: recommendations.PolicyStatusActive,
+		Tags:   key,
+	})
+	// the Postgres storage returns sql.ErrNoRows if there is no finding
+	if errors.Is(err, sql.ErrNoRows) {
+		finding, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if finding != nil {
+		existing, err := c.recordRepeatedEvent(s, finding.ID, eventHash, action.Event.Identity.Session, now)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			finding.UpdatedAt = now
+			finding.EventCount, err = countEvents(s, finding.ID)
+			if err != nil {
+				return nil, err
+			}
+			if err := s.Finding.CreateOrUpdate(*finding); err != nil {
+				return nil, err
+			}
+			return existing, nil
+		}
+	}
+
+	if finding == nil {
+		// create a new policy for the token and role if it doesn't exist
+		finding = &recommendations.Finding{
+			ID:         uuid.NewString(),
+			Identity:   identity,
+			UpdatedAt:  time.Now(),
+			EventCount: 0,
+			Status:     "active",
+			Tags:       key,
+			Document: policies.AWSIAMPolicy{
+				Version:   "2012-10-17",
+				Statement: []policies.AWSIAMStatement{},
+			},
+		}
+		// actions reference their finding, so a new finding is saved before
+		// the action is added. With Postgres and Bolt this is rolled back if
+		// the rest of the update fails.
+		err = s.Finding.CreateOrUpdate(*finding)
+		if err != nil {
+			return nil, err
+		}
+	} else if finding.Identity.IaCSource == nil {
+		// the finding may have been created before the role's stack was loaded
+		finding.Identity.IaCSource = identity.IaCSource
+	}
+
+	action.FindingID = finding.ID
+
 	c.log.With("action", action).Info("adding action")
-	err = c.storage.Action.Add(action)
+	err = s.Action.Add(*action)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := storage.StoredEvent{
+		ID:        action.Event.ID,
+		Hash:      eventHash,
+		ActionID:  action.ID,
+		FindingID: finding.ID,
+		Event:     action.Event,
+		FirstSeen: now,
+		LastSeen:  now,
+		Count:     1,
+	}
+	stored.RecordSession(action.Event.Identity.Session, now)
+	err = s.Event.Save(stored)
 	if err != nil {
 		return nil, err
 	}
 
-	actions, err := c.storage.Action.ListForPolicy(finding.ID)
+	actions, err := s.Action.ListForPolicy(finding.ID)
+	if err != nil {
+		return nil, err
+	}
+	finding.RecalculateDocument(actions, c.optimiser)
+	finding.EventCount, err = countEvents(s, finding.ID)
 	if err != nil {
 		return nil, err
 	}
-	finding.RecalculateDocument(actions)
 
-	err = c.storage.Finding.CreateOrUpdate(*finding)
+	err = s.Finding.CreateOrUpdate(*finding)
 	if err != nil {
 		return nil, err
 	}
-	return &action, nil
+	return action, nil
+}
+
+// recordRepeatedEvent counts another occurrence of an event which has already
+// created an action in the finding, and returns the action. It returns nil if
+// the event hasn't been seen for the finding.
+func (c *Detective) recordRepeatedEvent(s *storage.Storage, findingID string, eventHash string, session *recommendations.SessionContext, at time.Time) (*recommendations.AWSAction, error) {
+	seen, err := s.Event.GetByHash(eventHash)
+	if err != nil {
+		return nil, err
+	}
+	// an event seen for a finding which has since been resolved creates a new action
+	if seen == nil || seen.FindingID != findingID {
+		return nil, nil
+	}
+
+	action, err := s.Action.Get(seen.ActionID)
+	if err != nil || action == nil {
+		return nil, err
+	}
+
+	seen.Count++
+	seen.LastSeen = at
+	seen.RecordSession(session, at)
+	err = s.Event.Save(*seen)
+	if err != nil {
+		return nil, err
+	}
+	c.log.With("actionId", action.ID, "count", seen.Count).Debug("counted repeated event")
+	return action, nil
+}
+
+// countEvents returns the number of events received for the finding,
+// including repeated events.
+func countEvents(s *storage.Storage, findingID string) (int, error) {
+	stored, err := s.Event.ListStoredForFinding(findingID)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, e := range stored {
+		count += e.Count
+	}
+	return count, nil
+}
+
+// setSessionFromARN records the assumed role session ARN and the session name
+// in the identity's session context, unless they have already been provided.
+// The session context is copied, as it may be shared with the caller's event.
+func setSessionFromARN(identity *recommendations.AWSIdentity, sessionARN string) error {
+	session := recommendations.SessionContext{}
+	if identity.Session != nil {
+		session = *identity.Session
+	}
+	if session.ARN == "" {
+		session.ARN = sessionARN
+	}
+	if session.Name == "" {
+		name, err := recommendations.ExtractSessionNameFromSession(sessionARN)
+		if err != nil {
+			return err
+		}
+		session.Name = name
+	}
+	identity.Session = &session
+	return nil
 }
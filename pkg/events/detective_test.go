@@ -0,0 +1,304 @@
+package events
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/common-fate/iamzero/pkg/audit"
+	"github.com/common-fate/iamzero/pkg/recommendations"
+	"github.com/common-fate/iamzero/pkg/storage"
+	"github.com/common-fate/iamzero/pkg/tags"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func openTestBoltStorage(t *testing.T) *storage.Storage {
+	db, err := storm.Open(filepath.Join(t.TempDir(), "findings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	assert.NoError(t, db.Init(recommendations.Finding{}))
+	assert.NoError(t, db.Init(recommendations.AWSAction{}))
+	assert.NoError(t, db.Init(storage.StoredEvent{}))
+	return storage.BuildBoltStorage(db)
+}
+
+// slowFindingStorage pauses after looking up a role's finding, widening
+// the window between reading and writing the finding so that races are
+// likely even when the tests are run on a single CPU.
+type slowFindingStorage struct {
+	storage.FindingStorage
+}
+
+func (s *slowFindingStorage) FindByRole(q storage.FindByRoleQuery) (*recommendations.Finding, error) {
+	f, err := s.FindingStorage.FindByRole(q)
+	time.Sleep(time.Millisecond)
+	return f, err
+}
+
+// TestAnalyseEvent_Concurrent analyses events for a handful of roles concurrently
+// and checks that each role ends up with exactly one active finding containing
+// every one of its events.
+func TestAnalyseEvent_Concurrent(t *testing.T) {
+	const roles = 4
+	const eventsPerRole = 25
+
+	backends := map[string]func(t *testing.T) *storage.Storage{
+		"in-memory": func(t *testing.T) *storage.Storage { return storage.BuildInMemoryStorage() },
+		"bolt":      openTestBoltStorage,
+	}
+
+	for name, build := range backends {
+		t.Run(name, func(t *testing.T) {
+			s := build(t)
+			s.Finding = &slowFindingStorage{s.Finding}
+			detective := NewDetective(DetectiveOpts{
+				Log:     zap.NewNop().Sugar(),
+				Storage: s,
+				Auditor: audit.New(),
+			})
+
+			// start the goroutines at the same time to make races more likely
+			start := make(chan struct{})
+			var wg sync.WaitGroup
+			for i := 0; i < eventsPerRole; i++ {
+				for r := 0; r < roles; r++ {
+					wg.Add(1)
+					go func(r, i int) {
+						defer wg.Done()
+						<-start
+						e := recommendations.AWSEvent{
+							Identity: recommendations.AWSIdentity{
+								Role:    fmt.Sprintf("arn:aws:sts::123456789012:assumed-role/role-%d/session", r),
+								Account: "123456789012",
+							},
+							Data: recommendations.AWSData{
+								Type:       "awsAction",
+								Service:    "s3",
+								Region:     "ap-southeast-2",
+								Operation:  "GetObject",
+								Parameters: map[string]interface{}{"Bucket": "test", "Key": fmt.Sprintf("object-%d", i)},
+							},
+						}
+						_, err := detective.AnalyseEvent(e)
+						assert.NoError(t, err)
+					}(r, i)
+				}
+			}
+			close(start)
+			wg.Wait()
+
+			findings, err := s.Finding.ListForStatus(recommendations.PolicyStatusActive)
+			assert.NoError(t, err)
+			assert.Len(t, findings, roles)
+
+			perRole := map[string]int{}
+			for _, f := range findings {
+				perRole[f.Identity.Role]++
+				// the last update to the finding included every action
+				assert.Equal(t, eventsPerRole, f.EventCount)
+
+				actions, err := s.Action.ListForPolicy(f.ID)
+				assert.NoError(t, err)
+				assert.Len(t, actions, eventsPerRole)
+			}
+			for r := 0; r < roles; r++ {
+				assert.Equal(t, 1, perRole[fmt.Sprintf("arn:aws:iam::123456789012:role/role-%d", r)])
+			}
+		})
+	}
+}
+
+// TestAnalyseEvent_Deduplicates checks that identical events are counted against
+// a single action, and that events seen again after their finding is resolved
+// create a new action.
+func TestAnalyseEvent_Deduplicates(t *testing.T) {
+	backends := map[string]func(t *testing.T) *storage.Storage{
+		"in-memory": func(t *testing.T) *storage.Storage { return storage.BuildInMemoryStorage() },
+		"bolt":      openTestBoltStorage,
+	}
+
+	for name, build := range backends {
+		t.Run(name, func(t *testing.T) {
+			s := build(t)
+			detective := NewDetective(DetectiveOpts{
+				Log:     zap.NewNop().Sugar(),
+				Storage: s,
+				Auditor: audit.New(),
+			})
+
+			e := recommendations.AWSEvent{
+				Identity: recommendations.AWSIdentity{
+					Role:    "arn:aws:sts::123456789012:assumed-role/role/session",
+					Account: "123456789012",
+				},
+				Data: recommendations.AWSData{
+					Type:       "awsAction",
+					Service:    "s3",
+					Region:     "ap-southeast-2",
+					Operation:  "GetObject",
+					Parameters: map[string]interface{}{"Bucket": "test", "Key": "object"},
+				},
+			}
+
+			first, err := detective.AnalyseEvent(e)
+			assert.NoError(t, err)
+			created, err := s.Finding.Get(first.FindingID)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, created.EventCount)
+
+			second, err := detective.AnalyseEvent(e)
+			assert.NoError(t, err)
+			assert.Equal(t, first.ID, second.ID)
+
+			// the repeated event is counted in the finding
+			updated, err := s.Finding.Get(first.FindingID)
+			assert.NoError(t, err)
+			assert.Equal(t, 2, updated.EventCount)
+			assert.True(t, updated.UpdatedAt.After(created.UpdatedAt))
+
+			actions, err := s.Action.ListForPolicy(first.FindingID)
+			assert.NoError(t, err)
+			assert.Len(t, actions, 1)
+
+			stored, err := s.Event.GetForAction(first.ID)
+			assert.NoError(t, err)
+			if assert.NotNil(t, stored) {
+				assert.Equal(t, 2, stored.Count)
+				assert.False(t, stored.LastSeen.Before(stored.FirstSeen))
+			}
+
+			finding, err := s.Finding.Get(first.FindingID)
+			assert.NoError(t, err)
+			finding.Status = recommendations.PolicyStatusResolved
+			assert.NoError(t, s.Finding.CreateOrUpdate(*finding))
+
+			third, err := detective.AnalyseEvent(e)
+			assert.NoError(t, err)
+			assert.NotEqual(t, first.ID, third.ID)
+			assert.NotEqual(t, first.FindingID, third.FindingID)
+
+			stored, err = s.Event.GetForAction(third.ID)
+			assert.NoError(t, err)
+			if assert.NotNil(t, stored) {
+				assert.Equal(t, 1, stored.Count)
+			}
+		})
+	}
+}
+
+// TestAnalyseEvent_RecordsSessions checks that the session context is kept when
+// the session ARN is replaced with the role ARN, and that the sessions which
+// made identical calls are counted against the stored event.
+func TestAnalyseEvent_RecordsSessions(t *testing.T) {
+	s := storage.BuildInMemoryStorage()
+	detective := NewDetective(DetectiveOpts{
+		Log:     zap.NewNop().Sugar(),
+		Storage: s,
+		Auditor: audit.New(),
+	})
+
+	event := func(session string) recommendations.AWSEvent {
+		return recommendations.AWSEvent{
+			Identity: recommendations.AWSIdentity{
+				Role:    "arn:aws:sts::123456789012:assumed-role/role/" + session,
+				Account: "123456789012",
+				Session: &recommendations.SessionContext{SourceIP: "192.0.2.1"},
+			},
+			Data: recommendations.AWSData{
+				Type:       "awsAction",
+				Service:    "s3",
+				Region:     "ap-southeast-2",
+				Operation:  "GetObject",
+				Parameters: map[string]interface{}{"Bucket": "test", "Key": "object"},
+			},
+		}
+	}
+
+	first, err := detective.AnalyseEvent(event("alice"))
+	assert.NoError(t, err)
+	_, err = detective.AnalyseEvent(event("bob"))
+	assert.NoError(t, err)
+	_, err = detective.AnalyseEvent(event("alice"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "arn:aws:iam::123456789012:role/role", first.Event.Identity.Role)
+	assert.Equal(t, &recommendations.SessionContext{
+		ARN:      "arn:aws:sts::123456789012:assumed-role/role/alice",
+		Name:     "alice",
+		SourceIP: "192.0.2.1",
+	}, first.Event.Identity.Session)
+
+	stored, err := s.Event.GetForAction(first.ID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, stored) && assert.Len(t, stored.Sessions, 2) {
+		assert.Equal(t, "alice", stored.Sessions[0].Session.Name)
+		assert.Equal(t, 2, stored.Sessions[0].Count)
+		assert.Equal(t, "bob", stored.Sessions[1].Session.Name)
+		assert.Equal(t, 1, stored.Sessions[1].Count)
+	}
+}
+
+// TestAnalyseEvent_KeysFindingsByTags checks that events for the same role
+// create separate findings when their key tags differ, and that the account's
+// tags are used when the event doesn't set them.
+func TestAnalyseEvent_KeysFindingsByTags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.yml")
+	err := ioutil.WriteFile(path, []byte(`"123456789012": {env: prod}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagger := &tags.Tagger{FindingKeys: []string{"env"}, AccountTagsFile: path}
+	assert.NoError(t, tagger.Load())
+
+	s := storage.BuildInMemoryStorage()
+	detective := NewDetective(DetectiveOpts{
+		Log:     zap.NewNop().Sugar(),
+		Storage: s,
+		Auditor: audit.New(),
+		Tagger:  tagger,
+	})
+
+	event := func(key string, eventTags tags.Tags) recommendations.AWSEvent {
+		return recommendations.AWSEvent{
+			Identity: recommendations.AWSIdentity{
+				Role:    "arn:aws:sts::123456789012:assumed-role/role/session",
+				Account: "123456789012",
+			},
+			Data: recommendations.AWSData{
+				Type:       "awsAction",
+				Service:    "s3",
+				Region:     "ap-southeast-2",
+				Operation:  "GetObject",
+				Parameters: map[string]interface{}{"Bucket": "test", "Key": key},
+			},
+			Tags: eventTags,
+		}
+	}
+
+	prod, err := detective.AnalyseEvent(event("a", nil))
+	assert.NoError(t, err)
+	dev, err := detective.AnalyseEvent(event("b", tags.Tags{"env": "dev"}))
+	assert.NoError(t, err)
+	// tags which findings aren't keyed by don't create another finding
+	team, err := detective.AnalyseEvent(event("c", tags.Tags{"team": "payments"}))
+	assert.NoError(t, err)
+
+	assert.Equal(t, tags.Tags{"env": "prod"}, prod.Event.Tags)
+	assert.NotEqual(t, prod.FindingID, dev.FindingID)
+	assert.Equal(t, prod.FindingID, team.FindingID)
+
+	findings, err := s.Finding.ListForStatus(recommendations.PolicyStatusActive)
+	assert.NoError(t, err)
+	byEnv := map[string]int{}
+	for _, f := range findings {
+		byEnv[f.Tags["env"]] = f.EventCount
+	}
+	assert.Equal(t, map[string]int{"prod": 2, "dev": 1}, byEnv)
+}
@@ -0,0 +1,309 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/common-fate/iamzero/pkg/recommendations"
+	"github.com/common-fate/iamzero/pkg/storage"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultPipelineWorkers     = 10
+	DefaultPipelineMaxAttempts = 5
+	DefaultPipelineRetention   = 24 * time.Hour
+
+	// pipelineLease is how long a worker holds an event before it
+	// is made available to other workers again
+	pipelineLease         = 5 * time.Minute
+	pipelinePollInterval  = time.Second
+	pipelinePurgeInterval = 10 * time.Minute
+	initialRetryBackoff   = time.Second
+	maxRetryBackoff       = 5 * time.Minute
+)
+
+// EventAnalyser analyses events. It is implemented by the Detective.
+type EventAnalyser interface {
+	AnalyseEvent(e recommendations.AWSEvent) (*recommendations.AWSAction, error)
+}
+
+// Pipeline queues events received by the collector and analyses them
+// in the background with a bounded pool of workers. Events which fail
+// are retried with a backoff, and are moved to the dead-letter status
+// once they have failed the maximum number of times. Analysed events
+// are purged from the queue once they are older than the retention period.
+type Pipeline struct {
+	log           *zap.SugaredLogger
+	queue         storage.EventQueueStorage
+	analyser      EventAnalyser
+	workers       int
+	maxAttempts   int
+	lease         time.Duration
+	retention     time.Duration
+	pollInterval  time.Duration
+	purgeInterval time.Duration
+	retryBackoff  time.Duration
+
+	// notify wakes the dispatcher when events are enqueued
+	notify chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type PipelineParams struct {
+	Log      *zap.SugaredLogger
+	Queue    storage.EventQueueStorage
+	Analyser EventAnalyser
+	// Workers is the number of events analysed at once. Defaults to 10.
+	Workers int
+	// MaxAttempts is the number of times an event is analysed before
+	// it is dead-lettered. Defaults to 5.
+	MaxAttempts int
+	// Retention is how long analysed events are kept in the queue
+	// before they are purged. Defaults to 24 hours.
+	Retention time.Duration
+}
+
+func NewPipeline(params *PipelineParams) *Pipeline {
+	p := &Pipeline{
+		log:           params.Log,
+		queue:         params.Queue,
+		analyser:      params.Analyser,
+		workers:       params.Workers,
+		maxAttempts:   params.MaxAttempts,
+		lease:         pipelineLease,
+		retention:     params.Retention,
+		pollInterval:  pipelinePollInterval,
+		purgeInterval: pipelinePurgeInterval,
+		retryBackoff:  initialRetryBackoff,
+		notify:        make(chan struct{}, 1),
+	}
+	if p.workers <= 0 {
+		p.workers = DefaultPipelineWorkers
+	}
+	if p.maxAttempts <= 0 {
+		p.maxAttempts = DefaultPipelineMaxAttempts
+	}
+	if p.retention <= 0 {
+		p.retention = DefaultPipelineRetention
+	}
+	return p
+}
+
+// ValidateEvent checks that an event can be analysed by the detective,
+// so that invalid events are rejected before they are queued.
+func ValidateEvent(e recommendations.AWSEvent) error {
+	if e.Identity.Role == "" {
+		return errors.New("identity.role is required")
+	}
+	role, err := recommendations.ExtractRoleARNFromSession(e.Identity.Role)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		role = &e.Identity.Role
+	}
+	if _, err := arn.Parse(*role); err != nil {
+		return fmt.Errorf("identity.role is not a valid ARN: %s", e.Identity.Role)
+	}
+	if e.Data.Service == "" {
+		return errors.New("data.service is required")
+	}
+	if e.Data.Operation == "" {
+		return errors.New("data.operation is required")
+	}
+	return nil
+}
+
+// Enqueue durably queues a batch of events to be analysed,
+// returning the IDs which can be used to look up their status.
+func (p *Pipeline) Enqueue(tokenID string, events []recommendations.AWSEvent) ([]string, error) {
+	now := time.Now()
+	queued := []storage.QueuedEvent{}
+	ids := []string{}
+	for _, e := range events {
+		q := storage.QueuedEvent{
+			ID:          uuid.NewString(),
+			TokenID:     tokenID,
+			Event:       e,
+			Status:      storage.QueuedEventPending,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			AvailableAt: now,
+		}
+		queued = append(queued, q)
+		ids = append(ids, q.ID)
+	}
+
+	if err := p.queue.Enqueue(queued); err != nil {
+		return nil, err
+	}
+
+	// wake the dispatcher, unless it has already been woken
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+	return ids, nil
+}
+
+// Start starts the workers in separate goroutines
+func (p *Pipeline) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	p.cancel = cancel
+
+	// jobs is buffered so that the dispatcher never blocks when handing
+	// out events, as it only claims events when workers are free
+	jobs := make(chan storage.QueuedEvent, p.workers)
+	free := make(chan struct{}, p.workers)
+	for w := 0; w < p.workers; w++ {
+		free <- struct{}{}
+	}
+
+	p.wg.Add(p.workers + 2)
+	for w := 0; w < p.workers; w++ {
+		go p.worker(jobs, free)
+	}
+	go p.dispatch(ctx, jobs, free)
+	go p.purge(ctx)
+}
+
+// Stop stops claiming events, and waits for the workers
+// to finish the events they have already claimed.
+func (p *Pipeline) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.wg.Wait()
+}
+
+// dispatch claims events from the queue while there are free workers
+func (p *Pipeline) dispatch(ctx context.Context, jobs chan<- storage.QueuedEvent, free chan struct{}) {
+	defer p.wg.Done()
+	defer close(jobs)
+
+	for {
+		// wait for a worker to be free
+		select {
+		case <-ctx.Done():
+			return
+		case <-free:
+		}
+		n := 1
+	more:
+		for n < p.workers {
+			select {
+			case <-free:
+				n++
+			default:
+				break more
+			}
+		}
+
+		events, err := p.queue.Claim(n, p.lease, p.maxAttempts)
+		if err != nil {
+			p.log.With(zap.Error(err)).Error("error claiming queued events")
+		}
+		for _, e := range events {
+			jobs <- e
+		}
+		// return the workers which weren't given an event
+		for i := len(events); i < n; i++ {
+			free <- struct{}{}
+		}
+
+		// if every free worker was given an event there may be more
+		// waiting, otherwise wait until more events are enqueued
+		if err == nil && len(events) == n {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.notify:
+		case <-time.After(p.pollInterval):
+		}
+	}
+}
+
+// purge periodically deletes analysed events which are older than the retention period
+func (p *Pipeline) purge(ctx context.Context) {
+	defer p.wg.Done()
+
+	for {
+		n, err := p.queue.PurgeCompleted(time.Now().Add(-p.retention))
+		if err != nil {
+			p.log.With(zap.Error(err)).Error("error purging analysed events")
+		} else if n > 0 {
+			p.log.With("count", n).Debug("purged analysed events")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.purgeInterval):
+		}
+	}
+}
+
+func (p *Pipeline) worker(jobs <-chan storage.QueuedEvent, free chan<- struct{}) {
+	defer p.wg.Done()
+	for e := range jobs {
+		p.process(e)
+		free <- struct{}{}
+	}
+}
+
+// process analyses a queued event and records the outcome in the queue
+func (p *Pipeline) process(e storage.QueuedEvent) {
+	log := p.log.With("queuedEventId", e.ID, "attempt", e.Attempts)
+
+	action, err := p.analyse(e.Event)
+	if err == nil {
+		actionID := ""
+		if action != nil {
+			actionID = action.ID
+		}
+		if err := p.queue.Complete(e.ID, actionID); err != nil {
+			log.With(zap.Error(err)).Error("error completing queued event")
+		}
+		return
+	}
+
+	if e.Attempts >= p.maxAttempts {
+		log.With(zap.Error(err)).Error("event failed the maximum number of times, moving it to the dead-letter queue")
+		if err := p.queue.DeadLetter(e.ID, err.Error()); err != nil {
+			log.With(zap.Error(err)).Error("error dead-lettering queued event")
+		}
+		return
+	}
+
+	backoff := p.retryBackoff
+	for i := 1; i < e.Attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	log.With(zap.Error(err), "backoff", backoff).Warn("error analysing event, retrying")
+	if err := p.queue.Retry(e.ID, err.Error(), time.Now().Add(backoff)); err != nil {
+		log.With(zap.Error(err)).Error("error retrying queued event")
+	}
+}
+
+// analyse runs the analyser, recovering from panics so that
+// a poison event can't stop the worker.
+func (p *Pipeline) analyse(e recommendations.AWSEvent) (action *recommendations.AWSAction, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic analysing event: %v", r)
+		}
+	}()
+	return p.analyser.AnalyseEvent(e)
+}
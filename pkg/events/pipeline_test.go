@@ -0,0 +1,203 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/common-fate/iamzero/pkg/recommendations"
+	"github.com/common-fate/iamzero/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakeAnalyser fails each event until it has been analysed failures[operation] times
+type fakeAnalyser struct {
+	sync.Mutex
+	failures map[string]int
+	panics   bool
+	calls    map[string]int
+}
+
+func (a *fakeAnalyser) AnalyseEvent(e recommendations.AWSEvent) (*recommendations.AWSAction, error) {
+	a.Lock()
+	defer a.Unlock()
+	a.calls[e.Data.Operation]++
+	if a.panics {
+		panic("poison event")
+	}
+	if a.calls[e.Data.Operation] <= a.failures[e.Data.Operation] {
+		return nil, errors.New("analysis failed")
+	}
+	return &recommendations.AWSAction{ID: "action-" + e.Data.Operation}, nil
+}
+
+func testEvent(operation string) recommendations.AWSEvent {
+	return recommendations.AWSEvent{
+		Identity: recommendations.AWSIdentity{Role: "arn:aws:iam::123456789012:role/test-role"},
+		Data:     recommendations.AWSData{Type: "awsAction", Service: "s3", Operation: operation},
+	}
+}
+
+func newTestPipeline(analyser EventAnalyser) (*Pipeline, *storage.InMemoryEventQueueStorage) {
+	queue := storage.NewInMemoryEventQueueStorage()
+	p := NewPipeline(&PipelineParams{
+		Log:         zap.NewNop().Sugar(),
+		Queue:       queue,
+		Analyser:    analyser,
+		Workers:     2,
+		MaxAttempts: 3,
+	})
+	p.pollInterval = 5 * time.Millisecond
+	p.retryBackoff = time.Millisecond
+	return p, queue
+}
+
+// waitForStatus waits until the queued event has the given status
+func waitForStatus(t *testing.T, queue storage.EventQueueStorage, id string, status storage.QueuedEventStatus) *storage.QueuedEvent {
+	var e *storage.QueuedEvent
+	assert.Eventually(t, func() bool {
+		var err error
+		e, err = queue.Get(id)
+		return err == nil && e != nil && e.Status == status
+	}, 5*time.Second, 5*time.Millisecond)
+	return e
+}
+
+func TestPipeline(t *testing.T) {
+	analyser := &fakeAnalyser{
+		failures: map[string]int{"GetObject": 1, "PutObject": 10},
+		calls:    map[string]int{},
+	}
+	p, queue := newTestPipeline(analyser)
+	p.Start(context.Background())
+	defer p.Stop()
+
+	ids, err := p.Enqueue("token", []recommendations.AWSEvent{
+		testEvent("HeadObject"),
+		testEvent("GetObject"),
+		testEvent("PutObject"),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, ids, 3)
+
+	e := waitForStatus(t, queue, ids[0], storage.QueuedEventDone)
+	assert.Equal(t, "action-HeadObject", e.ActionID)
+	assert.Equal(t, 1, e.Attempts)
+	assert.Equal(t, "token", e.TokenID)
+
+	// the event succeeds when it is retried
+	e = waitForStatus(t, queue, ids[1], storage.QueuedEventDone)
+	assert.Equal(t, 2, e.Attempts)
+	assert.Empty(t, e.LastError)
+
+	// the event is dead-lettered after the maximum number of attempts
+	e = waitForStatus(t, queue, ids[2], storage.QueuedEventDeadLetter)
+	assert.Equal(t, 3, e.Attempts)
+	assert.Equal(t, "analysis failed", e.LastError)
+
+	dead, err := queue.ListForStatus(storage.QueuedEventDeadLetter)
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+}
+
+func TestPipeline_RecoversFromPanics(t *testing.T) {
+	analyser := &fakeAnalyser{panics: true, calls: map[string]int{}}
+	p, queue := newTestPipeline(analyser)
+	p.Start(context.Background())
+	defer p.Stop()
+
+	ids, err := p.Enqueue("token", []recommendations.AWSEvent{testEvent("HeadObject")})
+	assert.NoError(t, err)
+
+	e := waitForStatus(t, queue, ids[0], storage.QueuedEventDeadLetter)
+	assert.Equal(t, "panic analysing event: poison event", e.LastError)
+}
+
+func TestPipeline_ClaimsExpiredLeases(t *testing.T) {
+	analyser := &fakeAnalyser{calls: map[string]int{}}
+	p, queue := newTestPipeline(analyser)
+
+	ids, err := p.Enqueue("token", []recommendations.AWSEvent{testEvent("HeadObject")})
+	assert.NoError(t, err)
+
+	// a worker claims the event, then stops before finishing it
+	claimed, err := queue.Claim(10, -time.Second, 3)
+	assert.NoError(t, err)
+	assert.Len(t, claimed, 1)
+
+	p.Start(context.Background())
+	defer p.Stop()
+
+	e := waitForStatus(t, queue, ids[0], storage.QueuedEventDone)
+	assert.Equal(t, 2, e.Attempts)
+}
+
+func TestPipeline_DeadLettersExpiredLeasesAfterMaxAttempts(t *testing.T) {
+	analyser := &fakeAnalyser{calls: map[string]int{}}
+	p, queue := newTestPipeline(analyser)
+
+	ids, err := p.Enqueue("token", []recommendations.AWSEvent{testEvent("HeadObject")})
+	assert.NoError(t, err)
+
+	// the event stops the worker on every attempt, so its lease always expires
+	for i := 0; i < 3; i++ {
+		claimed, err := queue.Claim(10, -time.Second, 3)
+		assert.NoError(t, err)
+		assert.Len(t, claimed, 1)
+	}
+
+	p.Start(context.Background())
+	defer p.Stop()
+
+	e := waitForStatus(t, queue, ids[0], storage.QueuedEventDeadLetter)
+	assert.Equal(t, 3, e.Attempts)
+	assert.Equal(t, storage.QueuedEventLeaseExpired, e.LastError)
+	assert.Zero(t, analyser.calls["HeadObject"])
+}
+
+func TestPipeline_PurgesAnalysedEvents(t *testing.T) {
+	analyser := &fakeAnalyser{failures: map[string]int{"PutObject": 10}, calls: map[string]int{}}
+	p, queue := newTestPipeline(analyser)
+	p.retention = 50 * time.Millisecond
+	p.purgeInterval = 5 * time.Millisecond
+	p.Start(context.Background())
+	defer p.Stop()
+
+	ids, err := p.Enqueue("token", []recommendations.AWSEvent{testEvent("HeadObject"), testEvent("PutObject")})
+	assert.NoError(t, err)
+
+	waitForStatus(t, queue, ids[0], storage.QueuedEventDone)
+	waitForStatus(t, queue, ids[1], storage.QueuedEventDeadLetter)
+
+	// the analysed event is purged once it is older than the retention period
+	assert.Eventually(t, func() bool {
+		e, err := queue.Get(ids[0])
+		return err == nil && e == nil
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// dead-lettered events are kept
+	e, err := queue.Get(ids[1])
+	assert.NoError(t, err)
+	assert.NotNil(t, e)
+}
+
+func TestValidateEvent(t *testing.T) {
+	assert.NoError(t, ValidateEvent(testEvent("HeadObject")))
+
+	session := testEvent("HeadObject")
+	session.Identity.Role = "arn:aws:sts::123456789012:assumed-role/test-role/session"
+	assert.NoError(t, ValidateEvent(session))
+
+	noRole := testEvent("HeadObject")
+	noRole.Identity.Role = ""
+	assert.EqualError(t, ValidateEvent(noRole), "identity.role is required")
+
+	invalidRole := testEvent("HeadObject")
+	invalidRole.Identity.Role = "test-role"
+	assert.EqualError(t, ValidateEvent(invalidRole), "identity.role is not a valid ARN: test-role")
+
+	assert.EqualError(t, ValidateEvent(testEvent("")), "data.operation is required")
+}
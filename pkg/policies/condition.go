@@ -0,0 +1,101 @@
+package policies
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Condition is the Condition block of an IAM policy statement.
+// It is keyed by the condition operator (e.g. "StringEquals") and then
+// by the condition key (e.g. "aws:SourceVpce").
+//
+// For example:
+//
+//	"Condition": {
+//	  "StringLike": {"s3:prefix": ["home/", "home/alice/*"]},
+//	  "Bool": {"aws:SecureTransport": true}
+//	}
+type Condition map[string]map[string]ConditionValues
+
+// ConditionValues are the values for a condition key.
+//
+// In policy documents the values may be given as a single value or as a
+// list, and as strings, booleans or numbers. ConditionValues keeps track of
+// both so that policies can be round-tripped through JSON without changes.
+type ConditionValues struct {
+	// Values contains string, bool or json.Number values
+	Values []interface{}
+	// Single is true if the value was a single value rather than a list
+	Single bool
+}
+
+// NewConditionValue returns a single string condition value
+func NewConditionValue(value string) ConditionValues {
+	return ConditionValues{Values: []interface{}{value}, Single: true}
+}
+
+// NewConditionValues returns a list of string condition values
+func NewConditionValues(values ...string) ConditionValues {
+	c := ConditionValues{Values: []interface{}{}}
+	for _, v := range values {
+		c.Values = append(c.Values, v)
+	}
+	return c
+}
+
+// Strings returns the condition values as strings. Booleans and numbers
+// are formatted in the same way as they appear in the policy document.
+func (c ConditionValues) Strings() []string {
+	res := []string{}
+	for _, v := range c.Values {
+		res = append(res, fmt.Sprint(v))
+	}
+	return res
+}
+
+func (c ConditionValues) MarshalJSON() ([]byte, error) {
+	if c.Single && len(c.Values) == 1 {
+		return json.Marshal(c.Values[0])
+	}
+	if c.Values == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(c.Values)
+}
+
+func (c *ConditionValues) UnmarshalJSON(data []byte) error {
+	var tmp interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// keep numbers as they were written, rather than converting to float64
+	dec.UseNumber()
+	if err := dec.Decode(&tmp); err != nil {
+		return err
+	}
+
+	if slice, ok := tmp.([]interface{}); ok {
+		values := []interface{}{}
+		for _, item := range slice {
+			if !isConditionScalar(item) {
+				return fmt.Errorf("condition value %v must be a string, boolean or number", item)
+			}
+			values = append(values, item)
+		}
+		*c = ConditionValues{Values: values}
+		return nil
+	}
+
+	if !isConditionScalar(tmp) {
+		return fmt.Errorf("condition value %v must be a string, boolean, number or a list", tmp)
+	}
+	*c = ConditionValues{Values: []interface{}{tmp}, Single: true}
+	return nil
+}
+
+func isConditionScalar(v interface{}) bool {
+	switch v.(type) {
+	case string, bool, json.Number:
+		return true
+	}
+	return false
+}
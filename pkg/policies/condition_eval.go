@@ -0,0 +1,221 @@
+package policies
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// conditionOperator compares a value from the request context
+// against a value from the policy
+type conditionOperator struct {
+	match func(requestValue, policyValue string, rc requestContext) bool
+	// negated operators such as StringNotEquals are true if
+	// the request value matches none of the policy values
+	negated bool
+}
+
+var conditionOperators = map[string]conditionOperator{
+	"StringEquals":              {match: stringEquals},
+	"StringNotEquals":           {match: stringEquals, negated: true},
+	"StringEqualsIgnoreCase":    {match: stringEqualsIgnoreCase},
+	"StringNotEqualsIgnoreCase": {match: stringEqualsIgnoreCase, negated: true},
+	"StringLike":                {match: stringLike},
+	"StringNotLike":             {match: stringLike, negated: true},
+	"ArnEquals":                 {match: arnLike},
+	"ArnNotEquals":              {match: arnLike, negated: true},
+	"ArnLike":                   {match: arnLike},
+	"ArnNotLike":                {match: arnLike, negated: true},
+	"NumericEquals":             {match: numeric(func(r, p float64) bool { return r == p })},
+	"NumericNotEquals":          {match: numeric(func(r, p float64) bool { return r == p }), negated: true},
+	"NumericLessThan":           {match: numeric(func(r, p float64) bool { return r < p })},
+	"NumericLessThanEquals":     {match: numeric(func(r, p float64) bool { return r <= p })},
+	"NumericGreaterThan":        {match: numeric(func(r, p float64) bool { return r > p })},
+	"NumericGreaterThanEquals":  {match: numeric(func(r, p float64) bool { return r >= p })},
+	"DateEquals":                {match: date(func(r, p time.Time) bool { return r.Equal(p) })},
+	"DateNotEquals":             {match: date(func(r, p time.Time) bool { return r.Equal(p) }), negated: true},
+	"DateLessThan":              {match: date(func(r, p time.Time) bool { return r.Before(p) })},
+	"DateLessThanEquals":        {match: date(func(r, p time.Time) bool { return !r.After(p) })},
+	"DateGreaterThan":           {match: date(func(r, p time.Time) bool { return r.After(p) })},
+	"DateGreaterThanEquals":     {match: date(func(r, p time.Time) bool { return !r.Before(p) })},
+	"Bool":                      {match: stringEqualsIgnoreCase},
+	"BinaryEquals":              {match: stringEquals},
+	"IpAddress":                 {match: ipAddress},
+	"NotIpAddress":              {match: ipAddress, negated: true},
+}
+
+// evaluateCondition returns true if all of the condition operators in
+// a statement's Condition block are satisfied by the request context.
+// Unsupported condition operators are never satisfied.
+func evaluateCondition(c Condition, rc requestContext) bool {
+	for operator, keys := range c {
+		for key, values := range keys {
+			if !evaluateConditionKey(operator, key, values.Strings(), rc) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func evaluateConditionKey(operator, key string, policyValues []string, rc requestContext) bool {
+	requestValues, present := rc.get(key)
+	if len(requestValues) == 0 {
+		present = false
+	}
+
+	if operator == "Null" {
+		// "true" means that the key must not be present in the request
+		for _, v := range policyValues {
+			if strings.EqualFold(v, "true") != present {
+				return true
+			}
+		}
+		return false
+	}
+
+	forAll := false
+	forAny := false
+	switch {
+	case strings.HasPrefix(operator, "ForAllValues:"):
+		forAll = true
+		operator = strings.TrimPrefix(operator, "ForAllValues:")
+	case strings.HasPrefix(operator, "ForAnyValue:"):
+		forAny = true
+		operator = strings.TrimPrefix(operator, "ForAnyValue:")
+	}
+
+	ifExists := strings.HasSuffix(operator, "IfExists")
+	operator = strings.TrimSuffix(operator, "IfExists")
+
+	op, ok := conditionOperators[operator]
+	if !ok {
+		return false
+	}
+
+	if !present {
+		switch {
+		case ifExists, forAll:
+			return true
+		case forAny:
+			return false
+		}
+		// negated operators are satisfied if the key isn't in the request
+		return op.negated
+	}
+
+	// valueMatches returns whether a single request value satisfies the operator
+	valueMatches := func(requestValue string) bool {
+		matched := false
+		for _, p := range policyValues {
+			if op.match(requestValue, p, rc) {
+				matched = true
+				break
+			}
+		}
+		return matched != op.negated
+	}
+
+	if forAll {
+		for _, r := range requestValues {
+			if !valueMatches(r) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if op.negated && !forAny {
+		// for single-valued keys, a negated operator is satisfied
+		// if no request value matches any of the policy values
+		for _, r := range requestValues {
+			if !valueMatches(r) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, r := range requestValues {
+		if valueMatches(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringEquals(r, p string, rc requestContext) bool {
+	expanded, ok := expandLiteral(p, rc)
+	return ok && r == expanded
+}
+
+func stringEqualsIgnoreCase(r, p string, rc requestContext) bool {
+	expanded, ok := expandLiteral(p, rc)
+	return ok && strings.EqualFold(r, expanded)
+}
+
+func stringLike(r, p string, rc requestContext) bool {
+	re, ok := compileWildcard(p, rc, false)
+	return ok && re.MatchString(r)
+}
+
+func arnLike(r, p string, rc requestContext) bool {
+	return matchARN(p, r, rc)
+}
+
+func numeric(cmp func(r, p float64) bool) func(string, string, requestContext) bool {
+	return func(r, p string, _ requestContext) bool {
+		rf, err := strconv.ParseFloat(r, 64)
+		if err != nil {
+			return false
+		}
+		pf, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return false
+		}
+		return cmp(rf, pf)
+	}
+}
+
+func date(cmp func(r, p time.Time) bool) func(string, string, requestContext) bool {
+	return func(r, p string, _ requestContext) bool {
+		rt, ok := parseConditionDate(r)
+		if !ok {
+			return false
+		}
+		pt, ok := parseConditionDate(p)
+		if !ok {
+			return false
+		}
+		return cmp(rt, pt)
+	}
+}
+
+// parseConditionDate parses an ISO 8601 date or a Unix epoch time
+func parseConditionDate(s string) (time.Time, bool) {
+	if epoch, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(epoch, 0), true
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func ipAddress(r, p string, _ requestContext) bool {
+	ip := net.ParseIP(r)
+	if ip == nil {
+		return false
+	}
+	if !strings.Contains(p, "/") {
+		return ip.Equal(net.ParseIP(p))
+	}
+	_, cidr, err := net.ParseCIDR(p)
+	if err != nil {
+		return false
+	}
+	return cidr.Contains(ip)
+}
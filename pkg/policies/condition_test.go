@@ -0,0 +1,56 @@
+package policies
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatementRoundTrip(t *testing.T) {
+	doc := `{
+		"Version": "2012-10-17",
+		"Statement": [
+			{
+				"Sid": "DenyInsecure",
+				"Effect": "Deny",
+				"NotAction": ["iam:*"],
+				"NotResource": ["arn:aws:s3:::public-bucket/*"],
+				"Condition": {
+					"Bool": {"aws:SecureTransport": false},
+					"NumericLessThan": {"s3:max-keys": 10},
+					"StringLike": {"s3:prefix": ["home/", "home/${aws:username}/*"]},
+					"StringEquals": {"aws:SourceVpce": "vpce-1a2b3c4d"}
+				}
+			}
+		]
+	}`
+
+	var p AWSIAMPolicy
+	err := json.Unmarshal([]byte(doc), &p)
+	assert.NoError(t, err)
+
+	s := p.Statement[0]
+	assert.Equal(t, NewStringValues("iam:*"), s.NotAction)
+	assert.Equal(t, NewStringValues("arn:aws:s3:::public-bucket/*"), s.NotResource)
+	assert.Equal(t, []string{"false"}, s.Condition["Bool"]["aws:SecureTransport"].Strings())
+	assert.Equal(t, []string{"home/", "home/${aws:username}/*"}, s.Condition["StringLike"]["s3:prefix"].Strings())
+
+	out, err := json.Marshal(p)
+	assert.NoError(t, err)
+	assert.JSONEq(t, doc, string(out))
+}
+
+func TestConditionValuesMarshal(t *testing.T) {
+	single, _ := json.Marshal(NewConditionValue("vpce-1"))
+	assert.Equal(t, `"vpce-1"`, string(single))
+
+	list, _ := json.Marshal(NewConditionValues("vpce-1"))
+	assert.Equal(t, `["vpce-1"]`, string(list))
+}
+
+func TestConditionValuesRejectsObjects(t *testing.T) {
+	var c ConditionValues
+	err := json.Unmarshal([]byte(`{"a": "b"}`), &c)
+	assert.Error(t, err)
+}
@@ -0,0 +1,366 @@
+package policies
+
+import (
+	"strings"
+)
+
+// Decision is the result of evaluating a request against IAM policies
+type Decision string
+
+const (
+	// DecisionAllow means that the request is allowed
+	DecisionAllow Decision = "Allow"
+	// DecisionImplicitDeny means that no policy allows the request
+	DecisionImplicitDeny Decision = "ImplicitDeny"
+	// DecisionExplicitDeny means that a Deny statement matches the request
+	DecisionExplicitDeny Decision = "ExplicitDeny"
+)
+
+// PolicyType is the type of policy that a statement belongs to
+type PolicyType string
+
+const (
+	PolicyTypeIdentity            PolicyType = "identity"
+	PolicyTypeResource            PolicyType = "resource"
+	PolicyTypePermissionsBoundary PolicyType = "permissionsBoundary"
+	PolicyTypeSCP                 PolicyType = "scp"
+)
+
+// Request is an API request to be evaluated against IAM policies
+type Request struct {
+	// Principal is the ARN of the IAM role or user making the request,
+	// e.g. "arn:aws:iam::123456789012:role/example"
+	Principal string
+	// Action is the IAM action, e.g. "s3:GetObject"
+	Action string
+	// Resource is the ARN of the resource, or "*" for actions
+	// which don't support resource-level permissions
+	Resource string
+	// Context holds the values of condition keys in the request,
+	// e.g. "aws:SourceVpce" or "s3:prefix". Keys are case-insensitive.
+	// The values are also used to resolve policy variables such as ${aws:username}.
+	Context map[string][]string
+	// PartialContext is set if Context only holds some of the condition keys
+	// of the request. Conditions on other keys could be satisfied, so
+	// statements which depend on them are matched as conditional statements.
+	PartialContext bool
+}
+
+// PolicySet holds the policies which apply to a request
+type PolicySet struct {
+	// Identity holds the managed and inline policies attached to the principal
+	Identity []AWSIAMPolicy
+	// Resource holds the resource-based policies attached to the resource,
+	// such as an S3 bucket policy or a role trust policy
+	Resource []AWSIAMPolicy
+	// ResourcePolicyRequired is set for resources where the resource-based
+	// policy must always allow access, such as role trust policies and KMS key
+	// policies. An identity-based policy alone can't grant access to these.
+	ResourcePolicyRequired bool
+	// PermissionsBoundary is nil if the principal doesn't have a permissions boundary
+	PermissionsBoundary *AWSIAMPolicy
+	// SCPs holds the service control policies for the principal's account,
+	// grouped by their level in the organization: the root, each OU, and
+	// the account itself. At each level, at least one of the
+	// policies must allow the request.
+	SCPs [][]AWSIAMPolicy
+}
+
+// MatchedStatement is a policy statement which matched a request
+type MatchedStatement struct {
+	PolicyType PolicyType
+	// PolicyID is the Id of the policy containing the statement, if set
+	PolicyID  string
+	Statement AWSIAMStatement
+	// Conditional is true if the statement only matches when condition
+	// keys which aren't in the request context have particular values.
+	// Conditional Deny statements don't deny the request.
+	Conditional bool
+}
+
+// EvaluationResult is the result of evaluating a request
+type EvaluationResult struct {
+	Decision Decision
+	// Reason is a human-readable explanation of the decision
+	Reason string
+	// MatchedStatements are all of the Allow and Deny statements which matched the request
+	MatchedStatements []MatchedStatement
+	// Conditional is true if the request is allowed, but only when condition
+	// keys which aren't in the request context have particular values.
+	// It is only set for requests with PartialContext.
+	Conditional bool
+}
+
+// Evaluate determines whether a request is allowed by a set of policies,
+// following the AWS policy evaluation logic:
+//
+// 1. If any policy contains a Deny statement matching the request, it is explicitly denied.
+//
+// 2. If SCPs are provided, every level of the organization must allow the request.
+//
+// 3. Within an account, a resource-based policy which names the principal
+// allows the request without an identity-based policy.
+//
+// 4. Otherwise an identity-based policy must allow the request. If the principal
+// has a permissions boundary, it must also allow the request.
+//
+// 5. For cross-account requests, both an identity-based policy and a
+// resource-based policy must allow the request.
+//
+// Session policies are not supported.
+func Evaluate(ps PolicySet, req Request) EvaluationResult {
+	rc := newRequestContext(req.Context)
+	e := evaluator{req: req, rc: rc}
+
+	// all counts conditional Allow statements, unconditional doesn't
+	all := allowed{scp: true, boundary: true}
+	unconditional := allowed{scp: true, boundary: true}
+	for _, level := range ps.SCPs {
+		ok, certain := e.evaluatePolicies(PolicyTypeSCP, level)
+		all.scp = all.scp && ok
+		unconditional.scp = unconditional.scp && certain
+	}
+
+	if ps.PermissionsBoundary != nil {
+		all.boundary, unconditional.boundary = e.evaluatePolicies(PolicyTypePermissionsBoundary, []AWSIAMPolicy{*ps.PermissionsBoundary})
+	}
+
+	all.resource, unconditional.resource = e.evaluatePolicies(PolicyTypeResource, ps.Resource)
+	all.identity, unconditional.identity = e.evaluatePolicies(PolicyTypeIdentity, ps.Identity)
+	all.resourceDirectly, unconditional.resourceDirectly = e.resourceAllowedDirectly, e.resourceAllowedDirectlyUnconditionally
+
+	res := EvaluationResult{MatchedStatements: e.matched}
+	res.Decision, res.Reason = decide(ps, req, e.denied, all)
+	if res.Decision == DecisionAllow {
+		decision, _ := decide(ps, req, e.denied, unconditional)
+		res.Conditional = e.deniedConditionally || decision != DecisionAllow
+	}
+	return res
+}
+
+// allowed records which kinds of policy allow a request
+type allowed struct {
+	scp      bool
+	boundary bool
+	resource bool
+	identity bool
+	// resourceDirectly is true if a resource-based policy allows the
+	// request by naming the principal rather than its account.
+	resourceDirectly bool
+}
+
+// decide applies the AWS policy evaluation logic described in Evaluate.
+func decide(ps PolicySet, req Request, denied bool, a allowed) (Decision, string) {
+	switch {
+	case denied:
+		return DecisionExplicitDeny, "the request is denied by a Deny statement"
+	case !a.scp:
+		return DecisionImplicitDeny, "the request is not allowed by the service control policies"
+	case ps.ResourcePolicyRequired && !a.resource:
+		return DecisionImplicitDeny, "the request is not allowed by the resource-based policy"
+	case isCrossAccount(req.Principal, req.Resource):
+		switch {
+		case !a.identity:
+			return DecisionImplicitDeny, "cross-account request is not allowed by an identity-based policy"
+		case !a.resource:
+			return DecisionImplicitDeny, "cross-account request is not allowed by a resource-based policy"
+		case !a.boundary:
+			return DecisionImplicitDeny, "the request is not allowed by the permissions boundary"
+		}
+		return DecisionAllow, "the request is allowed by identity-based and resource-based policies"
+	case a.resourceDirectly:
+		return DecisionAllow, "the request is allowed by a resource-based policy"
+	case !a.identity:
+		return DecisionImplicitDeny, "no identity-based or resource-based policy allows the request"
+	case !a.boundary:
+		return DecisionImplicitDeny, "the request is not allowed by the permissions boundary"
+	}
+	return DecisionAllow, "the request is allowed by an identity-based policy"
+}
+
+type evaluator struct {
+	req     Request
+	rc      requestContext
+	matched []MatchedStatement
+	denied  bool
+	// deniedConditionally is true if a Deny statement matches the request
+	// depending on condition keys which aren't in the request context.
+	deniedConditionally bool
+	// resourceAllowedDirectly is true if a resource-based policy allows the
+	// request by naming the principal rather than its account.
+	resourceAllowedDirectly                bool
+	resourceAllowedDirectlyUnconditionally bool
+}
+
+// evaluatePolicies evaluates all statements in the policies, recording any
+// matched statements. Returns whether any Allow statement matches, and
+// whether any Allow statement matches unconditionally.
+func (e *evaluator) evaluatePolicies(pt PolicyType, ps []AWSIAMPolicy) (allowed bool, unconditional bool) {
+	for _, p := range ps {
+		id := ""
+		if p.Id != nil {
+			id = *p.Id
+		}
+		for _, s := range p.Statement {
+			matches, direct, conditional := e.statementMatches(pt, s)
+			if !matches {
+				continue
+			}
+			e.matched = append(e.matched, MatchedStatement{PolicyType: pt, PolicyID: id, Statement: s, Conditional: conditional})
+			if strings.EqualFold(s.Effect, "Deny") {
+				if conditional {
+					e.deniedConditionally = true
+				} else {
+					e.denied = true
+				}
+			} else if strings.EqualFold(s.Effect, "Allow") {
+				allowed = true
+				unconditional = unconditional || !conditional
+				if direct {
+					e.resourceAllowedDirectly = true
+					e.resourceAllowedDirectlyUnconditionally = e.resourceAllowedDirectlyUnconditionally || !conditional
+				}
+			}
+		}
+	}
+	return allowed, unconditional
+}
+
+// statementMatches returns whether the statement applies to the request.
+// For resource-based policies, direct is true if the statement names the
+// principal itself rather than its account. Conditional is true if the
+// statement only applies depending on condition keys which aren't in the
+// request context.
+func (e *evaluator) statementMatches(pt PolicyType, s AWSIAMStatement) (matches bool, direct bool, conditional bool) {
+	if !e.actionMatches(s) || !e.resourceMatches(s) {
+		return false, false, false
+	}
+	if pt == PolicyTypeResource {
+		matches, direct = principalMatches(s, e.req.Principal)
+		if !matches {
+			return false, false, false
+		}
+	}
+	matches, conditional = e.conditionMatches(s.Condition)
+	if !matches {
+		return false, false, false
+	}
+	return true, direct, conditional
+}
+
+// conditionMatches evaluates a condition block. If the request has a partial
+// context, keys which aren't in the context could be satisfied, so they are
+// skipped and conditional is true.
+func (e *evaluator) conditionMatches(c Condition) (matches bool, conditional bool) {
+	if !e.req.PartialContext {
+		return evaluateCondition(c, e.rc), false
+	}
+	for operator, keys := range c {
+		for key, values := range keys {
+			if _, ok := e.rc.get(key); !ok {
+				conditional = true
+				continue
+			}
+			if !evaluateConditionKey(operator, key, values.Strings(), e.rc) {
+				return false, false
+			}
+		}
+	}
+	return true, conditional
+}
+
+func (e *evaluator) actionMatches(s AWSIAMStatement) bool {
+	return s.MatchesAction(e.req.Action)
+}
+
+func (e *evaluator) resourceMatches(s AWSIAMStatement) bool {
+	return s.matchesResource(e.req.Resource, e.rc)
+}
+
+// MatchesAction returns true if the statement's Action or NotAction
+// element applies to the IAM action, e.g. "s3:GetObject".
+func (s AWSIAMStatement) MatchesAction(action string) bool {
+	if len(s.Action.Values) > 0 {
+		for _, a := range s.Action.Values {
+			if matchAction(a, action) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(s.NotAction.Values) > 0 {
+		for _, a := range s.NotAction.Values {
+			if matchAction(a, action) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// MatchesResource returns true if the statement's Resource or NotResource
+// element applies to the resource ARN. Resource patterns containing policy
+// variables don't match, as there is no request context to resolve them from.
+func (s AWSIAMStatement) MatchesResource(resource string) bool {
+	return s.matchesResource(resource, nil)
+}
+
+func (s AWSIAMStatement) matchesResource(resource string, rc requestContext) bool {
+	if len(s.Resource.Values) > 0 {
+		for _, r := range s.Resource.Values {
+			if matchResource(r, resource, rc) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(s.NotResource.Values) > 0 {
+		for _, r := range s.NotResource.Values {
+			if matchResource(r, resource, rc) {
+				return false
+			}
+		}
+		return true
+	}
+	// resource-based policies such as role trust policies don't
+	// contain a Resource element, as they apply to the resource
+	// they are attached to.
+	return true
+}
+
+// principalMatches checks the Principal or NotPrincipal element of a
+// resource-based policy statement.
+func principalMatches(s AWSIAMStatement, principal string) (matches bool, direct bool) {
+	if s.Principal != nil {
+		if !s.Principal.IncludesAWSPrincipal(principal) {
+			return false, false
+		}
+		direct = s.Principal.Wildcard || s.Principal.AWS.Contains(principal)
+		return true, direct
+	}
+	if s.NotPrincipal != nil {
+		return !s.NotPrincipal.IncludesAWSPrincipal(principal), false
+	}
+	return false, false
+}
+
+// isCrossAccount returns true if the principal and the resource are in
+// different accounts. Resources without an account in their ARN, such as
+// S3 buckets, are treated as being in the same account as the principal.
+func isCrossAccount(principal, resource string) bool {
+	principalAccount := accountFromARN(principal)
+	resourceAccount := accountFromARN(resource)
+	if principalAccount == "" || resourceAccount == "" {
+		return false
+	}
+	return principalAccount != resourceAccount
+}
+
+func accountFromARN(arn string) string {
+	split := strings.SplitN(arn, ":", 6)
+	if len(split) < 6 {
+		return ""
+	}
+	return split[4]
+}
@@ -0,0 +1,285 @@
+package policies
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testRole = "arn:aws:iam::123456789012:role/test-role"
+
+func mustParsePolicy(t *testing.T, doc string) AWSIAMPolicy {
+	var p AWSIAMPolicy
+	if err := json.Unmarshal([]byte(doc), &p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestEvaluate(t *testing.T) {
+	s3Read := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:Get*","Resource":"arn:aws:s3:::my-bucket/*"}]}`
+	denyObject := `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"s3:GetObject","Resource":"arn:aws:s3:::my-bucket/secret/*"}]}`
+	notAction := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","NotAction":"iam:*","Resource":"*"}]}`
+	notResource := `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"s3:*","NotResource":["arn:aws:s3:::my-bucket","arn:aws:s3:::my-bucket/*"]}]}`
+	allowAll := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`
+	sqsOnly := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sqs:*","Resource":"*"}]}`
+
+	cases := []struct {
+		name     string
+		ps       PolicySet
+		req      Request
+		decision Decision
+		matched  int
+	}{
+		{
+			name:     "no policies",
+			req:      Request{Principal: testRole, Action: "s3:GetObject", Resource: "arn:aws:s3:::my-bucket/key"},
+			decision: DecisionImplicitDeny,
+		},
+		{
+			name:     "wildcard action allows",
+			ps:       PolicySet{Identity: []AWSIAMPolicy{mustParsePolicy(t, s3Read)}},
+			req:      Request{Principal: testRole, Action: "s3:GetObject", Resource: "arn:aws:s3:::my-bucket/key"},
+			decision: DecisionAllow,
+			matched:  1,
+		},
+		{
+			name:     "actions are case-insensitive",
+			ps:       PolicySet{Identity: []AWSIAMPolicy{mustParsePolicy(t, s3Read)}},
+			req:      Request{Principal: testRole, Action: "S3:getobject", Resource: "arn:aws:s3:::my-bucket/key"},
+			decision: DecisionAllow,
+			matched:  1,
+		},
+		{
+			name:     "resources are case-sensitive",
+			ps:       PolicySet{Identity: []AWSIAMPolicy{mustParsePolicy(t, s3Read)}},
+			req:      Request{Principal: testRole, Action: "s3:GetObject", Resource: "arn:aws:s3:::MY-BUCKET/key"},
+			decision: DecisionImplicitDeny,
+		},
+		{
+			name:     "resource outside wildcard is implicitly denied",
+			ps:       PolicySet{Identity: []AWSIAMPolicy{mustParsePolicy(t, s3Read)}},
+			req:      Request{Principal: testRole, Action: "s3:GetObject", Resource: "arn:aws:s3:::other-bucket/key"},
+			decision: DecisionImplicitDeny,
+		},
+		{
+			name:     "deny overrides allow",
+			ps:       PolicySet{Identity: []AWSIAMPolicy{mustParsePolicy(t, s3Read), mustParsePolicy(t, denyObject)}},
+			req:      Request{Principal: testRole, Action: "s3:GetObject", Resource: "arn:aws:s3:::my-bucket/secret/key"},
+			decision: DecisionExplicitDeny,
+			matched:  2,
+		},
+		{
+			name:     "NotAction allows other services",
+			ps:       PolicySet{Identity: []AWSIAMPolicy{mustParsePolicy(t, notAction)}},
+			req:      Request{Principal: testRole, Action: "sqs:SendMessage", Resource: "arn:aws:sqs:us-east-1:123456789012:q"},
+			decision: DecisionAllow,
+			matched:  1,
+		},
+		{
+			name:     "NotAction excludes listed actions",
+			ps:       PolicySet{Identity: []AWSIAMPolicy{mustParsePolicy(t, notAction)}},
+			req:      Request{Principal: testRole, Action: "iam:CreateUser", Resource: "*"},
+			decision: DecisionImplicitDeny,
+		},
+		{
+			name:     "NotResource deny applies to other buckets",
+			ps:       PolicySet{Identity: []AWSIAMPolicy{mustParsePolicy(t, allowAll), mustParsePolicy(t, notResource)}},
+			req:      Request{Principal: testRole, Action: "s3:GetObject", Resource: "arn:aws:s3:::other-bucket/key"},
+			decision: DecisionExplicitDeny,
+			matched:  2,
+		},
+		{
+			name:     "NotResource deny doesn't apply to listed bucket",
+			ps:       PolicySet{Identity: []AWSIAMPolicy{mustParsePolicy(t, allowAll), mustParsePolicy(t, notResource)}},
+			req:      Request{Principal: testRole, Action: "s3:GetObject", Resource: "arn:aws:s3:::my-bucket/key"},
+			decision: DecisionAllow,
+			matched:  1,
+		},
+		{
+			name:     "permissions boundary limits identity policy",
+			ps:       PolicySet{Identity: []AWSIAMPolicy{mustParsePolicy(t, allowAll)}, PermissionsBoundary: policyPtr(mustParsePolicy(t, sqsOnly))},
+			req:      Request{Principal: testRole, Action: "s3:GetObject", Resource: "arn:aws:s3:::my-bucket/key"},
+			decision: DecisionImplicitDeny,
+			matched:  1,
+		},
+		{
+			name:     "SCP must allow at every level",
+			ps:       PolicySet{Identity: []AWSIAMPolicy{mustParsePolicy(t, allowAll)}, SCPs: [][]AWSIAMPolicy{{mustParsePolicy(t, allowAll)}, {mustParsePolicy(t, sqsOnly)}}},
+			req:      Request{Principal: testRole, Action: "s3:GetObject", Resource: "arn:aws:s3:::my-bucket/key"},
+			decision: DecisionImplicitDeny,
+			matched:  2,
+		},
+		{
+			name:     "SCP allows",
+			ps:       PolicySet{Identity: []AWSIAMPolicy{mustParsePolicy(t, allowAll)}, SCPs: [][]AWSIAMPolicy{{mustParsePolicy(t, allowAll)}, {mustParsePolicy(t, sqsOnly)}}},
+			req:      Request{Principal: testRole, Action: "sqs:SendMessage", Resource: "arn:aws:sqs:us-east-1:123456789012:q"},
+			decision: DecisionAllow,
+			matched:  3,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := Evaluate(tc.ps, tc.req)
+			assert.Equal(t, tc.decision, res.Decision, res.Reason)
+			assert.Len(t, res.MatchedStatements, tc.matched)
+		})
+	}
+}
+
+func policyPtr(p AWSIAMPolicy) *AWSIAMPolicy {
+	return &p
+}
+
+func TestEvaluateResourcePolicies(t *testing.T) {
+	bucketPolicy := func(principal string) AWSIAMPolicy {
+		return AWSIAMPolicy{Statement: IAMStatements{{
+			Effect:    "Allow",
+			Action:    NewStringValues("s3:GetObject"),
+			Resource:  NewStringValues("arn:aws:s3:::my-bucket/*"),
+			Principal: AWSPrincipal(principal),
+		}}}
+	}
+	req := Request{Principal: testRole, Action: "s3:GetObject", Resource: "arn:aws:s3:::my-bucket/key"}
+
+	// naming the role allows access without an identity-based policy
+	res := Evaluate(PolicySet{Resource: []AWSIAMPolicy{bucketPolicy(testRole)}}, req)
+	assert.Equal(t, DecisionAllow, res.Decision)
+
+	// naming the account delegates access to the account's identity-based policies
+	res = Evaluate(PolicySet{Resource: []AWSIAMPolicy{bucketPolicy("123456789012")}}, req)
+	assert.Equal(t, DecisionImplicitDeny, res.Decision)
+
+	// a policy for another role doesn't match
+	res = Evaluate(PolicySet{Resource: []AWSIAMPolicy{bucketPolicy("arn:aws:iam::123456789012:role/other")}}, req)
+	assert.Equal(t, DecisionImplicitDeny, res.Decision)
+	assert.Empty(t, res.MatchedStatements)
+}
+
+func TestEvaluateCrossAccount(t *testing.T) {
+	target := "arn:aws:iam::111222333444:role/target"
+	trust := AWSIAMPolicy{Statement: IAMStatements{{
+		Effect:    "Allow",
+		Action:    NewStringValues("sts:AssumeRole"),
+		Principal: AWSPrincipal(testRole),
+	}}}
+	identity := AWSIAMPolicy{Statement: IAMStatements{{
+		Effect:   "Allow",
+		Action:   NewStringValues("sts:AssumeRole"),
+		Resource: NewStringValues("arn:aws:iam::111222333444:role/*"),
+	}}}
+	req := Request{Principal: testRole, Action: "sts:AssumeRole", Resource: target}
+
+	res := Evaluate(PolicySet{Resource: []AWSIAMPolicy{trust}, ResourcePolicyRequired: true}, req)
+	assert.Equal(t, DecisionImplicitDeny, res.Decision)
+
+	res = Evaluate(PolicySet{Identity: []AWSIAMPolicy{identity}, ResourcePolicyRequired: true}, req)
+	assert.Equal(t, DecisionImplicitDeny, res.Decision)
+
+	res = Evaluate(PolicySet{Identity: []AWSIAMPolicy{identity}, Resource: []AWSIAMPolicy{trust}, ResourcePolicyRequired: true}, req)
+	assert.Equal(t, DecisionAllow, res.Decision)
+}
+
+func TestEvaluatePolicyVariables(t *testing.T) {
+	p := mustParsePolicy(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::my-bucket/home/${aws:username}/*"}]}`)
+	ps := PolicySet{Identity: []AWSIAMPolicy{p}}
+
+	req := Request{Principal: testRole, Action: "s3:GetObject", Resource: "arn:aws:s3:::my-bucket/home/alice/file", Context: map[string][]string{"aws:username": {"alice"}}}
+	assert.Equal(t, DecisionAllow, Evaluate(ps, req).Decision)
+
+	req.Resource = "arn:aws:s3:::my-bucket/home/bob/file"
+	assert.Equal(t, DecisionImplicitDeny, Evaluate(ps, req).Decision)
+
+	// a missing policy variable doesn't match
+	req.Context = nil
+	assert.Equal(t, DecisionImplicitDeny, Evaluate(ps, req).Decision)
+}
+
+func TestEvaluatePartialContext(t *testing.T) {
+	mfa := mustParsePolicy(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*","Condition":{"Bool":{"aws:MultiFactorAuthPresent":"true"},"StringEquals":{"aws:PrincipalAccount":"123456789012"}}}]}`)
+	allow := mustParsePolicy(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+	denyVpc := mustParsePolicy(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"s3:GetObject","Resource":"*","Condition":{"StringNotEquals":{"aws:SourceVpce":"vpce-1a2b3c4d"}}}]}`)
+
+	req := Request{Principal: testRole, Action: "s3:GetObject", Resource: "arn:aws:s3:::my-bucket/file", Context: map[string][]string{"aws:PrincipalAccount": {"123456789012"}}}
+
+	// without a partial context, missing keys don't match
+	assert.Equal(t, DecisionImplicitDeny, Evaluate(PolicySet{Identity: []AWSIAMPolicy{mfa}}, req).Decision)
+
+	req.PartialContext = true
+	res := Evaluate(PolicySet{Identity: []AWSIAMPolicy{mfa}}, req)
+	assert.Equal(t, DecisionAllow, res.Decision)
+	assert.True(t, res.Conditional)
+	if assert.Len(t, res.MatchedStatements, 1) {
+		assert.True(t, res.MatchedStatements[0].Conditional)
+	}
+
+	// an unconditional statement allows the request regardless
+	res = Evaluate(PolicySet{Identity: []AWSIAMPolicy{mfa, allow}}, req)
+	assert.Equal(t, DecisionAllow, res.Decision)
+	assert.False(t, res.Conditional)
+
+	// a Deny statement on unknown keys makes the request conditional
+	res = Evaluate(PolicySet{Identity: []AWSIAMPolicy{allow, denyVpc}}, req)
+	assert.Equal(t, DecisionAllow, res.Decision)
+	assert.True(t, res.Conditional)
+
+	// known keys are still evaluated
+	req.Context = map[string][]string{"aws:PrincipalAccount": {"210987654321"}}
+	assert.Equal(t, DecisionImplicitDeny, Evaluate(PolicySet{Identity: []AWSIAMPolicy{mfa}}, req).Decision)
+}
+
+func TestEvaluatePolicyVariableInAction(t *testing.T) {
+	// policy variables aren't substituted in actions, so an action containing
+	// one never matches, and a variable without a default mustn't panic
+	p := mustParsePolicy(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:${aws:username}","Resource":"*"}]}`)
+	ps := PolicySet{Identity: []AWSIAMPolicy{p}}
+
+	req := Request{Principal: testRole, Action: "s3:GetObject", Resource: "arn:aws:s3:::my-bucket/file", Context: map[string][]string{"aws:username": {"GetObject"}}}
+	assert.Equal(t, DecisionImplicitDeny, Evaluate(ps, req).Decision)
+}
+
+func TestEvaluateCondition(t *testing.T) {
+	cases := []struct {
+		name      string
+		condition string
+		context   map[string][]string
+		expected  bool
+	}{
+		{"StringEquals match", `{"StringEquals":{"aws:SourceVpce":"vpce-1"}}`, map[string][]string{"aws:sourcevpce": {"vpce-1"}}, true},
+		{"StringEquals mismatch", `{"StringEquals":{"aws:SourceVpce":"vpce-1"}}`, map[string][]string{"aws:SourceVpce": {"vpce-2"}}, false},
+		{"StringEquals missing key", `{"StringEquals":{"aws:SourceVpce":"vpce-1"}}`, nil, false},
+		{"StringEqualsIfExists missing key", `{"StringEqualsIfExists":{"aws:SourceVpce":"vpce-1"}}`, nil, true},
+		{"StringNotEquals missing key", `{"StringNotEquals":{"aws:SourceVpce":"vpce-1"}}`, nil, true},
+		{"StringNotEquals match", `{"StringNotEquals":{"aws:SourceVpce":["vpce-1","vpce-2"]}}`, map[string][]string{"aws:SourceVpce": {"vpce-2"}}, false},
+		{"StringLike", `{"StringLike":{"s3:prefix":["home/*"]}}`, map[string][]string{"s3:prefix": {"home/alice/"}}, true},
+		{"StringLike literal wildcard", `{"StringLike":{"s3:prefix":["home/${*}"]}}`, map[string][]string{"s3:prefix": {"home/alice"}}, false},
+		{"ArnLike doesn't cross sections", `{"ArnLike":{"aws:SourceArn":"arn:aws:sns:*:123456789012:*"}}`, map[string][]string{"aws:SourceArn": {"arn:aws:sns:us-east-1:210987654321:123456789012:topic"}}, false},
+		{"ArnLike", `{"ArnLike":{"aws:SourceArn":"arn:aws:sns:*:123456789012:*"}}`, map[string][]string{"aws:SourceArn": {"arn:aws:sns:us-east-1:123456789012:topic"}}, true},
+		{"Bool", `{"Bool":{"aws:SecureTransport":false}}`, map[string][]string{"aws:SecureTransport": {"false"}}, true},
+		{"NumericLessThan", `{"NumericLessThan":{"s3:max-keys":10}}`, map[string][]string{"s3:max-keys": {"5"}}, true},
+		{"DateGreaterThan", `{"DateGreaterThan":{"aws:CurrentTime":"2020-01-01T00:00:00Z"}}`, map[string][]string{"aws:CurrentTime": {"2021-06-01T00:00:00Z"}}, true},
+		{"IpAddress", `{"IpAddress":{"aws:SourceIp":"10.0.0.0/8"}}`, map[string][]string{"aws:SourceIp": {"10.1.2.3"}}, true},
+		{"NotIpAddress", `{"NotIpAddress":{"aws:SourceIp":"10.0.0.0/8"}}`, map[string][]string{"aws:SourceIp": {"10.1.2.3"}}, false},
+		{"Null true", `{"Null":{"aws:TokenIssueTime":"true"}}`, nil, true},
+		{"Null false", `{"Null":{"aws:TokenIssueTime":"false"}}`, nil, false},
+		{"ForAllValues", `{"ForAllValues:StringEquals":{"aws:TagKeys":["env","team"]}}`, map[string][]string{"aws:TagKeys": {"env"}}, true},
+		{"ForAllValues extra value", `{"ForAllValues:StringEquals":{"aws:TagKeys":["env","team"]}}`, map[string][]string{"aws:TagKeys": {"env", "owner"}}, false},
+		{"ForAllValues missing key", `{"ForAllValues:StringEquals":{"aws:TagKeys":["env"]}}`, nil, true},
+		{"ForAnyValue", `{"ForAnyValue:StringEquals":{"aws:TagKeys":["env"]}}`, map[string][]string{"aws:TagKeys": {"owner", "env"}}, true},
+		{"ForAnyValue missing key", `{"ForAnyValue:StringEquals":{"aws:TagKeys":["env"]}}`, nil, false},
+		{"unsupported operator", `{"Unknown":{"aws:SourceVpce":"vpce-1"}}`, map[string][]string{"aws:SourceVpce": {"vpce-1"}}, false},
+		{"all operators must match", `{"StringEquals":{"aws:SourceVpce":"vpce-1"},"Bool":{"aws:SecureTransport":"true"}}`, map[string][]string{"aws:SourceVpce": {"vpce-1"}, "aws:SecureTransport": {"false"}}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var c Condition
+			if err := json.Unmarshal([]byte(tc.condition), &c); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.expected, evaluateCondition(c, newRequestContext(tc.context)))
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package policies
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// IaCFramework is the infrastructure-as-code framework used to define a resource
+type IaCFramework string
+
+const (
+	IaCFrameworkCloudFormation IaCFramework = "cloudformation"
+	IaCFrameworkCDK            IaCFramework = "cdk"
+	IaCFrameworkSAM            IaCFramework = "sam"
+	IaCFrameworkServerless     IaCFramework = "serverless"
+)
+
+// IaCSource is a reference to where a resource is defined in
+// infrastructure-as-code. Every resource deployed by CloudFormation has a
+// source, regardless of the framework used to generate the template.
+type IaCSource struct {
+	Framework IaCFramework `json:"framework"`
+	// the ID of the CloudFormation stack the resource is defined in
+	StackID    string `json:"stackId"`
+	StackName  string `json:"stackName"`
+	LogicalID  string `json:"logicalId"`
+	PhysicalID string `json:"physicalId"`
+	AccountID  string `json:"accountId"`
+	Type       string `json:"type"`
+	// TemplatePath locates the resource in the framework's source when it
+	// is known: the construct path for CDK, e.g. CdkExampleStack/iamzero-example-role/Resource,
+	// or the SAM resource which generated it for SAM.
+	TemplatePath string `json:"templatePath,omitempty"`
+}
+
+// Value implements the driver.Valuer interface required to serialize the object to Postgres
+func (s IaCSource) Value() (driver.Value, error) { return json.Marshal(&s) }
+
+// Scan implements the sql.Scanner interface required to deserialize the object from Postgres
+func (s *IaCSource) Scan(val interface{}) error {
+	switch v := val.(type) {
+	case []byte:
+		return json.Unmarshal(v, &s)
+	case string:
+		return json.Unmarshal([]byte(v), &s)
+	default:
+		return fmt.Errorf("Unsupported type: %T", v)
+	}
+}
@@ -0,0 +1,177 @@
+package policies
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// requestContext holds the condition keys of a request.
+// Condition keys are case-insensitive, so keys are stored in lower case.
+type requestContext map[string][]string
+
+func newRequestContext(ctx map[string][]string) requestContext {
+	rc := requestContext{}
+	for k, v := range ctx {
+		rc[strings.ToLower(k)] = v
+	}
+	return rc
+}
+
+// get returns the values for a condition key and whether the key is present
+func (rc requestContext) get(key string) ([]string, bool) {
+	v, ok := rc[strings.ToLower(key)]
+	return v, ok
+}
+
+var wildcardCache sync.Map
+
+// compileWildcard compiles a pattern containing "*" and "?" wildcards into
+// a regular expression. Policy variables such as ${aws:username} are
+// replaced with their values from the request context.
+// Returns false if the pattern refers to a policy variable which isn't in
+// the request context and doesn't have a default value, in which case the
+// pattern doesn't match anything.
+func compileWildcard(pattern string, rc requestContext, caseInsensitive bool) (*regexp.Regexp, bool) {
+	var b strings.Builder
+	if caseInsensitive {
+		b.WriteString("(?is)^")
+	} else {
+		b.WriteString("(?s)^")
+	}
+
+	ok := expandPattern(pattern, rc, func(literal string) {
+		b.WriteString(regexp.QuoteMeta(literal))
+	}, func(wildcard rune) {
+		if wildcard == '*' {
+			b.WriteString(".*")
+		} else {
+			b.WriteString(".")
+		}
+	})
+	if !ok {
+		return nil, false
+	}
+	b.WriteString("$")
+
+	expr := b.String()
+	if re, found := wildcardCache.Load(expr); found {
+		return re.(*regexp.Regexp), true
+	}
+	re := regexp.MustCompile(expr)
+	wildcardCache.Store(expr, re)
+	return re, true
+}
+
+// expandLiteral replaces policy variables in a string with their values
+// from the request context, without treating "*" or "?" as wildcards.
+func expandLiteral(s string, rc requestContext) (string, bool) {
+	var b strings.Builder
+	ok := expandPattern(s, rc, func(literal string) {
+		b.WriteString(literal)
+	}, func(wildcard rune) {
+		b.WriteRune(wildcard)
+	})
+	return b.String(), ok
+}
+
+// expandPattern walks a pattern, calling `literal` for literal text
+// (including the values of policy variables) and `wildcard` for "*" and "?".
+func expandPattern(pattern string, rc requestContext, literal func(string), wildcard func(rune)) bool {
+	for i := 0; i < len(pattern); {
+		if strings.HasPrefix(pattern[i:], "${") {
+			end := strings.Index(pattern[i:], "}")
+			if end != -1 {
+				value, ok := resolveVariable(pattern[i+2:i+end], rc)
+				if !ok {
+					return false
+				}
+				literal(value)
+				i += end + 1
+				continue
+			}
+		}
+		c := pattern[i]
+		if c == '*' || c == '?' {
+			wildcard(rune(c))
+		} else {
+			literal(pattern[i : i+1])
+		}
+		i++
+	}
+	return true
+}
+
+// resolveVariable resolves the contents of a policy variable, e.g.
+// "aws:username" or "aws:username, 'default'".
+// The special variables ${*}, ${?} and ${$} are used to insert
+// literal "*", "?" and "$" characters.
+func resolveVariable(v string, rc requestContext) (string, bool) {
+	switch v {
+	case "*", "?", "$":
+		return v, true
+	}
+
+	key := v
+	defaultValue := ""
+	hasDefault := false
+	if split := strings.SplitN(v, ",", 2); len(split) == 2 {
+		key = split[0]
+		defaultValue = strings.Trim(strings.TrimSpace(split[1]), "'")
+		hasDefault = true
+	}
+
+	values, ok := rc.get(strings.TrimSpace(key))
+	if ok && len(values) > 0 {
+		return values[0], true
+	}
+	return defaultValue, hasDefault
+}
+
+// matchAction returns true if an IAM action matches an action pattern
+// such as "s3:Get*". Actions are case-insensitive.
+func matchAction(pattern, action string) bool {
+	if pattern == "*" {
+		return true
+	}
+	re, ok := compileWildcard(pattern, nil, true)
+	if !ok {
+		return false
+	}
+	return re.MatchString(action)
+}
+
+// matchResource returns true if a resource ARN matches a resource pattern
+// such as "arn:aws:s3:::my-bucket/*". Resources are case-sensitive and
+// may contain policy variables.
+func matchResource(pattern, resource string, rc requestContext) bool {
+	if pattern == "*" {
+		return true
+	}
+	re, ok := compileWildcard(pattern, rc, false)
+	if !ok {
+		return false
+	}
+	return re.MatchString(resource)
+}
+
+// matchARN matches an ARN against an ARN pattern as the ArnLike condition
+// operator does. Each of the six colon-delimited sections of the ARN is
+// matched separately, so wildcards don't match across sections.
+func matchARN(pattern, arn string, rc requestContext) bool {
+	if pattern == "*" {
+		return true
+	}
+	patternSections := strings.SplitN(pattern, ":", 6)
+	arnSections := strings.SplitN(arn, ":", 6)
+	if len(patternSections) != 6 || len(arnSections) != 6 {
+		return false
+	}
+	for i := range patternSections {
+		re, ok := compileWildcard(patternSections[i], rc, false)
+		if !ok || !re.MatchString(arnSections[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,315 @@
+package policies
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Optimiser consolidates the statements of a policy document.
+// Statements with the same effect and condition are merged, so that
+// actions which apply to the same set of resources share a statement.
+// Actions and resources which are already covered by a wildcard in
+// another statement are removed.
+//
+// Statements are given a Sid derived from their contents, so that
+// recalculating a document from the same statements always produces
+// the same output.
+type Optimiser struct {
+	// WildcardThreshold is the number of actions sharing a service and
+	// verb (such as s3:GetObject and s3:GetObjectTagging) on a resource
+	// at which they are collapsed into a wildcard (s3:Get*).
+	// A WildcardThreshold of zero disables collapsing actions.
+	WildcardThreshold int
+}
+
+// NewOptimiser creates an Optimiser which doesn't collapse actions
+// into wildcards.
+func NewOptimiser() *Optimiser {
+	return &Optimiser{}
+}
+
+func (o *Optimiser) AddFlags(fs *flag.FlagSet) {
+	fs.IntVar(&o.WildcardThreshold, "policy-wildcard-threshold", 0, "collapse actions sharing a service and verb into a wildcard (e.g. s3:Get*) when at least this many are granted on a resource (0 disables)")
+}
+
+// actionResource is a single action granted on a single resource.
+type actionResource struct {
+	action   string
+	resource string
+}
+
+// statementGroup holds statements which can be merged, as they have the
+// same effect and condition.
+type statementGroup struct {
+	effect    string
+	condition Condition
+	pairs     []actionResource
+}
+
+// Optimise returns a consolidated copy of the statements.
+// Statements using NotAction, NotResource, Principal or NotPrincipal
+// are deduplicated but otherwise returned unchanged.
+// A nil Optimiser can be used, in which case actions aren't collapsed
+// into wildcards.
+func (o *Optimiser) Optimise(statements []AWSIAMStatement) []AWSIAMStatement {
+	threshold := 0
+	if o != nil {
+		threshold = o.WildcardThreshold
+	}
+
+	groups := map[string]*statementGroup{}
+	var passthrough []AWSIAMStatement
+
+	for _, s := range statements {
+		if !isMergeable(s) {
+			passthrough = append(passthrough, s)
+			continue
+		}
+		key := s.Effect + "|" + conditionKey(s.Condition)
+		g, ok := groups[key]
+		if !ok {
+			g = &statementGroup{effect: s.Effect, condition: s.Condition}
+			groups[key] = g
+		}
+		for _, a := range s.Action.Values {
+			for _, r := range s.Resource.Values {
+				g.pairs = append(g.pairs, actionResource{action: a, resource: r})
+			}
+		}
+	}
+
+	result := []AWSIAMStatement{}
+	seen := map[string]bool{}
+	add := func(s AWSIAMStatement) {
+		s.Sid = ""
+		key := statementKey(s)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		s.Sid = "iamzero" + key[:32]
+		result = append(result, s)
+	}
+
+	for _, g := range groups {
+		pairs := removeSubsumed(dedupePairs(g.pairs))
+		if threshold > 0 {
+			pairs = removeSubsumed(dedupePairs(collapseActions(pairs, threshold)))
+		}
+		for _, s := range mergePairs(pairs) {
+			s.Effect = g.effect
+			s.Condition = g.condition
+			add(s)
+		}
+	}
+	for _, s := range passthrough {
+		add(s)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return statementLess(result[i], result[j])
+	})
+	return result
+}
+
+// isMergeable returns true if a statement only uses the Action and
+// Resource elements, and so can be merged with other statements.
+func isMergeable(s AWSIAMStatement) bool {
+	return len(s.Action.Values) > 0 && len(s.Resource.Values) > 0 &&
+		len(s.NotAction.Values) == 0 && len(s.NotResource.Values) == 0 &&
+		s.Principal == nil && s.NotPrincipal == nil
+}
+
+// dedupePairs removes duplicate pairs. Actions are case-insensitive,
+// so the casing of the first occurrence of an action is kept.
+func dedupePairs(pairs []actionResource) []actionResource {
+	seen := map[actionResource]bool{}
+	result := []actionResource{}
+	for _, p := range pairs {
+		key := actionResource{action: strings.ToLower(p.action), resource: p.resource}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, p)
+	}
+	return result
+}
+
+// removeSubsumed removes pairs which are covered by another pair, for
+// example s3:GetObject on arn:aws:s3:::bucket/key is covered by
+// s3:Get* on arn:aws:s3:::bucket/*.
+func removeSubsumed(pairs []actionResource) []actionResource {
+	result := []actionResource{}
+	for i, p := range pairs {
+		subsumed := false
+		for j, other := range pairs {
+			if i != j && patternCovers(other.action, p.action, true) && patternCovers(other.resource, p.resource, false) {
+				subsumed = true
+				break
+			}
+		}
+		if !subsumed {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// patternCovers returns true if everything matched by the pattern `b`
+// is also matched by the pattern `a`. The check is conservative: it may
+// return false for patterns where `a` does cover `b`.
+// dedupePairs ensures that two distinct pairs never cover each other.
+func patternCovers(a, b string, caseInsensitive bool) bool {
+	if caseInsensitive {
+		a, b = strings.ToLower(a), strings.ToLower(b)
+	}
+	if a == b {
+		return false
+	}
+	if a == "*" {
+		return true
+	}
+	// policy variables depend on the request, and a "?" in `a` could
+	// match a "*" in `b` which matches more than one character.
+	if strings.Contains(a, "${") || strings.Contains(b, "${") {
+		return false
+	}
+	if strings.ContainsRune(a, '?') && strings.ContainsAny(b, "*?") {
+		return false
+	}
+	if caseInsensitive {
+		return matchAction(a, b)
+	}
+	return matchResource(a, b, nil)
+}
+
+// collapseActions replaces actions on the same resource which share a
+// service and verb with a wildcard, once there are at least `threshold`
+// of them.
+func collapseActions(pairs []actionResource, threshold int) []actionResource {
+	counts := map[actionResource]int{}
+	for _, p := range pairs {
+		if prefix, ok := actionVerbPrefix(p.action); ok {
+			counts[actionResource{action: prefix, resource: p.resource}]++
+		}
+	}
+
+	result := []actionResource{}
+	for _, p := range pairs {
+		if prefix, ok := actionVerbPrefix(p.action); ok {
+			if counts[actionResource{action: prefix, resource: p.resource}] >= threshold {
+				p.action = prefix + "*"
+			}
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// actionVerbPrefix returns the service and leading verb of an action,
+// e.g. "s3:Get" for "s3:GetObjectTagging".
+// Returns false if the action already contains a wildcard.
+func actionVerbPrefix(action string) (string, bool) {
+	if strings.ContainsAny(action, "*?") {
+		return "", false
+	}
+	split := strings.SplitN(action, ":", 2)
+	if len(split) != 2 || split[1] == "" {
+		return "", false
+	}
+	name := split[1]
+	end := 1
+	for end < len(name) && !unicode.IsUpper(rune(name[end])) {
+		end++
+	}
+	if end == len(name) {
+		// the action is a single word, so a wildcard wouldn't
+		// consolidate anything.
+		return "", false
+	}
+	return split[0] + ":" + name[:end], true
+}
+
+// mergePairs builds statements from action/resource pairs. Actions which
+// are granted on exactly the same resources are placed in a single
+// statement.
+func mergePairs(pairs []actionResource) []AWSIAMStatement {
+	var actions []string
+	resourcesByAction := map[string][]string{}
+	for _, p := range pairs {
+		if _, ok := resourcesByAction[p.action]; !ok {
+			actions = append(actions, p.action)
+		}
+		resourcesByAction[p.action] = append(resourcesByAction[p.action], p.resource)
+	}
+
+	var keys []string
+	statements := map[string]*AWSIAMStatement{}
+	for _, a := range actions {
+		resources := resourcesByAction[a]
+		sort.Strings(resources)
+		key := strings.Join(resources, "\n")
+		s, ok := statements[key]
+		if !ok {
+			s = &AWSIAMStatement{Resource: NewStringValues(resources...)}
+			statements[key] = s
+			keys = append(keys, key)
+		}
+		s.Action.Values = append(s.Action.Values, a)
+	}
+
+	result := []AWSIAMStatement{}
+	for _, key := range keys {
+		s := statements[key]
+		sort.Strings(s.Action.Values)
+		result = append(result, *s)
+	}
+	return result
+}
+
+// conditionKey returns a canonical representation of a condition.
+// encoding/json sorts map keys, so the output is deterministic.
+func conditionKey(c Condition) string {
+	if len(c) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(c)
+	return string(b)
+}
+
+// statementKey returns a hash of the statement's contents, used to
+// deduplicate statements and to derive a stable Sid.
+func statementKey(s AWSIAMStatement) string {
+	b, _ := json.Marshal(s)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// statementLess orders statements so that allow statements come
+// first, followed by their actions and resources.
+func statementLess(a, b AWSIAMStatement) bool {
+	keys := func(s AWSIAMStatement) []string {
+		return []string{
+			s.Effect,
+			strings.Join(s.Action.Values, ","),
+			strings.Join(s.NotAction.Values, ","),
+			strings.Join(s.Resource.Values, ","),
+			strings.Join(s.NotResource.Values, ","),
+			conditionKey(s.Condition),
+			s.Sid,
+		}
+	}
+	ak, bk := keys(a), keys(b)
+	for i := range ak {
+		if ak[i] != bk[i] {
+			return ak[i] < bk[i]
+		}
+	}
+	return false
+}
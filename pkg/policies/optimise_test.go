@@ -0,0 +1,161 @@
+package policies
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func allow(actions []string, resources []string) AWSIAMStatement {
+	return AWSIAMStatement{Sid: "random", Effect: "Allow", Action: NewStringValues(actions...), Resource: NewStringValues(resources...)}
+}
+
+// withoutSids removes Sids so that statements can be compared by content.
+func withoutSids(statements []AWSIAMStatement) []AWSIAMStatement {
+	result := []AWSIAMStatement{}
+	for _, s := range statements {
+		s.Sid = ""
+		result = append(result, s)
+	}
+	return result
+}
+
+func TestOptimise(t *testing.T) {
+	bucket := "arn:aws:s3:::my-bucket"
+	objects := "arn:aws:s3:::my-bucket/*"
+	queue := "arn:aws:sqs:us-east-1:123456789012:my-queue"
+	prefixCondition := Condition{"StringLike": {"s3:prefix": NewConditionValue("logs/*")}}
+
+	cases := []struct {
+		name       string
+		threshold  int
+		statements []AWSIAMStatement
+		want       []AWSIAMStatement
+	}{
+		{
+			name: "merges actions on identical resources",
+			statements: []AWSIAMStatement{
+				allow([]string{"s3:PutObject"}, []string{objects}),
+				allow([]string{"s3:GetObject"}, []string{objects}),
+			},
+			want: []AWSIAMStatement{
+				{Effect: "Allow", Action: NewStringValues("s3:GetObject", "s3:PutObject"), Resource: NewStringValues(objects)},
+			},
+		},
+		{
+			name: "merges resources for identical actions",
+			statements: []AWSIAMStatement{
+				allow([]string{"sqs:SendMessage"}, []string{queue}),
+				allow([]string{"sqs:SendMessage"}, []string{queue + "-2"}),
+			},
+			want: []AWSIAMStatement{
+				{Effect: "Allow", Action: NewStringValues("sqs:SendMessage"), Resource: NewStringValues(queue, queue+"-2")},
+			},
+		},
+		{
+			name: "removes duplicate actions case-insensitively",
+			statements: []AWSIAMStatement{
+				allow([]string{"s3:GetObject"}, []string{objects}),
+				allow([]string{"S3:getobject"}, []string{objects}),
+			},
+			want: []AWSIAMStatement{
+				{Effect: "Allow", Action: NewStringValues("s3:GetObject"), Resource: NewStringValues(objects)},
+			},
+		},
+		{
+			name: "removes subsumed actions and resources",
+			statements: []AWSIAMStatement{
+				allow([]string{"s3:GetObject"}, []string{bucket + "/key"}),
+				allow([]string{"s3:Get*"}, []string{objects}),
+				allow([]string{"s3:ListBucket"}, []string{bucket}),
+			},
+			want: []AWSIAMStatement{
+				{Effect: "Allow", Action: NewStringValues("s3:Get*"), Resource: NewStringValues(objects)},
+				{Effect: "Allow", Action: NewStringValues("s3:ListBucket"), Resource: NewStringValues(bucket)},
+			},
+		},
+		{
+			name: "keeps statements with different conditions separate",
+			statements: []AWSIAMStatement{
+				allow([]string{"s3:ListBucket"}, []string{bucket}),
+				{Effect: "Allow", Action: NewStringValues("s3:ListBucket"), Resource: NewStringValues(bucket), Condition: prefixCondition},
+			},
+			want: []AWSIAMStatement{
+				{Effect: "Allow", Action: NewStringValues("s3:ListBucket"), Resource: NewStringValues(bucket)},
+				{Effect: "Allow", Action: NewStringValues("s3:ListBucket"), Resource: NewStringValues(bucket), Condition: prefixCondition},
+			},
+		},
+		{
+			name: "passes through NotAction statements",
+			statements: []AWSIAMStatement{
+				{Effect: "Deny", NotAction: NewStringValues("s3:*"), Resource: NewStringValues("*")},
+				{Effect: "Deny", NotAction: NewStringValues("s3:*"), Resource: NewStringValues("*")},
+				allow([]string{"s3:GetObject"}, []string{objects}),
+			},
+			want: []AWSIAMStatement{
+				{Effect: "Allow", Action: NewStringValues("s3:GetObject"), Resource: NewStringValues(objects)},
+				{Effect: "Deny", NotAction: NewStringValues("s3:*"), Resource: NewStringValues("*")},
+			},
+		},
+		{
+			name:      "collapses actions into a wildcard at the threshold",
+			threshold: 2,
+			statements: []AWSIAMStatement{
+				allow([]string{"s3:GetObject", "s3:GetObjectTagging", "s3:PutObject"}, []string{objects}),
+			},
+			want: []AWSIAMStatement{
+				{Effect: "Allow", Action: NewStringValues("s3:Get*", "s3:PutObject"), Resource: NewStringValues(objects)},
+			},
+		},
+		{
+			name:      "doesn't collapse actions below the threshold",
+			threshold: 3,
+			statements: []AWSIAMStatement{
+				allow([]string{"s3:GetObject", "s3:GetObjectTagging", "s3:PutObject"}, []string{objects}),
+			},
+			want: []AWSIAMStatement{
+				{Effect: "Allow", Action: NewStringValues("s3:GetObject", "s3:GetObjectTagging", "s3:PutObject"), Resource: NewStringValues(objects)},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &Optimiser{WildcardThreshold: tc.threshold}
+			got := o.Optimise(tc.statements)
+			assert.Equal(t, tc.want, withoutSids(got))
+		})
+	}
+}
+
+func TestOptimiseStableSids(t *testing.T) {
+	a := allow([]string{"s3:GetObject"}, []string{"arn:aws:s3:::my-bucket/*"})
+	b := allow([]string{"sqs:SendMessage"}, []string{"arn:aws:sqs:us-east-1:123456789012:my-queue"})
+
+	var o *Optimiser
+	first := o.Optimise([]AWSIAMStatement{a, b})
+	second := o.Optimise([]AWSIAMStatement{b, a, a})
+
+	assert.Equal(t, first, second)
+	assert.Len(t, first, 2)
+	assert.NotEqual(t, first[0].Sid, first[1].Sid)
+	assert.Regexp(t, "^iamzero[0-9a-f]{32}$", first[0].Sid)
+}
+
+func TestPatternCovers(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"*", "arn:aws:s3:::bucket", true},
+		{"arn:aws:s3:::bucket/*", "arn:aws:s3:::bucket/key", true},
+		{"arn:aws:s3:::bucket/*", "arn:aws:s3:::bucket/logs/*", true},
+		{"arn:aws:s3:::bucket/key", "arn:aws:s3:::bucket/*", false},
+		{"arn:aws:s3:::bucket/?", "arn:aws:s3:::bucket/*", false},
+		{"arn:aws:s3:::bucket/*", "arn:aws:s3:::bucket/${aws:username}", false},
+		{"arn:aws:s3:::bucket/*", "arn:aws:s3:::bucket/*", false},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, patternCovers(tc.a, tc.b, false), "%s covers %s", tc.a, tc.b)
+	}
+}
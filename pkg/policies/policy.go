@@ -1,6 +1,7 @@
 package policies
 
 import (
+	"bytes"
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
@@ -28,12 +29,69 @@ func (p *AWSIAMPolicy) Scan(val interface{}) error {
 	}
 }
 
+// AWSIAMStatement is a statement in an AWS IAM policy.
+// A statement contains either Action or NotAction, and either
+// Resource or NotResource. Principal and NotPrincipal are only
+// used in resource-based policies such as role trust policies.
 type AWSIAMStatement struct {
-	Sid       string
-	Effect    string
-	Action    StringOrStringArray
-	Principal *AWSIAMPrincipal `json:",omitempty"`
-	Resource  StringOrStringArray
+	Sid          string
+	Effect       string
+	Action       StringOrStringArray `json:",omitempty"`
+	NotAction    StringOrStringArray `json:",omitempty"`
+	Principal    *AWSIAMPrincipal    `json:",omitempty"`
+	NotPrincipal *AWSIAMPrincipal    `json:",omitempty"`
+	Resource     StringOrStringArray `json:",omitempty"`
+	NotResource  StringOrStringArray `json:",omitempty"`
+	Condition    Condition           `json:",omitempty"`
+}
+
+// statementJSON is the JSON representation of a statement. Elements which
+// aren't set are left out, as they are in policy documents.
+type statementJSON struct {
+	Sid          string `json:",omitempty"`
+	Effect       string
+	Action       *StringOrStringArray `json:",omitempty"`
+	NotAction    *StringOrStringArray `json:",omitempty"`
+	Principal    *AWSIAMPrincipal     `json:",omitempty"`
+	NotPrincipal *AWSIAMPrincipal     `json:",omitempty"`
+	Resource     *StringOrStringArray `json:",omitempty"`
+	NotResource  *StringOrStringArray `json:",omitempty"`
+	Condition    Condition            `json:",omitempty"`
+}
+
+func (s AWSIAMStatement) MarshalJSON() ([]byte, error) {
+	obj := statementJSON{
+		Sid:          s.Sid,
+		Effect:       s.Effect,
+		Principal:    s.Principal,
+		NotPrincipal: s.NotPrincipal,
+		Condition:    s.Condition,
+	}
+	if !s.Action.isEmpty() {
+		obj.Action = &s.Action
+	}
+	if !s.NotAction.isEmpty() {
+		obj.NotAction = &s.NotAction
+	}
+	if !s.Resource.isEmpty() {
+		obj.Resource = &s.Resource
+	}
+	if !s.NotResource.isEmpty() {
+		obj.NotResource = &s.NotResource
+	}
+	return marshalJSON(obj)
+}
+
+// marshalJSON marshals v without escaping HTML characters, as AWS
+// policies are written and measured without them being escaped.
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
 }
 
 // IAMStatements implements a custom UnmarshalJSON to handle
@@ -74,10 +132,40 @@ func (s *IAMStatements) unmarshalMany(data []byte) error {
 	return nil
 }
 
-// StringOrStringArray allows AWS statements to be unmarshalled
-// into a string slice.
-// Sometimes AWS policy JSONs contain a string, rather than a string array.
-type StringOrStringArray []string
+// StringOrStringArray is the Action, NotAction, Resource or NotResource
+// element of a statement.
+//
+// In policy documents these may be given as a single string or as a list of
+// strings. Single records whether the value was a string rather than a list,
+// so that policies can be round-tripped through JSON without changes.
+type StringOrStringArray struct {
+	Values []string
+	Single bool
+}
+
+// NewStringValue returns a single string
+func NewStringValue(value string) StringOrStringArray {
+	return StringOrStringArray{Values: []string{value}, Single: true}
+}
+
+// NewStringValues returns a list of strings
+func NewStringValues(values ...string) StringOrStringArray {
+	return StringOrStringArray{Values: append([]string{}, values...)}
+}
+
+func (c StringOrStringArray) isEmpty() bool {
+	return len(c.Values) == 0 && !c.Single
+}
+
+func (c StringOrStringArray) MarshalJSON() ([]byte, error) {
+	if c.Single && len(c.Values) == 1 {
+		return marshalJSON(c.Values[0])
+	}
+	if c.Values == nil {
+		return []byte("[]"), nil
+	}
+	return marshalJSON(c.Values)
+}
 
 func (c *StringOrStringArray) UnmarshalJSON(data []byte) error {
 	var tmp interface{}
@@ -87,19 +175,21 @@ func (c *StringOrStringArray) UnmarshalJSON(data []byte) error {
 	}
 	slice, ok := tmp.([]interface{})
 	if ok {
+		values := []string{}
 		for _, item := range slice {
-			*c = append(*c, item.(string))
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("%v must be a string", item)
+			}
+			values = append(values, s)
 		}
+		*c = StringOrStringArray{Values: values}
 		return nil
 	}
 	theString, ok := tmp.(string)
 	if ok {
-		*c = append(*c, theString)
+		*c = NewStringValue(theString)
 		return nil
 	}
 	return errors.New("Field neither slice or string")
 }
-
-type AWSIAMPrincipal struct {
-	AWS string
-}
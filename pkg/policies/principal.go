@@ -0,0 +1,218 @@
+package policies
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AWSIAMPrincipal is the Principal or NotPrincipal element of a policy statement.
+//
+// In policy documents the principal may be given as the string "*", which
+// matches all principals, or as an object keyed by principal type where each
+// value is a single string or a list of strings:
+//
+//	"Principal": "*"
+//	"Principal": {"AWS": "arn:aws:iam::123456789012:root"}
+//	"Principal": {"Service": ["lambda.amazonaws.com", "ecs-tasks.amazonaws.com"]}
+type AWSIAMPrincipal struct {
+	// Wildcard is true if the principal is "*"
+	Wildcard bool
+	// AWS contains IAM role and user ARNs, account ARNs and account IDs
+	AWS PrincipalValues
+	// Service contains AWS service principals, e.g. "lambda.amazonaws.com"
+	Service PrincipalValues
+	// Federated contains web identity and SAML providers, e.g. "cognito-identity.amazonaws.com"
+	Federated PrincipalValues
+	// CanonicalUser contains S3 canonical user IDs
+	CanonicalUser PrincipalValues
+}
+
+// PrincipalValues are the values for a principal type.
+// Single records whether the value was given as a string rather than a list,
+// so that policies can be round-tripped through JSON without changes.
+type PrincipalValues struct {
+	Values []string
+	Single bool
+}
+
+// NewPrincipalValue returns a single principal value
+func NewPrincipalValue(value string) PrincipalValues {
+	return PrincipalValues{Values: []string{value}, Single: true}
+}
+
+// NewPrincipalValues returns a list of principal values
+func NewPrincipalValues(values ...string) PrincipalValues {
+	return PrincipalValues{Values: append([]string{}, values...)}
+}
+
+// AWSPrincipal returns a principal for IAM role or user ARNs, account ARNs or account IDs
+func AWSPrincipal(values ...string) *AWSIAMPrincipal {
+	return &AWSIAMPrincipal{AWS: newPrincipalValues(values)}
+}
+
+// ServicePrincipal returns a principal for AWS services, e.g. "lambda.amazonaws.com"
+func ServicePrincipal(values ...string) *AWSIAMPrincipal {
+	return &AWSIAMPrincipal{Service: newPrincipalValues(values)}
+}
+
+// WildcardPrincipal returns the "*" principal
+func WildcardPrincipal() *AWSIAMPrincipal {
+	return &AWSIAMPrincipal{Wildcard: true}
+}
+
+func newPrincipalValues(values []string) PrincipalValues {
+	if len(values) == 1 {
+		return NewPrincipalValue(values[0])
+	}
+	return NewPrincipalValues(values...)
+}
+
+func (v PrincipalValues) isEmpty() bool {
+	return len(v.Values) == 0 && !v.Single
+}
+
+// Contains returns true if the values contain `value` or a "*" wildcard
+func (v PrincipalValues) Contains(value string) bool {
+	for _, val := range v.Values {
+		if val == value || val == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// IncludesAWSPrincipal returns true if the principal includes the IAM role
+// or user with the ARN `arn`. This is the case if the principal is "*",
+// or the AWS principal contains the ARN, a "*" wildcard, or the account
+// that the role or user belongs to. Specifying an account delegates
+// access to the IAM policies of the account.
+func (p *AWSIAMPrincipal) IncludesAWSPrincipal(arn string) bool {
+	if p == nil {
+		return false
+	}
+	if p.Wildcard || p.AWS.Contains(arn) {
+		return true
+	}
+
+	split := strings.Split(arn, ":")
+	if len(split) < 5 || split[4] == "" {
+		return false
+	}
+	account := split[4]
+	accountRoot := fmt.Sprintf("arn:%s:iam::%s:root", split[1], account)
+	return p.AWS.Contains(account) || p.AWS.Contains(accountRoot)
+}
+
+// IncludesService returns true if the principal includes the AWS service,
+// e.g. "lambda.amazonaws.com".
+func (p *AWSIAMPrincipal) IncludesService(service string) bool {
+	if p == nil {
+		return false
+	}
+	return p.Wildcard || p.Service.Contains(service)
+}
+
+// principalJSON is the object form of a principal
+type principalJSON struct {
+	AWS           *PrincipalValues `json:",omitempty"`
+	Service       *PrincipalValues `json:",omitempty"`
+	Federated     *PrincipalValues `json:",omitempty"`
+	CanonicalUser *PrincipalValues `json:",omitempty"`
+}
+
+func (p AWSIAMPrincipal) MarshalJSON() ([]byte, error) {
+	if p.Wildcard {
+		return json.Marshal("*")
+	}
+	var obj principalJSON
+	if !p.AWS.isEmpty() {
+		obj.AWS = &p.AWS
+	}
+	if !p.Service.isEmpty() {
+		obj.Service = &p.Service
+	}
+	if !p.Federated.isEmpty() {
+		obj.Federated = &p.Federated
+	}
+	if !p.CanonicalUser.isEmpty() {
+		obj.CanonicalUser = &p.CanonicalUser
+	}
+	return json.Marshal(obj)
+}
+
+func (p *AWSIAMPrincipal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return errors.New("no bytes to unmarshal")
+	}
+
+	if data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if s != "*" {
+			return fmt.Errorf("principal %q must be \"*\" or an object", s)
+		}
+		*p = AWSIAMPrincipal{Wildcard: true}
+		return nil
+	}
+
+	var obj principalJSON
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&obj); err != nil {
+		return err
+	}
+	*p = AWSIAMPrincipal{}
+	if obj.AWS != nil {
+		p.AWS = *obj.AWS
+	}
+	if obj.Service != nil {
+		p.Service = *obj.Service
+	}
+	if obj.Federated != nil {
+		p.Federated = *obj.Federated
+	}
+	if obj.CanonicalUser != nil {
+		p.CanonicalUser = *obj.CanonicalUser
+	}
+	return nil
+}
+
+func (v PrincipalValues) MarshalJSON() ([]byte, error) {
+	if v.Single && len(v.Values) == 1 {
+		return json.Marshal(v.Values[0])
+	}
+	if v.Values == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(v.Values)
+}
+
+func (v *PrincipalValues) UnmarshalJSON(data []byte) error {
+	var tmp interface{}
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+	switch val := tmp.(type) {
+	case string:
+		*v = NewPrincipalValue(val)
+		return nil
+	case []interface{}:
+		values := []string{}
+		for _, item := range val {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("principal value %v must be a string", item)
+			}
+			values = append(values, s)
+		}
+		*v = NewPrincipalValues(values...)
+		return nil
+	}
+	return fmt.Errorf("principal value %v must be a string or a list of strings", tmp)
+}
@@ -0,0 +1,78 @@
+package policies
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrincipalRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		json string
+	}{
+		{"wildcard", `"*"`},
+		{"single AWS", `{"AWS":"arn:aws:iam::123456789012:role/source"}`},
+		{"AWS list", `{"AWS":["arn:aws:iam::123456789012:root","111222333444"]}`},
+		{"service", `{"Service":"lambda.amazonaws.com"}`},
+		{"service list", `{"Service":["lambda.amazonaws.com","ecs-tasks.amazonaws.com"]}`},
+		{"federated", `{"Federated":"cognito-identity.amazonaws.com"}`},
+		{"canonical user", `{"CanonicalUser":"79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be"}`},
+		{"mixed", `{"AWS":"*","Service":["ec2.amazonaws.com"]}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var p AWSIAMPrincipal
+			err := json.Unmarshal([]byte(tc.json), &p)
+			assert.NoError(t, err)
+
+			out, err := json.Marshal(p)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tc.json, string(out))
+		})
+	}
+}
+
+func TestPrincipalRejectsInvalidForms(t *testing.T) {
+	var p AWSIAMPrincipal
+	assert.Error(t, json.Unmarshal([]byte(`"arn:aws:iam::123456789012:root"`), &p))
+	assert.Error(t, json.Unmarshal([]byte(`{"Unknown":"value"}`), &p))
+	assert.Error(t, json.Unmarshal([]byte(`{"AWS":[1]}`), &p))
+}
+
+func TestTrustPolicyWithServicePrincipal(t *testing.T) {
+	doc := `{
+		"Version": "2012-10-17",
+		"Statement": [
+			{
+				"Effect": "Allow",
+				"Principal": {"Service": "lambda.amazonaws.com"},
+				"Action": "sts:AssumeRole"
+			}
+		]
+	}`
+	var p AWSIAMPolicy
+	err := json.Unmarshal([]byte(doc), &p)
+	assert.NoError(t, err)
+	assert.True(t, p.Statement[0].Principal.IncludesService("lambda.amazonaws.com"))
+	assert.False(t, p.Statement[0].Principal.IncludesAWSPrincipal("arn:aws:iam::123456789012:role/source"))
+}
+
+func TestIncludesAWSPrincipal(t *testing.T) {
+	role := "arn:aws:iam::123456789012:role/source"
+
+	assert.True(t, AWSPrincipal(role).IncludesAWSPrincipal(role))
+	assert.True(t, AWSPrincipal("123456789012").IncludesAWSPrincipal(role))
+	assert.True(t, AWSPrincipal("arn:aws:iam::123456789012:root").IncludesAWSPrincipal(role))
+	assert.True(t, AWSPrincipal("*").IncludesAWSPrincipal(role))
+	assert.True(t, WildcardPrincipal().IncludesAWSPrincipal(role))
+
+	assert.False(t, AWSPrincipal("arn:aws:iam::123456789012:role/other").IncludesAWSPrincipal(role))
+	assert.False(t, AWSPrincipal("111222333444").IncludesAWSPrincipal(role))
+	assert.False(t, ServicePrincipal("lambda.amazonaws.com").IncludesAWSPrincipal(role))
+
+	var nilPrincipal *AWSIAMPrincipal
+	assert.False(t, nilPrincipal.IncludesAWSPrincipal(role))
+}
@@ -0,0 +1,186 @@
+package policies
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// AWS quotas on the size and number of IAM policies.
+// See https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_iam-quotas.html
+const (
+	// ManagedPolicyMaxLength is the maximum number of characters in a
+	// managed policy document, excluding whitespace.
+	ManagedPolicyMaxLength = 6144
+	// InlinePolicyAggregateMaxLength is the maximum number of characters
+	// in all of the inline policies of a role, excluding whitespace.
+	InlinePolicyAggregateMaxLength = 10240
+	// ManagedPoliciesPerRoleMax is the default maximum number of managed
+	// policies which can be attached to a role.
+	ManagedPoliciesPerRoleMax = 10
+)
+
+// Length returns the number of characters of the policy document which
+// count towards AWS policy size quotas. AWS doesn't count whitespace, so
+// the length of the minified JSON document is returned.
+func (p AWSIAMPolicy) Length() int {
+	return jsonLength(p)
+}
+
+// Length returns the number of characters the statement adds to a
+// minified policy document.
+func (s AWSIAMStatement) Length() int {
+	return jsonLength(s)
+}
+
+func jsonLength(v interface{}) int {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return 0
+	}
+	return utf8.RuneCount(bytes.TrimSpace(buf.Bytes()))
+}
+
+// PolicyPlan describes how the statements of a finding should be
+// written to IAM policies so that they fit within AWS quotas.
+type PolicyPlan struct {
+	// Inline is true if the statements fit in a single inline policy.
+	// Otherwise, the Documents should be created as managed policies.
+	Inline    bool           `json:"inline"`
+	Documents []AWSIAMPolicy `json:"documents"`
+	// Warnings describe quotas which the plan still exceeds, with
+	// suggestions on how to reduce the size of the policy.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// PlanPolicies splits a policy document into documents which fit within
+// AWS policy size quotas. If the document fits within the aggregated
+// inline policy quota for a role it is returned as a single inline policy.
+// Otherwise, the statements are packed into as few managed policies
+// as possible.
+func PlanPolicies(doc AWSIAMPolicy) PolicyPlan {
+	if doc.Length() <= InlinePolicyAggregateMaxLength {
+		return PolicyPlan{Inline: true, Documents: []AWSIAMPolicy{doc}}
+	}
+
+	plan := PolicyPlan{}
+	docs, oversized := PackStatements(doc.Version, doc.Statement, ManagedPolicyMaxLength)
+	plan.Documents = docs
+
+	for _, s := range oversized {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("statement %s is %d characters, which is larger than the %d character limit for a managed policy even after splitting its actions and resources. Consider using a wildcard in its resource ARNs or simplifying its conditions.", s.Sid, s.Length(), ManagedPolicyMaxLength))
+	}
+	if len(docs) > ManagedPoliciesPerRoleMax {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("the policy requires %d managed policies, but AWS allows %d managed policies per role by default. Consider collapsing actions into wildcards with the -policy-wildcard-threshold flag, using wildcards in resource ARNs, or requesting an increase to the managed policies per role quota.", len(docs), ManagedPoliciesPerRoleMax))
+	}
+	return plan
+}
+
+// PackStatements packs statements into as few policy documents as
+// possible, with each document no longer than maxLength characters.
+// Statements which are too long on their own are split by their actions
+// and then by their resources. Statements which still don't fit are
+// returned as oversized and placed in a document of their own.
+//
+// Packing is deterministic: the same statements always produce the
+// same documents, and statements keep their relative order within
+// each document.
+func PackStatements(version string, statements []AWSIAMStatement, maxLength int) (docs []AWSIAMPolicy, oversized []AWSIAMStatement) {
+	base := AWSIAMPolicy{Version: version, Statement: []AWSIAMStatement{}}.Length()
+
+	type item struct {
+		statement AWSIAMStatement
+		length    int
+		index     int
+	}
+	var items []item
+	for _, s := range statements {
+		for _, split := range splitStatement(s, maxLength-base) {
+			l := split.Length()
+			if base+l > maxLength {
+				oversized = append(oversized, split)
+			}
+			items = append(items, item{statement: split, length: l, index: len(items)})
+		}
+	}
+
+	// first-fit decreasing: place the largest statements first
+	sorted := make([]item, len(items))
+	copy(sorted, items)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].length > sorted[j].length })
+
+	type bin struct {
+		items  []item
+		length int
+	}
+	var bins []*bin
+	for _, it := range sorted {
+		var target *bin
+		for _, b := range bins {
+			// statements after the first are separated by a comma
+			if b.length+1+it.length <= maxLength {
+				target = b
+				break
+			}
+		}
+		if target == nil {
+			target = &bin{length: base - 1}
+			bins = append(bins, target)
+		}
+		target.items = append(target.items, it)
+		target.length += 1 + it.length
+	}
+
+	// order documents by their first statement, and statements within
+	// a document by their original position.
+	for _, b := range bins {
+		sort.Slice(b.items, func(i, j int) bool { return b.items[i].index < b.items[j].index })
+	}
+	sort.Slice(bins, func(i, j int) bool { return bins[i].items[0].index < bins[j].items[0].index })
+
+	for _, b := range bins {
+		doc := AWSIAMPolicy{Version: version, Statement: []AWSIAMStatement{}}
+		for _, it := range b.items {
+			doc.Statement = append(doc.Statement, it.statement)
+		}
+		docs = append(docs, doc)
+	}
+	return docs, oversized
+}
+
+// splitStatement splits a statement into statements with halves of its
+// actions, or if it has a single action, halves of its resources, until
+// each is no longer than maxLength characters.
+// Splitting doesn't change the meaning of a statement, as a request is
+// allowed (or denied) if any of the split statements applies to it.
+// Statements using NotAction or NotResource can't be split.
+func splitStatement(s AWSIAMStatement, maxLength int) []AWSIAMStatement {
+	if s.Length() <= maxLength {
+		return []AWSIAMStatement{s}
+	}
+
+	var a, b AWSIAMStatement
+	switch {
+	case len(s.Action.Values) > 1:
+		a, b = s, s
+		mid := len(s.Action.Values) / 2
+		a.Action = NewStringValues(s.Action.Values[:mid]...)
+		b.Action = NewStringValues(s.Action.Values[mid:]...)
+	case len(s.Resource.Values) > 1:
+		a, b = s, s
+		mid := len(s.Resource.Values) / 2
+		a.Resource = NewStringValues(s.Resource.Values[:mid]...)
+		b.Resource = NewStringValues(s.Resource.Values[mid:]...)
+	default:
+		return []AWSIAMStatement{s}
+	}
+	if s.Sid != "" {
+		a.Sid = s.Sid + "0"
+		b.Sid = s.Sid + "1"
+	}
+	return append(splitStatement(a, maxLength), splitStatement(b, maxLength)...)
+}
@@ -0,0 +1,107 @@
+package policies
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bucketStatements returns n statements, each granting a single action
+// on a bucket with a long name.
+func bucketStatements(n int) []AWSIAMStatement {
+	statements := []AWSIAMStatement{}
+	for i := 0; i < n; i++ {
+		statements = append(statements, AWSIAMStatement{
+			Sid:      fmt.Sprintf("s%d", i),
+			Effect:   "Allow",
+			Action:   NewStringValues("s3:GetObject"),
+			Resource: NewStringValues(fmt.Sprintf("arn:aws:s3:::%s-%d/*", strings.Repeat("a", 100), i)),
+		})
+	}
+	return statements
+}
+
+func TestPolicyLength(t *testing.T) {
+	p := AWSIAMPolicy{
+		Version: "2012-10-17",
+		Statement: []AWSIAMStatement{
+			{Sid: "1", Effect: "Allow", Action: NewStringValues("s3:GetObject"), Resource: NewStringValues("arn:aws:s3:::bucket/<key>")},
+		},
+	}
+	// HTML characters aren't escaped, as AWS counts the characters of the policy as written
+	assert.Equal(t, len(`{"Version":"2012-10-17","Statement":[{"Sid":"1","Effect":"Allow","Action":["s3:GetObject"],"Resource":["arn:aws:s3:::bucket/<key>"]}]}`), p.Length())
+}
+
+func TestPackStatements(t *testing.T) {
+	statements := bucketStatements(100)
+
+	docs, oversized := PackStatements("2012-10-17", statements, ManagedPolicyMaxLength)
+	assert.Empty(t, oversized)
+	assert.Greater(t, len(docs), 1)
+
+	count := 0
+	for _, doc := range docs {
+		assert.LessOrEqual(t, doc.Length(), ManagedPolicyMaxLength)
+		count += len(doc.Statement)
+	}
+	assert.Equal(t, len(statements), count)
+
+	// packing is deterministic
+	again, _ := PackStatements("2012-10-17", statements, ManagedPolicyMaxLength)
+	assert.Equal(t, docs, again)
+}
+
+func TestPackStatementsSplitsLargeStatements(t *testing.T) {
+	s := AWSIAMStatement{Sid: "large", Effect: "Allow", Action: NewStringValues("s3:GetObject")}
+	for _, b := range bucketStatements(100) {
+		s.Resource.Values = append(s.Resource.Values, b.Resource.Values...)
+	}
+
+	docs, oversized := PackStatements("2012-10-17", []AWSIAMStatement{s}, ManagedPolicyMaxLength)
+	assert.Empty(t, oversized)
+	assert.Greater(t, len(docs), 1)
+
+	resources := 0
+	sids := map[string]bool{}
+	for _, doc := range docs {
+		assert.LessOrEqual(t, doc.Length(), ManagedPolicyMaxLength)
+		for _, split := range doc.Statement {
+			resources += len(split.Resource.Values)
+			assert.False(t, sids[split.Sid], "duplicate Sid %s", split.Sid)
+			sids[split.Sid] = true
+		}
+	}
+	assert.Equal(t, len(s.Resource.Values), resources)
+}
+
+func TestPackStatementsOversized(t *testing.T) {
+	s := AWSIAMStatement{Sid: "huge", Effect: "Allow", NotAction: NewStringValues("s3:" + strings.Repeat("a", ManagedPolicyMaxLength)), Resource: NewStringValues("*")}
+	small := AWSIAMStatement{Sid: "small", Effect: "Allow", Action: NewStringValues("s3:GetObject"), Resource: NewStringValues("*")}
+
+	docs, oversized := PackStatements("2012-10-17", []AWSIAMStatement{s, small}, ManagedPolicyMaxLength)
+	assert.Equal(t, []AWSIAMStatement{s}, oversized)
+	assert.Len(t, docs, 2)
+}
+
+func TestPlanPolicies(t *testing.T) {
+	small := AWSIAMPolicy{Version: "2012-10-17", Statement: bucketStatements(2)}
+	plan := PlanPolicies(small)
+	assert.True(t, plan.Inline)
+	assert.Equal(t, []AWSIAMPolicy{small}, plan.Documents)
+	assert.Empty(t, plan.Warnings)
+
+	large := AWSIAMPolicy{Version: "2012-10-17", Statement: bucketStatements(100)}
+	plan = PlanPolicies(large)
+	assert.False(t, plan.Inline)
+	assert.Greater(t, len(plan.Documents), 1)
+	assert.Empty(t, plan.Warnings)
+
+	tooMany := AWSIAMPolicy{Version: "2012-10-17", Statement: bucketStatements(1000)}
+	plan = PlanPolicies(tooMany)
+	assert.Greater(t, len(plan.Documents), ManagedPoliciesPerRoleMax)
+	if assert.Len(t, plan.Warnings, 1) {
+		assert.Contains(t, plan.Warnings[0], "-policy-wildcard-threshold")
+	}
+}
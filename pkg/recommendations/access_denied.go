@@ -0,0 +1,196 @@
+package recommendations
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/google/uuid"
+)
+
+// DenialReason is the type of policy which caused an AccessDenied error
+type DenialReason string
+
+const (
+	// DenialReasonIdentityPolicy means that no identity-based policy allows
+	// the action, or that an identity-based policy explicitly denies it.
+	DenialReasonIdentityPolicy DenialReason = "identityPolicy"
+	// DenialReasonResourcePolicy means that a resource-based policy such
+	// as an S3 bucket policy didn't allow or explicitly denied the action.
+	DenialReasonResourcePolicy DenialReason = "resourcePolicy"
+	// DenialReasonServiceControlPolicy means that an AWS Organizations
+	// service control policy didn't allow or explicitly denied the action.
+	DenialReasonServiceControlPolicy DenialReason = "serviceControlPolicy"
+	// DenialReasonPermissionsBoundary means that the role's permissions
+	// boundary didn't allow or explicitly denied the action.
+	DenialReasonPermissionsBoundary DenialReason = "permissionsBoundary"
+	// DenialReasonSessionPolicy means that the policy passed when the role
+	// session was created didn't allow or explicitly denied the action.
+	DenialReasonSessionPolicy DenialReason = "sessionPolicy"
+	// DenialReasonUnknown is used when the error message doesn't say why
+	// access was denied.
+	DenialReasonUnknown DenialReason = "unknown"
+)
+
+// accessDeniedCodes are the exception codes AWS services return when
+// a request isn't authorized.
+var accessDeniedCodes = map[string]bool{
+	"AccessDenied":          true,
+	"AccessDeniedException": true,
+	"UnauthorizedOperation": true,
+}
+
+// MissingPermission describes an action which a role was denied.
+// It is recorded on actions generated from AccessDenied errors, to
+// distinguish them from permissions which the role already uses.
+type MissingPermission struct {
+	// Action is the IAM action which was denied, e.g. "s3:GetObject"
+	Action string `json:"action"`
+	// Resource is the ARN of the resource access was denied to.
+	// It is empty if the error message doesn't include a resource.
+	Resource string `json:"resource,omitempty"`
+	// Reason is the type of policy which denied the action
+	Reason DenialReason `json:"reason"`
+	// ExplicitDeny is true if a policy contains a Deny statement for the action,
+	// rather than no policy allowing it.
+	ExplicitDeny bool `json:"explicitDeny"`
+	// Message is the error message returned by AWS
+	Message string `json:"message"`
+}
+
+// Value implements the driver.Valuer interface required to serialize the object to Postgres
+func (m MissingPermission) Value() (driver.Value, error) { return json.Marshal(&m) }
+
+// Scan implements the sql.Scanner interface required to deserialize the object from Postgres
+func (m *MissingPermission) Scan(val interface{}) error {
+	switch v := val.(type) {
+	case []byte:
+		return json.Unmarshal(v, &m)
+	case string:
+		return json.Unmarshal([]byte(v), &m)
+	default:
+		return fmt.Errorf("Unsupported type: %T", v)
+	}
+}
+
+// Fixable returns true if granting the action in the role's identity-based
+// policy would resolve the error. Errors caused by an explicit deny, a
+// service control policy or a permissions boundary need those policies to
+// be changed instead.
+func (m MissingPermission) Fixable() bool {
+	if m.ExplicitDeny {
+		return false
+	}
+	return m.Reason == DenialReasonIdentityPolicy || m.Reason == DenialReasonUnknown
+}
+
+// accessDeniedRegex matches messages such as
+// "User: arn:aws:sts::123456789012:assumed-role/my-role/session is not authorized to perform: s3:GetObject on resource: arn:aws:s3:::my-bucket/key because no identity-based policy allows the s3:GetObject action"
+var accessDeniedRegex = regexp.MustCompile(`is not authorized to perform: ([A-Za-z0-9-]+:[A-Za-z0-9*]+)(?: on resource: "?([^"\s]+)"?)?`)
+
+// denialReasons maps phrases used in AccessDenied messages to the policy type which caused the error.
+// "an identity-based policy" is matched after the more specific phrases.
+var denialReasons = []struct {
+	phrase string
+	reason DenialReason
+}{
+	{"service control policy", DenialReasonServiceControlPolicy},
+	{"permissions boundary", DenialReasonPermissionsBoundary},
+	{"session policy", DenialReasonSessionPolicy},
+	{"resource-based policy", DenialReasonResourcePolicy},
+	{"identity-based policy", DenialReasonIdentityPolicy},
+}
+
+// parseAccessDeniedMessage extracts the denied action and resource and the
+// reason for the denial from an AWS error message.
+// The action is empty if the message doesn't follow the
+// "is not authorized to perform" format, as is the case for S3 and EC2.
+func parseAccessDeniedMessage(message string) MissingPermission {
+	m := MissingPermission{Reason: DenialReasonUnknown, Message: message}
+
+	if match := accessDeniedRegex.FindStringSubmatch(message); match != nil {
+		m.Action = match[1]
+		m.Resource = strings.TrimSuffix(match[2], ".")
+	}
+
+	lower := strings.ToLower(message)
+	m.ExplicitDeny = strings.Contains(lower, "explicit deny")
+	for _, r := range denialReasons {
+		if strings.Contains(lower, r.phrase) {
+			m.Reason = r.reason
+			break
+		}
+	}
+	return m
+}
+
+// MissingPermissionForEvent returns the permission which was missing for
+// an AccessDenied or UnauthorizedOperation error event.
+// Returns nil if the event isn't an authorization error.
+//
+// If the error message doesn't name the denied action, the IAM action
+// for the operation is looked up in the catalog.
+func (a *Advisor) MissingPermissionForEvent(e AWSEvent) *MissingPermission {
+	if e.Data.Type != "awsError" || !accessDeniedCodes[e.Data.ExceptionCode] {
+		return nil
+	}
+	m := parseAccessDeniedMessage(e.Data.ExceptionMessage)
+	if m.Action != "" {
+		return &m
+	}
+
+	if a.catalog != nil {
+		if actions := a.catalog.ActionsForOperation(e.Data.Service, e.Data.Operation); len(actions) > 0 {
+			m.Action = actions[0]
+			return &m
+		}
+		if prefix, ok := a.catalog.ServicePrefix(e.Data.Service); ok {
+			m.Action = prefix + ":" + e.Data.Operation
+			return &m
+		}
+	}
+	m.Action = strings.ToLower(e.Data.Service) + ":" + e.Data.Operation
+	return &m
+}
+
+// CreateAdviceForMissingPermission generates a least-privilege policy granting
+// exactly the action and resource named in an AccessDenied error message.
+// Returns nil if the resource isn't known.
+func (a *Advisor) CreateAdviceForMissingPermission(e *AWSEvent, m MissingPermission) (*LeastPrivilegePolicy, error) {
+	if m.Resource == "" {
+		return nil, nil
+	}
+	id := uuid.NewString()
+
+	policy := policies.AWSIAMPolicy{
+		Version: "2012-10-17",
+		Id:      &id,
+		Statement: []policies.AWSIAMStatement{{
+			Sid:      "iamzero" + strings.Replace(uuid.NewString(), "-", "", -1),
+			Effect:   "Allow",
+			Action:   policies.NewStringValues(m.Action),
+			Resource: policies.NewStringValues(m.Resource),
+		}},
+	}
+
+	roleName, err := GetRoleOrUserNameFromARN(e.Identity.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	advice := LeastPrivilegePolicy{
+		AWSPolicy: policy,
+		Comment:   fmt.Sprintf("Allow the denied %s action on %s", m.Action, m.Resource),
+		ID:        id,
+		RoleName:  roleName,
+		Resources: []CloudResourceInstance{{
+			ID:   uuid.NewString(),
+			Name: m.Resource,
+			ARN:  m.Resource,
+		}},
+	}
+	return &advice, nil
+}
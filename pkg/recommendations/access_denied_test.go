@@ -0,0 +1,122 @@
+package recommendations
+
+import (
+	"testing"
+
+	"github.com/common-fate/iamzero/pkg/catalog"
+	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/stretchr/testify/assert"
+)
+
+func accessDeniedEvent(code, message string) AWSEvent {
+	e := buildSampleEvent()
+	e.Data.Type = "awsError"
+	e.Data.ExceptionCode = code
+	e.Data.ExceptionMessage = message
+	return e
+}
+
+func TestParseAccessDeniedMessage(t *testing.T) {
+	const user = "User: arn:aws:sts::123456789012:assumed-role/iamzero-test-role/session is not authorized to perform: "
+
+	cases := []struct {
+		name    string
+		message string
+		want    MissingPermission
+	}{
+		{
+			name:    "no identity-based policy",
+			message: user + "dynamodb:GetItem on resource: arn:aws:dynamodb:us-east-1:123456789012:table/my-table because no identity-based policy allows the dynamodb:GetItem action",
+			want:    MissingPermission{Action: "dynamodb:GetItem", Resource: "arn:aws:dynamodb:us-east-1:123456789012:table/my-table", Reason: DenialReasonIdentityPolicy},
+		},
+		{
+			name:    "explicit deny in a service control policy",
+			message: user + "s3:GetObject on resource: \"arn:aws:s3:::my-bucket/key\" with an explicit deny in a service control policy",
+			want:    MissingPermission{Action: "s3:GetObject", Resource: "arn:aws:s3:::my-bucket/key", Reason: DenialReasonServiceControlPolicy, ExplicitDeny: true},
+		},
+		{
+			name:    "no permissions boundary",
+			message: user + "sqs:SendMessage on resource: arn:aws:sqs:us-east-1:123456789012:my-queue because no permissions boundary allows the sqs:SendMessage action",
+			want:    MissingPermission{Action: "sqs:SendMessage", Resource: "arn:aws:sqs:us-east-1:123456789012:my-queue", Reason: DenialReasonPermissionsBoundary},
+		},
+		{
+			name:    "explicit deny in a resource-based policy",
+			message: user + "kms:Decrypt on resource: arn:aws:kms:us-east-1:123456789012:key/abcd with an explicit deny in a resource-based policy",
+			want:    MissingPermission{Action: "kms:Decrypt", Resource: "arn:aws:kms:us-east-1:123456789012:key/abcd", Reason: DenialReasonResourcePolicy, ExplicitDeny: true},
+		},
+		{
+			name:    "legacy message without a reason",
+			message: user + "sns:Publish on resource: arn:aws:sns:us-east-1:123456789012:my-topic.",
+			want:    MissingPermission{Action: "sns:Publish", Resource: "arn:aws:sns:us-east-1:123456789012:my-topic", Reason: DenialReasonUnknown},
+		},
+		{
+			name:    "message without a resource",
+			message: user + "iam:ListRoles because no identity-based policy allows the iam:ListRoles action",
+			want:    MissingPermission{Action: "iam:ListRoles", Reason: DenialReasonIdentityPolicy},
+		},
+		{
+			name:    "message without an action",
+			message: "Access Denied",
+			want:    MissingPermission{Reason: DenialReasonUnknown},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.want.Message = tc.message
+			assert.Equal(t, tc.want, parseAccessDeniedMessage(tc.message))
+		})
+	}
+}
+
+func TestMissingPermissionFixable(t *testing.T) {
+	assert.True(t, MissingPermission{Reason: DenialReasonIdentityPolicy}.Fixable())
+	assert.True(t, MissingPermission{Reason: DenialReasonUnknown}.Fixable())
+	assert.False(t, MissingPermission{Reason: DenialReasonIdentityPolicy, ExplicitDeny: true}.Fixable())
+	assert.False(t, MissingPermission{Reason: DenialReasonServiceControlPolicy}.Fixable())
+	assert.False(t, MissingPermission{Reason: DenialReasonPermissionsBoundary}.Fixable())
+}
+
+func TestMissingPermissionForEvent(t *testing.T) {
+	a := &Advisor{catalog: catalog.Default()}
+
+	// successful calls and other errors aren't missing permissions
+	assert.Nil(t, a.MissingPermissionForEvent(buildSampleEvent()))
+	assert.Nil(t, a.MissingPermissionForEvent(accessDeniedEvent("NoSuchKey", "The specified key does not exist.")))
+
+	// S3 doesn't include the action in the message, so it is looked up from the operation
+	m := a.MissingPermissionForEvent(accessDeniedEvent("AccessDenied", "Access Denied"))
+	if assert.NotNil(t, m) {
+		assert.Equal(t, "s3:PutObject", m.Action)
+		assert.Equal(t, "", m.Resource)
+		assert.True(t, m.Fixable())
+	}
+
+	e := accessDeniedEvent("UnauthorizedOperation", "You are not authorized to perform this operation.")
+	e.Data.Service = "ec2"
+	e.Data.Operation = "DescribeInstances"
+	m = a.MissingPermissionForEvent(e)
+	if assert.NotNil(t, m) {
+		assert.Equal(t, "ec2:DescribeInstances", m.Action)
+	}
+}
+
+func TestCreateAdviceForMissingPermission(t *testing.T) {
+	a := &Advisor{catalog: catalog.Default()}
+	e := accessDeniedEvent("AccessDeniedException", "User: arn:aws:sts::123456789012:assumed-role/iamzero-test-role/session is not authorized to perform: kms:Decrypt on resource: arn:aws:kms:us-east-1:123456789012:key/abcd because no identity-based policy allows the kms:Decrypt action")
+
+	m := a.MissingPermissionForEvent(e)
+	if !assert.NotNil(t, m) {
+		return
+	}
+	advice, err := a.CreateAdviceForMissingPermission(&e, *m)
+	assert.NoError(t, err)
+	s := advice.AWSPolicy.Statement[0]
+	assert.Equal(t, policies.NewStringValues("kms:Decrypt"), s.Action)
+	assert.Equal(t, policies.NewStringValues("arn:aws:kms:us-east-1:123456789012:key/abcd"), s.Resource)
+
+	// without a resource there isn't enough information to scope the advice
+	advice, err = a.CreateAdviceForMissingPermission(&e, MissingPermission{Action: "kms:Decrypt"})
+	assert.NoError(t, err)
+	assert.Nil(t, advice)
+}
@@ -30,6 +30,9 @@ type AWSAction struct {
 	Enabled bool `json:"enabled"`
 	// SelectedLeastPrivilegePolicyID is the ID of the advisory selected by the user to resolve the policy
 	SelectedLeastPrivilegePolicyID string `json:"selectedAdvisoryId"`
+	// MissingPermission is set if the action was recorded from an AccessDenied error,
+	// rather than a call which used a permission the role already has.
+	MissingPermission *MissingPermission `json:"missingPermission,omitempty" db:"missing_permission"`
 }
 type AWSActions []*AWSAction
 
@@ -38,3 +38,17 @@ func ExtractRoleARNFromSession(arn string) (*string, error) {
 	}
 	return nil, nil
 }
+
+// ExtractSessionNameFromSession parses a session role ARN and returns the role session name.
+// If the provided ARN is not a session role ARN, an empty string is returned
+func ExtractSessionNameFromSession(arn string) (string, error) {
+	re, err := regexp.Compile(`arn:aws:sts::\d{12}:assumed-role/[\w\d+=,.@_-]+/([\w\d+=,.@_-]+)`)
+	if err != nil {
+		return "", err
+	}
+	matches := re.FindStringSubmatch(arn)
+	if matches == nil {
+		return "", nil
+	}
+	return matches[1], nil
+}
@@ -65,3 +65,17 @@ func ParseRealRoleARN_ReturnsNilIfAssumedRoleIsNotGiven(t *testing.T) {
 
 	assert.Nil(t, role)
 }
+
+func TestExtractSessionNameFromSession(t *testing.T) {
+	name, err := recommendations.ExtractSessionNameFromSession("arn:aws:sts::123456789012:assumed-role/iamzero-test-role/iamzero-test+=,.@-_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "iamzero-test+=,.@-_", name)
+
+	name, err = recommendations.ExtractSessionNameFromSession("arn:aws:iam::123456789012:role/iamzero-test-role")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "", name)
+}
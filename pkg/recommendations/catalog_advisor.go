@@ -0,0 +1,109 @@
+package recommendations
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/common-fate/iamzero/pkg/catalog"
+	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/google/uuid"
+)
+
+// CreateAdviceFromCatalog generates a least-privilege policy for an event
+// using the IAM action catalog. It is used as a fallback for operations
+// which don't have a hand-written AdvisoryTemplate.
+//
+// Each IAM action which authorizes the operation is scoped to the most
+// specific resource ARN which can be built from the event parameters.
+// Returns nil if the operation isn't in the catalog.
+func (a *Advisor) CreateAdviceFromCatalog(e *AWSEvent) (*LeastPrivilegePolicy, error) {
+	if a.catalog == nil {
+		return nil, nil
+	}
+	actions := a.catalog.ActionsForOperation(e.Data.Service, e.Data.Operation)
+	if len(actions) == 0 {
+		return nil, nil
+	}
+
+	ctx := catalog.ARNContext{
+		Region:  e.Data.Region,
+		Account: e.Identity.Account,
+	}
+
+	var iamStatements []policies.AWSIAMStatement
+	resources := []CloudResourceInstance{}
+
+	for _, action := range actions {
+		rendered := renderCatalogResources(a.catalog, action, ctx, e.Data.Parameters)
+
+		renderedResources := []string{}
+		for _, r := range rendered {
+			renderedResources = append(renderedResources, r.ARN)
+			if r.ARN == "*" {
+				continue
+			}
+			resources = append(resources, CloudResourceInstance{
+				ID:   uuid.NewString(),
+				Name: r.Name,
+				ARN:  r.ARN,
+			})
+		}
+
+		iamStatements = append(iamStatements, policies.AWSIAMStatement{
+			Sid:      "iamzero" + strings.Replace(uuid.NewString(), "-", "", -1),
+			Effect:   "Allow",
+			Action:   policies.NewStringValues(action),
+			Resource: policies.NewStringValues(renderedResources...),
+		})
+	}
+
+	id := uuid.NewString()
+
+	policy := policies.AWSIAMPolicy{
+		Version:   "2012-10-17",
+		Id:        &id,
+		Statement: iamStatements,
+	}
+
+	roleName, err := GetRoleOrUserNameFromARN(e.Identity.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	advice := LeastPrivilegePolicy{
+		AWSPolicy: policy,
+		Comment:   fmt.Sprintf("Allow %s (generated from the IAM action catalog)", strings.Join(actions, ", ")),
+		ID:        id,
+		RoleName:  roleName,
+		Resources: resources,
+	}
+	return &advice, nil
+}
+
+// renderCatalogResources renders the resource ARNs for an IAM action.
+// Where an action supports multiple resource types, the resource type
+// with the fewest variables replaced by wildcards is used. Ties are
+// broken by the number of resolved variables and then by catalog order,
+// so that a DynamoDB index is preferred to its table if an IndexName is provided.
+func renderCatalogResources(c *catalog.Catalog, action string, ctx catalog.ARNContext, params map[string]interface{}) []catalog.RenderedARN {
+	def, ok := c.Action(action)
+	if !ok || len(def.ResourceTypes) == 0 {
+		return []catalog.RenderedARN{{ARN: "*", Name: "*"}}
+	}
+
+	var best *catalog.Rendering
+	for _, name := range def.ResourceTypes {
+		rt, ok := c.ResourceType(action, name)
+		if !ok {
+			continue
+		}
+		r := rt.Render(ctx, params)
+		if best == nil || r.Unresolved < best.Unresolved || (r.Unresolved == best.Unresolved && r.Resolved > best.Resolved) {
+			best = &r
+		}
+	}
+	if best == nil {
+		return []catalog.RenderedARN{{ARN: "*", Name: "*"}}
+	}
+	return best.ARNs
+}
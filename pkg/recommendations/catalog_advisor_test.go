@@ -0,0 +1,76 @@
+package recommendations
+
+import (
+	"testing"
+
+	"github.com/common-fate/iamzero/pkg/catalog"
+	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/stretchr/testify/assert"
+)
+
+func catalogEvent(service, operation string, params map[string]interface{}) AWSEvent {
+	e := buildSampleEvent()
+	e.Data.Service = service
+	e.Data.Operation = operation
+	e.Data.Parameters = params
+	return e
+}
+
+func TestAdviseFallsBackToCatalog(t *testing.T) {
+	a := &Advisor{catalog: catalog.Default()}
+	e := catalogEvent("sqs", "SendMessage", map[string]interface{}{
+		"QueueUrl": "https://sqs.ap-southeast-2.amazonaws.com/123456789012/my-queue",
+	})
+
+	advices, err := a.Advise(e)
+	assert.NoError(t, err)
+	assert.Len(t, advices, 1)
+
+	s := advices[0].AWSPolicy.Statement[0]
+	assert.Equal(t, policies.NewStringValues("sqs:SendMessage"), s.Action)
+	assert.Equal(t, policies.NewStringValues("arn:aws:sqs:ap-southeast-2:123456789012:my-queue"), s.Resource)
+	assert.Equal(t, "my-queue", advices[0].Resources[0].Name)
+	assert.Equal(t, "iamzero-test-role", advices[0].RoleName)
+}
+
+func TestAdvisePrefersTemplatesToCatalog(t *testing.T) {
+	a := buildExampleAdvisor()
+	a.catalog = catalog.Default()
+
+	advices, err := a.Advise(buildSampleEvent())
+	assert.NoError(t, err)
+	assert.Len(t, advices, 1)
+	assert.Equal(t, "Allow PutObject access to the specific key", advices[0].Comment)
+}
+
+func TestCatalogPrefersMostSpecificResourceType(t *testing.T) {
+	a := &Advisor{catalog: catalog.Default()}
+
+	e := catalogEvent("dynamodb", "Query", map[string]interface{}{"TableName": "my-table", "IndexName": "my-index"})
+	advice, err := a.CreateAdviceFromCatalog(&e)
+	assert.NoError(t, err)
+	assert.Equal(t, policies.NewStringValues("arn:aws:dynamodb:ap-southeast-2:123456789012:table/my-table/index/my-index"), advice.AWSPolicy.Statement[0].Resource)
+
+	e = catalogEvent("dynamodb", "Query", map[string]interface{}{"TableName": "my-table"})
+	advice, err = a.CreateAdviceFromCatalog(&e)
+	assert.NoError(t, err)
+	assert.Equal(t, policies.NewStringValues("arn:aws:dynamodb:ap-southeast-2:123456789012:table/my-table"), advice.AWSPolicy.Statement[0].Resource)
+}
+
+func TestCatalogActionWithoutResourceTypes(t *testing.T) {
+	a := &Advisor{catalog: catalog.Default()}
+	e := catalogEvent("s3", "ListBuckets", map[string]interface{}{})
+
+	advice, err := a.CreateAdviceFromCatalog(&e)
+	assert.NoError(t, err)
+	assert.Equal(t, policies.NewStringValues("s3:ListAllMyBuckets"), advice.AWSPolicy.Statement[0].Action)
+	assert.Equal(t, policies.NewStringValues("*"), advice.AWSPolicy.Statement[0].Resource)
+	assert.Empty(t, advice.Resources)
+}
+
+func TestCatalogUnknownOperation(t *testing.T) {
+	a := &Advisor{catalog: catalog.Default()}
+	advices, err := a.Advise(catalogEvent("s3", "NotARealOperation", map[string]interface{}{}))
+	assert.NoError(t, err)
+	assert.Empty(t, advices)
+}
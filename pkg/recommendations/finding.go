@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/common-fate/iamzero/pkg/tags"
 )
 
 const (
@@ -22,6 +23,9 @@ type Finding struct {
 	// TerraformFinding *terraformApplier.TerraformFinding `json:"terraformFinding"`
 	// Status is either "active" or "resolved"
 	Status string `json:"status" db:"status"`
+	// Tags are the event tags which the finding is keyed by, along with its role.
+	// Events for the role with different values for these tags create separate findings.
+	Tags tags.Tags `json:"tags" db:"tags"`
 }
 
 // ProcessedAWSIdentity is the same as AWS identity but contains optional
@@ -35,11 +39,16 @@ type ProcessedAWSIdentity struct {
 	Role        string                `json:"role" db:"role"`
 	Account     string                `json:"account" db:"account"`
 	CDKResource *policies.CDKResource `json:"cdkResource"`
+	// IaCSource is where the role is defined, if it is managed by
+	// CloudFormation. Unlike CDKResource it is set for roles defined with
+	// any framework which deploys using CloudFormation.
+	IaCSource *policies.IaCSource `json:"iacSource,omitempty" db:"iac_source"`
 }
 
-// RecalculateDocument rebuilds the policy document based on the actions
-// this initial implementation is naive and doesn't deduplicate or aggregate policies.
-func (p *Finding) RecalculateDocument(actions []AWSAction) {
+// RecalculateDocument rebuilds the policy document based on the actions.
+// The statements of the selected advisories are consolidated by the optimiser,
+// which may be nil to use the default optimisation settings.
+func (p *Finding) RecalculateDocument(actions []AWSAction, optimiser *policies.Optimiser) {
 	statements := []policies.AWSIAMStatement{}
 
 	for _, alert := range actions {
@@ -56,8 +65,7 @@ func (p *Finding) RecalculateDocument(actions []AWSAction) {
 	}
 
 	p.UpdatedAt = time.Now()
-	p.EventCount = len(actions)
-	p.Document.Statement = statements
+	p.Document.Statement = optimiser.Optimise(statements)
 }
 
 func FindingStatusIsValid(status string) bool {
@@ -0,0 +1,30 @@
+package recommendations
+
+import (
+	"fmt"
+
+	"github.com/common-fate/iamzero/pkg/audit"
+)
+
+// GraphAnnotationsForFindings annotates the principals in the assume role
+// graph which have findings, so that they are highlighted when the graph
+// is rendered. Findings for assumed role sessions are attributed to the
+// role which was assumed.
+func GraphAnnotationsForFindings(findings []Finding) audit.GraphAnnotations {
+	annotations := audit.GraphAnnotations{}
+	for _, f := range findings {
+		principal := f.Identity.Role
+		if principal == "" {
+			principal = f.Identity.User
+		}
+		if principal == "" {
+			continue
+		}
+		if roleARN, err := ExtractRoleARNFromSession(principal); err == nil && roleARN != nil {
+			principal = *roleARN
+		}
+		note := fmt.Sprintf("%s finding %s (%d events)", f.Status, f.ID, f.EventCount)
+		annotations[principal] = append(annotations[principal], note)
+	}
+	return annotations
+}
@@ -0,0 +1,46 @@
+package recommendations
+
+import (
+	"testing"
+
+	"github.com/common-fate/iamzero/pkg/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphAnnotationsForFindings(t *testing.T) {
+	findings := []Finding{
+		{
+			ID:         "role-finding",
+			Status:     PolicyStatusActive,
+			EventCount: 3,
+			Identity:   ProcessedAWSIdentity{Role: "arn:aws:iam::123456789012:role/example"},
+		},
+		{
+			ID:         "session-finding",
+			Status:     PolicyStatusActive,
+			EventCount: 1,
+			Identity:   ProcessedAWSIdentity{Role: "arn:aws:sts::123456789012:assumed-role/example/session"},
+		},
+		{
+			ID:         "user-finding",
+			Status:     PolicyStatusActive,
+			EventCount: 2,
+			Identity:   ProcessedAWSIdentity{User: "arn:aws:iam::123456789012:user/alice"},
+		},
+		{
+			ID:     "no-identity",
+			Status: PolicyStatusActive,
+		},
+	}
+
+	want := audit.GraphAnnotations{
+		"arn:aws:iam::123456789012:role/example": {
+			"active finding role-finding (3 events)",
+			"active finding session-finding (1 events)",
+		},
+		"arn:aws:iam::123456789012:user/alice": {
+			"active finding user-finding (2 events)",
+		},
+	}
+	assert.Equal(t, want, GraphAnnotationsForFindings(findings))
+}
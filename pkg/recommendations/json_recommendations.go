@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"html/template"
 	"strings"
+	texttemplate "text/template"
 	"text/template/parse"
 
 	"github.com/common-fate/iamzero/pkg/policies"
@@ -13,14 +14,18 @@ import (
 )
 
 type AdvisoryTemplate struct {
-	Policy  []Statement
-	Comment string
-	DocLink string
+	Policy  []Statement `json:"policy" yaml:"policy"`
+	Comment string      `json:"comment" yaml:"comment"`
+	DocLink string      `json:"docLink,omitempty" yaml:"docLink,omitempty"`
 }
 
 type Statement struct {
-	Action   []string
-	Resource []string
+	Action   []string `json:"action" yaml:"action"`
+	Resource []string `json:"resource" yaml:"resource"`
+	// Condition is keyed by condition operator and then by condition key.
+	// Condition values are templated in the same way as resources, for example
+	//	StringLike: {"s3:prefix": ["{{ .Prefix }}*"]}
+	Condition map[string]map[string][]string `json:"condition,omitempty" yaml:"condition,omitempty"`
 }
 
 type LeastPrivilegePolicy struct {
@@ -84,11 +89,17 @@ func (a *Advisor) CreateAdviceFromEvent(e *AWSEvent, r AdvisoryTemplate) (*Least
 			})
 		}
 
+		condition, err := renderCondition(statement.Condition, vars)
+		if err != nil {
+			return nil, err
+		}
+
 		iamStatement := policies.AWSIAMStatement{
-			Sid:      "iamzero" + strings.Replace(uuid.NewString(), "-", "", -1),
-			Effect:   "Allow",
-			Action:   statement.Action,
-			Resource: renderedResources,
+			Sid:       "iamzero" + strings.Replace(uuid.NewString(), "-", "", -1),
+			Effect:    "Allow",
+			Action:    policies.NewStringValues(statement.Action...),
+			Resource:  policies.NewStringValues(renderedResources...),
+			Condition: condition,
 		}
 		iamStatements = append(iamStatements, iamStatement)
 	}
@@ -117,6 +128,59 @@ func (a *Advisor) CreateAdviceFromEvent(e *AWSEvent, r AdvisoryTemplate) (*Least
 	return &advice, nil
 }
 
+// renderCondition templates out the values of an advisory condition block.
+// Values which refer to a parameter the event doesn't contain, or which
+// render to an empty string, are skipped, and condition keys without any
+// values are left out of the rendered condition.
+//
+// Condition values are rendered with text/template rather than html/template,
+// as they are literal policy values and must not be HTML-escaped.
+func renderCondition(c map[string]map[string][]string, vars map[string]interface{}) (policies.Condition, error) {
+	if len(c) == 0 {
+		return nil, nil
+	}
+	rendered := policies.Condition{}
+	for operator, keys := range c {
+		for key, valueTemplates := range keys {
+			values := []string{}
+			for _, valueTemplate := range valueTemplates {
+				tmpl, err := texttemplate.New("condition").Option("missingkey=error").Parse(valueTemplate)
+				if err != nil {
+					return nil, err
+				}
+				var valBytes bytes.Buffer
+				err = tmpl.Execute(&valBytes, vars)
+				var execErr texttemplate.ExecError
+				if errors.As(err, &execErr) {
+					// the event doesn't contain a parameter the value refers to
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				if valBytes.Len() > 0 {
+					values = append(values, valBytes.String())
+				}
+			}
+			if len(values) == 0 {
+				continue
+			}
+			if rendered[operator] == nil {
+				rendered[operator] = map[string]policies.ConditionValues{}
+			}
+			if len(values) == 1 {
+				rendered[operator][key] = policies.NewConditionValue(values[0])
+			} else {
+				rendered[operator][key] = policies.NewConditionValues(values...)
+			}
+		}
+	}
+	if len(rendered) == 0 {
+		return nil, nil
+	}
+	return rendered, nil
+}
+
 func (a *LeastPrivilegePolicy) GetID() string {
 	return a.ID
 }
@@ -5,7 +5,9 @@ import (
 	"testing"
 
 	"github.com/common-fate/iamzero/pkg/audit"
+	"github.com/common-fate/iamzero/pkg/policies"
 	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
 )
 
 func buildExampleAdvisor() *Advisor {
@@ -136,3 +138,63 @@ func TestParseResourceFromTemplateGivesErrorIfNoVariables(t *testing.T) {
 		t.Fatal("expected error")
 	}
 }
+
+func TestJSONRecommendationsRendersConditions(t *testing.T) {
+	advisor := buildExampleAdvisor()
+	e := buildSampleEvent()
+	e.Data.Parameters["Prefix"] = "home/alice/"
+
+	tmpl := AdvisoryTemplate{
+		Policy: []Statement{
+			{
+				Action:   []string{"s3:ListBucket"},
+				Resource: []string{"arn:aws:s3:::{{ .Bucket }}"},
+				Condition: map[string]map[string][]string{
+					"StringLike":   {"s3:prefix": {"{{ .Prefix }}*"}},
+					"StringEquals": {"aws:SourceVpce": {"{{ .VpcEndpointId }}"}},
+				},
+			},
+		},
+		Comment: "Allow listing objects under the prefix",
+	}
+
+	a, err := advisor.CreateAdviceFromEvent(&e, tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the aws:SourceVpce condition is left out as the event doesn't contain a VpcEndpointId parameter
+	expected := policies.Condition{
+		"StringLike": {"s3:prefix": policies.NewConditionValue("home/alice/*")},
+	}
+	assert.Equal(t, expected, a.AWSPolicy.Statement[0].Condition)
+}
+
+func TestJSONRecommendationsDoesNotEscapeConditionValues(t *testing.T) {
+	advisor := buildExampleAdvisor()
+	e := buildSampleEvent()
+	e.Data.Parameters["Prefix"] = "a+b & 'c'/"
+
+	tmpl := AdvisoryTemplate{
+		Policy: []Statement{
+			{
+				Action:   []string{"s3:ListBucket"},
+				Resource: []string{"arn:aws:s3:::{{ .Bucket }}"},
+				Condition: map[string]map[string][]string{
+					"StringLike": {"s3:prefix": {"{{ .Prefix }}*"}},
+				},
+			},
+		},
+		Comment: "Allow listing objects under the prefix",
+	}
+
+	a, err := advisor.CreateAdviceFromEvent(&e, tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := policies.Condition{
+		"StringLike": {"s3:prefix": policies.NewConditionValue("a+b & 'c'/*")},
+	}
+	assert.Equal(t, expected, a.AWSPolicy.Statement[0].Condition)
+}
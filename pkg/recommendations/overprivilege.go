@@ -0,0 +1,294 @@
+package recommendations
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/common-fate/iamzero/pkg/audit"
+	"github.com/common-fate/iamzero/pkg/catalog"
+	"github.com/common-fate/iamzero/pkg/policies"
+)
+
+// AccessLevelUnknown is used for granted actions which aren't in the IAM action catalog
+const AccessLevelUnknown = "Unknown"
+
+// accessLevelWeights weight unused grants by how much risk they carry
+// when calculating the privilege reduction score.
+var accessLevelWeights = map[string]int{
+	catalog.AccessLevelPermissionsManagement: 5,
+	catalog.AccessLevelWrite:                 3,
+	catalog.AccessLevelTagging:               2,
+	catalog.AccessLevelRead:                  2,
+	catalog.AccessLevelList:                  1,
+	AccessLevelUnknown:                       2,
+}
+
+// OverPrivilegeReport compares the permissions granted to a role with the
+// actions that IAM Zero has observed the role using.
+type OverPrivilegeReport struct {
+	FindingID string `json:"findingId"`
+	Role      string `json:"role"`
+	// WindowStart and WindowEnd are the times of the first and last
+	// observed actions. They are nil if no actions have been observed.
+	WindowStart *time.Time `json:"windowStart,omitempty"`
+	WindowEnd   *time.Time `json:"windowEnd,omitempty"`
+	// ObservedActionCount is the number of observed actions in the window
+	ObservedActionCount int `json:"observedActionCount"`
+	// GrantedCount is the number of granted action/resource pairs
+	GrantedCount int `json:"grantedCount"`
+	// UnusedCount is the number of granted action/resource pairs which weren't used
+	UnusedCount int `json:"unusedCount"`
+	// Score is the privilege reduction score from 0 to 100: the share of
+	// the role's permissions, weighted by access level, which could be
+	// removed. Roles with higher scores should be tightened first.
+	Score int `json:"score"`
+	// UnusedByAccessLevel counts the unused grants for each access level
+	UnusedByAccessLevel map[string]int `json:"unusedByAccessLevel"`
+	// UnusedGrants are sorted with the most sensitive access levels first
+	UnusedGrants []Grant `json:"unusedGrants"`
+}
+
+// Grant is an action/resource pair allowed by a policy attached to a role
+type Grant struct {
+	Action   string `json:"action"`
+	Resource string `json:"resource"`
+	// ExcludedResources is set when the grant comes from a NotResource statement,
+	// in which case Resource is "*"
+	ExcludedResources []string `json:"excludedResources,omitempty"`
+	AccessLevel       string   `json:"accessLevel"`
+	// Policy is the ARN of the managed policy or the name of the inline policy that grants the action
+	Policy string `json:"policy"`
+}
+
+// observedUsage is an IAM action observed being used on a resource.
+// Resource is empty if the resource couldn't be determined from the event.
+type observedUsage struct {
+	action   string
+	resource string
+}
+
+// BuildOverPrivilegeReport builds a report of the action/resource pairs granted
+// to the role by its managed and inline policies which haven't been used
+// by any of the observed actions.
+//
+// Wildcard actions are expanded using the IAM action catalog. Grants which are
+// blocked by a Deny statement in the role's policies are not included.
+// Where the resource used by an observed action can't be determined,
+// all grants of the action are treated as used. Actions recording a
+// missing permission are ignored, as the request was denied.
+func BuildOverPrivilegeReport(f *Finding, actions []AWSAction, role *audit.AWSRole, c *catalog.Catalog) *OverPrivilegeReport {
+	report := OverPrivilegeReport{
+		FindingID:           f.ID,
+		Role:                role.ARN,
+		UnusedByAccessLevel: map[string]int{},
+		UnusedGrants:        []Grant{},
+	}
+
+	usages := []observedUsage{}
+	for _, a := range actions {
+		// actions which were denied didn't use any of the role's permissions
+		if a.MissingPermission != nil {
+			continue
+		}
+		report.ObservedActionCount++
+		t := a.Time
+		if report.WindowStart == nil || t.Before(*report.WindowStart) {
+			report.WindowStart = &t
+		}
+		if report.WindowEnd == nil || t.After(*report.WindowEnd) {
+			report.WindowEnd = &t
+		}
+		usages = append(usages, usagesForEvent(a.Event, c)...)
+	}
+
+	grantedWeight := 0
+	unusedWeight := 0
+
+	for _, g := range grantsForRole(role, c) {
+		weight := accessLevelWeights[g.AccessLevel]
+		grantedWeight += weight
+		report.GrantedCount++
+
+		if grantIsUsed(g, usages) {
+			continue
+		}
+		unusedWeight += weight
+		report.UnusedCount++
+		report.UnusedByAccessLevel[g.AccessLevel]++
+		report.UnusedGrants = append(report.UnusedGrants, g)
+	}
+
+	if grantedWeight > 0 {
+		report.Score = int(math.Round(100 * float64(unusedWeight) / float64(grantedWeight)))
+	}
+
+	sort.SliceStable(report.UnusedGrants, func(i, j int) bool {
+		gi, gj := report.UnusedGrants[i], report.UnusedGrants[j]
+		wi, wj := accessLevelWeights[gi.AccessLevel], accessLevelWeights[gj.AccessLevel]
+		if wi != wj {
+			return wi > wj
+		}
+		if gi.Action != gj.Action {
+			return gi.Action < gj.Action
+		}
+		return gi.Resource < gj.Resource
+	})
+
+	return &report
+}
+
+// usagesForEvent returns the IAM actions and resources used by an event
+func usagesForEvent(e AWSEvent, c *catalog.Catalog) []observedUsage {
+	iamActions := c.ActionsForOperation(e.Data.Service, e.Data.Operation)
+	if len(iamActions) == 0 {
+		iamActions = []string{e.Data.Service + ":" + e.Data.Operation}
+	}
+
+	ctx := catalog.ARNContext{Region: e.Data.Region, Account: e.Identity.Account}
+	usages := []observedUsage{}
+	for _, action := range iamActions {
+		for _, r := range renderCatalogResources(c, action, ctx, e.Data.Parameters) {
+			resource := r.ARN
+			// we can't tell which resource was used if the ARN contains a wildcard
+			if strings.Contains(resource, "*") {
+				resource = ""
+			}
+			usages = append(usages, observedUsage{action: action, resource: resource})
+		}
+	}
+	return usages
+}
+
+// grantsForRole lists the action/resource pairs allowed by the role's policies
+func grantsForRole(role *audit.AWSRole, c *catalog.Catalog) []Grant {
+	type source struct {
+		name     string
+		document policies.AWSIAMPolicy
+	}
+	sources := []source{}
+	for _, p := range role.ManagedPolicies {
+		sources = append(sources, source{name: p.ARN, document: p.Document})
+	}
+	for _, p := range role.InlinePolicies {
+		sources = append(sources, source{name: p.Name, document: p.Document})
+	}
+
+	denies := []policies.AWSIAMStatement{}
+	for _, src := range sources {
+		for _, s := range src.document.Statement {
+			if strings.EqualFold(s.Effect, "Deny") {
+				denies = append(denies, s)
+			}
+		}
+	}
+
+	grants := []Grant{}
+	seen := map[string]bool{}
+
+	for _, src := range sources {
+		for _, s := range src.document.Statement {
+			if !strings.EqualFold(s.Effect, "Allow") {
+				continue
+			}
+
+			resources := s.Resource.Values
+			var excluded []string
+			if len(resources) == 0 {
+				resources = []string{"*"}
+				excluded = s.NotResource.Values
+			}
+
+			for _, action := range expandStatementActions(s, c) {
+				for _, resource := range resources {
+					if isDenied(denies, action, resource) {
+						continue
+					}
+					key := strings.ToLower(action) + "|" + resource + "|" + strings.Join(excluded, ",")
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+
+					level := AccessLevelUnknown
+					if def, ok := c.Action(action); ok {
+						level = def.AccessLevel
+					}
+					grants = append(grants, Grant{
+						Action:            action,
+						Resource:          resource,
+						ExcludedResources: excluded,
+						AccessLevel:       level,
+						Policy:            src.name,
+					})
+				}
+			}
+		}
+	}
+	return grants
+}
+
+// expandStatementActions expands the wildcards in a statement's Action or
+// NotAction element into the actions in the catalog. Actions which aren't in
+// the catalog are returned as they appear in the statement.
+func expandStatementActions(s policies.AWSIAMStatement, c *catalog.Catalog) []string {
+	actions := []string{}
+
+	if len(s.Action.Values) == 0 {
+		// NotAction statements allow every action other than those listed
+		for _, name := range c.ActionNames() {
+			if s.MatchesAction(name) {
+				actions = append(actions, name)
+			}
+		}
+		return actions
+	}
+
+	for _, pattern := range s.Action.Values {
+		if !strings.ContainsAny(pattern, "*?") {
+			actions = append(actions, pattern)
+			continue
+		}
+		matched := false
+		single := policies.AWSIAMStatement{Action: policies.NewStringValues(pattern)}
+		for _, name := range c.ActionNames() {
+			if single.MatchesAction(name) {
+				actions = append(actions, name)
+				matched = true
+			}
+		}
+		if !matched {
+			actions = append(actions, pattern)
+		}
+	}
+	return actions
+}
+
+// isDenied returns true if a Deny statement blocks the action on the resource
+func isDenied(denies []policies.AWSIAMStatement, action, resource string) bool {
+	for _, d := range denies {
+		if d.MatchesAction(action) && d.MatchesResource(resource) && len(d.Condition) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// grantIsUsed returns true if any observed usage falls within the grant
+func grantIsUsed(g Grant, usages []observedUsage) bool {
+	s := policies.AWSIAMStatement{Action: policies.NewStringValues(g.Action), Resource: policies.NewStringValues(g.Resource)}
+	if len(g.ExcludedResources) > 0 {
+		s.Resource = policies.StringOrStringArray{}
+		s.NotResource = policies.NewStringValues(g.ExcludedResources...)
+	}
+	for _, u := range usages {
+		if !s.MatchesAction(u.action) {
+			continue
+		}
+		if u.resource == "" || s.MatchesResource(u.resource) {
+			return true
+		}
+	}
+	return false
+}
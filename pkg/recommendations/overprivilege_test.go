@@ -0,0 +1,123 @@
+package recommendations
+
+import (
+	"testing"
+	"time"
+
+	"github.com/common-fate/iamzero/pkg/audit"
+	"github.com/common-fate/iamzero/pkg/catalog"
+	"github.com/common-fate/iamzero/pkg/policies"
+	"github.com/stretchr/testify/assert"
+)
+
+func buildOverPrivilegedRole() *audit.AWSRole {
+	return &audit.AWSRole{
+		ARN:       "arn:aws:iam::123456789012:role/iamzero-test-role",
+		AccountID: "123456789012",
+		ManagedPolicies: []audit.ManagedPolicy{
+			{
+				ARN: "arn:aws:iam::123456789012:policy/s3-access",
+				Document: policies.AWSIAMPolicy{
+					Version: "2012-10-17",
+					Statement: policies.IAMStatements{
+						{
+							Effect:   "Allow",
+							Action:   policies.NewStringValues("s3:GetObject", "s3:PutObject"),
+							Resource: policies.NewStringValues("arn:aws:s3:::test-bucket/*"),
+						},
+					},
+				},
+			},
+		},
+		InlinePolicies: []audit.InlinePolicy{
+			{
+				Name: "iam-access",
+				Document: policies.AWSIAMPolicy{
+					Version: "2012-10-17",
+					Statement: policies.IAMStatements{
+						{
+							Effect:   "Allow",
+							Action:   policies.NewStringValues("iam:PassRole", "iam:GetRole"),
+							Resource: policies.NewStringValues("*"),
+						},
+						{
+							Effect:   "Deny",
+							Action:   policies.NewStringValues("iam:GetRole"),
+							Resource: policies.NewStringValues("*"),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestBuildOverPrivilegeReport(t *testing.T) {
+	e := buildSampleEvent()
+	observed := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	actions := []AWSAction{{ID: "1", Event: e, Time: observed}}
+	f := &Finding{ID: "finding"}
+
+	report := BuildOverPrivilegeReport(f, actions, buildOverPrivilegedRole(), catalog.Default())
+
+	// s3:PutObject was used, s3:GetObject and iam:PassRole weren't.
+	// iam:GetRole is denied so isn't counted as a grant.
+	assert.Equal(t, 3, report.GrantedCount)
+	assert.Equal(t, 2, report.UnusedCount)
+	assert.Equal(t, []Grant{
+		{Action: "iam:PassRole", Resource: "*", AccessLevel: catalog.AccessLevelWrite, Policy: "iam-access"},
+		{Action: "s3:GetObject", Resource: "arn:aws:s3:::test-bucket/*", AccessLevel: catalog.AccessLevelRead, Policy: "arn:aws:iam::123456789012:policy/s3-access"},
+	}, report.UnusedGrants)
+	assert.Equal(t, map[string]int{catalog.AccessLevelWrite: 1, catalog.AccessLevelRead: 1}, report.UnusedByAccessLevel)
+	// weights: PutObject 3 (used), PassRole 3, GetObject 2 => 5/8 unused
+	assert.Equal(t, 63, report.Score)
+	assert.Equal(t, observed, *report.WindowStart)
+	assert.Equal(t, observed, *report.WindowEnd)
+}
+
+func TestBuildOverPrivilegeReportExpandsWildcards(t *testing.T) {
+	role := &audit.AWSRole{
+		ARN: "arn:aws:iam::123456789012:role/iamzero-test-role",
+		InlinePolicies: []audit.InlinePolicy{
+			{
+				Name: "sqs",
+				Document: policies.AWSIAMPolicy{
+					Statement: policies.IAMStatements{
+						{Effect: "Allow", Action: policies.NewStringValues("sqs:*"), Resource: policies.NewStringValues("*")},
+					},
+				},
+			},
+		},
+	}
+	e := buildSampleEvent()
+	e.Data.Service = "sqs"
+	e.Data.Operation = "SendMessage"
+	e.Data.Parameters = map[string]interface{}{"QueueUrl": "https://sqs.ap-southeast-2.amazonaws.com/123456789012/my-queue"}
+
+	report := BuildOverPrivilegeReport(&Finding{ID: "finding"}, []AWSAction{{Event: e}}, role, catalog.Default())
+
+	assert.Equal(t, len(catalog.Default().Services["sqs"].Actions), report.GrantedCount)
+	assert.Equal(t, report.GrantedCount-1, report.UnusedCount)
+	for _, g := range report.UnusedGrants {
+		assert.NotEqual(t, "sqs:SendMessage", g.Action)
+	}
+}
+
+func TestBuildOverPrivilegeReportNoActions(t *testing.T) {
+	report := BuildOverPrivilegeReport(&Finding{ID: "finding"}, nil, buildOverPrivilegedRole(), catalog.Default())
+	assert.Equal(t, 100, report.Score)
+	assert.Nil(t, report.WindowStart)
+}
+
+func TestBuildOverPrivilegeReportIgnoresDeniedActions(t *testing.T) {
+	e := accessDeniedEvent("AccessDenied", "Access Denied")
+	actions := []AWSAction{{ID: "1", Event: e, Time: time.Now(), MissingPermission: &MissingPermission{Action: "s3:PutObject", Reason: DenialReasonServiceControlPolicy}}}
+	f := &Finding{ID: "finding"}
+
+	report := BuildOverPrivilegeReport(f, actions, buildOverPrivilegedRole(), catalog.Default())
+
+	// the denied s3:PutObject call doesn't count as using the grant
+	assert.Equal(t, 0, report.ObservedActionCount)
+	assert.Equal(t, 3, report.UnusedCount)
+	assert.Nil(t, report.WindowStart)
+}
@@ -1,10 +1,14 @@
 package recommendations
 
-import "github.com/common-fate/iamzero/pkg/audit"
+import (
+	"github.com/common-fate/iamzero/pkg/audit"
+	"github.com/common-fate/iamzero/pkg/catalog"
+)
 
 func NewAdvisor(auditor *audit.Auditor) *Advisor {
 	return &Advisor{
 		auditor: auditor,
+		catalog: catalog.Default(),
 		AlertsMapping: map[string][]AdvisoryTemplate{
 			"dynamodb:GetItem": {
 				AdvisoryTemplate{
@@ -129,6 +133,26 @@ func NewAdvisor(auditor *audit.Auditor) *Advisor {
 					Comment: "Allow access to the bucket",
 				},
 			},
+			"s3:ListObjectsV2": {
+				AdvisoryTemplate{
+					Policy: []Statement{{
+						Action:   []string{"s3:ListBucket"},
+						Resource: []string{"arn:aws:s3:::{{ .Bucket }}"},
+						Condition: map[string]map[string][]string{
+							"StringLike": {"s3:prefix": {"{{ .Prefix }}*"}},
+						},
+					}},
+					Comment: "Allow listing objects under the prefix",
+					DocLink: "https://docs.aws.amazon.com/AmazonS3/latest/userguide/amazon-s3-policy-keys.html",
+				},
+				AdvisoryTemplate{
+					Policy: []Statement{{
+						Action:   []string{"s3:ListBucket"},
+						Resource: []string{"arn:aws:s3:::{{ .Bucket }}"},
+					}},
+					Comment: "Allow listing all objects in the bucket",
+				},
+			},
 			"s3:ListBuckets": {
 				AdvisoryTemplate{
 					Policy: []Statement{{
@@ -149,6 +173,18 @@ func (a *Advisor) Advise(e AWSEvent) ([]*LeastPrivilegePolicy, error) {
 	advisoryTemplates := a.AlertsMapping[key]
 	var advices []*LeastPrivilegePolicy
 
+	// fall back to the IAM action catalog if we don't have a hand-written advisory
+	if len(advisoryTemplates) == 0 {
+		advice, err := a.CreateAdviceFromCatalog(&e)
+		if err != nil {
+			return nil, err
+		}
+		if advice != nil {
+			advices = append(advices, advice)
+		}
+		return advices, nil
+	}
+
 	for _, advisoryTemplate := range advisoryTemplates {
 		advice, err := a.CreateAdviceFromEvent(&e, advisoryTemplate)
 		if err != nil {
@@ -0,0 +1,223 @@
+package recommendations
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/common-fate/iamzero/pkg/audit"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// RulePackVersion is the rule pack format version understood by this
+// version of IAM Zero.
+const RulePackVersion = 1
+
+// RulePack is a set of advisory templates loaded from a YAML or JSON file.
+// Rule packs allow additional coverage for service operations to be shipped
+// without recompiling IAM Zero.
+//
+// An example rule pack is:
+//
+//	version: 1
+//	rules:
+//	  sqs:SendMessage:
+//	    - comment: Allow sending messages to the queue
+//	      docLink: https://docs.aws.amazon.com/AWSSimpleQueueService/latest/SQSDeveloperGuide/sqs-basic-examples-of-sqs-policies.html
+//	      policy:
+//	        - action: ["sqs:SendMessage"]
+//	          resource: ["arn:aws:sqs:{{ .Region }}:{{ .Account }}:{{ .QueueName }}"]
+//	          condition:
+//	            StringEquals:
+//	              aws:RequestedRegion: ["{{ .Region }}"]
+type RulePack struct {
+	Version int                           `json:"version" yaml:"version"`
+	Rules   map[string][]AdvisoryTemplate `json:"rules" yaml:"rules"`
+}
+
+// ruleKeyRegex matches keys in the form `service:Operation`
+var ruleKeyRegex = regexp.MustCompile(`^[a-z0-9-]+:[A-Za-z0-9]+$`)
+
+// Validate checks that the rule pack is well-formed, returning an
+// error describing the first problem found.
+func (r *RulePack) Validate() error {
+	if r.Version != RulePackVersion {
+		return fmt.Errorf("unsupported rule pack version %d (expected %d)", r.Version, RulePackVersion)
+	}
+	if len(r.Rules) == 0 {
+		return errors.New("rule pack does not contain any rules")
+	}
+
+	keys := []string{}
+	for key := range r.Rules {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		templates := r.Rules[key]
+		if !ruleKeyRegex.MatchString(key) {
+			return fmt.Errorf("rule %q: key must be in the form service:Operation, for example s3:GetObject", key)
+		}
+		if len(templates) == 0 {
+			return fmt.Errorf("rule %q: at least one advisory template must be provided", key)
+		}
+		for i, t := range templates {
+			if err := t.Validate(); err != nil {
+				return errors.Wrapf(err, "rule %q: advisory %d", key, i)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks that an advisory template contains statements with
+// actions and resources, and that each resource and condition value
+// can be parsed as a template.
+func (t *AdvisoryTemplate) Validate() error {
+	if t.Comment == "" {
+		return errors.New("comment must be provided")
+	}
+	if len(t.Policy) == 0 {
+		return errors.New("policy must contain at least one statement")
+	}
+	for i, s := range t.Policy {
+		if len(s.Action) == 0 {
+			return fmt.Errorf("statement %d: action must contain at least one entry", i)
+		}
+		for _, a := range s.Action {
+			if !strings.Contains(a, ":") {
+				return fmt.Errorf("statement %d: action %q must be in the form service:Action", i, a)
+			}
+		}
+		if len(s.Resource) == 0 {
+			return fmt.Errorf("statement %d: resource must contain at least one entry", i)
+		}
+		for _, res := range s.Resource {
+			if _, err := template.New("policy").Parse(res); err != nil {
+				return errors.Wrapf(err, "statement %d: parsing resource template %q", i, res)
+			}
+		}
+		for operator, keys := range s.Condition {
+			if len(keys) == 0 {
+				return fmt.Errorf("statement %d: condition operator %q must contain at least one condition key", i, operator)
+			}
+			for key, values := range keys {
+				if !strings.Contains(key, ":") {
+					return fmt.Errorf("statement %d: condition key %q must be in the form prefix:key, for example aws:SourceVpce", i, key)
+				}
+				if len(values) == 0 {
+					return fmt.Errorf("statement %d: condition key %q must contain at least one value", i, key)
+				}
+				for _, v := range values {
+					if _, err := texttemplate.New("condition").Parse(v); err != nil {
+						return errors.Wrapf(err, "statement %d: parsing condition template %q", i, v)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ParseRulePack parses a rule pack from YAML or JSON, depending on the
+// file extension provided in `name`. Unknown fields are treated as errors
+// to catch typos in rule packs.
+func ParseRulePack(name string, data []byte) (*RulePack, error) {
+	var rp RulePack
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rp); err != nil {
+			return nil, errors.Wrapf(err, "parsing rule pack %s", name)
+		}
+	case ".yml", ".yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&rp); err != nil {
+			return nil, errors.Wrapf(err, "parsing rule pack %s", name)
+		}
+	default:
+		return nil, fmt.Errorf("rule pack %s must have a .json, .yml or .yaml extension", name)
+	}
+
+	if err := rp.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "validating rule pack %s", name)
+	}
+	return &rp, nil
+}
+
+// LoadRulePackDir loads and validates all rule packs in a directory.
+// Files are read in lexical order so that merging is deterministic.
+// Files which aren't JSON or YAML are ignored.
+func LoadRulePackDir(dir string) ([]RulePack, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading rule pack directory")
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+
+	packs := []RulePack{}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(f.Name()))
+		if ext != ".json" && ext != ".yml" && ext != ".yaml" {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading rule pack %s", path)
+		}
+		rp, err := ParseRulePack(path, data)
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, *rp)
+	}
+	return packs, nil
+}
+
+// AddRulePack merges the rules from a rule pack into the advisor.
+// Advisory templates for an operation that is already covered are
+// appended after the existing templates, so that the built-in
+// advisory remains selected by default.
+func (a *Advisor) AddRulePack(rp RulePack) {
+	if a.AlertsMapping == nil {
+		a.AlertsMapping = map[string][]AdvisoryTemplate{}
+	}
+	for key, templates := range rp.Rules {
+		a.AlertsMapping[key] = append(a.AlertsMapping[key], templates...)
+	}
+}
+
+// NewAdvisorWithRulePacks creates an advisor with the built-in advisory
+// templates, merged with the rule packs found in `dir`.
+// If `dir` is empty only the built-in templates are used.
+func NewAdvisorWithRulePacks(auditor *audit.Auditor, dir string) (*Advisor, error) {
+	advisor := NewAdvisor(auditor)
+	if dir == "" {
+		return advisor, nil
+	}
+	packs, err := LoadRulePackDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, rp := range packs {
+		advisor.AddRulePack(rp)
+	}
+	return advisor, nil
+}
@@ -0,0 +1,172 @@
+package recommendations
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const exampleYAMLRulePack = `
+version: 1
+rules:
+  sqs:SendMessage:
+    - comment: Allow sending messages to the queue
+      policy:
+        - action: ["sqs:SendMessage"]
+          resource: ["arn:aws:sqs:{{ .Region }}:{{ .Account }}:{{ .QueueName }}"]
+`
+
+const exampleJSONRulePack = `
+{
+	"version": 1,
+	"rules": {
+		"s3:PutObject": [
+			{
+				"comment": "Allow PutObject access to the specific key",
+				"policy": [
+					{
+						"action": ["s3:PutObject"],
+						"resource": ["arn:aws:s3:::{{ .Bucket }}/{{ .Key }}"]
+					}
+				]
+			}
+		]
+	}
+}
+`
+
+func TestParseRulePack_YAML(t *testing.T) {
+	rp, err := ParseRulePack("rules.yml", []byte(exampleYAMLRulePack))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]AdvisoryTemplate{
+		"sqs:SendMessage": {
+			{
+				Comment: "Allow sending messages to the queue",
+				Policy: []Statement{
+					{
+						Action:   []string{"sqs:SendMessage"},
+						Resource: []string{"arn:aws:sqs:{{ .Region }}:{{ .Account }}:{{ .QueueName }}"},
+					},
+				},
+			},
+		},
+	}
+	assert.Equal(t, expected, rp.Rules)
+}
+
+func TestParseRulePack_JSON(t *testing.T) {
+	rp, err := ParseRulePack("rules.json", []byte(exampleJSONRulePack))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, rp.Rules["s3:PutObject"], 1)
+}
+
+func TestParseRulePack_RejectsUnknownFields(t *testing.T) {
+	pack := `
+version: 1
+rules:
+  sqs:SendMessage:
+    - comment: Allow sending messages to the queue
+      polcy: []
+`
+	_, err := ParseRulePack("rules.yml", []byte(pack))
+	assert.Error(t, err)
+}
+
+func TestParseRulePack_RejectsInvalidKey(t *testing.T) {
+	pack := `
+version: 1
+rules:
+  SendMessage:
+    - comment: Allow sending messages to the queue
+      policy:
+        - action: ["sqs:SendMessage"]
+          resource: ["*"]
+`
+	_, err := ParseRulePack("rules.yml", []byte(pack))
+	assert.EqualError(t, err, `validating rule pack rules.yml: rule "SendMessage": key must be in the form service:Operation, for example s3:GetObject`)
+}
+
+func TestParseRulePack_RejectsInvalidTemplate(t *testing.T) {
+	pack := `
+version: 1
+rules:
+  sqs:SendMessage:
+    - comment: Allow sending messages to the queue
+      policy:
+        - action: ["sqs:SendMessage"]
+          resource: ["arn:aws:sqs:{{ .Region "]
+`
+	_, err := ParseRulePack("rules.yml", []byte(pack))
+	assert.Error(t, err)
+}
+
+func TestNewAdvisorWithRulePacks_MergesWithDefaults(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "a.yml"), []byte(exampleYAMLRulePack), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "b.json"), []byte(exampleJSONRulePack), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// files without a rule pack extension are ignored
+	err = ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("# rules"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	advisor, err := NewAdvisorWithRulePacks(nil, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, advisor.AlertsMapping["sqs:SendMessage"], 1)
+
+	// the built-in template should remain first, with the rule pack template appended
+	putObject := advisor.AlertsMapping["s3:PutObject"]
+	assert.Len(t, putObject, 2)
+	assert.Equal(t, "Allow PutObject access to the bucket", putObject[0].Comment)
+	assert.Equal(t, "Allow PutObject access to the specific key", putObject[1].Comment)
+}
+
+func TestParseRulePack_Condition(t *testing.T) {
+	pack := `
+version: 1
+rules:
+  s3:ListObjectsV2:
+    - comment: Allow listing objects under the prefix
+      policy:
+        - action: ["s3:ListBucket"]
+          resource: ["arn:aws:s3:::{{ .Bucket }}"]
+          condition:
+            StringLike:
+              s3:prefix: ["{{ .Prefix }}*"]
+`
+	rp, err := ParseRulePack("rules.yml", []byte(pack))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"{{ .Prefix }}*"}, rp.Rules["s3:ListObjectsV2"][0].Policy[0].Condition["StringLike"]["s3:prefix"])
+}
+
+func TestParseRulePack_RejectsInvalidConditionKey(t *testing.T) {
+	pack := `
+version: 1
+rules:
+  s3:ListObjectsV2:
+    - comment: Allow listing objects under the prefix
+      policy:
+        - action: ["s3:ListBucket"]
+          resource: ["arn:aws:s3:::{{ .Bucket }}"]
+          condition:
+            StringLike:
+              prefix: ["{{ .Prefix }}*"]
+`
+	_, err := ParseRulePack("rules.yml", []byte(pack))
+	assert.EqualError(t, err, `validating rule pack rules.yml: rule "s3:ListObjectsV2": advisory 0: statement 0: condition key "prefix" must be in the form prefix:key, for example aws:SourceVpce`)
+}
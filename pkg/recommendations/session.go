@@ -0,0 +1,41 @@
+package recommendations
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// SessionContext describes the session which made an API call. Many sessions
+// may assume the same role, so this tells us which workload or person used
+// the role's permissions.
+type SessionContext struct {
+	// ARN is the assumed role session ARN, e.g.
+	// arn:aws:sts::123456789012:assumed-role/my-role/my-session
+	ARN string `json:"arn,omitempty"`
+	// Name is the role session name
+	Name string `json:"name,omitempty"`
+	// SourceIdentity is set by the principal which assumed the role,
+	// and is usually the name of the person using the session
+	SourceIdentity   string `json:"sourceIdentity,omitempty"`
+	MFAAuthenticated bool   `json:"mfaAuthenticated,omitempty"`
+	SourceIP         string `json:"sourceIp,omitempty"`
+	UserAgent        string `json:"userAgent,omitempty"`
+}
+
+// Value implements the driver.Valuer interface required to serialize the object to Postgres
+func (s SessionContext) Value() (driver.Value, error) { return json.Marshal(&s) }
+
+// Scan implements the sql.Scanner interface required to deserialize the object from Postgres
+func (s *SessionContext) Scan(val interface{}) error {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, &s)
+	case string:
+		return json.Unmarshal([]byte(v), &s)
+	default:
+		return fmt.Errorf("Unsupported type: %T", v)
+	}
+}
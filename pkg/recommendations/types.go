@@ -6,6 +6,8 @@ import (
 	"fmt"
 
 	"github.com/common-fate/iamzero/pkg/audit"
+	"github.com/common-fate/iamzero/pkg/catalog"
+	"github.com/common-fate/iamzero/pkg/tags"
 
 	"github.com/mitchellh/hashstructure/v2"
 )
@@ -24,6 +26,9 @@ type AWSEvent struct {
 	Time     string      `json:"time" hash:"ignore"`
 	Data     AWSData     `json:"data"`
 	Identity AWSIdentity `json:"identity"`
+	// Tags describe where the event came from, such as the environment or service.
+	// They are set by the client, or added from the token or the AWS account.
+	Tags tags.Tags `json:"tags,omitempty" db:"tags"`
 }
 
 // HashEvent calculates a hash of the event so that we can deduplicate it.
@@ -63,10 +68,17 @@ type AWSIdentity struct {
 	User    string `json:"user"`
 	Role    string `json:"role"`
 	Account string `json:"account"`
+	// Session is the session which made the call, if it was made by an assumed role.
+	// It isn't hashed, so that identical calls made by different sessions
+	// are deduplicated.
+	Session *SessionContext `json:"session,omitempty" db:"session" hash:"ignore"`
 }
 type Advisor struct {
 	AlertsMapping map[string][]AdvisoryTemplate
 	auditor       *audit.Auditor
+	// catalog is used to generate advice for operations which
+	// aren't covered by AlertsMapping. If nil, no fallback advice is generated.
+	catalog *catalog.Catalog
 }
 
 type Description struct {
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestHashEvent_Works(t *testing.T) {
@@ -30,3 +31,26 @@ func TestHashEvent_Works(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestHashEvent_IgnoresSession(t *testing.T) {
+	e := AWSEvent{
+		ID: uuid.NewString(),
+		Identity: AWSIdentity{
+			Role:    "arn:aws:iam::123456789012:role/test-role",
+			Account: "123456789012",
+			Session: &SessionContext{Name: "first", SourceIP: "192.0.2.1"},
+		},
+		Data: AWSData{Type: "awsAction", Service: "s3", Operation: "HeadObject"},
+	}
+	first, err := HashEvent(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.Identity.Session = &SessionContext{Name: "second", UserAgent: "aws-cli/2.2.0"}
+	second, err := HashEvent(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, first, second)
+}
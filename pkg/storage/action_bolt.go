@@ -6,7 +6,7 @@ import (
 )
 
 type BoltActionStorage struct {
-	db *storm.DB
+	db storm.Node
 }
 
 func (a *BoltActionStorage) ListEnabledActionsForFinding(findingID string) ([]recommendations.AWSAction, error) {
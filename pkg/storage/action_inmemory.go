@@ -38,10 +38,14 @@ func (a *InMemoryActionStorage) Add(action recommendations.AWSAction) error {
 }
 
 func (a *InMemoryActionStorage) List() ([]recommendations.AWSAction, error) {
-	return a.actions, nil
+	a.RLock()
+	defer a.RUnlock()
+	return append([]recommendations.AWSAction{}, a.actions...), nil
 }
 
 func (a *InMemoryActionStorage) Get(id string) (*recommendations.AWSAction, error) {
+	a.RLock()
+	defer a.RUnlock()
 	for _, action := range a.actions {
 		if action.ID == id {
 			return &action, nil
@@ -52,6 +56,8 @@ func (a *InMemoryActionStorage) Get(id string) (*recommendations.AWSAction, erro
 
 // ListForPolicy lists all the actions that related to a given policy
 func (a *InMemoryActionStorage) ListForPolicy(findingID string) ([]recommendations.AWSAction, error) {
+	a.RLock()
+	defer a.RUnlock()
 	actions := []recommendations.AWSAction{}
 
 	for _, action := range a.actions {
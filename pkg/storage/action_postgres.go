@@ -9,7 +9,7 @@ import (
 )
 
 type PostgresActionStorage struct {
-	db *sqlx.DB
+	db postgresDB
 }
 
 func NewPostgresActionStorage(db *sqlx.DB) *PostgresActionStorage {
@@ -32,7 +32,7 @@ func (s *PostgresActionStorage) Get(id string) (*recommendations.AWSAction, erro
 	// @TODO add recommendations?
 
 	var a DBAction
-	err := s.db.Get(&a, `SELECT actions.id, finding_id, status, actions.time as "time", has_recommendations, enabled, events.id as "event.id", events.time as "event.time", events.identity_user as "event.identity.user", events.identity_role as "event.identity.role", events.identity_account as "event.identity.account", events.data as "eventData" FROM actions INNER JOIN events ON actions.event_id=events.id WHERE actions.id=$1 `, id)
+	err := s.db.Get(&a, `SELECT actions.id, finding_id, status, actions.time as "time", has_recommendations, enabled, missing_permission, events.id as "event.id", events.time as "event.time", events.identity_user as "event.identity.user", events.identity_role as "event.identity.role", events.identity_account as "event.identity.account", events.identity_session as "event.identity.session", events.data as "eventData", events.tags as "event.tags" FROM actions INNER JOIN events ON actions.event_id=events.id WHERE actions.id=$1 `, id)
 	if err != nil {
 		return nil, errors.Wrap(err, "postgres get action")
 	}
@@ -54,15 +54,15 @@ func (s *PostgresActionStorage) Add(a recommendations.AWSAction) error {
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	_, err = s.db.Query("INSERT INTO events (id, time, identity_user, identity_role, identity_account, data) VALUES ($1, $2, $3, $4, $5, $6)",
-		a.Event.ID, a.Event.Time, a.Event.Identity.User, a.Event.Identity.Role, a.Event.Identity.Account, data,
+	_, err = s.db.Exec("INSERT INTO events (id, time, identity_user, identity_role, identity_account, identity_session, data, tags) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		a.Event.ID, a.Event.Time, a.Event.Identity.User, a.Event.Identity.Role, a.Event.Identity.Account, a.Event.Identity.Session, data, a.Event.Tags,
 	)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	_, err = s.db.Query("INSERT INTO actions (id, finding_id, event_id, status, time, has_recommendations, enabled) VALUES ($1, $2, $3, $4, $5, $6, $7)",
-		a.ID, a.FindingID, a.Event.ID, a.Status, a.Time, a.HasRecommendations, a.Enabled,
+	_, err = s.db.Exec("INSERT INTO actions (id, finding_id, event_id, status, time, has_recommendations, enabled, missing_permission) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		a.ID, a.FindingID, a.Event.ID, a.Status, a.Time, a.HasRecommendations, a.Enabled, a.MissingPermission,
 	)
 	return errors.WithStack(err)
 }
@@ -70,7 +70,7 @@ func (s *PostgresActionStorage) Add(a recommendations.AWSAction) error {
 func (s *PostgresActionStorage) ListForPolicy(findingID string) ([]recommendations.AWSAction, error) {
 	actions := []DBAction{}
 
-	err := s.db.Select(&actions, `SELECT actions.id, finding_id, status, actions.time as "time", has_recommendations, enabled, events.id as "event.id", events.time as "event.time", events.identity_user as "event.identity.user", events.identity_role as "event.identity.role", events.identity_account as "event.identity.account", events.data as "eventData" FROM actions INNER JOIN events ON actions.event_id=events.id  WHERE finding_id=$1`, findingID)
+	err := s.db.Select(&actions, `SELECT actions.id, finding_id, status, actions.time as "time", has_recommendations, enabled, missing_permission, events.id as "event.id", events.time as "event.time", events.identity_user as "event.identity.user", events.identity_role as "event.identity.role", events.identity_account as "event.identity.account", events.identity_session as "event.identity.session", events.data as "eventData", events.tags as "event.tags" FROM actions INNER JOIN events ON actions.event_id=events.id  WHERE finding_id=$1`, findingID)
 
 	if err != nil {
 		return nil, errors.Wrap(err, "postgres list actions")
@@ -90,7 +90,7 @@ func (s *PostgresActionStorage) ListForPolicy(findingID string) ([]recommendatio
 func (s *PostgresActionStorage) ListEnabledActionsForFinding(findingID string) ([]recommendations.AWSAction, error) {
 	actions := []DBAction{}
 
-	err := s.db.Select(&actions, `SELECT actions.id, finding_id, status, actions.time as "time", has_recommendations, enabled, events.id as "event.id", events.time as "event.time", events.identity_user as "event.identity.user", events.identity_role as "event.identity.role", events.identity_account as "event.identity.account", events.data as "eventData" FROM actions INNER JOIN events ON actions.event_id=events.id  WHERE finding_id=$1 AND enabled = true`, findingID)
+	err := s.db.Select(&actions, `SELECT actions.id, finding_id, status, actions.time as "time", has_recommendations, enabled, missing_permission, events.id as "event.id", events.time as "event.time", events.identity_user as "event.identity.user", events.identity_role as "event.identity.role", events.identity_account as "event.identity.account", events.identity_session as "event.identity.session", events.data as "eventData", events.tags as "event.tags" FROM actions INNER JOIN events ON actions.event_id=events.id  WHERE finding_id=$1 AND enabled = true`, findingID)
 
 	if err != nil {
 		return nil, errors.Wrap(err, "postgres list actions")
@@ -107,7 +107,7 @@ func (s *PostgresActionStorage) ListEnabledActionsForFinding(findingID string) (
 	return acts, err
 }
 func (s *PostgresActionStorage) SetStatus(id string, status string) error {
-	_, err := s.db.Query("UPDATE actions SET status = $1 WHERE id = $2", status, id)
+	_, err := s.db.Exec("UPDATE actions SET status = $1 WHERE id = $2", status, id)
 	if err != nil {
 		return errors.Wrap(err, "postgres set status actions")
 	}
@@ -115,7 +115,7 @@ func (s *PostgresActionStorage) SetStatus(id string, status string) error {
 }
 
 func (s *PostgresActionStorage) Update(action recommendations.AWSAction) error {
-	_, err := s.db.Query("UPDATE actions SET finding_id=$2, status=$3, time=$4, has_recommendations=$5, enabled=$6 WHERE id = $1", action.ID, action.FindingID, action.Status, action.Time, action.HasRecommendations, action.Enabled)
+	_, err := s.db.Exec("UPDATE actions SET finding_id=$2, status=$3, time=$4, has_recommendations=$5, enabled=$6, missing_permission=$7 WHERE id = $1", action.ID, action.FindingID, action.Status, action.Time, action.HasRecommendations, action.Enabled, action.MissingPermission)
 	if err != nil {
 		return errors.Wrap(err, "postgres update actions")
 	}
@@ -124,7 +124,7 @@ func (s *PostgresActionStorage) Update(action recommendations.AWSAction) error {
 	if err != nil {
 		return errors.Wrap(err, "postgres update actions, updating event")
 	}
-	_, err = s.db.Query("UPDATE events SET time=$2, identity_user=$3, identity_role=$4, identity_account=$5, data=$6  WHERE id = $1", action.Event.ID, action.Event.Time, action.Event.Identity.User, action.Event.Identity.Role, action.Event.Identity.Account, data)
+	_, err = s.db.Exec("UPDATE events SET time=$2, identity_user=$3, identity_role=$4, identity_account=$5, identity_session=$6, data=$7, tags=$8  WHERE id = $1", action.Event.ID, action.Event.Time, action.Event.Identity.User, action.Event.Identity.Role, action.Event.Identity.Account, action.Event.Identity.Session, data, action.Event.Tags)
 	if err != nil {
 		return errors.Wrap(err, "postgres update actions, updating event")
 	}
@@ -36,6 +36,14 @@ func OpenBoltDB() (*storm.DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = db.Init(StoredEvent{})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Init(QueuedEvent{})
+	if err != nil {
+		return nil, err
+	}
 
 	return db, nil
 }
@@ -1,9 +1,106 @@
 package storage
 
-import "github.com/common-fate/iamzero/pkg/recommendations"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/common-fate/iamzero/pkg/recommendations"
+)
 
 type EventStorage interface {
 	ListForFinding(findingID string) ([]recommendations.AWSEvent, error)
 	Get(id string) (*recommendations.AWSEvent, error)
 	Create(recommendations.AWSEvent) error
+	// GetByHash returns the most recently seen event with the content hash,
+	// or nil if no event with the hash has been stored
+	GetByHash(hash string) (*StoredEvent, error)
+	// GetForAction returns the event which created an action, or nil if
+	// the action was created before events were deduplicated
+	GetForAction(actionID string) (*StoredEvent, error)
+	ListStoredForFinding(findingID string) ([]StoredEvent, error)
+	// Save creates or updates a stored event
+	Save(e StoredEvent) error
+}
+
+// StoredEvent is an event which created an action. Identical events, which
+// have the same hash, are counted against the stored event rather than
+// creating another action.
+type StoredEvent struct {
+	// ID is the ID of the event which was first seen
+	ID string `json:"id" db:"id"`
+	// Hash is the content hash of the event, from recommendations.HashEvent
+	Hash      string                   `json:"hash" db:"hash" storm:"index"`
+	ActionID  string                   `json:"actionId" db:"action_id" storm:"index"`
+	FindingID string                   `json:"findingId" db:"finding_id" storm:"index"`
+	Event     recommendations.AWSEvent `json:"event" db:"event"`
+	FirstSeen time.Time                `json:"firstSeen" db:"first_seen"`
+	LastSeen  time.Time                `json:"lastSeen" db:"last_seen"`
+	// Count is the number of times the event has been seen
+	Count int `json:"count" db:"count"`
+	// Sessions are the most recent sessions which made the call
+	Sessions EventSessions `json:"sessions" db:"sessions"`
+}
+
+// MaxEventSessions is the number of sessions recorded for each stored event.
+// Sessions are often short-lived, so only the most recently seen are kept.
+const MaxEventSessions = 20
+
+// EventSession is a session which made a call, and how often it made it
+type EventSession struct {
+	Session   recommendations.SessionContext `json:"session"`
+	Count     int                            `json:"count"`
+	FirstSeen time.Time                      `json:"firstSeen"`
+	LastSeen  time.Time                      `json:"lastSeen"`
+}
+
+type EventSessions []EventSession
+
+// Value implements the driver.Valuer interface required to serialize the object to Postgres
+func (s EventSessions) Value() (driver.Value, error) {
+	if s == nil {
+		s = EventSessions{}
+	}
+	return json.Marshal(s)
+}
+
+// Scan implements the sql.Scanner interface required to deserialize the object from Postgres
+func (s *EventSessions) Scan(val interface{}) error {
+	switch v := val.(type) {
+	case []byte:
+		return json.Unmarshal(v, &s)
+	case string:
+		return json.Unmarshal([]byte(v), &s)
+	default:
+		return fmt.Errorf("Unsupported type: %T", v)
+	}
+}
+
+// RecordSession counts a call made by the session. Calls which weren't made
+// by an assumed role session aren't recorded.
+func (e *StoredEvent) RecordSession(session *recommendations.SessionContext, at time.Time) {
+	if session == nil {
+		return
+	}
+	for i := range e.Sessions {
+		if e.Sessions[i].Session == *session {
+			e.Sessions[i].Count++
+			e.Sessions[i].LastSeen = at
+			return
+		}
+	}
+	e.Sessions = append(e.Sessions, EventSession{
+		Session:   *session,
+		Count:     1,
+		FirstSeen: at,
+		LastSeen:  at,
+	})
+	if len(e.Sessions) > MaxEventSessions {
+		sort.SliceStable(e.Sessions, func(i, j int) bool {
+			return e.Sessions[i].LastSeen.After(e.Sessions[j].LastSeen)
+		})
+		e.Sessions = e.Sessions[:MaxEventSessions]
+	}
 }
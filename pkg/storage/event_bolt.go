@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/common-fate/iamzero/pkg/recommendations"
+	"github.com/pkg/errors"
+)
+
+type BoltEventStorage struct {
+	db storm.Node
+}
+
+func NewBoltEventStorage(db *storm.DB) *BoltEventStorage {
+	return &BoltEventStorage{db: db}
+}
+
+func (s *BoltEventStorage) ListForFinding(findingID string) ([]recommendations.AWSEvent, error) {
+	stored, err := s.ListStoredForFinding(findingID)
+	if err != nil {
+		return nil, err
+	}
+	events := []recommendations.AWSEvent{}
+	for _, e := range stored {
+		events = append(events, e.Event)
+	}
+	return events, nil
+}
+
+func (s *BoltEventStorage) Get(id string) (*recommendations.AWSEvent, error) {
+	var e StoredEvent
+	err := s.db.One("ID", id, &e)
+	if err == storm.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "boltdb get event")
+	}
+	return &e.Event, nil
+}
+
+func (s *BoltEventStorage) Create(e recommendations.AWSEvent) error {
+	now := time.Now()
+	return s.Save(StoredEvent{ID: e.ID, Event: e, FirstSeen: now, LastSeen: now, Count: 1})
+}
+
+// findOne returns the most recently seen event matching the field, or nil if there isn't one.
+// The field must be indexed, so that only the matching events are read.
+func (s *BoltEventStorage) findOne(field string, value string) (*StoredEvent, error) {
+	var events []StoredEvent
+	err := s.db.Find(field, value, &events)
+	if err == storm.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "boltdb find event")
+	}
+	latest := events[0]
+	for _, e := range events[1:] {
+		if e.LastSeen.After(latest.LastSeen) {
+			latest = e
+		}
+	}
+	return &latest, nil
+}
+
+func (s *BoltEventStorage) GetByHash(hash string) (*StoredEvent, error) {
+	return s.findOne("Hash", hash)
+}
+
+func (s *BoltEventStorage) GetForAction(actionID string) (*StoredEvent, error) {
+	return s.findOne("ActionID", actionID)
+}
+
+func (s *BoltEventStorage) ListStoredForFinding(findingID string) ([]StoredEvent, error) {
+	events := []StoredEvent{}
+	err := s.db.Find("FindingID", findingID, &events)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, errors.Wrap(err, "boltdb list events")
+	}
+	return events, nil
+}
+
+func (s *BoltEventStorage) Save(e StoredEvent) error {
+	return s.db.Save(&e)
+}
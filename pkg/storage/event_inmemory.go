@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/common-fate/iamzero/pkg/recommendations"
+)
+
+type InMemoryEventStorage struct {
+	sync.RWMutex
+	events []StoredEvent
+}
+
+func NewInMemoryEventStorage() *InMemoryEventStorage {
+	return &InMemoryEventStorage{events: []StoredEvent{}}
+}
+
+func (s *InMemoryEventStorage) ListForFinding(findingID string) ([]recommendations.AWSEvent, error) {
+	stored, err := s.ListStoredForFinding(findingID)
+	if err != nil {
+		return nil, err
+	}
+	events := []recommendations.AWSEvent{}
+	for _, e := range stored {
+		events = append(events, e.Event)
+	}
+	return events, nil
+}
+
+func (s *InMemoryEventStorage) Get(id string) (*recommendations.AWSEvent, error) {
+	s.RLock()
+	defer s.RUnlock()
+	for _, e := range s.events {
+		if e.ID == id {
+			return &e.Event, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *InMemoryEventStorage) Create(e recommendations.AWSEvent) error {
+	now := time.Now()
+	return s.Save(StoredEvent{ID: e.ID, Event: e, FirstSeen: now, LastSeen: now, Count: 1})
+}
+
+func (s *InMemoryEventStorage) GetByHash(hash string) (*StoredEvent, error) {
+	s.RLock()
+	defer s.RUnlock()
+	var latest *StoredEvent
+	for i, e := range s.events {
+		if e.Hash == hash && (latest == nil || e.LastSeen.After(latest.LastSeen)) {
+			latest = &s.events[i]
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+	e := latest.copy()
+	return &e, nil
+}
+
+func (s *InMemoryEventStorage) GetForAction(actionID string) (*StoredEvent, error) {
+	s.RLock()
+	defer s.RUnlock()
+	for _, e := range s.events {
+		if e.ActionID == actionID {
+			e = e.copy()
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *InMemoryEventStorage) ListStoredForFinding(findingID string) ([]StoredEvent, error) {
+	s.RLock()
+	defer s.RUnlock()
+	events := []StoredEvent{}
+	for _, e := range s.events {
+		if e.FindingID == findingID {
+			events = append(events, e.copy())
+		}
+	}
+	return events, nil
+}
+
+func (s *InMemoryEventStorage) Save(e StoredEvent) error {
+	s.Lock()
+	defer s.Unlock()
+	e = e.copy()
+	for i, existing := range s.events {
+		if existing.ID == e.ID {
+			s.events[i] = e
+			return nil
+		}
+	}
+	s.events = append(s.events, e)
+	return nil
+}
+
+// copy returns a copy of the event which doesn't share its sessions with
+// the original, so that stored events aren't modified by callers
+func (e StoredEvent) copy() StoredEvent {
+	if e.Sessions != nil {
+		e.Sessions = append(EventSessions{}, e.Sessions...)
+	}
+	return e
+}
@@ -1,13 +1,15 @@
 package storage
 
 import (
+	"database/sql"
+
 	"github.com/common-fate/iamzero/pkg/recommendations"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 )
 
 type PostgresEventStorage struct {
-	db *sqlx.DB
+	db postgresDB
 }
 
 func NewPostgresEventStorage(db *sqlx.DB) *PostgresEventStorage {
@@ -17,7 +19,7 @@ func NewPostgresEventStorage(db *sqlx.DB) *PostgresEventStorage {
 func (s *PostgresEventStorage) ListForFinding(findingID string) ([]recommendations.AWSEvent, error) {
 	e := []recommendations.AWSEvent{}
 
-	err := s.db.Select(&e, `SELECT events.id, identity_user as "identity.user", identity_role as "identity.role", identity_account as "identity.account", events.time, data FROM events INNER JOIN actions ON actions.event_id = events.id WHERE actions.finding_id=$1`, findingID)
+	err := s.db.Select(&e, `SELECT events.id, identity_user as "identity.user", identity_role as "identity.role", identity_account as "identity.account", identity_session as "identity.session", events.time, data, events.tags FROM events INNER JOIN actions ON actions.event_id = events.id WHERE actions.finding_id=$1`, findingID)
 
 	if err != nil {
 		return nil, errors.Wrap(err, "postgres list events")
@@ -27,8 +29,8 @@ func (s *PostgresEventStorage) ListForFinding(findingID string) ([]recommendatio
 }
 
 func (s *PostgresEventStorage) Create(e recommendations.AWSEvent) error {
-	_, err := s.db.Query("INSERT INTO events (id, time, identity_user, identity_role, identity_account, data) VALUES ($1, $2, $3, $4, $5, $6)",
-		e.ID, e.Time, e.Identity.User, e.Identity.Role, e.Identity.Account, e.Data,
+	_, err := s.db.Exec("INSERT INTO events (id, time, identity_user, identity_role, identity_account, identity_session, data, tags) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		e.ID, e.Time, e.Identity.User, e.Identity.Role, e.Identity.Account, e.Identity.Session, e.Data, e.Tags,
 	)
 	return err
 }
@@ -36,7 +38,7 @@ func (s *PostgresEventStorage) Create(e recommendations.AWSEvent) error {
 func (s *PostgresEventStorage) Get(id string) (*recommendations.AWSEvent, error) {
 	var e recommendations.AWSEvent
 
-	err := s.db.Get(&e, `SELECT events.id, identity_user as "identity.user", identity_role as "identity.role", identity_account as "identity.account", events.time, data FROM events WHERE id=$1`, id)
+	err := s.db.Get(&e, `SELECT events.id, identity_user as "identity.user", identity_role as "identity.role", identity_account as "identity.account", identity_session as "identity.session", events.time, data, events.tags FROM events WHERE id=$1`, id)
 
 	if err != nil {
 		return nil, errors.Wrap(err, "postgres get event")
@@ -44,3 +46,46 @@ func (s *PostgresEventStorage) Get(id string) (*recommendations.AWSEvent, error)
 
 	return &e, err
 }
+
+// storedEventQuery selects stored events along with the action they created
+const storedEventQuery = `SELECT events.id, events.hash, actions.id as action_id, actions.finding_id, events.id as "event.id", events.time as "event.time", identity_user as "event.identity.user", identity_role as "event.identity.role", identity_account as "event.identity.account", identity_session as "event.identity.session", data as "event.data", events.tags as "event.tags", first_seen, last_seen, occurrences as count, sessions FROM events INNER JOIN actions ON actions.event_id = events.id`
+
+// getStoredEvent returns the first stored event matching the query, or nil if there isn't one
+func (s *PostgresEventStorage) getStoredEvent(query string, args ...interface{}) (*StoredEvent, error) {
+	var e StoredEvent
+	err := s.db.Get(&e, query, args...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "postgres get stored event")
+	}
+	return &e, nil
+}
+
+func (s *PostgresEventStorage) GetByHash(hash string) (*StoredEvent, error) {
+	return s.getStoredEvent(storedEventQuery+` WHERE events.hash=$1 ORDER BY last_seen DESC LIMIT 1`, hash)
+}
+
+func (s *PostgresEventStorage) GetForAction(actionID string) (*StoredEvent, error) {
+	return s.getStoredEvent(storedEventQuery+` WHERE actions.id=$1`, actionID)
+}
+
+func (s *PostgresEventStorage) ListStoredForFinding(findingID string) ([]StoredEvent, error) {
+	e := []StoredEvent{}
+	err := s.db.Select(&e, storedEventQuery+` WHERE actions.finding_id=$1`, findingID)
+	if err != nil {
+		return nil, errors.Wrap(err, "postgres list stored events")
+	}
+	return e, nil
+}
+
+// Save creates or updates the event. The action and finding of the event
+// are recorded on the action, rather than the event.
+func (s *PostgresEventStorage) Save(e StoredEvent) error {
+	_, err := s.db.Exec(`INSERT INTO events (id, time, identity_user, identity_role, identity_account, identity_session, data, tags, hash, first_seen, last_seen, occurrences, sessions) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+ON CONFLICT (id) DO UPDATE SET hash = $9, first_seen = $10, last_seen = $11, occurrences = $12, sessions = $13`,
+		e.ID, e.Event.Time, e.Event.Identity.User, e.Event.Identity.Role, e.Event.Identity.Account, e.Event.Identity.Session, e.Event.Data, e.Event.Tags, e.Hash, e.FirstSeen, e.LastSeen, e.Count, e.Sessions,
+	)
+	return errors.Wrap(err, "postgres save event")
+}
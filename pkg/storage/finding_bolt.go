@@ -8,7 +8,7 @@ import (
 )
 
 type BoltFindingStorage struct {
-	db *storm.DB
+	db storm.Node
 }
 
 func NewBoltFindingStorage(db *storm.DB) *BoltFindingStorage {
@@ -47,7 +47,7 @@ func (s *BoltFindingStorage) Get(id string) (*recommendations.Finding, error) {
 	return &p, err
 }
 
-// FindByRole finds a matching finding by its role
+// FindByRole finds a matching finding by its role and tags
 func (s *BoltFindingStorage) FindByRole(query FindByRoleQuery) (*recommendations.Finding, error) {
 	policies := []recommendations.Finding{}
 
@@ -57,7 +57,7 @@ func (s *BoltFindingStorage) FindByRole(query FindByRoleQuery) (*recommendations
 	}
 
 	for _, finding := range policies {
-		if finding.Identity.Role == query.Role && finding.Status == query.Status {
+		if query.matches(finding) {
 			return &finding, nil
 		}
 	}
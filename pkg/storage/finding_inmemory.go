@@ -4,6 +4,7 @@ import (
 	"sync"
 
 	"github.com/common-fate/iamzero/pkg/recommendations"
+	"github.com/common-fate/iamzero/pkg/tags"
 	"github.com/common-fate/iamzero/pkg/tokens"
 )
 
@@ -17,10 +18,14 @@ func NewInMemoryFindingStorage() *InMemoryFindingStorage {
 }
 
 func (s *InMemoryFindingStorage) List() ([]recommendations.Finding, error) {
-	return s.findings, nil
+	s.RLock()
+	defer s.RUnlock()
+	return append([]recommendations.Finding{}, s.findings...), nil
 }
 
 func (s *InMemoryFindingStorage) ListForStatus(status string) ([]recommendations.Finding, error) {
+	s.RLock()
+	defer s.RUnlock()
 	findings := []recommendations.Finding{}
 	for _, f := range s.findings {
 		if f.Status == status {
@@ -31,6 +36,8 @@ func (s *InMemoryFindingStorage) ListForStatus(status string) ([]recommendations
 }
 
 func (s *InMemoryFindingStorage) Get(id string) (*recommendations.Finding, error) {
+	s.RLock()
+	defer s.RUnlock()
 	for _, finding := range s.findings {
 		if finding.ID == id {
 			return &finding, nil
@@ -48,12 +55,21 @@ type FindFindingQuery struct {
 type FindByRoleQuery struct {
 	Role   string
 	Status string
+	// Tags must match the tags which the finding is keyed by exactly
+	Tags tags.Tags
 }
 
-// FindByRole finds a matching finding by its role
+// matches returns true if the finding is the one for the query
+func (q FindByRoleQuery) matches(f recommendations.Finding) bool {
+	return f.Identity.Role == q.Role && f.Status == q.Status && f.Tags.Equal(q.Tags)
+}
+
+// FindByRole finds a matching finding by its role and tags
 func (s *InMemoryFindingStorage) FindByRole(q FindByRoleQuery) (*recommendations.Finding, error) {
+	s.RLock()
+	defer s.RUnlock()
 	for _, finding := range s.findings {
-		if finding.Identity.Role == q.Role && finding.Status == q.Status {
+		if q.matches(finding) {
 			return &finding, nil
 		}
 	}
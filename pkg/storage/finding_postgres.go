@@ -7,7 +7,7 @@ import (
 )
 
 type PostgresFindingStorage struct {
-	db *sqlx.DB
+	db postgresDB
 }
 
 func NewPostgresFindingStorage(db *sqlx.DB) *PostgresFindingStorage {
@@ -29,7 +29,7 @@ func (s *PostgresFindingStorage) List() ([]recommendations.Finding, error) {
 func (s *PostgresFindingStorage) ListForStatus(status string) ([]recommendations.Finding, error) {
 	f := []recommendations.Finding{}
 
-	err := s.db.Select(&f, `SELECT id, identity_user as "identity.user", identity_role as "identity.role", identity_account as "identity.account", updated_at, event_count, status, document FROM findings WHERE status=$1`, status)
+	err := s.db.Select(&f, `SELECT id, identity_user as "identity.user", identity_role as "identity.role", identity_account as "identity.account", identity_iac_source as "identity.iac_source", updated_at, event_count, status, document, tags FROM findings WHERE status=$1`, status)
 	if err != nil {
 		return nil, errors.Wrap(err, "postgres list findings for status")
 	}
@@ -40,7 +40,7 @@ func (s *PostgresFindingStorage) ListForStatus(status string) ([]recommendations
 func (s *PostgresFindingStorage) Get(id string) (*recommendations.Finding, error) {
 	var f recommendations.Finding
 
-	err := s.db.Get(&f, `SELECT id, identity_user as "identity.user", identity_role as "identity.role", identity_account as "identity.account", updated_at, event_count, status, document FROM findings WHERE id=$1`, id)
+	err := s.db.Get(&f, `SELECT id, identity_user as "identity.user", identity_role as "identity.role", identity_account as "identity.account", identity_iac_source as "identity.iac_source", updated_at, event_count, status, document, tags FROM findings WHERE id=$1`, id)
 	if err != nil {
 		return nil, errors.Wrap(err, "postgres get finding")
 	}
@@ -48,18 +48,19 @@ func (s *PostgresFindingStorage) Get(id string) (*recommendations.Finding, error
 	return &f, nil
 }
 
-// FindByRole finds a matching finding by its role
+// FindByRole finds a matching finding by its role and tags
 func (s *PostgresFindingStorage) FindByRole(query FindByRoleQuery) (*recommendations.Finding, error) {
 	var f recommendations.Finding
 
-	err := s.db.Get(&f, `SELECT id, identity_user as "identity.user", identity_role as "identity.role", identity_account as "identity.account", updated_at, event_count, status, document FROM findings WHERE identity_role=$1 AND status=$2`, query.Role, query.Status)
+	err := s.db.Get(&f, `SELECT id, identity_user as "identity.user", identity_role as "identity.role", identity_account as "identity.account", identity_iac_source as "identity.iac_source", updated_at, event_count, status, document, tags FROM findings WHERE identity_role=$1 AND status=$2 AND tags=$3`, query.Role, query.Status, query.Tags)
 
 	return &f, err
 }
 
 func (s *PostgresFindingStorage) CreateOrUpdate(f recommendations.Finding) error {
-	_, err := s.db.Query("INSERT INTO findings (id, identity_user, identity_role, identity_account, updated_at, event_count, status, document) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
-		f.ID, f.Identity.User, f.Identity.Role, f.Identity.Account, f.UpdatedAt, f.EventCount, f.Status, f.Document,
+	_, err := s.db.Exec(`INSERT INTO findings (id, identity_user, identity_role, identity_account, identity_iac_source, updated_at, event_count, status, document, tags) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+ON CONFLICT (id) DO UPDATE SET identity_user = $2, identity_role = $3, identity_account = $4, identity_iac_source = $5, updated_at = $6, event_count = $7, status = $8, document = $9, tags = $10`,
+		f.ID, f.Identity.User, f.Identity.Role, f.Identity.Account, f.Identity.IaCSource, f.UpdatedAt, f.EventCount, f.Status, f.Document, f.Tags,
 	)
 	return err
 }
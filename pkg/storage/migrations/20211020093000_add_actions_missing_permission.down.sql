@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS actions DROP COLUMN IF EXISTS missing_permission;
@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS actions ADD COLUMN IF NOT EXISTS missing_permission JSONB;
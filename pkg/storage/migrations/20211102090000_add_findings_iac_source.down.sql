@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS findings DROP COLUMN IF EXISTS identity_iac_source;
@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS findings ADD COLUMN IF NOT EXISTS identity_iac_source JSONB;
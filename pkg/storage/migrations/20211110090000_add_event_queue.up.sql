@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS event_queue (
+	id UUID PRIMARY KEY,
+	token_id varchar(1024) NOT NULL,
+	event JSONB NOT NULL,
+	status varchar(20) NOT NULL,
+	attempts integer NOT NULL,
+	last_error text NOT NULL,
+	action_id varchar(36) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	available_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS event_queue_status_available_at ON event_queue (status, available_at);
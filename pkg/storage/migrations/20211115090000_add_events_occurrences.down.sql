@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS events_hash;
+ALTER TABLE IF EXISTS events DROP COLUMN IF EXISTS occurrences;
+ALTER TABLE IF EXISTS events DROP COLUMN IF EXISTS last_seen;
+ALTER TABLE IF EXISTS events DROP COLUMN IF EXISTS first_seen;
+ALTER TABLE IF EXISTS events DROP COLUMN IF EXISTS hash;
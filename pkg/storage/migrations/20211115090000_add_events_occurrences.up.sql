@@ -0,0 +1,13 @@
+ALTER TABLE IF EXISTS events ADD COLUMN IF NOT EXISTS hash varchar(20) NOT NULL DEFAULT '';
+ALTER TABLE IF EXISTS events ADD COLUMN IF NOT EXISTS first_seen TIMESTAMPTZ;
+ALTER TABLE IF EXISTS events ADD COLUMN IF NOT EXISTS last_seen TIMESTAMPTZ;
+ALTER TABLE IF EXISTS events ADD COLUMN IF NOT EXISTS occurrences integer NOT NULL DEFAULT 1;
+
+UPDATE events SET first_seen = time, last_seen = time WHERE first_seen IS NULL;
+
+ALTER TABLE IF EXISTS events ALTER COLUMN first_seen SET NOT NULL;
+ALTER TABLE IF EXISTS events ALTER COLUMN first_seen SET DEFAULT now();
+ALTER TABLE IF EXISTS events ALTER COLUMN last_seen SET NOT NULL;
+ALTER TABLE IF EXISTS events ALTER COLUMN last_seen SET DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS events_hash ON events (hash);
@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS events DROP COLUMN IF EXISTS sessions;
+ALTER TABLE IF EXISTS events DROP COLUMN IF EXISTS identity_session;
@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS events ADD COLUMN IF NOT EXISTS identity_session JSONB;
+ALTER TABLE IF EXISTS events ADD COLUMN IF NOT EXISTS sessions JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS tokens DROP COLUMN IF EXISTS tags;
+ALTER TABLE IF EXISTS findings DROP COLUMN IF EXISTS tags;
+ALTER TABLE IF EXISTS events DROP COLUMN IF EXISTS tags;
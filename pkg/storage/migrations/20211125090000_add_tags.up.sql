@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS events ADD COLUMN IF NOT EXISTS tags JSONB;
+ALTER TABLE IF EXISTS findings ADD COLUMN IF NOT EXISTS tags JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE IF EXISTS tokens ADD COLUMN IF NOT EXISTS tags JSONB;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS event_queue_status_updated_at;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS event_queue_status_updated_at ON event_queue (status, updated_at);
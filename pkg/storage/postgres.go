@@ -14,6 +14,14 @@ import (
 	"go.uber.org/zap"
 )
 
+// postgresDB is implemented by both *sqlx.DB and *sqlx.Tx, so that the
+// Postgres storage can be used inside a transaction
+type postgresDB interface {
+	sqlx.Execer
+	Get(dest interface{}, query string, args ...interface{}) error
+	Select(dest interface{}, query string, args ...interface{}) error
+}
+
 // PostgresStorage holds config for connecting to Postgres.
 // It has an AddFlags method so it can be configured in the
 // same way as other modules in the application.
@@ -10,6 +10,7 @@ import (
 	"github.com/common-fate/iamzero/pkg/policies"
 	"github.com/common-fate/iamzero/pkg/recommendations"
 	"github.com/common-fate/iamzero/pkg/storage"
+	"github.com/common-fate/iamzero/pkg/tags"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 )
@@ -31,8 +32,8 @@ func mockFinding() recommendations.Finding {
 				{
 					Sid:      "1",
 					Effect:   "Allow",
-					Action:   []string{"sts:AssumeRole"},
-					Resource: []string{"arn:aws:iam::111222333444:role/target"},
+					Action:   policies.NewStringValues("sts:AssumeRole"),
+					Resource: policies.NewStringValues("arn:aws:iam::111222333444:role/target"),
 				},
 			},
 		},
@@ -158,3 +159,46 @@ func Test_FindByRoleNotFound(t *testing.T) {
 	})
 	assert.ErrorIs(t, err, sql.ErrNoRows)
 }
+
+func Test_FindByRoleWithTags(t *testing.T) {
+	db, err := GetDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Query("DELETE FROM actions")
+	db.Query("DELETE FROM events")
+	db.Query("DELETE FROM findings")
+
+	s := storage.NewPostgresFindingStorage(db)
+
+	prod := mockFinding()
+	prod.Tags = tags.Tags{"env": "prod", "service": "api"}
+	dev := mockFinding()
+	dev.Tags = tags.Tags{"env": "dev", "service": "api"}
+
+	for _, f := range []recommendations.Finding{prod, dev} {
+		err = s.CreateOrUpdate(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	actual, err := s.FindByRole(storage.FindByRoleQuery{
+		Role:   dev.Identity.Role,
+		Status: dev.Status,
+		Tags:   tags.Tags{"service": "api", "env": "dev"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, dev.ID, actual.ID)
+	assert.Equal(t, dev.Tags, actual.Tags)
+
+	// the tags must match exactly
+	_, err = s.FindByRole(storage.FindByRoleQuery{
+		Role:   dev.Identity.Role,
+		Status: dev.Status,
+		Tags:   tags.Tags{"env": "dev"},
+	})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -0,0 +1,44 @@
+// +build postgres
+
+package postgresintegrationtests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/common-fate/iamzero/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PurgeCompletedQueuedEvents(t *testing.T) {
+	db, err := GetDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := storage.NewPostgresEventQueueStorage(db)
+
+	now := time.Now()
+	queued := func(status storage.QueuedEventStatus, updatedAt time.Time) storage.QueuedEvent {
+		return storage.QueuedEvent{ID: uuid.NewString(), TokenID: "token", Status: status, CreatedAt: updatedAt, UpdatedAt: updatedAt, AvailableAt: updatedAt}
+	}
+	old := queued(storage.QueuedEventDone, now.Add(-2*time.Hour))
+	recent := queued(storage.QueuedEventDone, now.Add(-time.Minute))
+	dead := queued(storage.QueuedEventDeadLetter, now.Add(-2*time.Hour))
+	err = s.Enqueue([]storage.QueuedEvent{old, recent, dead})
+	assert.NoError(t, err)
+
+	n, err := s.PurgeCompleted(now.Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	e, err := s.Get(old.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, e)
+
+	for _, id := range []string{recent.ID, dead.ID} {
+		e, err := s.Get(id)
+		assert.NoError(t, err)
+		assert.NotNil(t, e)
+	}
+}
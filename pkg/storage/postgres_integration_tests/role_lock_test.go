@@ -0,0 +1,74 @@
+// +build postgres
+
+package postgresintegrationtests
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/common-fate/iamzero/pkg/recommendations"
+	"github.com/common-fate/iamzero/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test_WithRoleLockConcurrent makes the same read-modify-write as the detective
+// from many goroutines, and checks that the role has exactly one active finding.
+func Test_WithRoleLockConcurrent(t *testing.T) {
+	db, err := GetDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := storage.BuildPostgresStorage(db)
+	role := "testRole-" + uuid.NewString()
+	const n = 20
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.WithRoleLock(role, func(s *storage.Storage) error {
+				finding, err := s.Finding.FindByRole(storage.FindByRoleQuery{Role: role, Status: recommendations.PolicyStatusActive})
+				if errors.Is(err, sql.ErrNoRows) {
+					f := mockFinding()
+					f.Identity.Role = role
+					f.Status = recommendations.PolicyStatusActive
+					finding, err = &f, nil
+				}
+				if err != nil {
+					return err
+				}
+				// the action references the finding, so the finding must exist first
+				if err := s.Finding.CreateOrUpdate(*finding); err != nil {
+					return err
+				}
+				if err := s.Action.Add(mockAWSAction(finding.ID)); err != nil {
+					return err
+				}
+				actions, err := s.Action.ListForPolicy(finding.ID)
+				if err != nil {
+					return err
+				}
+				finding.EventCount = len(actions)
+				return s.Finding.CreateOrUpdate(*finding)
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	findings, err := s.Finding.ListForStatus(recommendations.PolicyStatusActive)
+	assert.NoError(t, err)
+	matching := []recommendations.Finding{}
+	for _, f := range findings {
+		if f.Identity.Role == role {
+			matching = append(matching, f)
+		}
+	}
+	if assert.Len(t, matching, 1) {
+		assert.Equal(t, n, matching[0].EventCount)
+	}
+}
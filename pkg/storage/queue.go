@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/common-fate/iamzero/pkg/recommendations"
+)
+
+// QueuedEventStatus is the processing status of an event in the event queue
+type QueuedEventStatus string
+
+const (
+	// QueuedEventPending events are waiting to be analysed, either for the first time or to be retried
+	QueuedEventPending QueuedEventStatus = "pending"
+	// QueuedEventProcessing events have been claimed by a worker
+	QueuedEventProcessing QueuedEventStatus = "processing"
+	// QueuedEventDone events have been analysed by the detective
+	QueuedEventDone QueuedEventStatus = "done"
+	// QueuedEventDeadLetter events couldn't be analysed after the maximum number
+	// of attempts. They are kept so that they can be inspected, but aren't retried.
+	QueuedEventDeadLetter QueuedEventStatus = "dead_letter"
+)
+
+// QueuedEventLeaseExpired is the error recorded for an event which is
+// dead-lettered because its lease expired on its final attempt, for example
+// because analysing it stopped the collector.
+const QueuedEventLeaseExpired = "the lease expired before the event was analysed"
+
+// QueuedEvent is an event received by the collector which is waiting to be,
+// or has been, analysed by the detective
+type QueuedEvent struct {
+	ID string `json:"id" db:"id"`
+	// TokenID is the token the event was sent with, so that only the
+	// sender can look up the status of the event
+	TokenID   string                   `json:"tokenId" db:"token_id"`
+	Event     recommendations.AWSEvent `json:"event" db:"-"`
+	Status    QueuedEventStatus        `json:"status" db:"status" storm:"index"`
+	Attempts  int                      `json:"attempts" db:"attempts"`
+	LastError string                   `json:"lastError,omitempty" db:"last_error"`
+	// ActionID is the action created by the detective, once the event has been analysed
+	ActionID  string    `json:"actionId,omitempty" db:"action_id"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+	// AvailableAt is when the event can next be claimed. While an event is
+	// processing it is when the worker's lease expires, so that events held by
+	// a worker which stopped before finishing are picked up again.
+	AvailableAt time.Time `json:"availableAt" db:"available_at"`
+}
+
+// claimable returns true if the event can be claimed by a worker at the given time
+func (e *QueuedEvent) claimable(now time.Time) bool {
+	return (e.Status == QueuedEventPending || e.Status == QueuedEventProcessing) && !e.AvailableAt.After(now)
+}
+
+// leaseExhausted returns true if the event's lease has expired at the given
+// time and it has already been claimed the maximum number of times
+func (e *QueuedEvent) leaseExhausted(now time.Time, maxAttempts int) bool {
+	return e.Status == QueuedEventProcessing && !e.AvailableAt.After(now) && e.Attempts >= maxAttempts
+}
+
+// EventQueueStorage durably queues events between the collector and the detective
+type EventQueueStorage interface {
+	// Enqueue adds a batch of events to the queue. Either every event
+	// in the batch is added or none are.
+	Enqueue(events []QueuedEvent) error
+	// Claim marks up to limit available events as processing until the
+	// lease expires, and returns them, oldest first. Events whose lease has
+	// expired after maxAttempts attempts are dead-lettered rather than
+	// claimed again, so that an event which stops the worker isn't retried forever.
+	Claim(limit int, lease time.Duration, maxAttempts int) ([]QueuedEvent, error)
+	// Complete marks an event as analysed
+	Complete(id string, actionID string) error
+	// Retry returns an event to the queue after a failed attempt.
+	// It won't be claimed again until availableAt.
+	Retry(id string, lastError string, availableAt time.Time) error
+	// DeadLetter marks an event as failed so that it isn't retried
+	DeadLetter(id string, lastError string) error
+	// Get returns the event, or nil if it isn't in the queue
+	Get(id string) (*QueuedEvent, error)
+	ListForStatus(status QueuedEventStatus) ([]QueuedEvent, error)
+	// PurgeCompleted deletes events which were completed before the given
+	// time, and returns the number of events deleted. Dead-lettered events
+	// are kept so that they can be inspected.
+	PurgeCompleted(before time.Time) (int, error)
+}
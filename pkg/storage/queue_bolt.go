@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/pkg/errors"
+)
+
+type BoltEventQueueStorage struct {
+	db *storm.DB
+}
+
+func NewBoltEventQueueStorage(db *storm.DB) *BoltEventQueueStorage {
+	return &BoltEventQueueStorage{db: db}
+}
+
+func (s *BoltEventQueueStorage) Enqueue(events []QueuedEvent) error {
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return errors.Wrap(err, "boltdb enqueue events")
+	}
+	defer tx.Rollback()
+
+	for _, e := range events {
+		e := e
+		if err := tx.Save(&e); err != nil {
+			return errors.Wrap(err, "boltdb enqueue events")
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *BoltEventQueueStorage) Claim(limit int, lease time.Duration, maxAttempts int) ([]QueuedEvent, error) {
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return nil, errors.Wrap(err, "boltdb claim events")
+	}
+	defer tx.Rollback()
+
+	// only pending and processing events can be claimed or dead-lettered
+	var events []QueuedEvent
+	for _, status := range []QueuedEventStatus{QueuedEventPending, QueuedEventProcessing} {
+		matching, err := findForStatus(tx, status)
+		if err != nil {
+			return nil, errors.Wrap(err, "boltdb claim events")
+		}
+		events = append(events, matching...)
+	}
+
+	now := time.Now()
+	changed := false
+	var available []QueuedEvent
+	for _, e := range events {
+		if e.leaseExhausted(now, maxAttempts) {
+			e.Status = QueuedEventDeadLetter
+			e.LastError = QueuedEventLeaseExpired
+			e.UpdatedAt = now
+			if err := tx.Save(&e); err != nil {
+				return nil, errors.Wrap(err, "boltdb claim events")
+			}
+			changed = true
+			continue
+		}
+		if e.claimable(now) {
+			available = append(available, e)
+		}
+	}
+	// don't commit the transaction if there is nothing to claim,
+	// so that polling an idle queue doesn't write to disk
+	if !changed && len(available) == 0 {
+		return []QueuedEvent{}, nil
+	}
+	sort.Slice(available, func(i, j int) bool {
+		return available[i].CreatedAt.Before(available[j].CreatedAt)
+	})
+	if len(available) > limit {
+		available = available[:limit]
+	}
+
+	claimed := []QueuedEvent{}
+	for _, e := range available {
+		e.Status = QueuedEventProcessing
+		e.Attempts++
+		e.AvailableAt = now.Add(lease)
+		e.UpdatedAt = now
+		if err := tx.Save(&e); err != nil {
+			return nil, errors.Wrap(err, "boltdb claim events")
+		}
+		claimed = append(claimed, e)
+	}
+	return claimed, tx.Commit()
+}
+
+// findForStatus returns the events with the status, using the index on Status
+func findForStatus(node storm.Node, status QueuedEventStatus) ([]QueuedEvent, error) {
+	events := []QueuedEvent{}
+	err := node.Find("Status", status, &events)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return events, nil
+}
+
+// update applies fn to the queued event with the given ID in a transaction
+func (s *BoltEventQueueStorage) update(id string, fn func(e *QueuedEvent)) error {
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return errors.Wrap(err, "boltdb update queued event")
+	}
+	defer tx.Rollback()
+
+	var e QueuedEvent
+	if err := tx.One("ID", id, &e); err != nil {
+		return errors.Wrap(err, "boltdb update queued event")
+	}
+	fn(&e)
+	e.UpdatedAt = time.Now()
+	if err := tx.Save(&e); err != nil {
+		return errors.Wrap(err, "boltdb update queued event")
+	}
+	return tx.Commit()
+}
+
+func (s *BoltEventQueueStorage) Complete(id string, actionID string) error {
+	return s.update(id, func(e *QueuedEvent) {
+		e.Status = QueuedEventDone
+		e.ActionID = actionID
+		e.LastError = ""
+	})
+}
+
+func (s *BoltEventQueueStorage) Retry(id string, lastError string, availableAt time.Time) error {
+	return s.update(id, func(e *QueuedEvent) {
+		e.Status = QueuedEventPending
+		e.LastError = lastError
+		e.AvailableAt = availableAt
+	})
+}
+
+func (s *BoltEventQueueStorage) DeadLetter(id string, lastError string) error {
+	return s.update(id, func(e *QueuedEvent) {
+		e.Status = QueuedEventDeadLetter
+		e.LastError = lastError
+	})
+}
+
+func (s *BoltEventQueueStorage) Get(id string) (*QueuedEvent, error) {
+	var e QueuedEvent
+	err := s.db.One("ID", id, &e)
+	if err == storm.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "boltdb get queued event")
+	}
+	return &e, nil
+}
+
+func (s *BoltEventQueueStorage) ListForStatus(status QueuedEventStatus) ([]QueuedEvent, error) {
+	matching, err := findForStatus(s.db, status)
+	if err != nil {
+		return nil, errors.Wrap(err, "boltdb list queued events")
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return matching[i].CreatedAt.Before(matching[j].CreatedAt)
+	})
+	return matching, nil
+}
+
+func (s *BoltEventQueueStorage) PurgeCompleted(before time.Time) (int, error) {
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return 0, errors.Wrap(err, "boltdb purge queued events")
+	}
+	defer tx.Rollback()
+
+	done, err := findForStatus(tx, QueuedEventDone)
+	if err != nil {
+		return 0, errors.Wrap(err, "boltdb purge queued events")
+	}
+	purged := 0
+	for _, e := range done {
+		if !e.UpdatedAt.Before(before) {
+			continue
+		}
+		e := e
+		if err := tx.DeleteStruct(&e); err != nil {
+			return 0, errors.Wrap(err, "boltdb purge queued events")
+		}
+		purged++
+	}
+	if purged == 0 {
+		return 0, nil
+	}
+	return purged, tx.Commit()
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+type InMemoryEventQueueStorage struct {
+	sync.Mutex
+	events map[string]*QueuedEvent
+}
+
+func NewInMemoryEventQueueStorage() *InMemoryEventQueueStorage {
+	return &InMemoryEventQueueStorage{events: map[string]*QueuedEvent{}}
+}
+
+func (s *InMemoryEventQueueStorage) Enqueue(events []QueuedEvent) error {
+	s.Lock()
+	defer s.Unlock()
+	for _, e := range events {
+		if _, ok := s.events[e.ID]; ok {
+			return errors.New("queued event already exists: " + e.ID)
+		}
+	}
+	for _, e := range events {
+		e := e
+		s.events[e.ID] = &e
+	}
+	return nil
+}
+
+func (s *InMemoryEventQueueStorage) Claim(limit int, lease time.Duration, maxAttempts int) ([]QueuedEvent, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	var available []*QueuedEvent
+	for _, e := range s.events {
+		if e.leaseExhausted(now, maxAttempts) {
+			e.Status = QueuedEventDeadLetter
+			e.LastError = QueuedEventLeaseExpired
+			e.UpdatedAt = now
+			continue
+		}
+		if e.claimable(now) {
+			available = append(available, e)
+		}
+	}
+	sort.Slice(available, func(i, j int) bool {
+		return available[i].CreatedAt.Before(available[j].CreatedAt)
+	})
+	if len(available) > limit {
+		available = available[:limit]
+	}
+
+	claimed := []QueuedEvent{}
+	for _, e := range available {
+		e.Status = QueuedEventProcessing
+		e.Attempts++
+		e.AvailableAt = now.Add(lease)
+		e.UpdatedAt = now
+		claimed = append(claimed, *e)
+	}
+	return claimed, nil
+}
+
+// update applies fn to the queued event with the given ID
+func (s *InMemoryEventQueueStorage) update(id string, fn func(e *QueuedEvent)) error {
+	s.Lock()
+	defer s.Unlock()
+	e, ok := s.events[id]
+	if !ok {
+		return errors.New("could not find queued event")
+	}
+	fn(e)
+	e.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *InMemoryEventQueueStorage) Complete(id string, actionID string) error {
+	return s.update(id, func(e *QueuedEvent) {
+		e.Status = QueuedEventDone
+		e.ActionID = actionID
+		e.LastError = ""
+	})
+}
+
+func (s *InMemoryEventQueueStorage) Retry(id string, lastError string, availableAt time.Time) error {
+	return s.update(id, func(e *QueuedEvent) {
+		e.Status = QueuedEventPending
+		e.LastError = lastError
+		e.AvailableAt = availableAt
+	})
+}
+
+func (s *InMemoryEventQueueStorage) DeadLetter(id string, lastError string) error {
+	return s.update(id, func(e *QueuedEvent) {
+		e.Status = QueuedEventDeadLetter
+		e.LastError = lastError
+	})
+}
+
+func (s *InMemoryEventQueueStorage) Get(id string) (*QueuedEvent, error) {
+	s.Lock()
+	defer s.Unlock()
+	e, ok := s.events[id]
+	if !ok {
+		return nil, nil
+	}
+	copy := *e
+	return &copy, nil
+}
+
+func (s *InMemoryEventQueueStorage) PurgeCompleted(before time.Time) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	purged := 0
+	for id, e := range s.events {
+		if e.Status == QueuedEventDone && e.UpdatedAt.Before(before) {
+			delete(s.events, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (s *InMemoryEventQueueStorage) ListForStatus(status QueuedEventStatus) ([]QueuedEvent, error) {
+	s.Lock()
+	defer s.Unlock()
+	events := []QueuedEvent{}
+	for _, e := range s.events {
+		if e.Status == status {
+			events = append(events, *e)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+	return events, nil
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+type PostgresEventQueueStorage struct {
+	db *sqlx.DB
+}
+
+func NewPostgresEventQueueStorage(db *sqlx.DB) *PostgresEventQueueStorage {
+	return &PostgresEventQueueStorage{db: db}
+}
+
+// DBQueuedEvent is a queued event with the event stored as JSON
+type DBQueuedEvent struct {
+	QueuedEvent
+	EventData []byte `db:"event"`
+}
+
+func (e *DBQueuedEvent) toQueuedEvent() (QueuedEvent, error) {
+	err := json.Unmarshal(e.EventData, &e.Event)
+	return e.QueuedEvent, err
+}
+
+const queuedEventColumns = "id, token_id, event, status, attempts, last_error, action_id, created_at, updated_at, available_at"
+
+func (s *PostgresEventQueueStorage) Enqueue(events []QueuedEvent) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "postgres enqueue events")
+	}
+	defer tx.Rollback()
+
+	for _, e := range events {
+		data, err := json.Marshal(e.Event)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = tx.Exec("INSERT INTO event_queue ("+queuedEventColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+			e.ID, e.TokenID, data, e.Status, e.Attempts, e.LastError, e.ActionID, e.CreatedAt, e.UpdatedAt, e.AvailableAt,
+		)
+		if err != nil {
+			return errors.Wrap(err, "postgres enqueue events")
+		}
+	}
+	return tx.Commit()
+}
+
+// Claim uses SKIP LOCKED so that multiple collectors can drain the same queue
+// without claiming the same events.
+func (s *PostgresEventQueueStorage) Claim(limit int, lease time.Duration, maxAttempts int) ([]QueuedEvent, error) {
+	now := time.Now()
+	_, err := s.db.Exec(`UPDATE event_queue SET status = $1, last_error = $2, updated_at = $3
+WHERE status = $4 AND available_at <= $3 AND attempts >= $5`,
+		QueuedEventDeadLetter, QueuedEventLeaseExpired, now, QueuedEventProcessing, maxAttempts,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "postgres claim events, dead-lettering expired leases")
+	}
+
+	rows := []DBQueuedEvent{}
+	err = s.db.Select(&rows, `UPDATE event_queue SET status = $1, attempts = attempts + 1, available_at = $2, updated_at = $3
+WHERE id IN (
+	SELECT id FROM event_queue
+	WHERE (status = $4 OR (status = $5 AND attempts < $7)) AND available_at <= $3
+	ORDER BY created_at
+	LIMIT $6
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING `+queuedEventColumns,
+		QueuedEventProcessing, now.Add(lease), now, QueuedEventPending, QueuedEventProcessing, limit, maxAttempts,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "postgres claim events")
+	}
+
+	claimed := []QueuedEvent{}
+	for _, r := range rows {
+		e, err := r.toQueuedEvent()
+		if err != nil {
+			return nil, errors.Wrap(err, "postgres claim events, unmarshalling event")
+		}
+		claimed = append(claimed, e)
+	}
+	sort.Slice(claimed, func(i, j int) bool {
+		return claimed[i].CreatedAt.Before(claimed[j].CreatedAt)
+	})
+	return claimed, nil
+}
+
+func (s *PostgresEventQueueStorage) Complete(id string, actionID string) error {
+	_, err := s.db.Exec("UPDATE event_queue SET status = $1, action_id = $2, last_error = '', updated_at = $3 WHERE id = $4",
+		QueuedEventDone, actionID, time.Now(), id,
+	)
+	return errors.Wrap(err, "postgres complete queued event")
+}
+
+func (s *PostgresEventQueueStorage) Retry(id string, lastError string, availableAt time.Time) error {
+	_, err := s.db.Exec("UPDATE event_queue SET status = $1, last_error = $2, available_at = $3, updated_at = $4 WHERE id = $5",
+		QueuedEventPending, lastError, availableAt, time.Now(), id,
+	)
+	return errors.Wrap(err, "postgres retry queued event")
+}
+
+func (s *PostgresEventQueueStorage) DeadLetter(id string, lastError string) error {
+	_, err := s.db.Exec("UPDATE event_queue SET status = $1, last_error = $2, updated_at = $3 WHERE id = $4",
+		QueuedEventDeadLetter, lastError, time.Now(), id,
+	)
+	return errors.Wrap(err, "postgres dead letter queued event")
+}
+
+func (s *PostgresEventQueueStorage) Get(id string) (*QueuedEvent, error) {
+	var row DBQueuedEvent
+	err := s.db.Get(&row, "SELECT "+queuedEventColumns+" FROM event_queue WHERE id = $1", id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "postgres get queued event")
+	}
+	e, err := row.toQueuedEvent()
+	if err != nil {
+		return nil, errors.Wrap(err, "postgres get queued event, unmarshalling event")
+	}
+	return &e, nil
+}
+
+func (s *PostgresEventQueueStorage) ListForStatus(status QueuedEventStatus) ([]QueuedEvent, error) {
+	rows := []DBQueuedEvent{}
+	err := s.db.Select(&rows, "SELECT "+queuedEventColumns+" FROM event_queue WHERE status = $1 ORDER BY created_at", status)
+	if err != nil {
+		return nil, errors.Wrap(err, "postgres list queued events")
+	}
+	events := []QueuedEvent{}
+	for _, r := range rows {
+		e, err := r.toQueuedEvent()
+		if err != nil {
+			return nil, errors.Wrap(err, "postgres list queued events, unmarshalling event")
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (s *PostgresEventQueueStorage) PurgeCompleted(before time.Time) (int, error) {
+	res, err := s.db.Exec("DELETE FROM event_queue WHERE status = $1 AND updated_at < $2", QueuedEventDone, before)
+	if err != nil {
+		return 0, errors.Wrap(err, "postgres purge queued events")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "postgres purge queued events")
+	}
+	return int(n), nil
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+// queueBackends returns the event queue storage backends which can be
+// tested without a database server
+func queueBackends(t *testing.T) map[string]EventQueueStorage {
+	db, err := storm.Open(path.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Init(QueuedEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]EventQueueStorage{
+		"bolt":     NewBoltEventQueueStorage(db),
+		"inmemory": NewInMemoryEventQueueStorage(),
+	}
+}
+
+func queuedEvent(id string, status QueuedEventStatus, updatedAt time.Time) QueuedEvent {
+	return QueuedEvent{ID: id, Status: status, CreatedAt: updatedAt, UpdatedAt: updatedAt, AvailableAt: updatedAt}
+}
+
+func TestEventQueueClaim(t *testing.T) {
+	for name, queue := range queueBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			err := queue.Enqueue([]QueuedEvent{
+				queuedEvent("pending", QueuedEventPending, now.Add(-time.Minute)),
+				queuedEvent("later", QueuedEventPending, now.Add(time.Hour)),
+				queuedEvent("done", QueuedEventDone, now.Add(-2*time.Minute)),
+				queuedEvent("dead", QueuedEventDeadLetter, now.Add(-2*time.Minute)),
+			})
+			assert.NoError(t, err)
+
+			claimed, err := queue.Claim(10, time.Minute, 3)
+			assert.NoError(t, err)
+			if assert.Len(t, claimed, 1) {
+				assert.Equal(t, "pending", claimed[0].ID)
+				assert.Equal(t, QueuedEventProcessing, claimed[0].Status)
+				assert.Equal(t, 1, claimed[0].Attempts)
+			}
+
+			// nothing else is available until the lease expires
+			claimed, err = queue.Claim(10, time.Minute, 3)
+			assert.NoError(t, err)
+			assert.Empty(t, claimed)
+
+			processing, err := queue.ListForStatus(QueuedEventProcessing)
+			assert.NoError(t, err)
+			assert.Len(t, processing, 1)
+		})
+	}
+}
+
+func TestEventQueuePurgeCompleted(t *testing.T) {
+	for name, queue := range queueBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			err := queue.Enqueue([]QueuedEvent{
+				queuedEvent("old", QueuedEventDone, now.Add(-2*time.Hour)),
+				queuedEvent("recent", QueuedEventDone, now.Add(-time.Minute)),
+				queuedEvent("dead", QueuedEventDeadLetter, now.Add(-2*time.Hour)),
+				queuedEvent("pending", QueuedEventPending, now.Add(-2*time.Hour)),
+			})
+			assert.NoError(t, err)
+
+			n, err := queue.PurgeCompleted(now.Add(-time.Hour))
+			assert.NoError(t, err)
+			assert.Equal(t, 1, n)
+
+			for id, exists := range map[string]bool{"old": false, "recent": true, "dead": true, "pending": true} {
+				e, err := queue.Get(id)
+				assert.NoError(t, err)
+				assert.Equal(t, exists, e != nil, id)
+			}
+
+			n, err = queue.PurgeCompleted(now.Add(-time.Hour))
+			assert.NoError(t, err)
+			assert.Zero(t, n)
+		})
+	}
+}
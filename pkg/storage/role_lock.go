@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// roleLocker serialises updates to the findings for a role
+type roleLocker interface {
+	withRoleLock(role string, fn func(s *Storage) error) error
+}
+
+// WithRoleLock runs fn while holding an exclusive lock for the role, so that
+// findings for the role can be read, modified and written without racing other
+// events for the same role. fn must use the Storage it is passed: with Postgres
+// and Bolt it is bound to a transaction which is committed if fn returns nil and
+// rolled back otherwise.
+func (s *Storage) WithRoleLock(role string, fn func(s *Storage) error) error {
+	if s.roleLocker == nil {
+		return fn(s)
+	}
+	return s.roleLocker.withRoleLock(role, fn)
+}
+
+// roleLockKey returns the key of the Postgres advisory lock for a role
+func roleLockKey(role string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(role))
+	return int64(h.Sum64())
+}
+
+// keyedMutex holds a mutex for each key. Mutexes are removed once nothing
+// holds or is waiting for them, so that keys don't accumulate.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*refMutex
+}
+
+type refMutex struct {
+	sync.Mutex
+	refs int
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: map[string]*refMutex{}}
+}
+
+// Lock locks the mutex for the key, returning a function to unlock it
+func (m *keyedMutex) Lock(key string) func() {
+	m.mu.Lock()
+	l, ok := m.locks[key]
+	if !ok {
+		l = &refMutex{}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		m.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(m.locks, key)
+		}
+		m.mu.Unlock()
+	}
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"github.com/asdine/storm/v3"
+	"github.com/pkg/errors"
+)
+
+// boltRoleLocker runs fn in a writable Bolt transaction. Bolt only
+// allows a single writable transaction at a time, so this serialises
+// updates for every role rather than only for the one being updated.
+type boltRoleLocker struct {
+	db *storm.DB
+}
+
+func (l *boltRoleLocker) withRoleLock(role string, fn func(s *Storage) error) error {
+	tx, err := l.db.Begin(true)
+	if err != nil {
+		return errors.Wrap(err, "boltdb begin transaction")
+	}
+	defer tx.Rollback()
+
+	// the event queue isn't included, as it starts its own transactions
+	// which would wait for this one to finish
+	s := &Storage{
+		Event:   &BoltEventStorage{db: tx},
+		Finding: &BoltFindingStorage{db: tx},
+		Action:  &BoltActionStorage{db: tx},
+	}
+	if err := fn(s); err != nil {
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "boltdb commit transaction")
+}
@@ -0,0 +1,14 @@
+package storage
+
+// inMemoryRoleLocker holds a mutex for each role. The in-memory
+// storage isn't transactional, so fn's writes aren't rolled back if it fails.
+type inMemoryRoleLocker struct {
+	storage *Storage
+	locks   *keyedMutex
+}
+
+func (l *inMemoryRoleLocker) withRoleLock(role string, fn func(s *Storage) error) error {
+	unlock := l.locks.Lock(role)
+	defer unlock()
+	return fn(l.storage)
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// postgresRoleLocker runs fn in a transaction holding an advisory lock for the role
+type postgresRoleLocker struct {
+	db *sqlx.DB
+}
+
+func (l *postgresRoleLocker) withRoleLock(role string, fn func(s *Storage) error) error {
+	tx, err := l.db.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "postgres begin transaction")
+	}
+	defer tx.Rollback()
+
+	// the lock is released when the transaction is committed or rolled back
+	_, err = tx.Exec("SELECT pg_advisory_xact_lock($1)", roleLockKey(role))
+	if err != nil {
+		return errors.Wrap(err, "postgres lock role")
+	}
+
+	// the event queue isn't part of the transaction, as the queue
+	// records the outcome of fn whether or not it succeeds
+	s := &Storage{
+		Event:      &PostgresEventStorage{db: tx},
+		Finding:    &PostgresFindingStorage{db: tx},
+		Action:     &PostgresActionStorage{db: tx},
+		EventQueue: NewPostgresEventQueueStorage(l.db),
+	}
+	if err := fn(s); err != nil {
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "postgres commit transaction")
+}
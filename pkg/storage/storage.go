@@ -11,31 +11,43 @@ type Storage struct {
 	Event   EventStorage
 	Finding FindingStorage
 	Action  ActionStorage
+	// EventQueue holds events received by the collector until
+	// they are analysed by the detective
+	EventQueue EventQueueStorage
+
+	roleLocker roleLocker
 }
 
 // BuildPostgresStorage builds the storage layer with Postgres as the driver
 func BuildPostgresStorage(db *sqlx.DB) *Storage {
 	return &Storage{
-		Event:   NewPostgresEventStorage(db),
-		Finding: NewPostgresFindingStorage(db),
-		Action:  NewPostgresActionStorage(db),
+		Event:      NewPostgresEventStorage(db),
+		Finding:    NewPostgresFindingStorage(db),
+		Action:     NewPostgresActionStorage(db),
+		EventQueue: NewPostgresEventQueueStorage(db),
+		roleLocker: &postgresRoleLocker{db: db},
 	}
 }
 
 // BuildBoltStorage builds the storage layer with BoltDB as the driver
 func BuildBoltStorage(db *storm.DB) *Storage {
 	return &Storage{
-		Event:   &NoOpEventStorage{}, // currently unused in local workflows, so we pass the no-op.
-		Finding: NewBoltFindingStorage(db),
-		Action:  NewBoltActionStorage(db),
+		Event:      NewBoltEventStorage(db),
+		Finding:    NewBoltFindingStorage(db),
+		Action:     NewBoltActionStorage(db),
+		EventQueue: NewBoltEventQueueStorage(db),
+		roleLocker: &boltRoleLocker{db: db},
 	}
 }
 
 // BuildBoltStorage builds the storage layer using in-memory arrays
 func BuildInMemoryStorage() *Storage {
-	return &Storage{
-		Event:   &NoOpEventStorage{}, // currently unused in local workflows, so we pass the no-op.
-		Finding: NewInMemoryFindingStorage(),
-		Action:  NewInMemoryActionStorage(),
+	s := &Storage{
+		Event:      NewInMemoryEventStorage(),
+		Finding:    NewInMemoryFindingStorage(),
+		Action:     NewInMemoryActionStorage(),
+		EventQueue: NewInMemoryEventQueueStorage(),
 	}
+	s.roleLocker = &inMemoryRoleLocker{storage: s, locks: newKeyedMutex()}
+	return s
 }
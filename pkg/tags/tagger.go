@@ -0,0 +1,91 @@
+package tags
+
+import (
+	"flag"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Tagger adds tags to events based on the AWS account they were made in,
+// and selects the tags which findings are partitioned by.
+//
+// The account tags file is a YAML or JSON map of account IDs to tags:
+//
+//	"123456789012":
+//	  env: prod
+//	"210987654321":
+//	  env: dev
+type Tagger struct {
+	// FindingKeys are the tags which findings are keyed by, in addition to
+	// the role. Events with different values for these tags create separate
+	// findings for the same role.
+	FindingKeys []string
+	// AccountTagsFile is the path to the account tags file
+	AccountTagsFile string
+
+	accounts map[string]Tags
+}
+
+// NewTagger creates a Tagger which keys findings by role alone,
+// and doesn't tag events by account
+func NewTagger() *Tagger {
+	return &Tagger{}
+}
+
+func (t *Tagger) AddFlags(fs *flag.FlagSet) {
+	fs.Func("finding-key-tags", "a comma-separated list of event tags which findings are keyed by in addition to the role (e.g. env,service)", func(s string) error {
+		t.FindingKeys = nil
+		for _, k := range strings.Split(s, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				t.FindingKeys = append(t.FindingKeys, k)
+			}
+		}
+		return nil
+	})
+	fs.StringVar(&t.AccountTagsFile, "account-tags-file", "", "a YAML or JSON file mapping AWS account IDs to tags which are added to events from the account")
+}
+
+// Load reads the account tags file, if one was provided
+func (t *Tagger) Load() error {
+	if t == nil || t.AccountTagsFile == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(t.AccountTagsFile)
+	if err != nil {
+		return errors.Wrap(err, "reading account tags file")
+	}
+	accounts := map[string]Tags{}
+	if err := yaml.Unmarshal(data, &accounts); err != nil {
+		return errors.Wrapf(err, "parsing account tags file %s", t.AccountTagsFile)
+	}
+	t.accounts = accounts
+	return nil
+}
+
+// ForAccount returns the tags for events made in the account.
+// A nil Tagger can be used, in which case no tags are returned.
+func (t *Tagger) ForAccount(account string) Tags {
+	if t == nil {
+		return nil
+	}
+	return t.accounts[account]
+}
+
+// FindingKey returns the tags which identify the finding for an event with
+// the tags. Key tags which the event doesn't have are left out.
+// A nil Tagger can be used, in which case findings aren't keyed by tags.
+func (t *Tagger) FindingKey(eventTags Tags) Tags {
+	key := Tags{}
+	if t == nil {
+		return key
+	}
+	for _, k := range t.FindingKeys {
+		if v, ok := eventTags[k]; ok {
+			key[k] = v
+		}
+	}
+	return key
+}
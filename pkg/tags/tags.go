@@ -0,0 +1,71 @@
+package tags
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Tags are key/value pairs describing where an event came from, such as
+// the environment or service which made the call
+type Tags map[string]string
+
+// Value implements the driver.Valuer interface required to serialize the object to Postgres
+func (t Tags) Value() (driver.Value, error) {
+	if t == nil {
+		t = Tags{}
+	}
+	return json.Marshal(t)
+}
+
+// Scan implements the sql.Scanner interface required to deserialize the object from Postgres.
+// Empty tags are scanned as nil, as nil tags are stored as an empty object.
+func (t *Tags) Scan(val interface{}) error {
+	var err error
+	switch v := val.(type) {
+	case nil:
+	case []byte:
+		err = json.Unmarshal(v, &t)
+	case string:
+		err = json.Unmarshal([]byte(v), &t)
+	default:
+		return fmt.Errorf("Unsupported type: %T", v)
+	}
+	if len(*t) == 0 {
+		*t = nil
+	}
+	return err
+}
+
+// Matches returns true if the tags contain every key and value in the filter.
+// An empty filter matches any tags.
+func (t Tags) Matches(filter Tags) bool {
+	for k, v := range filter {
+		if got, ok := t[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal returns true if the tags contain the same keys and values.
+// Nil and empty tags are equal.
+func (t Tags) Equal(other Tags) bool {
+	return len(t) == len(other) && t.Matches(other)
+}
+
+// WithDefaults returns a copy of the tags, with any keys which
+// aren't set taken from the defaults
+func (t Tags) WithDefaults(defaults Tags) Tags {
+	if len(t) == 0 && len(defaults) == 0 {
+		return t
+	}
+	out := Tags{}
+	for k, v := range defaults {
+		out[k] = v
+	}
+	for k, v := range t {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,77 @@
+package tags
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatches(t *testing.T) {
+	tags := Tags{"env": "prod", "service": "api"}
+
+	assert.True(t, tags.Matches(nil))
+	assert.True(t, tags.Matches(Tags{"env": "prod"}))
+	assert.False(t, tags.Matches(Tags{"env": "dev"}))
+	assert.False(t, tags.Matches(Tags{"team": "payments"}))
+}
+
+func TestEqual(t *testing.T) {
+	assert.True(t, Tags(nil).Equal(Tags{}))
+	assert.True(t, Tags{"env": "prod"}.Equal(Tags{"env": "prod"}))
+	assert.False(t, Tags{"env": "prod"}.Equal(Tags{"env": "prod", "service": "api"}))
+}
+
+func TestWithDefaults(t *testing.T) {
+	defaults := Tags{"env": "dev", "team": "payments"}
+	tags := Tags{"env": "prod"}
+
+	assert.Equal(t, Tags{"env": "prod", "team": "payments"}, tags.WithDefaults(defaults))
+	// the original tags aren't modified
+	assert.Equal(t, Tags{"env": "prod"}, tags)
+}
+
+func TestTagger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.yml")
+	err := ioutil.WriteFile(path, []byte(`"123456789012":
+  env: prod
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tagger := NewTagger()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	tagger.AddFlags(fs)
+	err = fs.Parse([]string{"-finding-key-tags", "env, service", "-account-tags-file", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, tagger.Load())
+
+	assert.Equal(t, []string{"env", "service"}, tagger.FindingKeys)
+	assert.Equal(t, Tags{"env": "prod"}, tagger.ForAccount("123456789012"))
+	assert.Nil(t, tagger.ForAccount("210987654321"))
+	assert.Equal(t, Tags{"env": "prod"}, tagger.FindingKey(Tags{"env": "prod", "team": "payments"}))
+}
+
+func TestTagger_Nil(t *testing.T) {
+	var tagger *Tagger
+	assert.Nil(t, tagger.ForAccount("123456789012"))
+	assert.Equal(t, Tags{}, tagger.FindingKey(Tags{"env": "prod"}))
+}
+
+func TestValueAndScan(t *testing.T) {
+	v, err := Tags(nil).Value()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`{}`), v)
+
+	var scanned Tags
+	assert.NoError(t, scanned.Scan(v))
+	assert.Nil(t, scanned)
+
+	assert.NoError(t, scanned.Scan(`{"env":"prod"}`))
+	assert.Equal(t, Tags{"env": "prod"}, scanned)
+}
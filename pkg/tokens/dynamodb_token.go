@@ -9,6 +9,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/common-fate/iamzero/pkg/crypto"
+	"github.com/common-fate/iamzero/pkg/tags"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
@@ -34,7 +35,7 @@ func NewDynamoDBTokenStorer(ctx context.Context, tableName string, log *zap.Suga
 }
 
 // Create a Token and store it in the database
-func (s *DynamoDBTokenStorer) Create(ctx context.Context, name string) (*Token, error) {
+func (s *DynamoDBTokenStorer) Create(ctx context.Context, name string, tags tags.Tags) (*Token, error) {
 	s.log.With("table", s.tableName).Info("creating token")
 
 	ID, err := crypto.GenerateRandomToken()
@@ -45,6 +46,7 @@ func (s *DynamoDBTokenStorer) Create(ctx context.Context, name string) (*Token,
 	token := Token{
 		ID:   ID,
 		Name: name,
+		Tags: tags,
 	}
 
 	putItem, err := attributevalue.MarshalMap(token)
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/common-fate/iamzero/pkg/crypto"
+	"github.com/common-fate/iamzero/pkg/tags"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
@@ -23,7 +24,7 @@ func NewInMemoryTokenStorer(ctx context.Context, log *zap.SugaredLogger, tracer
 }
 
 // Create a Token and store it in memory
-func (s *InMemoryTokenStorer) Create(ctx context.Context, name string) (*Token, error) {
+func (s *InMemoryTokenStorer) Create(ctx context.Context, name string, tags tags.Tags) (*Token, error) {
 	s.log.Info("creating token")
 
 	ID, err := crypto.GenerateRandomToken()
@@ -34,6 +35,7 @@ func (s *InMemoryTokenStorer) Create(ctx context.Context, name string) (*Token,
 	token := Token{
 		ID:   ID,
 		Name: name,
+		Tags: tags,
 	}
 
 	s.tokens = append(s.tokens, token)
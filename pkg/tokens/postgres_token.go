@@ -5,6 +5,7 @@ import (
 	"database/sql"
 
 	"github.com/common-fate/iamzero/pkg/crypto"
+	"github.com/common-fate/iamzero/pkg/tags"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/trace"
@@ -24,7 +25,7 @@ func NewPostgresDBTokenStorer(ctx context.Context, db *sqlx.DB, log *zap.Sugared
 }
 
 // Create a Token and store it in the database
-func (s *PostgresDBTokenStorer) Create(ctx context.Context, name string) (*Token, error) {
+func (s *PostgresDBTokenStorer) Create(ctx context.Context, name string, tags tags.Tags) (*Token, error) {
 	s.log.Info("creating token")
 
 	ID, err := crypto.GenerateRandomToken()
@@ -35,9 +36,10 @@ func (s *PostgresDBTokenStorer) Create(ctx context.Context, name string) (*Token
 	token := Token{
 		ID:   ID,
 		Name: name,
+		Tags: tags,
 	}
 
-	_, err = s.db.ExecContext(ctx, "INSERT INTO tokens (id, name) VALUES ($1, $2)", token.ID, token.Name)
+	_, err = s.db.ExecContext(ctx, "INSERT INTO tokens (id, name, tags) VALUES ($1, $2, $3)", token.ID, token.Name, token.Tags)
 	if err != nil {
 		return nil, errors.Wrap(err, "inserting item")
 	}
@@ -3,6 +3,7 @@ package tokens
 import (
 	"context"
 
+	"github.com/common-fate/iamzero/pkg/tags"
 	"github.com/pkg/errors"
 )
 
@@ -10,13 +11,15 @@ import (
 type Token struct {
 	ID   string `dynamodbav:"id" json:"id" db:"id"`
 	Name string `dynamodbav:"name" json:"name" db:"name"`
+	// Tags are added to events sent with the token, unless the client sets them
+	Tags tags.Tags `dynamodbav:"tags,omitempty" json:"tags,omitempty" db:"tags"`
 }
 
 var ErrTokenNotFound = errors.New("token not found")
 
 // TokenStorer stores and loads Tokens
 type TokenStorer interface {
-	Create(ctx context.Context, name string) (*Token, error)
+	Create(ctx context.Context, name string, tags tags.Tags) (*Token, error)
 	Delete(ctx context.Context, id string) error
 	Get(ctx context.Context, id string) (*Token, error)
 	List(ctx context.Context) ([]Token, error)
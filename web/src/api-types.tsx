@@ -2,8 +2,12 @@ export interface Event {
   time: string;
   data: AWSData;
   // identity: AWSIdentity;
+  tags?: Tags;
 }
 
+/** Key/value pairs describing where an event came from, such as its environment */
+export type Tags = Record<string, string>;
+
 export interface AWSData {
   service: string;
   region: string;
@@ -21,6 +25,37 @@ export interface AWSIdentity {
   user: string;
   role: string;
   account: string;
+  session?: SessionContext;
+}
+
+/** The session which made a call, if it was made by an assumed role */
+export interface SessionContext {
+  arn?: string;
+  name?: string;
+  sourceIdentity?: string;
+  mfaAuthenticated?: boolean;
+  sourceIp?: string;
+  userAgent?: string;
+}
+
+export type IaCFramework = "cloudformation" | "cdk" | "sam" | "serverless";
+
+/** Where a resource is defined in infrastructure-as-code */
+export interface IaCSource {
+  framework: IaCFramework;
+  stackId: string;
+  stackName: string;
+  logicalId: string;
+  physicalId: string;
+  accountId: string;
+  type: string;
+  /** the CDK construct path, or the SAM resource which generated the resource */
+  templatePath?: string;
+}
+
+/** An identity which IAM Zero has matched to its infrastructure-as-code definition */
+export interface ProcessedAWSIdentity extends AWSIdentity {
+  iacSource?: IaCSource;
 }
 
 export interface Recommendation {
@@ -42,12 +77,17 @@ export interface AWSIAMPolicy {
 }
 
 export interface AWSIAMStatement {
-  Sid: string;
+  Sid?: string;
   Effect: "Allow";
-  Action: string | string[];
-  Resource: string[];
+  Action?: string | string[];
+  NotAction?: string | string[];
+  Resource?: string | string[];
+  NotResource?: string | string[];
+  Condition?: Record<string, Record<string, ConditionValue | ConditionValue[]>>;
 }
 
+export type ConditionValue = string | boolean | number;
+
 export type AlertStatus = "active" | "fixed" | "applying" | "ignored";
 
 /** A resource such as an AWS S3 bucket */
@@ -68,6 +108,8 @@ export interface ActionWithRecommendations {
   hasRecommendations: true;
   enabled: boolean;
   selectedAdvisoryId: string;
+  missingPermission?: MissingPermission;
+  occurrences?: EventOccurrences;
 }
 
 /** An alert that we do not yet handle and haven't generated recommendations for */
@@ -82,13 +124,49 @@ export interface UnhandledAction {
   hasRecommendations: false;
   enabled: boolean;
   selectedAdvisoryId: string;
+  missingPermission?: MissingPermission;
+  occurrences?: EventOccurrences;
 }
 
 export type Action = ActionWithRecommendations | UnhandledAction;
 
+export type DenialReason =
+  | "identityPolicy"
+  | "resourcePolicy"
+  | "serviceControlPolicy"
+  | "permissionsBoundary"
+  | "sessionPolicy"
+  | "unknown";
+
+/** A permission which an action was denied, recorded from an AccessDenied error */
+export interface MissingPermission {
+  action: string;
+  resource?: string;
+  reason: DenialReason;
+  explicitDeny: boolean;
+  message: string;
+}
+
+/** How often an action's event has been seen, and the sessions which made it */
+export interface EventOccurrences {
+  count: number;
+  firstSeen: string;
+  lastSeen: string;
+  sessions: EventSession[];
+}
+
+/** A session which made a call, and how often it made it */
+export interface EventSession {
+  session: SessionContext;
+  count: number;
+  firstSeen: string;
+  lastSeen: string;
+}
+
 export interface Token {
   id: string;
   name: string;
+  tags?: Tags;
 }
 
 /**
@@ -96,11 +174,37 @@ export interface Token {
  */
 export interface Finding {
   id: string;
-  identity: AWSIdentity;
+  identity: ProcessedAWSIdentity;
   updatedAt: Date;
   eventCount: number;
   document: AWSIAMPolicy;
+  /** the event tags which the finding is keyed by, along with its role */
+  tags?: Tags;
   status: PolicyStatus;
 }
 
 export type PolicyStatus = "active" | "resolved";
+
+/**
+ * Permissions granted to a Finding's role which haven't been used
+ */
+export interface OverPrivilegeReport {
+  findingId: string;
+  role: string;
+  windowStart?: Date;
+  windowEnd?: Date;
+  observedActionCount: number;
+  grantedCount: number;
+  unusedCount: number;
+  score: number;
+  unusedByAccessLevel: Record<string, number>;
+  unusedGrants: Grant[];
+}
+
+export interface Grant {
+  action: string;
+  resource: string;
+  excludedResources?: string[];
+  accessLevel: string;
+  policy: string;
+}
@@ -1,5 +1,5 @@
 import useSWR from "swr";
-import { Action, Finding, PolicyStatus, Token } from "./api-types";
+import { Action, Finding, PolicyStatus, Tags, Token } from "./api-types";
 
 /**
  * Adds the x-iamzero-token header to auth requests.
@@ -61,13 +61,21 @@ export const useActions = () => useSWR<Action[]>("/api/v1/actions");
 export const useAction = (actionId: string | null) =>
   useSWR<Action>(actionId ? `/api/v1/actions/${actionId}` : null);
 
-export const usePolicies = (status?: PolicyStatus) =>
-  useSWR<Finding[]>(
-    status ? `/api/v1/findings?status=${status}` : `/api/v1/findings`,
+/**
+ * Lists findings, optionally filtered by their status and tags.
+ */
+export const usePolicies = (status?: PolicyStatus, tags?: Tags) => {
+  const params = new URLSearchParams();
+  if (status) params.set("status", status);
+  Object.entries(tags ?? {}).forEach(([k, v]) => params.set(`tag.${k}`, v));
+  const query = params.toString();
+  return useSWR<Finding[]>(
+    query ? `/api/v1/findings?${query}` : `/api/v1/findings`,
     {
       revalidateOnFocus: true,
     }
   );
+};
 
 export const useFinding = (findingId: string | null) =>
   useSWR<Finding>(findingId ? `/api/v1/findings/${findingId}` : null);
@@ -1,4 +1,4 @@
-import { Flex, Heading, Stack } from "@chakra-ui/layout";
+import { Flex, Heading, HStack, Stack } from "@chakra-ui/layout";
 import { Badge, Box } from "@chakra-ui/react";
 import React from "react";
 import { Finding } from "../api-types";
@@ -28,6 +28,15 @@ export const PolicyBox: React.FC<Props> = ({ policy, onClick }) => {
         <Heading size="sm" textAlign="left">
           {policy.identity.role}
         </Heading>
+        {policy.tags && Object.keys(policy.tags).length > 0 && (
+          <HStack>
+            {Object.entries(policy.tags).map(([key, value]) => (
+              <Badge key={key} colorScheme="purple">
+                {key}: {value}
+              </Badge>
+            ))}
+          </HStack>
+        )}
       </Stack>
       <Flex direction="column" justify="space-between" align="flex-end">
         <RelativeDateText textAlign="right" date={policy.updatedAt} />
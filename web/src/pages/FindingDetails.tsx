@@ -33,6 +33,7 @@ import {
 import produce from "immer";
 import React, { useState } from "react";
 import { Link as RouterLink, useParams } from "react-router-dom";
+import { format } from "timeago.js";
 import { StringParam, useQueryParam } from "use-query-params";
 import {
   editAction,
@@ -41,13 +42,49 @@ import {
   useActionsForPolicy,
   useFinding,
 } from "../api";
-import { Action, PolicyStatus } from "../api-types";
+import {
+  Action,
+  IaCFramework,
+  MissingPermission,
+  PolicyStatus,
+} from "../api-types";
 import { CenteredSpinner } from "../components/CenteredSpinner";
 import { KeyValueBadge } from "../components/KeyValueBadge";
 import { RelativeDateText } from "../components/LastUpdatedText";
 import { getAlertTitle } from "../utils/getAlertTitle";
 import { getEventCountString } from "../utils/getEventCountString";
 import { renderStringOrObject } from "../utils/renderStringOrObject";
+import { statementIncludes } from "../utils/statementIncludes";
+
+const getIaCFrameworkName = (f: IaCFramework) => {
+  switch (f) {
+    case "cdk":
+      return "CDK";
+    case "sam":
+      return "SAM";
+    case "serverless":
+      return "Serverless";
+    default:
+      return "CloudFormation";
+  }
+};
+
+const getMissingPermissionLabel = (m: MissingPermission) => {
+  switch (m.reason) {
+    case "serviceControlPolicy":
+      return "Denied by a service control policy";
+    case "permissionsBoundary":
+      return "Denied by a permissions boundary";
+    case "sessionPolicy":
+      return "Denied by a session policy";
+    case "resourcePolicy":
+      return "Denied by a resource policy";
+    default:
+      return m.explicitDeny
+        ? "Explicitly denied"
+        : `Missing permission: ${m.action}`;
+  }
+};
 
 const FindingDetails: React.FC = () => {
   const { findingId } = useParams<{ findingId: string }>();
@@ -198,6 +235,29 @@ const FindingDetails: React.FC = () => {
             <Stack direction="row" wrap="wrap" spacing={3} px={3}>
               <KeyValueBadge label="Role ARN" value={policy.identity.role} />
               <KeyValueBadge label="Account" value={policy.identity.account} />
+              {Object.entries(policy.tags ?? {}).map(([key, value]) => (
+                <KeyValueBadge key={key} label={key} value={value} />
+              ))}
+              {policy.identity.iacSource && (
+                <>
+                  <KeyValueBadge
+                    label={`${getIaCFrameworkName(
+                      policy.identity.iacSource.framework
+                    )} Stack`}
+                    value={policy.identity.iacSource.stackName}
+                  />
+                  <KeyValueBadge
+                    label="Logical ID"
+                    value={policy.identity.iacSource.logicalId}
+                  />
+                  {policy.identity.iacSource.templatePath && (
+                    <KeyValueBadge
+                      label="Source"
+                      value={policy.identity.iacSource.templatePath}
+                    />
+                  )}
+                </>
+              )}
             </Stack>
             <Text px={3}>
               The actions below have been recorded by IAM Zero for this role.
@@ -305,8 +365,12 @@ const FindingDetails: React.FC = () => {
               const selectedAction = actions.find(
                 (a) => a.id === selectedActionId
               );
-              const statementSids = selectedAction?.recommendations?.flatMap(
-                (s) => s.AWSPolicy?.Statement.map((s) => s.Sid)
+              const recommendedStatements =
+                selectedAction?.recommendations?.flatMap(
+                  (s) => s.AWSPolicy?.Statement ?? []
+                ) ?? [];
+              const highlighted = recommendedStatements.some((s) =>
+                statementIncludes(statement, s)
               );
               return (
                 <Box
@@ -314,14 +378,10 @@ const FindingDetails: React.FC = () => {
                   position="relative"
                   as="span"
                   display="block"
-                  backgroundColor={
-                    statementSids?.includes(statement.Sid)
-                      ? "whiteAlpha.200"
-                      : undefined
-                  }
+                  backgroundColor={highlighted ? "whiteAlpha.200" : undefined}
                   px={5}
                 >
-                  {statementSids?.includes(statement.Sid) && selectedAction && (
+                  {highlighted && selectedAction && (
                     <Text
                       fontFamily="body"
                       position="absolute"
@@ -414,6 +474,25 @@ const ActionDisplay: React.FC<ActionDisplayProps> = ({
             </Flex>
             <Flex w="350px" justify="flex-end">
               <Stack>
+                {action.missingPermission && (
+                  <Tooltip hasArrow label={action.missingPermission.message}>
+                    <Badge colorScheme="red">
+                      {getMissingPermissionLabel(action.missingPermission)}
+                    </Badge>
+                  </Tooltip>
+                )}
+                {action.occurrences && action.occurrences.count > 1 && (
+                  <Tooltip
+                    hasArrow
+                    label={`First seen ${format(
+                      action.occurrences.firstSeen
+                    )}, last seen ${format(action.occurrences.lastSeen)}`}
+                  >
+                    <Badge colorScheme="gray">
+                      {action.occurrences.count} calls
+                    </Badge>
+                  </Tooltip>
+                )}
                 {/* {action.resources.map((resource) => (
                   <Box
                     key={resource.id}
@@ -474,6 +553,39 @@ const ActionDisplay: React.FC<ActionDisplayProps> = ({
                 )}
               </Tbody>
             </Table>
+            {action.occurrences && action.occurrences.sessions.length > 0 && (
+              <Table size="sm">
+                <Thead>
+                  <Tr>
+                    <Th>Session</Th>
+                    <Th>Source Identity</Th>
+                    <Th>Source IP</Th>
+                    <Th>User Agent</Th>
+                    <Th>Calls</Th>
+                    <Th>Last Seen</Th>
+                  </Tr>
+                </Thead>
+                <Tbody>
+                  {action.occurrences.sessions.map((s, i) => (
+                    <Tr key={i}>
+                      <Td>
+                        {s.session.name}
+                        {s.session.mfaAuthenticated && (
+                          <Badge ml={2} colorScheme="green">
+                            MFA
+                          </Badge>
+                        )}
+                      </Td>
+                      <Td>{s.session.sourceIdentity}</Td>
+                      <Td>{s.session.sourceIp}</Td>
+                      <Td>{s.session.userAgent}</Td>
+                      <Td>{s.count}</Td>
+                      <Td>{format(s.lastSeen)}</Td>
+                    </Tr>
+                  ))}
+                </Tbody>
+              </Table>
+            )}
           </Stack>
         )}
       </Stack>
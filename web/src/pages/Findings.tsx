@@ -11,10 +11,19 @@ import {
 import React from "react";
 import { useHistory } from "react-router-dom";
 import { usePolicies } from "../api";
-import { PolicyStatus } from "../api-types";
+import { PolicyStatus, Tags } from "../api-types";
 import { CenteredSpinner } from "../components/CenteredSpinner";
 import { PolicyBox } from "../components/PolicyBox";
 
+/** tagFilterFromSearch reads tag filters such as ?tag.env=prod from the page URL */
+const tagFilterFromSearch = (search: string): Tags => {
+  const tags: Tags = {};
+  new URLSearchParams(search).forEach((value, key) => {
+    if (key.startsWith("tag.")) tags[key.slice("tag.".length)] = value;
+  });
+  return tags;
+};
+
 const Findings: React.FC = () => {
   return (
     <Container maxW="1200px" py={5}>
@@ -41,8 +50,11 @@ interface FindingListProps {
 }
 
 const FindingList: React.FC<FindingListProps> = ({ status }) => {
-  const { data } = usePolicies(status);
   const history = useHistory();
+  const { data } = usePolicies(
+    status,
+    tagFilterFromSearch(history.location.search)
+  );
 
   if (data === undefined) {
     return <CenteredSpinner />;
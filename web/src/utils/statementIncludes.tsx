@@ -0,0 +1,34 @@
+import { AWSIAMStatement } from "../api-types";
+
+const toArray = (v?: string | string[]) =>
+  v === undefined ? [] : Array.isArray(v) ? v : [v];
+
+const escapeRegExp = (s: string) => s.replace(/[.+^${}()|[\]\\]/g, "\\$&");
+
+/** matches a value against an IAM pattern containing "*" and "?" wildcards */
+const matchesPattern = (pattern: string, value: string, flags = "") =>
+  new RegExp(
+    "^" +
+      escapeRegExp(pattern).replace(/\*/g, ".*").replace(/\?/g, ".") +
+      "$",
+    flags
+  ).test(value);
+
+/**
+ * Returns true if a statement in a finding's policy document grants the
+ * actions and resources of a recommended statement.
+ *
+ * The statements of a finding are consolidated by IAM Zero, so a
+ * recommended statement may have been merged with others or collapsed
+ * into a wildcard, and can't be matched by its Sid.
+ */
+export const statementIncludes = (
+  statement: AWSIAMStatement,
+  recommended: AWSIAMStatement
+) =>
+  toArray(recommended.Action).some((action) =>
+    toArray(statement.Action).some((a) => matchesPattern(a, action, "i"))
+  ) &&
+  toArray(recommended.Resource).some((resource) =>
+    toArray(statement.Resource).some((r) => matchesPattern(r, resource))
+  );